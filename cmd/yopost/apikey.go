@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"YoPost/internal/auth"
+	"YoPost/internal/config"
+	"YoPost/internal/db/mysql"
+	"YoPost/internal/mail/delivery"
+
+	"github.com/spf13/cobra"
+)
+
+// withAuth 加载配置并创建基于 MySQL 的认证服务后执行 fn
+func withAuth(fn func(ctx context.Context, svc *auth.Service) error) error {
+	return withDirectory(func(ctx context.Context, cfg *config.Config, dir *mysql.MySQLClient) error {
+		svc, err := auth.NewService(auth.NewMySQLStore(dir), cfg.Auth)
+		if err != nil {
+			return err
+		}
+		return fn(ctx, svc)
+	})
+}
+
+func newAPIKeyCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "apikey",
+		Short: "Manage API keys",
+		Long: "Manage API keys for services calling the REST API.\n\n" +
+			"Keys are sent as \"Authorization: Bearer <key>\" or \"X-API-Key: <key>\". A key never\n" +
+			"has more permissions than the user owning it.",
+	}
+
+	var req auth.KeyRequest
+	var role string
+	var expires time.Duration
+	create := &cobra.Command{
+		Use:   "create <address>",
+		Short: "Create an API key owned by a user",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			req.Subject = delivery.Normalize(args[0])
+			req.Role = auth.Role(role)
+			req.ExpiresIn = int64(expires / time.Second)
+			return withAuth(func(ctx context.Context, svc *auth.Service) error {
+				k, secret, err := svc.CreateKey(ctx, auth.System, req)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("api key %s created for %s (role %s, scopes %s)\n", k.ID, k.Subject, k.Role, strings.Join(k.Scopes, ","))
+				fmt.Printf("key: %s\n", secret)
+				fmt.Fprintln(os.Stderr, "Store the key now, it cannot be shown again.")
+				return nil
+			})
+		},
+	}
+	create.Flags().StringVar(&req.Name, "name", "", "description of the key (required)")
+	create.Flags().StringVar(&role, "role", "", "role of the key (default: the owner's role)")
+	create.Flags().StringSliceVar(&req.Domains, "domain", nil, "domains of a domainadmin key (default: the owner's domains)")
+	create.Flags().StringSliceVar(&req.Scopes, "scope", []string{"*"}, "scopes, e.g. queue, quota:read, *")
+	create.Flags().DurationVar(&expires, "expires", 0, "lifetime of the key, e.g. 720h (default: never expires)")
+	create.MarkFlagRequired("name")
+
+	var user string
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "List API keys",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withAuth(func(ctx context.Context, svc *auth.Service) error {
+				keys, err := svc.ListKeys(ctx, auth.System, delivery.Normalize(user))
+				if err != nil {
+					return err
+				}
+				w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+				fmt.Fprintln(w, "ID\tNAME\tOWNER\tROLE\tSCOPES\tSTATUS\tLAST USED")
+				for _, k := range keys {
+					status := "active"
+					if !k.RevokedAt.IsZero() {
+						status = "revoked"
+					} else if !k.Active(time.Now()) {
+						status = "expired"
+					}
+					used := "never"
+					if !k.LastUsedAt.IsZero() {
+						used = k.LastUsedAt.Format(time.DateTime)
+					}
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+						k.ID, k.Name, k.Subject, k.Role, strings.Join(k.Scopes, ","), status, used)
+				}
+				return w.Flush()
+			})
+		},
+	}
+	list.Flags().StringVar(&user, "user", "", "only list keys owned by this user")
+
+	revoke := &cobra.Command{
+		Use:   "revoke <id>",
+		Short: "Revoke an API key",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withAuth(func(ctx context.Context, svc *auth.Service) error {
+				if err := svc.RevokeKey(ctx, auth.System, args[0]); err != nil {
+					return err
+				}
+				fmt.Printf("api key %s revoked\n", args[0])
+				return nil
+			})
+		},
+	}
+
+	cmd.AddCommand(create, list, revoke)
+	return cmd
+}
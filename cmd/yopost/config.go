@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"YoPost/internal/config"
+
+	"github.com/spf13/cobra"
+)
+
+func newConfigCommand() *cobra.Command {
+	cmd := &cobra.Command{Use: "config", Short: "Inspect the configuration"}
+
+	check := &cobra.Command{
+		Use:   "check",
+		Short: "Validate the configuration file and exit",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load(configPath)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("configuration OK (hostname %s, api %s)\n", cfg.Server.Hostname, cfg.API.Listen)
+			return nil
+		},
+	}
+
+	env := &cobra.Command{
+		Use:   "env",
+		Short: "List configuration keys and their environment variables",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			keys := config.Keys()
+			names := make([]string, 0, len(keys))
+			for k := range keys {
+				names = append(names, k)
+			}
+			sort.Strings(names)
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "KEY\tENVIRONMENT")
+			for _, k := range names {
+				fmt.Fprintf(w, "%s\t%s\n", k, keys[k])
+			}
+			return w.Flush()
+		},
+	}
+
+	cmd.AddCommand(check, env)
+	return cmd
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"YoPost/internal/auth"
+	"YoPost/internal/config"
+	"YoPost/internal/db/mysql"
+	"YoPost/internal/mail/delivery"
+
+	"github.com/spf13/cobra"
+)
+
+// withDirectory 加载配置并连接 MySQL 后执行 fn
+func withDirectory(fn func(ctx context.Context, cfg *config.Config, dir *mysql.MySQLClient) error) error {
+	cfg, _, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	dir, err := openMySQL(cfg)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	ctx := context.Background()
+	if _, err := dir.Migrate(ctx); err != nil {
+		return err
+	}
+	return fn(ctx, cfg, dir)
+}
+
+// validAddress 检查并规范化邮箱地址
+func validAddress(address string) (string, error) {
+	address = delivery.Normalize(address)
+	at := strings.LastIndex(address, "@")
+	if at <= 0 || at == len(address)-1 || strings.ContainsAny(address, " \t<>") {
+		return "", fmt.Errorf("invalid email address %q", address)
+	}
+	return address, nil
+}
+
+// readPassword 未通过 --password 指定时从标准输入读取一行
+func readPassword(password string) (string, error) {
+	if password != "" {
+		return password, nil
+	}
+	fmt.Fprint(os.Stderr, "Password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", errors.New("no password given")
+	}
+	password = strings.TrimRight(line, "\r\n")
+	if len(password) < 8 {
+		return "", errors.New("password must be at least 8 characters")
+	}
+	return password, nil
+}
+
+func newUserCommand() *cobra.Command {
+	cmd := &cobra.Command{Use: "user", Short: "Manage mailbox users"}
+
+	var password string
+	add := &cobra.Command{
+		Use:   "add <address>",
+		Short: "Create a mailbox user",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			address, err := validAddress(args[0])
+			if err != nil {
+				return err
+			}
+			password, err := readPassword(password)
+			if err != nil {
+				return err
+			}
+			return withDirectory(func(ctx context.Context, cfg *config.Config, dir *mysql.MySQLClient) error {
+				if err := dir.AddUser(ctx, address, password); err != nil {
+					return err
+				}
+				fmt.Printf("user %s created\n", address)
+				return nil
+			})
+		},
+	}
+	add.Flags().StringVarP(&password, "password", "p", "", "password (read from stdin if omitted)")
+
+	del := &cobra.Command{
+		Use:     "del <address>",
+		Aliases: []string{"delete"},
+		Short:   "Delete a mailbox user (stored messages are kept)",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			address := delivery.Normalize(args[0])
+			return withDirectory(func(ctx context.Context, cfg *config.Config, dir *mysql.MySQLClient) error {
+				if err := dir.DeleteUser(ctx, address); err != nil {
+					return err
+				}
+				fmt.Printf("user %s deleted\n", address)
+				return nil
+			})
+		},
+	}
+
+	var newPassword string
+	passwd := &cobra.Command{
+		Use:   "passwd <address>",
+		Short: "Change a user's password",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			address := delivery.Normalize(args[0])
+			password, err := readPassword(newPassword)
+			if err != nil {
+				return err
+			}
+			return withDirectory(func(ctx context.Context, cfg *config.Config, dir *mysql.MySQLClient) error {
+				if err := dir.SetPassword(ctx, address, password); err != nil {
+					return err
+				}
+				// 修改密码后已登录的会话需要重新登录
+				if err := dir.DeleteRefreshTokens(ctx, address); err != nil {
+					return err
+				}
+				fmt.Printf("password of %s changed\n", address)
+				return nil
+			})
+		},
+	}
+	passwd.Flags().StringVarP(&newPassword, "password", "p", "", "new password (read from stdin if omitted)")
+
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "List mailbox users",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withDirectory(func(ctx context.Context, cfg *config.Config, dir *mysql.MySQLClient) error {
+				users, err := dir.ListUsers(ctx)
+				if err != nil {
+					return err
+				}
+				w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+				fmt.Fprintln(w, "ADDRESS\tROLE\tCREATED")
+				for _, u := range users {
+					fmt.Fprintf(w, "%s\t%s\t%s\n", u.Username, u.Role, u.CreatedAt)
+				}
+				return w.Flush()
+			})
+		},
+	}
+
+	var domains []string
+	setRole := &cobra.Command{
+		Use:   "role <address> <user|domainadmin|superadmin>",
+		Short: "Set a user's API role",
+		Long: "Set a user's API role.\n\n" +
+			"A domainadmin manages the domains given with --domain (default: the domain of\n" +
+			"the user's own address). Existing sessions of the user are logged out.",
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			address := delivery.Normalize(args[0])
+			role, err := auth.ParseRole(args[1])
+			if err != nil {
+				return err
+			}
+			managed := domains
+			if role != auth.RoleDomainAdmin {
+				managed = nil
+			} else if len(managed) == 0 {
+				managed = []string{address[strings.LastIndex(address, "@")+1:]}
+			}
+			for i, d := range managed {
+				managed[i] = strings.ToLower(strings.TrimSpace(d))
+			}
+			return withDirectory(func(ctx context.Context, cfg *config.Config, dir *mysql.MySQLClient) error {
+				if err := dir.SetUserRole(ctx, address, string(role), managed); err != nil {
+					return err
+				}
+				if err := dir.DeleteRefreshTokens(ctx, address); err != nil {
+					return err
+				}
+				if len(managed) > 0 {
+					fmt.Printf("role of %s set to %s for %s\n", address, role, strings.Join(managed, ", "))
+				} else {
+					fmt.Printf("role of %s set to %s\n", address, role)
+				}
+				return nil
+			})
+		},
+	}
+	setRole.Flags().StringSliceVar(&domains, "domain", nil, "domains managed by a domainadmin")
+
+	cmd.AddCommand(add, del, passwd, list, setRole)
+	return cmd
+}
+
+func newDomainCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "domain",
+		Short: "Manage local domains",
+		Long: "Manage local domains stored in the database.\n\n" +
+			"Domains listed under server.domains in the configuration are always local.\n" +
+			"A running server picks up changes on the next configuration reload (SIGHUP).",
+	}
+
+	add := &cobra.Command{
+		Use:   "add <domain>",
+		Short: "Add a local domain",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			domain := strings.ToLower(strings.TrimSpace(args[0]))
+			if domain == "" || strings.ContainsAny(domain, "@ /") {
+				return fmt.Errorf("invalid domain %q", args[0])
+			}
+			return withDirectory(func(ctx context.Context, cfg *config.Config, dir *mysql.MySQLClient) error {
+				if err := dir.AddDomain(ctx, domain); err != nil {
+					return err
+				}
+				fmt.Printf("domain %s added\n", domain)
+				return nil
+			})
+		},
+	}
+
+	del := &cobra.Command{
+		Use:     "del <domain>",
+		Aliases: []string{"delete"},
+		Short:   "Remove a local domain",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			domain := strings.ToLower(strings.TrimSpace(args[0]))
+			return withDirectory(func(ctx context.Context, cfg *config.Config, dir *mysql.MySQLClient) error {
+				if err := dir.DeleteDomain(ctx, domain); err != nil {
+					return err
+				}
+				fmt.Printf("domain %s removed\n", domain)
+				return nil
+			})
+		},
+	}
+
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "List local domains from the configuration and the database",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withDirectory(func(ctx context.Context, cfg *config.Config, dir *mysql.MySQLClient) error {
+				domains, err := dir.ListDomains(ctx)
+				if err != nil {
+					return err
+				}
+				w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+				fmt.Fprintln(w, "DOMAIN\tSOURCE")
+				for _, d := range cfg.Server.Domains {
+					fmt.Fprintf(w, "%s\tconfig\n", d)
+				}
+				for _, d := range domains {
+					fmt.Fprintf(w, "%s\tdatabase\n", d)
+				}
+				return w.Flush()
+			})
+		},
+	}
+
+	cmd.AddCommand(add, del, list)
+	return cmd
+}
+
+func newAliasCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "alias",
+		Short: "Manage address aliases",
+		Long: "Manage address aliases stored in the database.\n\n" +
+			"Aliases under server.aliases in the configuration take precedence.\n" +
+			"A running server picks up changes on the next configuration reload (SIGHUP).",
+	}
+
+	add := &cobra.Command{
+		Use:   "add <alias> <target>",
+		Short: "Deliver mail for <alias> to the mailbox <target>",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			alias, err := validAddress(args[0])
+			if err != nil {
+				return err
+			}
+			target, err := validAddress(args[1])
+			if err != nil {
+				return err
+			}
+			return withDirectory(func(ctx context.Context, cfg *config.Config, dir *mysql.MySQLClient) error {
+				if err := dir.SetAlias(ctx, alias, target); err != nil {
+					return err
+				}
+				fmt.Printf("alias %s -> %s saved\n", alias, target)
+				return nil
+			})
+		},
+	}
+
+	del := &cobra.Command{
+		Use:     "del <alias>",
+		Aliases: []string{"delete"},
+		Short:   "Remove an alias",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			alias := delivery.Normalize(args[0])
+			return withDirectory(func(ctx context.Context, cfg *config.Config, dir *mysql.MySQLClient) error {
+				if err := dir.DeleteAlias(ctx, alias); err != nil {
+					return err
+				}
+				fmt.Printf("alias %s removed\n", alias)
+				return nil
+			})
+		},
+	}
+
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "List aliases from the configuration and the database",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withDirectory(func(ctx context.Context, cfg *config.Config, dir *mysql.MySQLClient) error {
+				aliases, err := dir.ListAliases(ctx)
+				if err != nil {
+					return err
+				}
+				w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+				fmt.Fprintln(w, "ALIAS\tTARGET\tSOURCE")
+				configured := make([]string, 0, len(cfg.Server.Aliases))
+				for alias := range cfg.Server.Aliases {
+					configured = append(configured, alias)
+				}
+				sort.Strings(configured)
+				for _, alias := range configured {
+					fmt.Fprintf(w, "%s\t%s\tconfig\n", alias, cfg.Server.Aliases[alias])
+				}
+				for _, a := range aliases {
+					fmt.Fprintf(w, "%s\t%s\tdatabase\n", a.Address, a.Target)
+				}
+				return w.Flush()
+			})
+		},
+	}
+
+	cmd.AddCommand(add, del, list)
+	return cmd
+}
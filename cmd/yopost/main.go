@@ -0,0 +1,46 @@
+// Command yopost 是 YoPost 邮件服务器的唯一入口
+//
+// yopost serve 启动服务，其余子命令用于管理用户、域名、别名、API 密钥、出站队列和数据库结构，
+// 以及生成 REST API 的 OpenAPI 文档
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// configPath 全局 --config 参数，为空时按 config.ResolvePath 查找
+var configPath string
+
+func newRootCommand() *cobra.Command {
+	root := &cobra.Command{
+		Use:           "yopost",
+		Short:         "YoPost mail server",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+	root.PersistentFlags().StringVarP(&configPath, "config", "c", "", "path to config file (default $YOPOST_CONFIG or ./yopost.yml)")
+
+	root.AddCommand(
+		newServeCommand(),
+		newUserCommand(),
+		newDomainCommand(),
+		newAliasCommand(),
+		newAPIKeyCommand(),
+		newQueueCommand(),
+		newMigrateCommand(),
+		newConfigCommand(),
+		newOpenAPICommand(),
+		newVersionCommand(),
+	)
+	return root
+}
+
+func main() {
+	if err := newRootCommand().Execute(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
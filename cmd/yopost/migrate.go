@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"YoPost/internal/mail/store"
+	"YoPost/internal/search"
+	"YoPost/internal/server"
+
+	"github.com/spf13/cobra"
+)
+
+func newMigrateCommand() *cobra.Command {
+	var reindex, rotateKeys bool
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Apply database schema migrations and create indexes",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, _, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			ctx := context.Background()
+
+			mysqlClient, err := openMySQL(cfg)
+			if err != nil {
+				return err
+			}
+			defer mysqlClient.Close()
+			applied, err := mysqlClient.Migrate(ctx)
+			for _, m := range applied {
+				fmt.Printf("mysql: applied migration %s\n", m)
+			}
+			if err != nil {
+				return err
+			}
+			version, err := mysqlClient.SchemaVersion(ctx)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("mysql: schema version %d\n", version)
+
+			mongoClient, err := openMongo(cfg)
+			if err != nil {
+				return err
+			}
+			defer mongoClient.Close()
+			storage, err := server.OpenStorage(cfg, mongoClient.GetDB())
+			if err != nil {
+				return err
+			}
+			if err := storage.EnsureIndexes(ctx); err != nil {
+				return err
+			}
+			fmt.Println("mongodb: indexes up to date")
+
+			if rotateKeys {
+				if storage.Encryption == nil {
+					return errors.New("--rotate-keys requires storage.encryption.enabled")
+				}
+				owners, err := storage.Base.Owners(ctx)
+				if err != nil {
+					return err
+				}
+				total := 0
+				for _, owner := range owners {
+					n, err := storage.Encryption.RotateKeys(ctx, owner)
+					total += n
+					if err != nil {
+						return fmt.Errorf("failed to rotate keys of %s: %v", owner, err)
+					}
+				}
+				fmt.Printf("encryption: rewrapped %d messages of %d users\n", total, len(owners))
+			}
+
+			if reindex {
+				// 检索词来自邮件明文，启用加密时需经过解密层读取
+				var src store.Store = storage.Base
+				if storage.Encryption != nil {
+					src = storage.Encryption
+				}
+				n, err := search.Rebuild(ctx, src, storage.Index)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("search: reindexed %d messages\n", n)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&reindex, "reindex", false, "rebuild the full-text search index")
+	cmd.Flags().BoolVar(&rotateKeys, "rotate-keys", false, "rewrap all messages to storage.encryption.active_key and encrypt plaintext ones")
+	return cmd
+}
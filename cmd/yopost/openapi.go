@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"YoPost/internal/api/docs"
+	"YoPost/internal/server"
+
+	"github.com/spf13/cobra"
+)
+
+// specPath 仓库中提交的 OpenAPI 文档
+const specPath = "docs/api/openapi.json"
+
+func newOpenAPICommand() *cobra.Command {
+	var output string
+	var check bool
+	cmd := &cobra.Command{
+		Use:   "openapi",
+		Short: "Generate or check the OpenAPI document of the REST API",
+		Long: "Generate the OpenAPI 3.1 document of /api/v1 from the registered routes and their\n" +
+			"request and response types. The running server serves the same document at\n" +
+			"/api/v1/openapi.json.\n\n" +
+			"With --check the command fails when a route is not fully documented or when the\n" +
+			"file given by --output differs from the generated document.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			r := server.APIRouter()
+			problems := r.CheckDocs()
+			spec, err := docs.Spec(r).Marshal()
+			if err != nil {
+				return err
+			}
+			if !check {
+				if len(problems) > 0 {
+					fmt.Fprintf(os.Stderr, "warning: undocumented routes:\n  %s\n", strings.Join(problems, "\n  "))
+				}
+				if output == "" || output == "-" {
+					_, err := os.Stdout.Write(spec)
+					return err
+				}
+				if err := os.WriteFile(output, spec, 0o644); err != nil {
+					return err
+				}
+				fmt.Printf("wrote %s (%d routes)\n", output, len(r.Routes()))
+				return nil
+			}
+
+			if output == "" || output == "-" {
+				output = specPath
+			}
+			current, err := os.ReadFile(output)
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(current, spec) {
+				problems = append(problems, fmt.Sprintf("%s is out of date, run: yopost openapi -o %s", output, output))
+			}
+			if len(problems) > 0 {
+				return fmt.Errorf("OpenAPI document check failed:\n  %s", strings.Join(problems, "\n  "))
+			}
+			fmt.Printf("%s OK (%d routes)\n", output, len(r.Routes()))
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&output, "output", "o", "", "file to write, - for stdout (default stdout; with --check "+specPath+")")
+	cmd.Flags().BoolVar(&check, "check", false, "fail when routes are undocumented or the file is out of date")
+	return cmd
+}
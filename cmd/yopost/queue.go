@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"YoPost/internal/config"
+	"YoPost/internal/mail/core"
+	"YoPost/internal/mail/queue"
+	"YoPost/internal/ratelimit"
+	"YoPost/internal/server"
+	"YoPost/internal/webhook"
+
+	"github.com/spf13/cobra"
+)
+
+// withQueue 加载配置并连接 MongoDB 出站队列后执行 fn
+func withQueue(fn func(ctx context.Context, cfg *config.Config, q *queue.MongoQueue) error) error {
+	cfg, _, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	mongo, err := openMongo(cfg)
+	if err != nil {
+		return err
+	}
+	defer mongo.Close()
+	return fn(context.Background(), cfg, queue.NewMongoQueue(mongo.GetDB()))
+}
+
+// queueWorker 返回与 serve 相同的投递方式：本地收件人直接投递，其余经中继发送；
+// 投递结果作为 Webhook 事件写入存储，由 serve 进程推送。域名限速只在本进程内计数
+func queueWorker(ctx context.Context, cfg *config.Config, q queue.Queue) (*queue.Worker, func() error, error) {
+	dir, err := openMySQL(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	mongo, err := openMongo(cfg)
+	if err != nil {
+		dir.Close()
+		return nil, nil, err
+	}
+	closeAll := func() error {
+		mongo.Close()
+		return dir.Close()
+	}
+	storage, err := server.OpenStorage(cfg, mongo.GetDB())
+	if err != nil {
+		closeAll()
+		return nil, nil, err
+	}
+	hooks := webhook.NewDispatcher(storage.Webhooks, cfg.Webhooks)
+	local, err := server.NewLocal(ctx, cfg, storage, server.NewMySQLDirectory(dir), hooks)
+	if err != nil {
+		closeAll()
+		return nil, nil, err
+	}
+	worker := &queue.Worker{
+		Queue:  q,
+		Sender: local.QueueSender(queue.RelaySender(core.NewRelay(cfg.Relay))),
+		Notify: server.QueueNotifier(hooks, storage),
+
+		Concurrency: cfg.Limits.Delivery.Concurrency,
+		Throttle:    ratelimit.NewLimiter(cfg.Limits),
+	}
+	return worker, closeAll, nil
+}
+
+func newQueueCommand() *cobra.Command {
+	cmd := &cobra.Command{Use: "queue", Short: "Inspect and manage the outbound queue"}
+
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "List queued messages",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withQueue(func(ctx context.Context, cfg *config.Config, q *queue.MongoQueue) error {
+				items, err := q.List(ctx)
+				if err != nil {
+					return err
+				}
+				w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+				fmt.Fprintln(w, "ID\tFROM\tTO\tSIZE\tATTEMPTS\tNEXT ATTEMPT\tSEND AT\tLAST ERROR")
+				for _, item := range items {
+					sendAt := "-"
+					if !item.SendAt.IsZero() {
+						sendAt = item.SendAt.Local().Format(time.DateTime)
+					}
+					fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%s\t%s\t%s\n",
+						item.ID, item.From, strings.Join(item.To, ","), item.Size, item.Attempts,
+						item.NextAttempt.Local().Format(time.DateTime), sendAt, item.LastError)
+				}
+				if err := w.Flush(); err != nil {
+					return err
+				}
+				fmt.Printf("%d messages in queue\n", len(items))
+				return nil
+			})
+		},
+	}
+
+	flush := &cobra.Command{
+		Use:   "flush",
+		Short: "Attempt delivery of all queued messages now",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withQueue(func(ctx context.Context, cfg *config.Config, q *queue.MongoQueue) error {
+				// 定时发送的邮件可能包含本地收件人，需要本地投递后端
+				worker, closeDir, err := queueWorker(ctx, cfg, q)
+				if err != nil {
+					return err
+				}
+				defer closeDir()
+				n, err := worker.Flush(ctx)
+				if err != nil {
+					return err
+				}
+				remaining, err := q.List(ctx)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("attempted %d messages, %d remain in queue\n", n, len(remaining))
+				return nil
+			})
+		},
+	}
+
+	del := &cobra.Command{
+		Use:     "delete <id>...",
+		Aliases: []string{"del"},
+		Short:   "Remove messages from the queue without delivering them",
+		Args:    cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withQueue(func(ctx context.Context, cfg *config.Config, q *queue.MongoQueue) error {
+				for _, id := range args {
+					if err := q.Delete(ctx, id); err != nil {
+						return fmt.Errorf("message %s: %w", id, err)
+					}
+					fmt.Printf("message %s deleted\n", id)
+				}
+				return nil
+			})
+		},
+	}
+
+	cmd.AddCommand(list, flush, del)
+	return cmd
+}
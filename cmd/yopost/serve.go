@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"YoPost/internal/auth"
+	"YoPost/internal/config"
+	"YoPost/internal/db"
+	"YoPost/internal/db/mongodb"
+	"YoPost/internal/db/mysql"
+	"YoPost/internal/lifecycle"
+	"YoPost/internal/logging"
+	"YoPost/internal/server"
+
+	"github.com/spf13/cobra"
+)
+
+// components serve 可启动的组件
+var components = []string{"api", "smtp", "queue"}
+
+func newServeCommand() *cobra.Command {
+	var only []string
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Start the mail server",
+		Long: "Start the mail server.\n\n" +
+			"By default the API server, the outbound queue worker and every listener enabled\n" +
+			"in the configuration are started. Use --only to start a subset, e.g. --only smtp.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			for _, c := range only {
+				if !contains(components, c) {
+					return fmt.Errorf("unknown component %q (available: %s)", c, strings.Join(components, ", "))
+				}
+			}
+			return serve(only)
+		},
+	}
+	cmd.Flags().StringSliceVar(&only, "only", nil, "components to start: "+strings.Join(components, ", "))
+	return cmd
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func serve(only []string) error {
+	cfg, logFilter, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	enabled := func(c string) bool {
+		if len(only) > 0 {
+			return contains(only, c)
+		}
+		return c != "smtp" || cfg.Listeners.SMTP.Enabled
+	}
+	if !enabled("api") && !enabled("smtp") && !enabled("queue") {
+		return errors.New("no components enabled")
+	}
+
+	// SIGINT/SIGTERM 取消 ctx 开始优雅关闭，关闭期间再次收到信号则立即退出
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	manager := lifecycle.NewManager(time.Duration(cfg.Server.ShutdownTimeout) * time.Second)
+
+	// 存储最先启动、最后关闭
+	var clients *db.Clients
+	var srv *server.Server
+	manager.Add("storage", lifecycle.Hook{
+		OnStart: func(ctx context.Context) error {
+			var err error
+			clients, err = db.Open(db.DBConfig{
+				MySQL:   mysql.MySQLConfig(cfg.Storage.MySQL),
+				MongoDB: mongodb.MongoDBConfig(cfg.Storage.MongoDB),
+			})
+			if err != nil {
+				return err
+			}
+			if applied, err := clients.MySQL.Migrate(ctx); err != nil {
+				return err
+			} else if len(applied) > 0 {
+				log.Printf("INFO: Applied %d MySQL migrations", len(applied))
+			}
+			storage, err := server.OpenStorage(cfg, clients.MongoDB.GetDB())
+			if err != nil {
+				return err
+			}
+			if err := storage.EnsureIndexes(ctx); err != nil {
+				return err
+			}
+
+			srv, err = server.New(server.Options{
+				Config:     cfg,
+				ConfigPath: configPath,
+				Storage:    storage,
+				Directory:  server.NewMySQLDirectory(clients.MySQL),
+				Auth:       auth.NewMySQLStore(clients.MySQL),
+			})
+			if err != nil {
+				return err
+			}
+			// 配置热加载: SIGHUP 或 POST /api/admin/reload
+			srv.Config().Subscribe(config.ReloadFunc(func(c *config.Config) (func(), error) {
+				level, err := logging.ParseLevel(c.Server.LogLevel)
+				return func() { logFilter.SetLevel(level) }, err
+			}))
+			srv.Config().WatchSignals(ctx)
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			return clients.Close()
+		},
+	})
+
+	if enabled("queue") {
+		var cancel context.CancelFunc
+		done := make(chan struct{})
+		manager.Add("outbound queue", lifecycle.Hook{
+			OnStart: func(context.Context) error {
+				var queueCtx context.Context
+				queueCtx, cancel = context.WithCancel(context.Background())
+				go func() {
+					srv.RunQueue(queueCtx)
+					close(done)
+				}()
+				return nil
+			},
+			OnStop: func(ctx context.Context) error {
+				// 等待当前投递结束，未投递的邮件在 Worker 中释放回队列
+				cancel()
+				select {
+				case <-done:
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			},
+		})
+	}
+
+	if enabled("smtp") {
+		manager.Add("smtp listener", lifecycle.Hook{
+			OnStart: func(ctx context.Context) error {
+				l, err := net.Listen("tcp", cfg.Listeners.SMTP.Listen)
+				if err != nil {
+					return err
+				}
+				go func() {
+					if err := srv.ServeSMTP(l); err != nil {
+						manager.Fail("smtp listener", err)
+					}
+				}()
+				return nil
+			},
+			OnStop: func(ctx context.Context) error {
+				return srv.ShutdownSMTP(ctx)
+			},
+		})
+	}
+
+	if enabled("api") {
+		manager.Add("api server", lifecycle.Hook{
+			OnStart: func(ctx context.Context) error {
+				l, err := net.Listen("tcp", cfg.API.Listen)
+				if err != nil {
+					return err
+				}
+				go func() {
+					if err := srv.ServeAPI(l); err != nil {
+						manager.Fail("api server", err)
+					}
+				}()
+				return nil
+			},
+			OnStop: func(ctx context.Context) error {
+				return srv.ShutdownAPI(ctx)
+			},
+		})
+	}
+
+	return manager.Run(ctx)
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"os"
+
+	"YoPost/internal/config"
+	"YoPost/internal/db/mongodb"
+	"YoPost/internal/db/mysql"
+	"YoPost/internal/logging"
+)
+
+// loadConfig 加载 --config 指定的配置并按 server.log_level 设置日志级别
+func loadConfig() (*config.Config, *logging.Filter, error) {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	level, _ := logging.ParseLevel(cfg.Server.LogLevel)
+	return cfg, logging.Install(os.Stderr, level), nil
+}
+
+func openMySQL(cfg *config.Config) (*mysql.MySQLClient, error) {
+	return mysql.NewMySQLClient(mysql.MySQLConfig(cfg.Storage.MySQL))
+}
+
+func openMongo(cfg *config.Config) (*mongodb.MongoDBClient, error) {
+	return mongodb.NewMongoDBClient(mongodb.MongoDBConfig(cfg.Storage.MongoDB))
+}
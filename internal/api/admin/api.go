@@ -0,0 +1,131 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+
+	"YoPost/internal/api/rest"
+	"YoPost/internal/auth"
+	"YoPost/internal/config"
+	"YoPost/internal/mail/dnsbl"
+	"YoPost/internal/ratelimit"
+)
+
+// API exposes server administration endpoints
+type API struct {
+	Config *config.Holder
+	// Limiter may be nil, GET /admin/limits then returns 404
+	Limiter *ratelimit.Limiter
+	// DNSBL may be nil, GET /admin/dnsbl then returns 404
+	DNSBL *dnsbl.Checker
+}
+
+// DNSBLResponse is the result of looking up an IP and domains in the
+// configured DNS lists
+type DNSBLResponse struct {
+	dnsbl.Result
+	// Action is accept, tag or reject
+	Action string `json:"action"`
+}
+
+// ReloadResponse defines the response structure for configuration reloads
+type ReloadResponse struct {
+	Success  bool     `json:"success"`
+	Message  string   `json:"message"`
+	Problems []string `json:"problems,omitempty"`
+}
+
+// Register registers the admin routes on mux
+func (a *API) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/api/admin/reload", a.ReloadHandler)
+}
+
+// ReloadHandler reloads the configuration file; an invalid file is rejected
+// and the current configuration stays active
+func (a *API) ReloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	log.Printf("INFO: Handling configuration reload request")
+	resp := ReloadResponse{Success: true, Message: "Configuration reloaded"}
+	status := http.StatusOK
+	if err := a.Config.Reload(); err != nil {
+		resp = ReloadResponse{Success: false, Message: err.Error()}
+		status = http.StatusUnprocessableEntity
+		var ve *config.ValidationError
+		if errors.As(err, &ve) {
+			resp.Message = "invalid configuration"
+			resp.Problems = ve.Problems
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// Routes registers the versioned admin endpoints on r
+func (a *API) Routes(r *rest.Router) {
+	r.POST("/admin/reload", a.reload).Require(string(auth.RoleSuperAdmin)).
+		Response(http.StatusOK, ReloadResponse{}).
+		Describe("Reload the configuration file")
+	r.GET("/admin/limits", a.limits).Require(string(auth.RoleSuperAdmin)).
+		Response(http.StatusOK, ratelimit.Stats{}).
+		Describe("Get submission rate limit usage and outbound delivery throttling per domain")
+	r.GET("/admin/dnsbl", a.dnsbl).Require(string(auth.RoleSuperAdmin)).
+		Query("ip", "domain").
+		Response(http.StatusOK, DNSBLResponse{}).
+		Describe("Look up an IP address and domains in the configured DNS block and allow lists")
+}
+
+func (a *API) reload(w http.ResponseWriter, r *http.Request) error {
+	log.Printf("INFO: Handling configuration reload request")
+	if err := a.Config.Reload(); err != nil {
+		e := rest.Errorf(http.StatusUnprocessableEntity, rest.CodeUnprocessable, "%v", err)
+		var ve *config.ValidationError
+		if errors.As(err, &ve) {
+			e.Message = "invalid configuration"
+			e.Details = map[string][]string{"problems": ve.Problems}
+		}
+		return e
+	}
+	return rest.JSON(w, http.StatusOK, ReloadResponse{Success: true, Message: "Configuration reloaded"})
+}
+
+// limits handles GET /api/v1/admin/limits; counters start at process start
+func (a *API) limits(w http.ResponseWriter, r *http.Request) error {
+	if a.Limiter == nil {
+		return rest.NotFound("rate limiting is not enabled")
+	}
+	return rest.JSON(w, http.StatusOK, a.Limiter.Stats())
+}
+
+// dnsbl handles GET /api/v1/admin/dnsbl?ip=&domain=, domain may be repeated
+func (a *API) dnsbl(w http.ResponseWriter, r *http.Request) error {
+	if a.DNSBL == nil || !a.DNSBL.Enabled() {
+		return rest.NotFound("DNS list checks are not enabled")
+	}
+	q := r.URL.Query()
+	var ip net.IP
+	if v := q.Get("ip"); v != "" {
+		if ip = net.ParseIP(v); ip == nil {
+			return rest.InvalidParameter("ip", "invalid IP address %q", v)
+		}
+	}
+	if ip == nil && len(q["domain"]) == 0 {
+		return rest.BadRequest("ip or domain is required")
+	}
+
+	resp := DNSBLResponse{Result: dnsbl.Result{Hits: []dnsbl.Hit{}}}
+	if ip != nil {
+		resp.Merge(a.DNSBL.CheckIP(r.Context(), ip))
+	}
+	resp.Merge(a.DNSBL.CheckDomains(r.Context(), q["domain"]...))
+	resp.Action = a.DNSBL.Classify(&resp.Result).String()
+	return rest.JSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,267 @@
+package auth
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"YoPost/internal/api/rest"
+	"YoPost/internal/auth"
+)
+
+// API exposes login, token refresh and API key management
+type API struct {
+	Service *auth.Service
+}
+
+// LoginRequest defines the request structure for logins
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// RefreshRequest defines the request structure for token refresh and logout
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// KeyResponse describes an API key; the secret is never returned after creation
+type KeyResponse struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Subject    string     `json:"subject"`
+	Role       auth.Role  `json:"role"`
+	Domains    []string   `json:"domains,omitempty"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// CreateKeyResponse returns a new API key together with its secret
+type CreateKeyResponse struct {
+	KeyResponse
+	// Key is the full API key, shown only once
+	Key string `json:"key"`
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func keyResponse(k *auth.APIKey) KeyResponse {
+	return KeyResponse{
+		ID:         k.ID,
+		Name:       k.Name,
+		Subject:    k.Subject,
+		Role:       k.Role,
+		Domains:    k.Domains,
+		Scopes:     k.Scopes,
+		CreatedAt:  k.CreatedAt,
+		ExpiresAt:  optionalTime(k.ExpiresAt),
+		LastUsedAt: optionalTime(k.LastUsedAt),
+		RevokedAt:  optionalTime(k.RevokedAt),
+	}
+}
+
+// Routes registers the authentication endpoints on r
+func (a *API) Routes(r *rest.Router) {
+	r.POST("/auth/login", a.login).Require(auth.Public).
+		Request(LoginRequest{}).
+		Response(http.StatusOK, auth.TokenPair{}).
+		Describe("Log in and obtain access and refresh tokens")
+	r.POST("/auth/refresh", a.refresh).Require(auth.Public).
+		Request(RefreshRequest{}).
+		Response(http.StatusOK, auth.TokenPair{}).
+		Describe("Exchange a refresh token for new tokens")
+	r.POST("/auth/logout", a.logout).Require(auth.Public).
+		Request(RefreshRequest{}).
+		Response(http.StatusNoContent, nil).
+		Describe("Revoke a refresh token")
+	r.GET("/auth/oidc/login", a.oidcLogin).Require(auth.Public).
+		Response(http.StatusFound, nil).
+		Describe("Redirect to the OpenID Connect provider")
+	r.GET("/auth/oidc/callback", a.oidcCallback).Require(auth.Public).
+		Query("code", "state", "error", "error_description").
+		Response(http.StatusOK, auth.TokenPair{}).
+		Response(http.StatusFound, nil).
+		Describe("Complete an OpenID Connect login")
+	r.GET("/auth/me", a.me).Response(http.StatusOK, auth.Principal{}).Describe("Describe the authenticated caller")
+	r.GET("/auth/keys", a.listKeys).Paged("subject").Response(http.StatusOK, rest.List[KeyResponse]{}).Describe("List API keys")
+	r.POST("/auth/keys", a.createKey).
+		Request(auth.KeyRequest{}).
+		Response(http.StatusCreated, CreateKeyResponse{}).
+		Describe("Create an API key")
+	r.DELETE("/auth/keys/{id}", a.revokeKey).Response(http.StatusNoContent, nil).Describe("Revoke an API key")
+}
+
+func (a *API) login(w http.ResponseWriter, r *http.Request) error {
+	var req LoginRequest
+	if err := rest.Decode(r, &req); err != nil {
+		return err
+	}
+	if req.Username == "" || req.Password == "" {
+		return rest.BadRequest("username and password are required")
+	}
+	tokens, err := a.Service.Login(r.Context(), req.Username, req.Password)
+	if err != nil {
+		return auth.Error(err)
+	}
+	return rest.JSON(w, http.StatusOK, tokens)
+}
+
+func (a *API) refresh(w http.ResponseWriter, r *http.Request) error {
+	var req RefreshRequest
+	if err := rest.Decode(r, &req); err != nil {
+		return err
+	}
+	tokens, err := a.Service.Refresh(r.Context(), req.RefreshToken)
+	if err != nil {
+		return auth.Error(err)
+	}
+	return rest.JSON(w, http.StatusOK, tokens)
+}
+
+func (a *API) logout(w http.ResponseWriter, r *http.Request) error {
+	var req RefreshRequest
+	if err := rest.Decode(r, &req); err != nil {
+		return err
+	}
+	if err := a.Service.Logout(r.Context(), req.RefreshToken); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// oidcError maps failures talking to the identity provider to 502 responses
+func oidcError(err error) error {
+	if mapped := auth.Error(err); mapped != err {
+		return mapped
+	}
+	log.Printf("ERROR: OIDC login failed - %v", err)
+	return rest.Errorf(http.StatusBadGateway, "oidc_error", "identity provider request failed")
+}
+
+// oidcStateCookie binds a login to the browser that started it; the callback
+// is only accepted when the cookie matches the state returned by the provider
+const oidcStateCookie = "yopost_oidc_state"
+
+// setOIDCState sets or, with an empty state, clears the state cookie. It is
+// scoped to the oidc endpoints and sent on the provider's top-level redirect
+// back to the callback (SameSite=Lax).
+func (a *API) setOIDCState(w http.ResponseWriter, r *http.Request, state string) {
+	c := &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     path.Dir(r.URL.Path),
+		MaxAge:   int(auth.OIDCLoginTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil || strings.HasPrefix(a.Service.OIDCConfig().RedirectURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	}
+	if state == "" {
+		c.MaxAge = -1
+	}
+	http.SetCookie(w, c)
+}
+
+func (a *API) oidcLogin(w http.ResponseWriter, r *http.Request) error {
+	location, state, err := a.Service.StartOIDC(r.Context())
+	if err != nil {
+		return oidcError(err)
+	}
+	a.setOIDCState(w, r, state)
+	http.Redirect(w, r, location, http.StatusFound)
+	return nil
+}
+
+// oidcCallback exchanges the authorization code for local tokens. When
+// post_login_redirect is configured the tokens are passed to the frontend in
+// the URL fragment, otherwise they are returned as JSON.
+func (a *API) oidcCallback(w http.ResponseWriter, r *http.Request) error {
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		return rest.Errorf(http.StatusUnauthorized, rest.CodeUnauthorized, "identity provider returned %s: %s",
+			e, q.Get("error_description"))
+	}
+	if q.Get("code") == "" || q.Get("state") == "" {
+		return rest.BadRequest("code and state are required")
+	}
+	var browserState string
+	if c, err := r.Cookie(oidcStateCookie); err == nil {
+		browserState = c.Value
+	}
+	// the state is single use, clear the cookie whatever the outcome
+	a.setOIDCState(w, r, "")
+	tokens, err := a.Service.FinishOIDC(r.Context(), q.Get("code"), q.Get("state"), browserState)
+	if err != nil {
+		return oidcError(err)
+	}
+
+	redirect := a.Service.OIDCConfig().PostLoginRedirect
+	if redirect == "" {
+		return rest.JSON(w, http.StatusOK, tokens)
+	}
+	fragment := url.Values{
+		"access_token":  {tokens.AccessToken},
+		"token_type":    {tokens.TokenType},
+		"expires_in":    {strconv.FormatInt(tokens.ExpiresIn, 10)},
+		"refresh_token": {tokens.RefreshToken},
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, fmt.Sprintf("%s#%s", redirect, fragment.Encode()), http.StatusFound)
+	return nil
+}
+
+func (a *API) me(w http.ResponseWriter, r *http.Request) error {
+	return rest.JSON(w, http.StatusOK, auth.FromContext(r.Context()))
+}
+
+// listKeys handles GET /api/v1/auth/keys?subject=&limit=&cursor=
+func (a *API) listKeys(w http.ResponseWriter, r *http.Request) error {
+	p, err := rest.ParseList(r, "subject")
+	if err != nil {
+		return err
+	}
+	keys, err := a.Service.ListKeys(r.Context(), auth.FromContext(r.Context()), p.Filters["subject"])
+	if err != nil {
+		return auth.Error(err)
+	}
+	list := make([]KeyResponse, len(keys))
+	for i, k := range keys {
+		list[i] = keyResponse(k)
+	}
+	return rest.JSON(w, http.StatusOK, rest.Paginate(list, p, func(k KeyResponse) string {
+		return k.CreatedAt.UTC().Format("20060102150405") + "|" + k.ID
+	}))
+}
+
+func (a *API) createKey(w http.ResponseWriter, r *http.Request) error {
+	var req auth.KeyRequest
+	if err := rest.Decode(r, &req); err != nil {
+		return err
+	}
+	k, secret, err := a.Service.CreateKey(r.Context(), auth.FromContext(r.Context()), req)
+	if err != nil {
+		return auth.Error(err)
+	}
+	return rest.JSON(w, http.StatusCreated, CreateKeyResponse{KeyResponse: keyResponse(k), Key: secret})
+}
+
+func (a *API) revokeKey(w http.ResponseWriter, r *http.Request) error {
+	if err := a.Service.RevokeKey(r.Context(), auth.FromContext(r.Context()), r.PathValue("id")); err != nil {
+		return auth.Error(err)
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
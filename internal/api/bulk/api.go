@@ -0,0 +1,332 @@
+package bulk
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/mail"
+	"strings"
+
+	mailboxapi "YoPost/internal/api/mailbox"
+	"YoPost/internal/api/rest"
+	"YoPost/internal/auth"
+	"YoPost/internal/bulk"
+	"YoPost/internal/config"
+	"YoPost/internal/mail/compose"
+	"YoPost/internal/mail/delivery"
+	"YoPost/internal/ratelimit"
+	"YoPost/internal/templates"
+)
+
+// API sends a template to many recipients, one queued message each, and
+// reports the progress of each batch
+type API struct {
+	Runner *bulk.Runner
+	// Templates supplies the template, which is copied into the batch
+	Templates templates.Store
+	// Delivery checks that the sender address belongs to the caller
+	Delivery *delivery.Local
+	Config   *config.Holder
+	// Limiter may be nil; otherwise every recipient of a new batch counts as
+	// one message against the owner's and the API key's hourly limits
+	Limiter *ratelimit.Limiter
+}
+
+// BatchRequest creates a batch. Every recipient gets its own message rendered
+// with the batch variables overridden by its own
+type BatchRequest struct {
+	// From defaults to the caller and must be the caller's address or an alias of it
+	From     *mailboxapi.Address `json:"from,omitempty"`
+	Template string              `json:"template"`
+	// Locale is used for recipients without a locale of their own
+	Locale     string                 `json:"locale,omitempty"`
+	Variables  map[string]interface{} `json:"variables,omitempty"`
+	Headers    map[string]string      `json:"headers,omitempty"`
+	Recipients []RecipientInput       `json:"recipients"`
+}
+
+// RecipientInput is a recipient of a batch; the template also sees its
+// address as "email" and its name as "name" unless variables override them
+type RecipientInput struct {
+	Address   string                 `json:"address"`
+	Name      string                 `json:"name,omitempty"`
+	Locale    string                 `json:"locale,omitempty"`
+	Variables map[string]interface{} `json:"variables,omitempty"`
+}
+
+// Routes registers the batch endpoints on r
+func (a *API) Routes(r *rest.Router) {
+	r.GET("/batches", a.list).
+		Paged("owner", "status").
+		Response(http.StatusOK, rest.List[*bulk.Batch]{}).
+		Describe("List bulk send batches, newest first")
+	r.POST("/batches", a.create).
+		Request(BatchRequest{}).
+		Response(http.StatusCreated, bulk.Batch{}).
+		Describe("Send a template to a list of recipients")
+	r.GET("/batches/{id}", a.get).Response(http.StatusOK, bulk.Batch{}).Describe("Get a batch with its progress")
+	r.GET("/batches/{id}/recipients", a.recipients).
+		Paged("status").
+		Response(http.StatusOK, rest.List[*bulk.Recipient]{}).
+		Describe("List the recipients of a batch with their delivery status")
+	r.POST("/batches/{id}/cancel", a.cancel).
+		Response(http.StatusOK, bulk.Batch{}).
+		Describe("Stop sending a batch to recipients not queued yet")
+}
+
+// load reads the batch {id}; batches of other users are reported as missing
+func (a *API) load(r *http.Request) (*bulk.Batch, error) {
+	id := r.PathValue("id")
+	b, err := a.Runner.Store().Get(r.Context(), id)
+	if err == nil && !auth.FromContext(r.Context()).CanAccessAddress(b.Owner) {
+		err = bulk.ErrNotFound
+	}
+	if errors.Is(err, bulk.ErrNotFound) {
+		return nil, rest.NotFound("batch %s not found", id)
+	}
+	return b, err
+}
+
+// batchKey orders batches newest first as ascending cursor keys
+func batchKey(b *bulk.Batch) string {
+	return fmt.Sprintf("%019d|%s", math.MaxInt64-b.CreatedAt.UnixNano(), b.ID)
+}
+
+// list handles GET /api/v1/batches?owner=&status=&limit=&cursor=; owner
+// defaults to the caller
+func (a *API) list(w http.ResponseWriter, r *http.Request) error {
+	p, err := rest.ParseList(r, "owner", "status")
+	if err != nil {
+		return err
+	}
+	caller := auth.FromContext(r.Context())
+	owner := strings.ToLower(caller.Subject)
+	if v, ok := p.Filters["owner"]; ok {
+		owner = strings.ToLower(strings.TrimSpace(v))
+	}
+	if !caller.CanAccessAddress(owner) {
+		return rest.Errorf(http.StatusForbidden, rest.CodeForbidden, "no access to batches of %s", owner)
+	}
+	all, err := a.Runner.Store().List(r.Context(), owner)
+	if err != nil {
+		return err
+	}
+
+	matched := all[:0]
+	for _, b := range all {
+		if v, ok := p.Filters["status"]; ok && string(b.Status) != v {
+			continue
+		}
+		matched = append(matched, b)
+	}
+	page := rest.Paginate(matched, p, batchKey)
+	if page.Data == nil {
+		page.Data = []*bulk.Batch{}
+	}
+	return rest.JSON(w, http.StatusOK, page)
+}
+
+// recipientError reports a recipient that cannot be sent to
+func recipientError(status int, code string, rcpt *bulk.Recipient, format string, args ...interface{}) error {
+	e := rest.Errorf(status, code, "recipient %d (%s): %s", rcpt.Index, rcpt.Address, fmt.Sprintf(format, args...))
+	e.Details = map[string]interface{}{"index": rcpt.Index, "address": rcpt.Address}
+	return e
+}
+
+// decode reads a BatchRequest into a batch of the caller and its recipients
+func (a *API) decode(r *http.Request) (*bulk.Batch, []*bulk.Recipient, error) {
+	var req BatchRequest
+	if err := rest.Decode(r, &req); err != nil {
+		return nil, nil, err
+	}
+	max := a.Config.Get().API.Bulk.MaxRecipients
+	switch {
+	case req.Template == "":
+		return nil, nil, rest.InvalidParameter("template", "template is required")
+	case len(req.Recipients) == 0:
+		return nil, nil, rest.InvalidParameter("recipients", "at least one recipient is required")
+	case len(req.Recipients) > max:
+		return nil, nil, rest.InvalidParameter("recipients", "a batch has at most %d recipients", max)
+	}
+
+	user := strings.ToLower(auth.FromContext(r.Context()).Subject)
+	b := &bulk.Batch{
+		Owner:     user,
+		From:      user,
+		Locale:    req.Locale,
+		Variables: req.Variables,
+		Headers:   req.Headers,
+		Status:    bulk.BatchSending,
+	}
+	if req.From != nil {
+		b.From, b.FromName = strings.TrimSpace(req.From.Address), req.From.Name
+		if !a.Delivery.Owns(user, b.From) {
+			return nil, nil, rest.Errorf(http.StatusForbidden, rest.CodeForbidden, "%s is not an address of %s", b.From, user)
+		}
+	}
+	t, err := a.Templates.Get(r.Context(), req.Template)
+	if errors.Is(err, templates.ErrNotFound) {
+		return nil, nil, rest.InvalidParameter("template", "template %s not found", req.Template)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	b.Template, b.TemplateID, b.TemplateRevision = *t, t.ID, t.Revision
+
+	rcpts := make([]*bulk.Recipient, len(req.Recipients))
+	seen := make(map[string]int, len(req.Recipients))
+	for i, in := range req.Recipients {
+		addr, err := mail.ParseAddress(strings.TrimSpace(in.Address))
+		if err != nil {
+			return nil, nil, rest.InvalidParameter("recipients", "recipient %d: invalid address %q", i, in.Address)
+		}
+		key := strings.ToLower(addr.Address)
+		if j, ok := seen[key]; ok {
+			return nil, nil, rest.InvalidParameter("recipients", "recipient %d: %s is also recipient %d", i, addr.Address, j)
+		}
+		seen[key] = i
+		name := in.Name
+		if name == "" {
+			name = addr.Name
+		}
+		rcpts[i] = &bulk.Recipient{
+			Index:     i,
+			Address:   addr.Address,
+			Name:      name,
+			Locale:    in.Locale,
+			Variables: in.Variables,
+			Status:    bulk.StatusPending,
+		}
+	}
+	return b, rcpts, nil
+}
+
+// check renders and builds the message of every recipient, so that missing
+// variables and invalid headers are reported before anything is sent
+func (a *API) check(b *bulk.Batch, rcpts []*bulk.Recipient) error {
+	maxBytes := a.Config.Get().Listeners.SMTP.MaxMessageBytes
+	render := b.Renderer()
+	for _, rcpt := range rcpts {
+		m, err := render.Message(rcpt)
+		if err != nil {
+			return recipientError(http.StatusUnprocessableEntity, rest.CodeUnprocessable, rcpt, "failed to render template: %v", err)
+		}
+		raw, err := m.Build()
+		if errors.Is(err, compose.ErrInvalid) {
+			return rest.BadRequest("%s", strings.TrimPrefix(err.Error(), compose.ErrInvalid.Error()+": "))
+		}
+		if err != nil {
+			return err
+		}
+		if maxBytes > 0 && int64(len(raw)) > maxBytes {
+			return recipientError(http.StatusRequestEntityTooLarge, rest.CodePayloadTooLarge, rcpt,
+				"message of %d bytes exceeds the limit of %d bytes", len(raw), maxBytes)
+		}
+	}
+	return nil
+}
+
+// limit charges a new batch against the rate limits. Batches larger than the
+// hourly limit itself are rejected with 422, others over the limit with 429
+func (a *API) limit(r *http.Request, b *bulk.Batch, recipients int) error {
+	if a.Limiter == nil {
+		return nil
+	}
+	err := a.Limiter.SubmitBatch(r.Context(), b.Owner, recipients)
+	var le *ratelimit.LimitError
+	if !errors.As(err, &le) {
+		return err
+	}
+	log.Printf("INFO: Rejecting batch of %s for %d recipients - %v", b.Owner, recipients, le)
+	if le.Permanent() {
+		e := rest.Errorf(http.StatusUnprocessableEntity, rest.CodeUnprocessable, "%s", le.Error())
+		e.Details = map[string]interface{}{"limit": le.Limit, "per_hour": le.PerHour, "requested": le.Requested}
+		return e
+	}
+	return rest.RateLimited(le.RetryAfter, "%s", le.Error())
+}
+
+// create handles POST /api/v1/batches. The request is rejected as a whole when
+// any message cannot be rendered; recipients refused at submission, such as
+// unknown local users, are marked failed individually
+func (a *API) create(w http.ResponseWriter, r *http.Request) error {
+	b, rcpts, err := a.decode(r)
+	if err != nil {
+		return err
+	}
+	if err := a.check(b, rcpts); err != nil {
+		return err
+	}
+	if err := a.limit(r, b, len(rcpts)); err != nil {
+		return err
+	}
+	if err := a.Runner.Store().Create(r.Context(), b, rcpts); err != nil {
+		return err
+	}
+	b.Counts.Pending = len(rcpts)
+	a.Runner.Wake()
+	log.Printf("INFO: User %s created batch %s with template %s for %d recipients", b.Owner, b.ID, b.TemplateID, len(rcpts))
+	return rest.JSON(w, http.StatusCreated, b)
+}
+
+func (a *API) get(w http.ResponseWriter, r *http.Request) error {
+	b, err := a.load(r)
+	if err != nil {
+		return err
+	}
+	return rest.JSON(w, http.StatusOK, b)
+}
+
+func recipientKey(rcpt *bulk.Recipient) string {
+	return fmt.Sprintf("%09d", rcpt.Index)
+}
+
+// recipients handles GET /api/v1/batches/{id}/recipients?status=&limit=&cursor=,
+// ordered as in the request
+func (a *API) recipients(w http.ResponseWriter, r *http.Request) error {
+	p, err := rest.ParseList(r, "status")
+	if err != nil {
+		return err
+	}
+	b, err := a.load(r)
+	if err != nil {
+		return err
+	}
+	status := bulk.Status(p.Filters["status"])
+	all, err := a.Runner.Store().Recipients(r.Context(), b.ID, status)
+	if err != nil {
+		return err
+	}
+	page := rest.Paginate(all, p, recipientKey)
+	if page.Data == nil {
+		page.Data = []*bulk.Recipient{}
+	}
+	return rest.JSON(w, http.StatusOK, page)
+}
+
+// cancel handles POST /api/v1/batches/{id}/cancel. Messages already in the
+// outbound queue are still delivered
+func (a *API) cancel(w http.ResponseWriter, r *http.Request) error {
+	b, err := a.load(r)
+	if err != nil {
+		return err
+	}
+	ok, err := a.Runner.Store().Finish(r.Context(), b, bulk.BatchCancelled)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return rest.Conflict("batch %s has already finished", b.ID)
+	}
+	n, err := a.Runner.Store().CancelPending(r.Context(), b.ID)
+	if err != nil {
+		return err
+	}
+	log.Printf("INFO: Cancelled batch %s of %s, %d recipients not sent", b.ID, b.Owner, n)
+	if b, err = a.load(r); err != nil {
+		return err
+	}
+	return rest.JSON(w, http.StatusOK, b)
+}
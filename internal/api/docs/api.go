@@ -0,0 +1,64 @@
+// Package docs serves the OpenAPI document of the /api/v1 routes and a
+// browsable API reference built from it
+package docs
+
+import (
+	_ "embed"
+	"net/http"
+	"sync"
+
+	"YoPost/internal/api/rest"
+	"YoPost/internal/auth"
+)
+
+// Info describes the versioned API in the generated document
+var Info = rest.Info{
+	Title:       "YoPost API",
+	Version:     "v1",
+	Description: "REST API of the YoPost mail server. Conventions are described in docs/api/REST-API-v1.md.",
+}
+
+//go:embed index.html
+var index []byte
+
+// API serves the OpenAPI document of Router; it must be registered after
+// every other route, the document is built on the first request
+type API struct {
+	Router *rest.Router
+
+	once sync.Once
+	spec []byte
+	err  error
+}
+
+// Spec documents every route of r
+func Spec(r *rest.Router) *rest.Document {
+	return r.OpenAPI(Info, auth.Public)
+}
+
+// Routes registers the documentation endpoints on r; both are public
+func (a *API) Routes(r *rest.Router) {
+	r.GET("/openapi.json", a.openapi).Require(auth.Public).
+		Response(http.StatusOK, map[string]interface{}{}).
+		Describe("Get the OpenAPI document of this API")
+	r.GET("/docs", a.docs).Require(auth.Public).
+		Response(http.StatusOK, rest.Raw("text/html")).
+		Describe("Browse the API reference")
+}
+
+func (a *API) openapi(w http.ResponseWriter, r *http.Request) error {
+	a.once.Do(func() { a.spec, a.err = Spec(a.Router).Marshal() })
+	if a.err != nil {
+		return a.err
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_, err := w.Write(a.spec)
+	return err
+}
+
+func (a *API) docs(w http.ResponseWriter, r *http.Request) error {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src 'unsafe-inline'; style-src 'unsafe-inline'")
+	_, err := w.Write(index)
+	return err
+}
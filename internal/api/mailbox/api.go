@@ -0,0 +1,686 @@
+package mailbox
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"mime"
+	"net/http"
+	"net/mail"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"YoPost/internal/api/rest"
+	"YoPost/internal/auth"
+	"YoPost/internal/config"
+	"YoPost/internal/mail/delivery"
+	"YoPost/internal/mail/message"
+	"YoPost/internal/mail/queue"
+	"YoPost/internal/mail/store"
+	"YoPost/internal/templates"
+)
+
+// API exposes a user's mailboxes and messages to the web client
+type API struct {
+	Store store.Store
+	// Delivery submits sent messages; Config supplies the message size limit
+	Delivery *delivery.Local
+	Config   *config.Holder
+	// Queue is the outbound queue holding scheduled messages
+	Queue queue.Queue
+	// Templates renders messages sent with a template
+	Templates templates.Store
+}
+
+// Mailbox describes a folder with its message counts
+type Mailbox struct {
+	Name   string `json:"name"`
+	Total  int    `json:"total"`
+	Unread int    `json:"unread"`
+	Size   int64  `json:"size"`
+}
+
+// Address is a parsed mailbox address
+type Address struct {
+	Name    string `json:"name,omitempty"`
+	Address string `json:"address"`
+}
+
+// Summary describes a message in a message list
+type Summary struct {
+	ID             string    `json:"id"`
+	Mailbox        string    `json:"mailbox"`
+	UID            uint32    `json:"uid"`
+	From           []Address `json:"from"`
+	To             []Address `json:"to"`
+	Subject        string    `json:"subject"`
+	Date           time.Time `json:"date"`
+	ReceivedAt     time.Time `json:"received_at"`
+	Flags          []string  `json:"flags"`
+	Unread         bool      `json:"unread"`
+	Flagged        bool      `json:"flagged"`
+	Size           int64     `json:"size"`
+	HasAttachments bool      `json:"has_attachments"`
+	Preview        string    `json:"preview"`
+}
+
+// AttachmentInfo describes an attachment without its content
+type AttachmentInfo struct {
+	Index       int    `json:"index"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	ContentID   string `json:"content_id,omitempty"`
+	Inline      bool   `json:"inline"`
+	Size        int    `json:"size"`
+}
+
+// Detail is a fully parsed message. HTML is returned as sent and must be
+// sanitized by the client before rendering
+type Detail struct {
+	Summary
+	Cc          []Address           `json:"cc"`
+	ReplyTo     []Address           `json:"reply_to"`
+	MessageID   string              `json:"message_id,omitempty"`
+	InReplyTo   string              `json:"in_reply_to,omitempty"`
+	References  []string            `json:"references,omitempty"`
+	Headers     map[string][]string `json:"headers"`
+	Text        string              `json:"text"`
+	HTML        string              `json:"html"`
+	Attachments []AttachmentInfo    `json:"attachments"`
+}
+
+// FlagsUpdate adds and removes message flags, e.g. {"add": ["\\Seen"]}
+type FlagsUpdate struct {
+	Add    []string `json:"add"`
+	Remove []string `json:"remove"`
+}
+
+// BulkFlagsRequest updates the flags of several messages
+type BulkFlagsRequest struct {
+	IDs []string `json:"ids"`
+	FlagsUpdate
+}
+
+// MoveRequest moves several messages to another mailbox
+type MoveRequest struct {
+	IDs     []string `json:"ids"`
+	Mailbox string   `json:"mailbox"`
+}
+
+// DeleteRequest moves several messages to Trash, or deletes them when
+// permanent is set or they already are in Trash
+type DeleteRequest struct {
+	IDs       []string `json:"ids"`
+	Permanent bool     `json:"permanent"`
+}
+
+// BulkResponse reports how many messages a bulk operation changed
+type BulkResponse struct {
+	Count int `json:"count"`
+}
+
+// maxBulk caps the number of messages in one bulk request
+const maxBulk = 1000
+
+// previewLength is the number of characters in a message preview
+const previewLength = 200
+
+var keywordPattern = regexp.MustCompile(`^\$?[A-Za-z0-9_.-]{1,64}$`)
+
+var systemFlags = map[string]string{
+	`\seen`:     store.FlagSeen,
+	`\answered`: store.FlagAnswered,
+	`\flagged`:  store.FlagFlagged,
+	`\deleted`:  store.FlagDeleted,
+	`\draft`:    store.FlagDraft,
+}
+
+// Routes registers the mailbox and message endpoints on r. Every endpoint
+// takes an optional ?user= naming the mailbox owner, defaulting to the caller
+func (a *API) Routes(r *rest.Router) {
+	r.GET("/mailboxes", a.mailboxes).
+		Query("user").
+		Response(http.StatusOK, rest.List[Mailbox]{}).
+		Describe("List mailboxes with message and unread counts")
+	r.GET("/messages", a.list).
+		Paged("user", "mailbox", "unread", "flagged").
+		Response(http.StatusOK, rest.List[Summary]{}).
+		Describe("List message summaries in a mailbox, newest first")
+	// base64 attachments grow by a third; the built message is checked against
+	// listeners.smtp.max_message_bytes
+	r.POST("/messages/send", a.send).
+		Consumes("application/json", "multipart/form-data").
+		MaxBody(a.Config.Get().Listeners.SMTP.MaxMessageBytes*2).
+		Request(SendRequest{}, SendForm{}).
+		Response(http.StatusAccepted, SendResponse{}).
+		Describe("Send a message as the caller")
+	r.POST("/messages/flags", a.bulkFlags).
+		Query("user").
+		Request(BulkFlagsRequest{}).
+		Response(http.StatusOK, BulkResponse{}).
+		Describe("Add or remove flags on several messages")
+	r.POST("/messages/move", a.move).
+		Query("user").
+		Request(MoveRequest{}).
+		Response(http.StatusOK, BulkResponse{}).
+		Describe("Move several messages to another mailbox")
+	r.POST("/messages/delete", a.bulkDelete).
+		Query("user").
+		Request(DeleteRequest{}).
+		Response(http.StatusOK, BulkResponse{}).
+		Describe("Move several messages to Trash or delete them")
+	r.GET("/messages/{id}", a.get).Query("user").Response(http.StatusOK, Detail{}).Describe("Get a parsed message")
+	r.PATCH("/messages/{id}", a.updateFlags).
+		Query("user").
+		Request(FlagsUpdate{}).
+		Response(http.StatusOK, Summary{}).
+		Describe("Add or remove flags on a message")
+	r.DELETE("/messages/{id}", a.delete).
+		Query("user", "permanent").
+		Response(http.StatusNoContent, nil).
+		Describe("Move a message to Trash or delete it")
+	r.GET("/messages/{id}/raw", a.raw).
+		Query("user").
+		Response(http.StatusOK, rest.Raw("message/rfc822")).
+		Describe("Download a message as .eml")
+	r.GET("/messages/{id}/attachments/{index}", a.attachment).
+		Query("user").
+		Response(http.StatusOK, rest.Raw("application/octet-stream")).
+		Describe("Download an attachment")
+	a.draftRoutes(r)
+	a.scheduledRoutes(r)
+}
+
+// owner returns the mailbox owner from ?user=, defaulting to the caller
+func owner(r *http.Request, user string) (string, error) {
+	caller := auth.FromContext(r.Context())
+	if user == "" {
+		user = caller.Subject
+	}
+	user = strings.ToLower(strings.TrimSpace(user))
+	if !caller.CanAccessAddress(user) {
+		return "", rest.Errorf(http.StatusForbidden, rest.CodeForbidden, "no access to mailbox %s", user)
+	}
+	return user, nil
+}
+
+// storeError maps message store errors to API errors
+func storeError(err error, id string) error {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		return rest.NotFound("message %s not found", id)
+	case errors.Is(err, store.ErrConflict):
+		return rest.Conflict("message %s was modified concurrently, reload it and retry", id)
+	}
+	return err
+}
+
+// validMailbox checks a mailbox name supplied by the client
+func validMailbox(name string) error {
+	if name == "" {
+		return rest.InvalidParameter("mailbox", "mailbox is required")
+	}
+	if len(name) > 200 || strings.ContainsFunc(name, unicode.IsControl) {
+		return rest.InvalidParameter("mailbox", "invalid mailbox name %q", name)
+	}
+	return nil
+}
+
+// normalizeFlags validates flags and canonicalizes system flags
+func normalizeFlags(flags []string) ([]string, error) {
+	out := make([]string, 0, len(flags))
+	for _, f := range flags {
+		if sys, ok := systemFlags[strings.ToLower(f)]; ok {
+			out = append(out, sys)
+			continue
+		}
+		if !keywordPattern.MatchString(f) {
+			return nil, rest.InvalidParameter("flags", "invalid flag %q", f)
+		}
+		out = append(out, f)
+	}
+	return out, nil
+}
+
+// apply returns flags with u applied, keeping their order
+func (u FlagsUpdate) apply(flags []string) []string {
+	out := make([]string, 0, len(flags)+len(u.Add))
+	for _, f := range flags {
+		removed := false
+		for _, rm := range u.Remove {
+			removed = removed || strings.EqualFold(f, rm)
+		}
+		if !removed {
+			out = append(out, f)
+		}
+	}
+	for _, add := range u.Add {
+		exists := false
+		for _, f := range out {
+			exists = exists || strings.EqualFold(f, add)
+		}
+		if !exists {
+			out = append(out, add)
+		}
+	}
+	return out
+}
+
+func (u *FlagsUpdate) normalize() error {
+	var err error
+	if u.Add, err = normalizeFlags(u.Add); err != nil {
+		return err
+	}
+	if u.Remove, err = normalizeFlags(u.Remove); err != nil {
+		return err
+	}
+	if len(u.Add) == 0 && len(u.Remove) == 0 {
+		return rest.BadRequest("add or remove is required")
+	}
+	return nil
+}
+
+func addresses(list []*mail.Address) []Address {
+	out := make([]Address, 0, len(list))
+	for _, a := range list {
+		out = append(out, Address{Name: a.Name, Address: a.Address})
+	}
+	return out
+}
+
+// preview returns the first previewLength characters of the body with
+// whitespace collapsed
+func preview(p *message.Parsed) string {
+	text := strings.Join(strings.Fields(p.PlainText()), " ")
+	if r := []rune(text); len(r) > previewLength {
+		return string(r[:previewLength])
+	}
+	return text
+}
+
+func summary(msg *store.Message, p *message.Parsed) Summary {
+	s := Summary{
+		ID:         msg.ID,
+		Mailbox:    msg.Mailbox,
+		UID:        msg.UID,
+		ReceivedAt: msg.InternalDate,
+		Flags:      msg.Flags,
+		Unread:     !msg.HasFlag(store.FlagSeen),
+		Flagged:    msg.HasFlag(store.FlagFlagged),
+		Size:       msg.Size,
+		From:       []Address{},
+		To:         []Address{},
+	}
+	if s.Flags == nil {
+		s.Flags = []string{}
+	}
+	if p == nil {
+		return s
+	}
+	s.From, s.To = addresses(p.From), addresses(p.To)
+	s.Subject, s.Date = p.Subject, p.Date
+	if s.Date.IsZero() {
+		s.Date = msg.InternalDate
+	}
+	for _, att := range p.Attachments {
+		s.HasAttachments = s.HasAttachments || !att.Inline
+	}
+	s.Preview = preview(p)
+	return s
+}
+
+// parse parses a stored message, logging messages that are not valid RFC 5322
+func parse(msg *store.Message) *message.Parsed {
+	p, err := message.Parse(msg.Raw)
+	if err != nil {
+		log.Printf("WARNING: Failed to parse message %s - %v", msg.ID, err)
+		return nil
+	}
+	return p
+}
+
+// mailboxes handles GET /api/v1/mailboxes?user=
+func (a *API) mailboxes(w http.ResponseWriter, r *http.Request) error {
+	user, err := owner(r, r.URL.Query().Get("user"))
+	if err != nil {
+		return err
+	}
+	names, err := a.Store.Mailboxes(r.Context(), user)
+	if err != nil {
+		return err
+	}
+	seen := make(map[string]bool)
+	var all []string
+	for _, name := range append(append([]string(nil), store.DefaultMailboxes...), names...) {
+		if !seen[name] {
+			seen[name] = true
+			all = append(all, name)
+		}
+	}
+
+	result := rest.List[Mailbox]{Data: []Mailbox{}}
+	for _, name := range all {
+		msgs, err := a.Store.List(r.Context(), user, name)
+		if err != nil {
+			return storeError(err, "")
+		}
+		mb := Mailbox{Name: name, Total: len(msgs)}
+		for _, msg := range msgs {
+			mb.Size += msg.Size
+			if !msg.HasFlag(store.FlagSeen) {
+				mb.Unread++
+			}
+		}
+		result.Data = append(result.Data, mb)
+	}
+	return rest.JSON(w, http.StatusOK, result)
+}
+
+// messageKey orders messages newest (highest UID) first as ascending cursor keys
+func messageKey(msg *store.Message) string {
+	return fmt.Sprintf("%010d|%s", math.MaxUint32-int64(msg.UID), msg.ID)
+}
+
+func boolFilter(p rest.ListParams, name string) (value, set bool, err error) {
+	v, ok := p.Filters[name]
+	if !ok {
+		return false, false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, false, rest.InvalidParameter(name, "%s must be true or false", name)
+	}
+	return b, true, nil
+}
+
+// list handles GET /api/v1/messages?user=&mailbox=&unread=&flagged=&limit=&cursor=;
+// mailbox defaults to INBOX
+func (a *API) list(w http.ResponseWriter, r *http.Request) error {
+	p, err := rest.ParseList(r, "user", "mailbox", "unread", "flagged")
+	if err != nil {
+		return err
+	}
+	user, err := owner(r, p.Filters["user"])
+	if err != nil {
+		return err
+	}
+	mailbox := p.Filters["mailbox"]
+	if mailbox == "" {
+		mailbox = store.Inbox
+	}
+	unread, filterUnread, err := boolFilter(p, "unread")
+	if err != nil {
+		return err
+	}
+	flagged, filterFlagged, err := boolFilter(p, "flagged")
+	if err != nil {
+		return err
+	}
+
+	msgs, err := a.Store.List(r.Context(), user, mailbox)
+	if err != nil {
+		return storeError(err, "")
+	}
+	matched := msgs[:0]
+	for _, msg := range msgs {
+		if filterUnread && msg.HasFlag(store.FlagSeen) == unread {
+			continue
+		}
+		if filterFlagged && msg.HasFlag(store.FlagFlagged) != flagged {
+			continue
+		}
+		matched = append(matched, msg)
+	}
+	sort.Slice(matched, func(i, j int) bool { return messageKey(matched[i]) < messageKey(matched[j]) })
+	page := rest.Paginate(matched, p, messageKey)
+
+	// only the messages on the page are parsed
+	result := rest.List[Summary]{Data: []Summary{}, NextCursor: page.NextCursor}
+	for _, msg := range page.Data {
+		result.Data = append(result.Data, summary(msg, parse(msg)))
+	}
+	return rest.JSON(w, http.StatusOK, result)
+}
+
+// load reads the message named by the {id} path parameter
+func (a *API) load(r *http.Request) (*store.Message, error) {
+	user, err := owner(r, r.URL.Query().Get("user"))
+	if err != nil {
+		return nil, err
+	}
+	id := r.PathValue("id")
+	msg, err := a.Store.Get(r.Context(), user, id)
+	if err != nil {
+		return nil, storeError(err, id)
+	}
+	return msg, nil
+}
+
+func (a *API) get(w http.ResponseWriter, r *http.Request) error {
+	msg, err := a.load(r)
+	if err != nil {
+		return err
+	}
+	p := parse(msg)
+	d := Detail{
+		Summary:     summary(msg, p),
+		Cc:          []Address{},
+		ReplyTo:     []Address{},
+		Headers:     map[string][]string{},
+		Attachments: []AttachmentInfo{},
+	}
+	if p == nil {
+		return rest.JSON(w, http.StatusOK, d)
+	}
+	d.Cc = addresses(p.Cc)
+	d.ReplyTo = addresses(message.ParseAddressList(p.Header.Get("Reply-To")))
+	d.MessageID = p.MessageID
+	d.InReplyTo = strings.TrimSpace(p.Header.Get("In-Reply-To"))
+	d.References = strings.Fields(p.Header.Get("References"))
+	for k, values := range p.Header {
+		for _, v := range values {
+			d.Headers[k] = append(d.Headers[k], message.DecodeHeader(v))
+		}
+	}
+	d.Text, d.HTML = p.Text, p.HTML
+	for i, att := range p.Attachments {
+		d.Attachments = append(d.Attachments, AttachmentInfo{
+			Index:       i,
+			Filename:    att.Filename,
+			ContentType: att.ContentType,
+			ContentID:   att.ContentID,
+			Inline:      att.Inline,
+			Size:        att.Size,
+		})
+	}
+	return rest.JSON(w, http.StatusOK, d)
+}
+
+func (a *API) raw(w http.ResponseWriter, r *http.Request) error {
+	msg, err := a.load(r)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "message/rfc822")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": msg.ID + ".eml"}))
+	w.Header().Set("Content-Length", strconv.Itoa(len(msg.Raw)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(msg.Raw)
+	return nil
+}
+
+func (a *API) attachment(w http.ResponseWriter, r *http.Request) error {
+	msg, err := a.load(r)
+	if err != nil {
+		return err
+	}
+	index, err := strconv.Atoi(r.PathValue("index"))
+	p := parse(msg)
+	if err != nil || p == nil || index < 0 || index >= len(p.Attachments) {
+		return rest.NotFound("attachment %s of message %s not found", r.PathValue("index"), msg.ID)
+	}
+	att := p.Attachments[index]
+	filename := att.Filename
+	if filename == "" {
+		filename = fmt.Sprintf("attachment-%d", index)
+	}
+	// always served as a download so HTML attachments are never rendered in the API origin
+	w.Header().Set("Content-Type", att.ContentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	w.Header().Set("Content-Length", strconv.Itoa(len(att.Data)))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	w.Write(att.Data)
+	return nil
+}
+
+func (a *API) updateFlags(w http.ResponseWriter, r *http.Request) error {
+	var req FlagsUpdate
+	if err := rest.Decode(r, &req); err != nil {
+		return err
+	}
+	if err := req.normalize(); err != nil {
+		return err
+	}
+	msg, err := a.load(r)
+	if err != nil {
+		return err
+	}
+	msg.Flags = req.apply(msg.Flags)
+	if err := a.Store.Update(r.Context(), msg); err != nil {
+		return storeError(err, msg.ID)
+	}
+	return rest.JSON(w, http.StatusOK, summary(msg, parse(msg)))
+}
+
+// trash moves a message to Trash, or deletes it when permanent is set or it
+// already is in Trash
+func (a *API) trash(r *http.Request, msg *store.Message, permanent bool) error {
+	if permanent || msg.Mailbox == store.Trash {
+		return a.Store.Delete(r.Context(), msg.Owner, msg.ID)
+	}
+	return a.Store.Move(r.Context(), msg.Owner, msg.ID, store.Trash)
+}
+
+func (a *API) delete(w http.ResponseWriter, r *http.Request) error {
+	permanent := false
+	if v := r.URL.Query().Get("permanent"); v != "" {
+		var err error
+		if permanent, err = strconv.ParseBool(v); err != nil {
+			return rest.InvalidParameter("permanent", "permanent must be true or false")
+		}
+	}
+	msg, err := a.load(r)
+	if err != nil {
+		return err
+	}
+	if err := a.trash(r, msg, permanent); err != nil {
+		return storeError(err, msg.ID)
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// loadAll reads every message of a bulk request before anything is changed,
+// so an unknown id fails the whole request
+func (a *API) loadAll(r *http.Request, ids []string) ([]*store.Message, error) {
+	if len(ids) == 0 {
+		return nil, rest.InvalidParameter("ids", "ids is required")
+	}
+	if len(ids) > maxBulk {
+		return nil, rest.InvalidParameter("ids", "at most %d ids per request", maxBulk)
+	}
+	user, err := owner(r, r.URL.Query().Get("user"))
+	if err != nil {
+		return nil, err
+	}
+
+	var msgs []*store.Message
+	var missing []string
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		msg, err := a.Store.Get(r.Context(), user, id)
+		if errors.Is(err, store.ErrNotFound) {
+			missing = append(missing, id)
+			continue
+		}
+		if err != nil {
+			return nil, storeError(err, id)
+		}
+		msgs = append(msgs, msg)
+	}
+	if len(missing) > 0 {
+		e := rest.NotFound("%d of the messages were not found", len(missing))
+		e.Details = map[string]interface{}{"ids": missing}
+		return nil, e
+	}
+	return msgs, nil
+}
+
+func (a *API) bulkFlags(w http.ResponseWriter, r *http.Request) error {
+	var req BulkFlagsRequest
+	if err := rest.Decode(r, &req); err != nil {
+		return err
+	}
+	if err := req.normalize(); err != nil {
+		return err
+	}
+	msgs, err := a.loadAll(r, req.IDs)
+	if err != nil {
+		return err
+	}
+	for _, msg := range msgs {
+		msg.Flags = req.apply(msg.Flags)
+		if err := a.Store.Update(r.Context(), msg); err != nil {
+			return storeError(err, msg.ID)
+		}
+	}
+	return rest.JSON(w, http.StatusOK, BulkResponse{Count: len(msgs)})
+}
+
+func (a *API) move(w http.ResponseWriter, r *http.Request) error {
+	var req MoveRequest
+	if err := rest.Decode(r, &req); err != nil {
+		return err
+	}
+	if err := validMailbox(req.Mailbox); err != nil {
+		return err
+	}
+	msgs, err := a.loadAll(r, req.IDs)
+	if err != nil {
+		return err
+	}
+	for _, msg := range msgs {
+		if err := a.Store.Move(r.Context(), msg.Owner, msg.ID, req.Mailbox); err != nil {
+			return storeError(err, msg.ID)
+		}
+	}
+	log.Printf("INFO: Moved %d messages of %s to %s", len(msgs), msgs[0].Owner, req.Mailbox)
+	return rest.JSON(w, http.StatusOK, BulkResponse{Count: len(msgs)})
+}
+
+func (a *API) bulkDelete(w http.ResponseWriter, r *http.Request) error {
+	var req DeleteRequest
+	if err := rest.Decode(r, &req); err != nil {
+		return err
+	}
+	msgs, err := a.loadAll(r, req.IDs)
+	if err != nil {
+		return err
+	}
+	for _, msg := range msgs {
+		if err := a.trash(r, msg, req.Permanent); err != nil {
+			return storeError(err, msg.ID)
+		}
+	}
+	return rest.JSON(w, http.StatusOK, BulkResponse{Count: len(msgs)})
+}
@@ -0,0 +1,218 @@
+package mailbox
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"YoPost/internal/api/rest"
+	"YoPost/internal/auth"
+	"YoPost/internal/config"
+	"YoPost/internal/mail/delivery"
+	"YoPost/internal/mail/queue"
+	"YoPost/internal/mail/store"
+	"YoPost/internal/templates"
+)
+
+var (
+	alice = &auth.Principal{Subject: "alice@example.com", Role: auth.RoleUser}
+	bob   = &auth.Principal{Subject: "bob@example.com", Role: auth.RoleUser}
+)
+
+// testAPI is the mailbox API on in-memory stores with example.com as the local
+// domain, where every user except nobody@example.com exists
+type testAPI struct {
+	*API
+	router *rest.Router
+}
+
+func newTestAPI(t *testing.T, configure func(cfg *config.Config)) *testAPI {
+	t.Helper()
+	cfg := config.Default()
+	if configure != nil {
+		configure(cfg)
+	}
+	st := store.NewMemoryStore()
+	q := queue.NewMemoryQueue()
+	local := delivery.NewLocal(st, nil, delivery.DirectoryFunc(func(ctx context.Context, address string) (bool, error) {
+		return address != "nobody@example.com", nil
+	}))
+	local.SetRouting([]string{"example.com"}, map[string]string{"hello@example.com": "alice@example.com"})
+	local.SetOutbound(q)
+
+	a := &testAPI{
+		API:    &API{Store: st, Delivery: local, Config: config.NewHolder("", cfg), Queue: q, Templates: templates.NewMemoryStore()},
+		router: rest.NewRouter("/api/v1", cfg.API.MaxBodyBytes),
+	}
+	a.Routes(a.router)
+	return a
+}
+
+// do sends a request as p; header holds extra header fields as name, value pairs
+func (a *testAPI) do(t *testing.T, p *auth.Principal, method, path, body string, header ...string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, "/api/v1"+path, strings.NewReader(body))
+	if body == "" {
+		req.Body, req.ContentLength = http.NoBody, 0
+	} else {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	a.router.ServeHTTP(w, req.WithContext(auth.NewContext(req.Context(), p)))
+	return w
+}
+
+// decode parses a JSON response with the wanted status into v
+func decode(t *testing.T, w *httptest.ResponseRecorder, status int, v interface{}) {
+	t.Helper()
+	if w.Code != status {
+		t.Fatalf("status = %d, want %d (body %s)", w.Code, status, w.Body)
+	}
+	if v != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+			t.Fatalf("response %s - %v", w.Body, err)
+		}
+	}
+}
+
+// appendMessage stores a plain text message and returns its id
+func (a *testAPI) appendMessage(t *testing.T, owner, mailbox, subject string) string {
+	t.Helper()
+	msg := &store.Message{Owner: owner, Mailbox: mailbox, Raw: []byte("From: carol@remote.example\r\nTo: " + owner +
+		"\r\nSubject: " + subject + "\r\nMessage-ID: <" + subject + "@remote.example>\r\n\r\nbody of " + subject + "\r\n")}
+	if err := a.Store.Append(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	return msg.ID
+}
+
+func TestOwnerAccess(t *testing.T) {
+	a := newTestAPI(t, nil)
+	id := a.appendMessage(t, "bob@example.com", store.Inbox, "hello")
+	domainAdmin := &auth.Principal{Subject: "ops@example.com", Role: auth.RoleDomainAdmin, Domains: []string{"example.com"}}
+	otherAdmin := &auth.Principal{Subject: "ops@other.example", Role: auth.RoleDomainAdmin, Domains: []string{"other.example"}}
+	superAdmin := &auth.Principal{Subject: "root@other.example", Role: auth.RoleSuperAdmin}
+
+	tests := []struct {
+		name   string
+		caller *auth.Principal
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"owner", bob, http.MethodGet, "/messages/" + id, "", http.StatusOK},
+		{"owner by ?user=", bob, http.MethodGet, "/messages/" + id + "?user=BOB@example.com", "", http.StatusOK},
+		{"other user's message", alice, http.MethodGet, "/messages/" + id, "", http.StatusNotFound},
+		{"other user's mailbox", alice, http.MethodGet, "/messages?user=bob@example.com", "", http.StatusForbidden},
+		{"other user's raw message", alice, http.MethodGet, "/messages/" + id + "/raw?user=bob@example.com", "", http.StatusForbidden},
+		{"other user's flags", alice, http.MethodPatch, "/messages/" + id + "?user=bob@example.com", `{"add":["\\Seen"]}`, http.StatusForbidden},
+		{"other user's bulk delete", alice, http.MethodPost, "/messages/delete?user=bob@example.com", `{"ids":["` + id + `"]}`, http.StatusForbidden},
+		{"other user's message by id", alice, http.MethodPost, "/messages/move", `{"ids":["` + id + `"],"mailbox":"Archive"}`, http.StatusNotFound},
+		{"domain admin", domainAdmin, http.MethodGet, "/messages/" + id + "?user=bob@example.com", "", http.StatusOK},
+		{"admin of another domain", otherAdmin, http.MethodGet, "/mailboxes?user=bob@example.com", "", http.StatusForbidden},
+		{"super admin", superAdmin, http.MethodGet, "/mailboxes?user=bob@example.com", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := a.do(t, tt.caller, tt.method, tt.path, tt.body)
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d (body %s)", w.Code, tt.status, w.Body)
+			}
+		})
+	}
+
+	msg, err := a.Store.Get(context.Background(), "bob@example.com", id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Mailbox != store.Inbox || len(msg.Flags) != 0 {
+		t.Errorf("message of bob in %s with flags %v, want unchanged in INBOX", msg.Mailbox, msg.Flags)
+	}
+}
+
+func TestBulkUnknownID(t *testing.T) {
+	a := newTestAPI(t, nil)
+	id := a.appendMessage(t, "alice@example.com", store.Inbox, "hello")
+	other := a.appendMessage(t, "bob@example.com", store.Inbox, "other")
+
+	var e struct {
+		Error struct {
+			Code    string `json:"code"`
+			Details struct {
+				IDs []string `json:"ids"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	decode(t, a.do(t, alice, http.MethodPost, "/messages/move", `{"ids":["`+id+`","`+other+`"],"mailbox":"Archive"}`), http.StatusNotFound, &e)
+	if e.Error.Code != rest.CodeNotFound || strings.Join(e.Error.Details.IDs, ",") != other {
+		t.Errorf("error = %+v, want not_found for %s", e.Error, other)
+	}
+	msg, err := a.Store.Get(context.Background(), "alice@example.com", id)
+	if err != nil || msg.Mailbox != store.Inbox {
+		t.Errorf("message moved to %s, %v, want INBOX after a rejected bulk move", msg.Mailbox, err)
+	}
+}
+
+// racingStore changes every message between Get and the caller's Update,
+// like another client updating it concurrently
+type racingStore struct {
+	store.Store
+}
+
+func (s *racingStore) Get(ctx context.Context, owner, id string) (*store.Message, error) {
+	msg, err := s.Store.Get(ctx, owner, id)
+	if err != nil {
+		return nil, err
+	}
+	other, err := s.Store.Get(ctx, owner, id)
+	if err != nil {
+		return nil, err
+	}
+	other.Flags = append(other.Flags, "$Concurrent")
+	return msg, s.Store.Update(ctx, other)
+}
+
+func TestRevisionConflict(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+	}{
+		{"flags", http.MethodPatch, "/messages/%s", `{"add":["\\Flagged"]}`},
+		{"bulk flags", http.MethodPost, "/messages/flags", `{"ids":["%s"],"add":["\\Flagged"]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestAPI(t, nil)
+			id := a.appendMessage(t, "alice@example.com", store.Inbox, "hello")
+			base := a.Store
+			a.Store = &racingStore{Store: base}
+
+			var e struct {
+				Error struct {
+					Code string `json:"code"`
+				} `json:"error"`
+			}
+			decode(t, a.do(t, alice, tt.method, strings.Replace(tt.path, "%s", id, 1), strings.Replace(tt.body, "%s", id, 1)), http.StatusConflict, &e)
+			if e.Error.Code != rest.CodeConflict {
+				t.Errorf("error code = %q, want %q", e.Error.Code, rest.CodeConflict)
+			}
+			msg, err := base.Get(ctx, "alice@example.com", id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if msg.HasFlag(store.FlagFlagged) || !msg.HasFlag("$Concurrent") {
+				t.Errorf("flags = %v, want only the concurrent change", msg.Flags)
+			}
+		})
+	}
+}
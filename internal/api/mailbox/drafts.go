@@ -0,0 +1,491 @@
+package mailbox
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"YoPost/internal/api/rest"
+	"YoPost/internal/auth"
+	"YoPost/internal/mail/compose"
+	"YoPost/internal/mail/message"
+	"YoPost/internal/mail/queue"
+	"YoPost/internal/mail/store"
+)
+
+// Draft is an unsent message stored in the caller's Drafts mailbox, so IMAP
+// clients see it too
+type Draft struct {
+	ID string `json:"id"`
+	// Revision changes on every update and is also returned as the ETag
+	Revision    int64             `json:"revision"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+	MessageID   string            `json:"message_id"`
+	From        Address           `json:"from"`
+	To          []Address         `json:"to"`
+	Cc          []Address         `json:"cc"`
+	Bcc         []Address         `json:"bcc"`
+	ReplyTo     []Address         `json:"reply_to"`
+	Subject     string            `json:"subject"`
+	Text        string            `json:"text"`
+	HTML        string            `json:"html"`
+	Headers     map[string]string `json:"headers"`
+	InReplyTo   string            `json:"in_reply_to,omitempty"`
+	References  []string          `json:"references,omitempty"`
+	Attachments []AttachmentInfo  `json:"attachments"`
+}
+
+// DraftRequest creates a draft or replaces its content. Attachments are added
+// and removed through their own endpoints and kept when the draft is updated
+type DraftRequest struct {
+	From        *Address          `json:"from,omitempty"`
+	To          []Address         `json:"to"`
+	Cc          []Address         `json:"cc,omitempty"`
+	Bcc         []Address         `json:"bcc,omitempty"`
+	ReplyTo     []Address         `json:"reply_to,omitempty"`
+	Subject     string            `json:"subject"`
+	Text        string            `json:"text,omitempty"`
+	HTML        string            `json:"html,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	InReplyTo   string            `json:"in_reply_to,omitempty"`
+	References  []string          `json:"references,omitempty"`
+	InReplyToID string            `json:"in_reply_to_id,omitempty"`
+	// Revision is the revision being replaced; an If-Match header may be sent instead
+	Revision *int64 `json:"revision,omitempty"`
+}
+
+// AttachmentsRequest adds attachments to a draft. Multipart requests send
+// them as file parts named "attachments" instead
+type AttachmentsRequest struct {
+	Attachments []AttachmentInput `json:"attachments"`
+}
+
+// AttachmentsForm documents the multipart/form-data variant of AttachmentsRequest
+type AttachmentsForm struct {
+	Attachments []rest.File `json:"attachments"`
+}
+
+func (d *DraftRequest) sendRequest() *SendRequest {
+	return &SendRequest{
+		From:        d.From,
+		To:          d.To,
+		Cc:          d.Cc,
+		Bcc:         d.Bcc,
+		ReplyTo:     d.ReplyTo,
+		Subject:     d.Subject,
+		Text:        d.Text,
+		HTML:        d.HTML,
+		Headers:     d.Headers,
+		InReplyTo:   d.InReplyTo,
+		References:  d.References,
+		InReplyToID: d.InReplyToID,
+	}
+}
+
+// draftRoutes registers the draft endpoints; drafts always belong to the caller
+func (a *API) draftRoutes(r *rest.Router) {
+	max := a.Config.Get().Listeners.SMTP.MaxMessageBytes
+	r.POST("/drafts", a.createDraft).MaxBody(max*2).
+		Request(DraftRequest{}).
+		Response(http.StatusCreated, Draft{}).
+		Describe("Create a draft in the Drafts mailbox")
+	r.GET("/drafts/{id}", a.getDraft).Response(http.StatusOK, Draft{}).Describe("Get a draft with its editable fields")
+	r.PUT("/drafts/{id}", a.updateDraft).MaxBody(max*2).
+		Request(DraftRequest{}).
+		Response(http.StatusOK, Draft{}).
+		Describe("Replace the content of a draft, keeping its attachments")
+	r.DELETE("/drafts/{id}", a.deleteDraft).Response(http.StatusNoContent, nil).Describe("Delete a draft")
+	r.POST("/drafts/{id}/attachments", a.addDraftAttachments).
+		Consumes("application/json", "multipart/form-data").
+		MaxBody(max*2).
+		Request(AttachmentsRequest{}, AttachmentsForm{}).
+		Response(http.StatusOK, Draft{}).
+		Describe("Add attachments to a draft")
+	r.DELETE("/drafts/{id}/attachments/{index}", a.deleteDraftAttachment).
+		Response(http.StatusOK, Draft{}).
+		Describe("Remove an attachment from a draft")
+	r.POST("/drafts/{id}/send", a.sendDraft).
+		Request(DraftSendRequest{}).
+		Response(http.StatusAccepted, SendResponse{}).
+		Describe("Send a draft and move it to the Sent mailbox")
+}
+
+func caller(r *http.Request) string {
+	return strings.ToLower(auth.FromContext(r.Context()).Subject)
+}
+
+// ifMatch returns the revision of an If-Match: "<revision>" header
+func ifMatch(r *http.Request) (int64, bool, error) {
+	v := strings.TrimSpace(r.Header.Get("If-Match"))
+	if v == "" {
+		return 0, false, nil
+	}
+	rev, err := strconv.ParseInt(strings.Trim(strings.TrimPrefix(v, "W/"), `"`), 10, 64)
+	if err != nil {
+		return 0, false, rest.BadRequest("If-Match must be a draft revision")
+	}
+	return rev, true, nil
+}
+
+// checkRevision fails with 409 when the draft no longer has the revision
+// the client edited
+func checkRevision(msg *store.Message, rev int64) error {
+	if msg.Revision == rev {
+		return nil
+	}
+	e := rest.Conflict("draft %s is at revision %d, not %d", msg.ID, msg.Revision, rev)
+	e.Details = map[string]interface{}{"revision": msg.Revision}
+	return e
+}
+
+// loadDraft reads the caller's draft named by {id}, checking If-Match when sent
+func (a *API) loadDraft(r *http.Request) (*store.Message, error) {
+	id := r.PathValue("id")
+	msg, err := a.Store.Get(r.Context(), caller(r), id)
+	if errors.Is(err, store.ErrNotFound) || err == nil && msg.Mailbox != store.Drafts {
+		return nil, rest.NotFound("draft %s not found", id)
+	}
+	if err != nil {
+		return nil, storeError(err, id)
+	}
+	if rev, ok, err := ifMatch(r); err != nil {
+		return nil, err
+	} else if ok {
+		if err := checkRevision(msg, rev); err != nil {
+			return nil, err
+		}
+	}
+	return msg, nil
+}
+
+// parseDraft turns a stored draft back into the message it was built from
+func parseDraft(msg *store.Message) (*compose.Message, error) {
+	p, err := message.Parse(msg.Raw)
+	if err != nil {
+		return nil, err
+	}
+	m := &compose.Message{
+		To:         p.To,
+		Cc:         p.Cc,
+		Bcc:        message.ParseAddressList(p.Header.Get("Bcc")),
+		ReplyTo:    message.ParseAddressList(p.Header.Get("Reply-To")),
+		Subject:    p.Subject,
+		Text:       strings.ReplaceAll(p.Text, "\r\n", "\n"),
+		HTML:       strings.ReplaceAll(p.HTML, "\r\n", "\n"),
+		InReplyTo:  strings.TrimSpace(p.Header.Get("In-Reply-To")),
+		References: strings.Fields(p.Header.Get("References")),
+		Headers:    map[string]string{},
+		Date:       p.Date,
+		MessageID:  p.MessageID,
+		Draft:      true,
+	}
+	if len(p.From) > 0 {
+		m.From = p.From[0]
+	}
+	for name, values := range p.Header {
+		if !compose.Reserved(name) && len(values) > 0 {
+			m.Headers[name] = message.DecodeHeader(values[0])
+		}
+	}
+	for _, att := range p.Attachments {
+		m.Attachments = append(m.Attachments, compose.Attachment{
+			Filename:    att.Filename,
+			ContentType: att.ContentType,
+			ContentID:   att.ContentID,
+			Inline:      att.Inline,
+			Data:        att.Data,
+		})
+	}
+	return m, nil
+}
+
+func draftView(msg *store.Message, m *compose.Message) Draft {
+	d := Draft{
+		ID:          msg.ID,
+		Revision:    msg.Revision,
+		UpdatedAt:   m.Date,
+		MessageID:   m.MessageID,
+		To:          addresses(m.To),
+		Cc:          addresses(m.Cc),
+		Bcc:         addresses(m.Bcc),
+		ReplyTo:     addresses(m.ReplyTo),
+		Subject:     m.Subject,
+		Text:        m.Text,
+		HTML:        m.HTML,
+		Headers:     m.Headers,
+		InReplyTo:   m.InReplyTo,
+		References:  m.References,
+		Attachments: []AttachmentInfo{},
+	}
+	if m.From != nil {
+		d.From = Address{Name: m.From.Name, Address: m.From.Address}
+	}
+	if d.Headers == nil {
+		d.Headers = map[string]string{}
+	}
+	for i, att := range m.Attachments {
+		d.Attachments = append(d.Attachments, AttachmentInfo{
+			Index:       i,
+			Filename:    att.Filename,
+			ContentType: att.ContentType,
+			ContentID:   att.ContentID,
+			Inline:      att.Inline,
+			Size:        len(att.Data),
+		})
+	}
+	return d
+}
+
+// writeDraft responds with the draft as stored, so inferred content types
+// and normalized line endings are what the client sees
+func writeDraft(w http.ResponseWriter, status int, msg *store.Message) error {
+	m, err := parseDraft(msg)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("ETag", strconv.Quote(strconv.FormatInt(msg.Revision, 10)))
+	return rest.JSON(w, status, draftView(msg, m))
+}
+
+// build builds m and checks it against listeners.smtp.max_message_bytes
+func (a *API) build(m *compose.Message) ([]byte, error) {
+	raw, err := m.Build()
+	if errors.Is(err, compose.ErrInvalid) {
+		return nil, rest.BadRequest("%s", strings.TrimPrefix(err.Error(), compose.ErrInvalid.Error()+": "))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if max := a.Config.Get().Listeners.SMTP.MaxMessageBytes; max > 0 && int64(len(raw)) > max {
+		return nil, rest.Errorf(http.StatusRequestEntityTooLarge, rest.CodePayloadTooLarge, "message of %d bytes exceeds the limit of %d bytes", len(raw), max)
+	}
+	return raw, nil
+}
+
+// saveDraft rebuilds a draft with a new date and stores it in place. The
+// store rejects the update when the draft changed since it was read
+func (a *API) saveDraft(w http.ResponseWriter, r *http.Request, msg *store.Message, m *compose.Message) error {
+	m.Date = time.Time{}
+	raw, err := a.build(m)
+	if err != nil {
+		return err
+	}
+	msg.Raw = raw
+	if err := a.Store.Update(r.Context(), msg); err != nil {
+		return storeError(err, msg.ID)
+	}
+	return writeDraft(w, http.StatusOK, msg)
+}
+
+// createDraft handles POST /api/v1/drafts
+func (a *API) createDraft(w http.ResponseWriter, r *http.Request) error {
+	var req DraftRequest
+	if err := rest.Decode(r, &req); err != nil {
+		return err
+	}
+	user := caller(r)
+	m, err := a.compose(r, user, req.sendRequest())
+	if err != nil {
+		return err
+	}
+	m.Draft = true
+	raw, err := a.build(m)
+	if err != nil {
+		return err
+	}
+	msg := &store.Message{Owner: user, Mailbox: store.Drafts, Flags: []string{store.FlagSeen, store.FlagDraft}, Raw: raw}
+	if err := a.Store.Append(r.Context(), msg); err != nil {
+		return storeError(err, "")
+	}
+	return writeDraft(w, http.StatusCreated, msg)
+}
+
+func (a *API) getDraft(w http.ResponseWriter, r *http.Request) error {
+	msg, err := a.loadDraft(r)
+	if err != nil {
+		return err
+	}
+	return writeDraft(w, http.StatusOK, msg)
+}
+
+// updateDraft handles PUT /api/v1/drafts/{id}; the revision is required so
+// an autosave never overwrites changes made elsewhere
+func (a *API) updateDraft(w http.ResponseWriter, r *http.Request) error {
+	var req DraftRequest
+	if err := rest.Decode(r, &req); err != nil {
+		return err
+	}
+	msg, err := a.loadDraft(r)
+	if err != nil {
+		return err
+	}
+	if req.Revision != nil {
+		if err := checkRevision(msg, *req.Revision); err != nil {
+			return err
+		}
+	} else if r.Header.Get("If-Match") == "" {
+		return rest.InvalidParameter("revision", "revision or an If-Match header is required")
+	}
+	old, err := parseDraft(msg)
+	if err != nil {
+		return err
+	}
+
+	m, err := a.compose(r, msg.Owner, req.sendRequest())
+	if err != nil {
+		return err
+	}
+	m.Draft, m.MessageID, m.Attachments = true, old.MessageID, old.Attachments
+	return a.saveDraft(w, r, msg, m)
+}
+
+func (a *API) deleteDraft(w http.ResponseWriter, r *http.Request) error {
+	msg, err := a.loadDraft(r)
+	if err != nil {
+		return err
+	}
+	if err := a.Store.Delete(r.Context(), msg.Owner, msg.ID); err != nil {
+		return storeError(err, msg.ID)
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// addDraftAttachments handles POST /api/v1/drafts/{id}/attachments with a
+// JSON AttachmentsRequest or multipart/form-data file parts
+func (a *API) addDraftAttachments(w http.ResponseWriter, r *http.Request) error {
+	var req AttachmentsRequest
+	if isMultipart(r) {
+		if err := parseMultipart(r); err != nil {
+			return err
+		}
+		defer r.MultipartForm.RemoveAll()
+		files, err := formAttachments(r)
+		if err != nil {
+			return err
+		}
+		req.Attachments = files
+	} else if err := rest.Decode(r, &req); err != nil {
+		return err
+	}
+	if len(req.Attachments) == 0 {
+		return rest.InvalidParameter("attachments", "attachments is required")
+	}
+
+	msg, err := a.loadDraft(r)
+	if err != nil {
+		return err
+	}
+	m, err := parseDraft(msg)
+	if err != nil {
+		return err
+	}
+	for _, att := range req.Attachments {
+		m.Attachments = append(m.Attachments, compose.Attachment{
+			Filename:    att.Filename,
+			ContentType: att.ContentType,
+			ContentID:   att.ContentID,
+			Inline:      att.Inline,
+			Data:        att.Content,
+		})
+	}
+	return a.saveDraft(w, r, msg, m)
+}
+
+func (a *API) deleteDraftAttachment(w http.ResponseWriter, r *http.Request) error {
+	msg, err := a.loadDraft(r)
+	if err != nil {
+		return err
+	}
+	m, err := parseDraft(msg)
+	if err != nil {
+		return err
+	}
+	index, err := strconv.Atoi(r.PathValue("index"))
+	if err != nil || index < 0 || index >= len(m.Attachments) {
+		return rest.NotFound("attachment %s of draft %s not found", r.PathValue("index"), msg.ID)
+	}
+	m.Attachments = append(m.Attachments[:index], m.Attachments[index+1:]...)
+	return a.saveDraft(w, r, msg, m)
+}
+
+// DraftSendRequest is the optional body of a draft send
+type DraftSendRequest struct {
+	SendAt *time.Time `json:"send_at,omitempty"`
+}
+
+// sendDraft handles POST /api/v1/drafts/{id}/send. The draft is sent like
+// POST /messages/send and becomes the copy in the Sent mailbox
+func (a *API) sendDraft(w http.ResponseWriter, r *http.Request) error {
+	var req DraftSendRequest
+	if r.ContentLength != 0 {
+		if err := rest.Decode(r, &req); err != nil {
+			return err
+		}
+	}
+	at, err := a.holdUntil(req.SendAt)
+	if err != nil {
+		return err
+	}
+	msg, err := a.loadDraft(r)
+	if err != nil {
+		return err
+	}
+	m, err := parseDraft(msg)
+	if err != nil {
+		return err
+	}
+	if m.From == nil || !a.Delivery.Owns(msg.Owner, m.From.Address) {
+		return rest.Errorf(http.StatusForbidden, rest.CodeForbidden, "draft %s is not from an address of %s", msg.ID, msg.Owner)
+	}
+	m.Draft, m.Date = false, time.Time{}
+	raw, err := a.build(m)
+	if err != nil {
+		return err
+	}
+
+	// claim the draft before submitting so a concurrent send or edit fails
+	// with 409 instead of sending it twice
+	msg.Raw = sentCopy(m, raw)
+	msg.Flags = FlagsUpdate{Remove: []string{store.FlagDraft}}.apply(msg.Flags)
+	if err := a.Store.Update(r.Context(), msg); err != nil {
+		return storeError(err, msg.ID)
+	}
+	recipients := m.Recipients()
+	resp := SendResponse{MessageID: m.MessageID, Recipients: recipients, SentID: msg.ID}
+	if at.IsZero() {
+		err = a.Delivery.Submit(r.Context(), msg.Owner, m.From.Address, recipients, raw)
+	} else {
+		var item *queue.Item
+		if item, err = a.Delivery.Schedule(r.Context(), msg.Owner, m.From.Address, recipients, raw, at, msg.ID); err == nil {
+			resp.QueueID, resp.SendAt = item.ID, &at
+		}
+	}
+	if err != nil {
+		a.restoreDraft(r, msg, m)
+		return submitError(err)
+	}
+	log.Printf("INFO: User %s sent draft %s as message %s to %d recipients", msg.Owner, msg.ID, m.MessageID, len(recipients))
+
+	if err := a.Store.Move(r.Context(), msg.Owner, msg.ID, store.Sent); err != nil {
+		log.Printf("ERROR: Failed to move sent draft %s of %s - %v", msg.ID, msg.Owner, err)
+	}
+	return rest.JSON(w, http.StatusAccepted, resp)
+}
+
+// restoreDraft puts back a draft whose submission was rejected
+func (a *API) restoreDraft(r *http.Request, msg *store.Message, m *compose.Message) {
+	m.Draft = true
+	raw, err := m.Build()
+	if err == nil {
+		msg.Raw = raw
+		msg.Flags = FlagsUpdate{Add: []string{store.FlagDraft}}.apply(msg.Flags)
+		err = a.Store.Update(r.Context(), msg)
+	}
+	if err != nil {
+		log.Printf("ERROR: Failed to restore draft %s of %s - %v", msg.ID, msg.Owner, err)
+	}
+}
@@ -0,0 +1,143 @@
+package mailbox
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"YoPost/internal/mail/store"
+)
+
+// createDraft creates a draft of alice from body
+func (a *testAPI) createDraft(t *testing.T, body string) Draft {
+	t.Helper()
+	var d Draft
+	w := a.do(t, alice, http.MethodPost, "/drafts", body)
+	decode(t, w, http.StatusCreated, &d)
+	if etag := w.Header().Get("ETag"); etag != strconv.Quote(strconv.FormatInt(d.Revision, 10)) {
+		t.Errorf("ETag = %s, want revision %d", etag, d.Revision)
+	}
+	return d
+}
+
+func TestDraftRoundTrip(t *testing.T) {
+	a := newTestAPI(t, nil)
+	d := a.createDraft(t, `{"to":["Bob <bob@example.com>"],"bcc":["carol@example.com"],"subject":"Plans 计划",
+		"text":"line one\nline two","headers":{"X-Priority":"1"}}`)
+
+	var got Draft
+	decode(t, a.do(t, alice, http.MethodGet, "/drafts/"+d.ID, ""), http.StatusOK, &got)
+	if got.From.Address != "alice@example.com" || len(got.To) != 1 || got.To[0] != (Address{Name: "Bob", Address: "bob@example.com"}) ||
+		len(got.Bcc) != 1 || got.Bcc[0].Address != "carol@example.com" || got.Subject != "Plans 计划" ||
+		got.Text != "line one\nline two" || got.Headers["X-Priority"] != "1" {
+		t.Errorf("GET draft = %+v, want the created fields", got)
+	}
+	msg := a.only(t, "alice@example.com", store.Drafts)
+	if !msg.HasFlag(store.FlagDraft) || !msg.HasFlag(store.FlagSeen) {
+		t.Errorf("draft flags = %v, want \\Seen and \\Draft", msg.Flags)
+	}
+
+	// messages outside Drafts and drafts of other users are not drafts
+	inbox := a.appendMessage(t, "alice@example.com", store.Inbox, "hello")
+	decode(t, a.do(t, alice, http.MethodGet, "/drafts/"+inbox, ""), http.StatusNotFound, nil)
+	decode(t, a.do(t, bob, http.MethodGet, "/drafts/"+d.ID, ""), http.StatusNotFound, nil)
+}
+
+func TestDraftUpdate(t *testing.T) {
+	a := newTestAPI(t, nil)
+	d := a.createDraft(t, `{"to":["bob@example.com"],"subject":"v1"}`)
+	decode(t, a.do(t, alice, http.MethodPost, "/drafts/"+d.ID+"/attachments",
+		`{"attachments":[{"filename":"notes.txt","content":"aGVsbG8="}]}`), http.StatusOK, &d)
+
+	tests := []struct {
+		name     string
+		body     string
+		header   []string
+		status   int
+		revision int64
+	}{
+		{"without revision", `{"to":["bob@example.com"],"subject":"v2"}`, nil, http.StatusBadRequest, 0},
+		{"stale revision", fmt.Sprintf(`{"to":["bob@example.com"],"subject":"v2","revision":%d}`, d.Revision-1), nil, http.StatusConflict, d.Revision},
+		{"stale If-Match", `{"to":["bob@example.com"],"subject":"v2"}`, []string{"If-Match", `"0"`}, http.StatusConflict, d.Revision},
+		{"invalid If-Match", `{"to":["bob@example.com"],"subject":"v2"}`, []string{"If-Match", `"abc"`}, http.StatusBadRequest, 0},
+		{"If-Match", `{"to":["bob@example.com"],"subject":"v2"}`, []string{"If-Match", strconv.Quote(strconv.FormatInt(d.Revision, 10))}, http.StatusOK, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var e struct {
+				Error struct {
+					Details struct {
+						Revision int64 `json:"revision"`
+					} `json:"details"`
+				} `json:"error"`
+			}
+			decode(t, a.do(t, alice, http.MethodPut, "/drafts/"+d.ID, tt.body, tt.header...), tt.status, &e)
+			if tt.status == http.StatusConflict && e.Error.Details.Revision != tt.revision {
+				t.Errorf("conflict details revision = %d, want %d", e.Error.Details.Revision, tt.revision)
+			}
+		})
+	}
+
+	var got Draft
+	decode(t, a.do(t, alice, http.MethodGet, "/drafts/"+d.ID, ""), http.StatusOK, &got)
+	if got.Subject != "v2" || got.Revision != d.Revision+1 || got.MessageID != d.MessageID {
+		t.Errorf("updated draft = subject %q revision %d message id %s, want v2, %d, %s", got.Subject, got.Revision, got.MessageID, d.Revision+1, d.MessageID)
+	}
+	if len(got.Attachments) != 1 || got.Attachments[0].Filename != "notes.txt" || got.Attachments[0].Size != 5 {
+		t.Errorf("attachments after update = %+v, want notes.txt kept", got.Attachments)
+	}
+
+	decode(t, a.do(t, alice, http.MethodDelete, "/drafts/"+d.ID+"/attachments/1", ""), http.StatusNotFound, nil)
+	decode(t, a.do(t, alice, http.MethodDelete, "/drafts/"+d.ID+"/attachments/0", ""), http.StatusOK, &got)
+	if len(got.Attachments) != 0 {
+		t.Errorf("attachments after delete = %+v, want none", got.Attachments)
+	}
+	decode(t, a.do(t, alice, http.MethodDelete, "/drafts/"+d.ID, ""), http.StatusNoContent, nil)
+	decode(t, a.do(t, alice, http.MethodGet, "/drafts/"+d.ID, ""), http.StatusNotFound, nil)
+}
+
+func TestDraftSend(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		sent   bool
+	}{
+		{"sent", `{"to":["bob@example.com"],"bcc":["carol@example.com"],"subject":"hi","text":"hi"}`, http.StatusAccepted, true},
+		{"without recipients", `{"subject":"hi","text":"hi"}`, http.StatusBadRequest, false},
+		{"rejected recipient", `{"to":["nobody@example.com"],"subject":"hi","text":"hi"}`, http.StatusUnprocessableEntity, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestAPI(t, nil)
+			d := a.createDraft(t, tt.body)
+			var resp SendResponse
+			decode(t, a.do(t, alice, http.MethodPost, "/drafts/"+d.ID+"/send", ""), tt.status, &resp)
+
+			ctx := context.Background()
+			msg, err := a.Store.Get(ctx, "alice@example.com", d.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.sent {
+				if msg.Mailbox != store.Drafts || !msg.HasFlag(store.FlagDraft) {
+					t.Errorf("draft in %s with flags %v, want it kept as a draft", msg.Mailbox, msg.Flags)
+				}
+				return
+			}
+			if resp.SentID != d.ID || msg.Mailbox != store.Sent || msg.HasFlag(store.FlagDraft) ||
+				!strings.Contains(string(msg.Raw), "Bcc: <carol@example.com>") {
+				t.Errorf("sent draft %s in %s with flags %v, want it in Sent with its Bcc header", resp.SentID, msg.Mailbox, msg.Flags)
+			}
+			for _, owner := range []string{"bob@example.com", "carol@example.com"} {
+				if raw := string(a.only(t, owner, store.Inbox).Raw); strings.Contains(raw, "Bcc:") {
+					t.Errorf("message delivered to %s:\n%s", owner, raw)
+				}
+			}
+			decode(t, a.do(t, alice, http.MethodPost, "/drafts/"+d.ID+"/send", ""), http.StatusNotFound, nil)
+		})
+	}
+}
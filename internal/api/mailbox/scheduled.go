@@ -0,0 +1,207 @@
+package mailbox
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"YoPost/internal/api/rest"
+	"YoPost/internal/mail/message"
+	"YoPost/internal/mail/queue"
+	"YoPost/internal/mail/store"
+)
+
+// Scheduled is a message of the caller held in the outbound queue, either
+// scheduled with send_at or within the undo window
+type Scheduled struct {
+	ID        string `json:"id"`
+	MessageID string `json:"message_id,omitempty"`
+	From      string `json:"from"`
+	// To lists every envelope recipient, including Bcc
+	To        []string  `json:"to"`
+	Subject   string    `json:"subject"`
+	SendAt    time.Time `json:"send_at"`
+	CreatedAt time.Time `json:"created_at"`
+	Size      int64     `json:"size"`
+	// SentID is the copy in the Sent mailbox, moved back to Drafts on cancel
+	SentID string `json:"sent_id,omitempty"`
+}
+
+// RescheduleRequest changes when a held message is sent; a time that is not
+// in the future sends it at once
+type RescheduleRequest struct {
+	SendAt *time.Time `json:"send_at"`
+}
+
+// CancelResponse describes a cancelled message; DraftID is the draft it was
+// turned back into, empty when no Sent copy was saved
+type CancelResponse struct {
+	DraftID string `json:"draft_id,omitempty"`
+}
+
+// scheduledRoutes registers the endpoints for held messages of the caller
+func (a *API) scheduledRoutes(r *rest.Router) {
+	r.GET("/scheduled", a.listScheduled).
+		Paged().
+		Response(http.StatusOK, rest.List[Scheduled]{}).
+		Describe("List scheduled messages and messages within the undo window")
+	r.GET("/scheduled/{id}", a.getScheduled).Response(http.StatusOK, Scheduled{}).Describe("Get a scheduled message")
+	r.PATCH("/scheduled/{id}", a.reschedule).
+		Request(RescheduleRequest{}).
+		Response(http.StatusOK, Scheduled{}).
+		Describe("Change when a scheduled message is sent")
+	r.POST("/scheduled/{id}/cancel", a.cancelScheduled).
+		Response(http.StatusOK, CancelResponse{}).
+		Describe("Cancel a scheduled message and turn it back into a draft")
+}
+
+func scheduledView(item *queue.Item) Scheduled {
+	s := Scheduled{
+		ID:        item.ID,
+		From:      item.From,
+		To:        item.To,
+		SendAt:    item.SendAt,
+		CreatedAt: item.CreatedAt,
+		Size:      item.Size,
+		SentID:    item.SentID,
+	}
+	if p, err := message.ParseHeader(item.Raw); err == nil {
+		s.Subject, s.MessageID = p.Subject, p.MessageID
+	}
+	return s
+}
+
+// queueError maps outbound queue errors of held messages to API errors
+func queueError(err error, id string) error {
+	switch {
+	case errors.Is(err, queue.ErrNotFound):
+		return rest.NotFound("scheduled message %s not found", id)
+	case errors.Is(err, queue.ErrNotHeld):
+		return rest.Conflict("message %s is already being sent", id)
+	}
+	return err
+}
+
+// loadScheduled reads the caller's held message named by {id}
+func (a *API) loadScheduled(r *http.Request) (*queue.Item, error) {
+	id := r.PathValue("id")
+	item, err := a.Queue.Get(r.Context(), id)
+	if err == nil && item.Owner != caller(r) {
+		err = queue.ErrNotFound
+	}
+	if err == nil && !item.Held(time.Now()) {
+		err = queue.ErrNotHeld
+	}
+	if err != nil {
+		return nil, queueError(err, id)
+	}
+	return item, nil
+}
+
+func scheduledKey(s Scheduled) string {
+	return fmt.Sprintf("%020d|%s", s.SendAt.UnixNano(), s.ID)
+}
+
+// listScheduled handles GET /api/v1/scheduled, soonest first
+func (a *API) listScheduled(w http.ResponseWriter, r *http.Request) error {
+	p, err := rest.ParseList(r)
+	if err != nil {
+		return err
+	}
+	items, err := a.Queue.List(r.Context())
+	if err != nil {
+		return err
+	}
+	user, now := caller(r), time.Now()
+	var held []Scheduled
+	for _, item := range items {
+		if item.Owner == user && item.Held(now) {
+			held = append(held, scheduledView(item))
+		}
+	}
+	sort.Slice(held, func(i, j int) bool { return scheduledKey(held[i]) < scheduledKey(held[j]) })
+	page := rest.Paginate(held, p, scheduledKey)
+	if page.Data == nil {
+		page.Data = []Scheduled{}
+	}
+	return rest.JSON(w, http.StatusOK, page)
+}
+
+func (a *API) getScheduled(w http.ResponseWriter, r *http.Request) error {
+	item, err := a.loadScheduled(r)
+	if err != nil {
+		return err
+	}
+	return rest.JSON(w, http.StatusOK, scheduledView(item))
+}
+
+// reschedule handles PATCH /api/v1/scheduled/{id}
+func (a *API) reschedule(w http.ResponseWriter, r *http.Request) error {
+	var req RescheduleRequest
+	if err := rest.Decode(r, &req); err != nil {
+		return err
+	}
+	if req.SendAt == nil {
+		return rest.InvalidParameter("send_at", "send_at is required")
+	}
+	now := time.Now()
+	at := *req.SendAt
+	if !at.After(now) {
+		at = now
+	}
+	if max := a.Config.Get().API.Send.MaxScheduleDays; at.After(now.AddDate(0, 0, max)) {
+		return rest.InvalidParameter("send_at", "send_at must be within %d days", max)
+	}
+
+	item, err := a.loadScheduled(r)
+	if err != nil {
+		return err
+	}
+	item.SendAt, item.NextAttempt = at, at
+	if err := a.Queue.UpdateHeld(r.Context(), item, now); err != nil {
+		return queueError(err, item.ID)
+	}
+	log.Printf("INFO: User %s rescheduled message %s for %s", item.Owner, item.ID, at.Format(time.RFC3339))
+	return rest.JSON(w, http.StatusOK, scheduledView(item))
+}
+
+// cancelScheduled handles POST /api/v1/scheduled/{id}/cancel. The message is
+// removed from the queue before anyone receives it and its Sent copy becomes
+// a draft again
+func (a *API) cancelScheduled(w http.ResponseWriter, r *http.Request) error {
+	item, err := a.loadScheduled(r)
+	if err != nil {
+		return err
+	}
+	if err := a.Queue.DeleteHeld(r.Context(), item.ID, time.Now()); err != nil {
+		return queueError(err, item.ID)
+	}
+	log.Printf("INFO: User %s cancelled message %s", item.Owner, item.ID)
+
+	var resp CancelResponse
+	if item.SentID != "" {
+		if err := a.restoreSent(r, item.Owner, item.SentID); err != nil {
+			log.Printf("WARNING: Failed to restore cancelled message %s of %s as a draft - %v", item.SentID, item.Owner, err)
+		} else {
+			resp.DraftID = item.SentID
+		}
+	}
+	return rest.JSON(w, http.StatusOK, resp)
+}
+
+// restoreSent moves the Sent copy of a cancelled message back to Drafts. The
+// copy keeps its Bcc header, so it is a complete draft
+func (a *API) restoreSent(r *http.Request, owner, id string) error {
+	msg, err := a.Store.Get(r.Context(), owner, id)
+	if err != nil {
+		return err
+	}
+	msg.Flags = FlagsUpdate{Add: []string{store.FlagDraft}}.apply(msg.Flags)
+	if err := a.Store.Update(r.Context(), msg); err != nil {
+		return err
+	}
+	return a.Store.Move(r.Context(), owner, id, store.Drafts)
+}
@@ -0,0 +1,150 @@
+package mailbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"YoPost/internal/config"
+	"YoPost/internal/mail/queue"
+	"YoPost/internal/mail/store"
+)
+
+func undoWindow(seconds int) func(cfg *config.Config) {
+	return func(cfg *config.Config) {
+		cfg.API.Send.UndoSeconds = seconds
+		cfg.API.Send.MaxScheduleDays = 7
+	}
+}
+
+func TestSendHold(t *testing.T) {
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	tests := []struct {
+		name   string
+		undo   int
+		sendAt string
+		status int
+		held   time.Duration
+	}{
+		{"immediately", 0, "", http.StatusAccepted, 0},
+		{"undo window", 30, "", http.StatusAccepted, 30 * time.Second},
+		{"scheduled", 0, future, http.StatusAccepted, time.Hour},
+		{"scheduled within undo window", 7200, future, http.StatusAccepted, 2 * time.Hour},
+		{"send_at in the past", 0, "2020-01-01T00:00:00Z", http.StatusAccepted, 0},
+		{"beyond max_schedule_days", 0, time.Now().AddDate(0, 0, 8).UTC().Format(time.RFC3339), http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestAPI(t, undoWindow(tt.undo))
+			sendAt := ""
+			if tt.sendAt != "" {
+				sendAt = `,"send_at":"` + tt.sendAt + `"`
+			}
+			var resp SendResponse
+			decode(t, a.do(t, alice, http.MethodPost, "/messages/send", `{"to":["bob@example.com"],"subject":"hi","text":"hi"`+sendAt+`}`), tt.status, &resp)
+			if tt.status != http.StatusAccepted {
+				return
+			}
+			msgs, err := a.Store.List(context.Background(), "bob@example.com", store.Inbox)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.held == 0 {
+				if resp.QueueID != "" || len(msgs) != 1 {
+					t.Errorf("queue id %q, %d delivered, want the message delivered at once", resp.QueueID, len(msgs))
+				}
+				return
+			}
+			if len(msgs) != 0 {
+				t.Errorf("%d messages delivered within the hold", len(msgs))
+			}
+			if resp.SendAt == nil || time.Until(*resp.SendAt) > tt.held || time.Until(*resp.SendAt) < tt.held-time.Minute {
+				t.Errorf("send_at = %v, want in %v", resp.SendAt, tt.held)
+			}
+			item, err := a.Queue.Get(context.Background(), resp.QueueID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if item.Owner != "alice@example.com" || item.SentID != resp.SentID || !item.Held(time.Now()) {
+				t.Errorf("queued item %+v, want held for alice with Sent copy %s", item, resp.SentID)
+			}
+		})
+	}
+}
+
+func TestScheduledCancel(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAPI(t, undoWindow(30))
+	var resp SendResponse
+	decode(t, a.do(t, alice, http.MethodPost, "/messages/send", `{"to":["bob@example.com"],"bcc":["carol@example.com"],"subject":"oops","text":"hi"}`), http.StatusAccepted, &resp)
+
+	var list struct {
+		Data []Scheduled `json:"data"`
+	}
+	decode(t, a.do(t, alice, http.MethodGet, "/scheduled", ""), http.StatusOK, &list)
+	if len(list.Data) != 1 || list.Data[0].ID != resp.QueueID || list.Data[0].Subject != "oops" || len(list.Data[0].To) != 2 {
+		t.Errorf("GET /scheduled = %+v, want the held message to bob and carol", list.Data)
+	}
+	decode(t, a.do(t, bob, http.MethodGet, "/scheduled", ""), http.StatusOK, &list)
+	if len(list.Data) != 0 {
+		t.Errorf("GET /scheduled as bob = %+v, want none", list.Data)
+	}
+	decode(t, a.do(t, bob, http.MethodPost, "/scheduled/"+resp.QueueID+"/cancel", ""), http.StatusNotFound, nil)
+
+	var cancel CancelResponse
+	decode(t, a.do(t, alice, http.MethodPost, "/scheduled/"+resp.QueueID+"/cancel", ""), http.StatusOK, &cancel)
+	if cancel.DraftID != resp.SentID {
+		t.Errorf("draft id = %q, want the Sent copy %s", cancel.DraftID, resp.SentID)
+	}
+	if _, err := a.Queue.Get(ctx, resp.QueueID); !errors.Is(err, queue.ErrNotFound) {
+		t.Errorf("queue Get() after cancel error = %v, want ErrNotFound", err)
+	}
+	var d Draft
+	decode(t, a.do(t, alice, http.MethodGet, "/drafts/"+cancel.DraftID, ""), http.StatusOK, &d)
+	if d.Subject != "oops" || len(d.Bcc) != 1 || d.Bcc[0].Address != "carol@example.com" {
+		t.Errorf("restored draft = %+v, want the cancelled message with its Bcc", d)
+	}
+	decode(t, a.do(t, alice, http.MethodPost, "/scheduled/"+resp.QueueID+"/cancel", ""), http.StatusNotFound, nil)
+}
+
+func TestReschedule(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAPI(t, undoWindow(30))
+	var resp SendResponse
+	decode(t, a.do(t, alice, http.MethodPost, "/messages/send", `{"to":["bob@example.com","dave@remote.example"],"subject":"hi","text":"hi"}`), http.StatusAccepted, &resp)
+	path := "/scheduled/" + resp.QueueID
+
+	later := time.Now().Add(2 * time.Hour).UTC().Truncate(time.Second)
+	var s Scheduled
+	decode(t, a.do(t, alice, http.MethodPatch, path, `{"send_at":"`+later.Format(time.RFC3339)+`"}`), http.StatusOK, &s)
+	if !s.SendAt.Equal(later) {
+		t.Errorf("send_at = %v, want %v", s.SendAt, later)
+	}
+	decode(t, a.do(t, alice, http.MethodPatch, path, `{"send_at":"`+time.Now().AddDate(0, 0, 8).UTC().Format(time.RFC3339)+`"}`), http.StatusBadRequest, nil)
+	decode(t, a.do(t, alice, http.MethodPatch, path, `{}`), http.StatusBadRequest, nil)
+
+	// a time in the past sends the message at once, it can no longer be changed
+	decode(t, a.do(t, alice, http.MethodPatch, path, `{"send_at":"2020-01-01T00:00:00Z"}`), http.StatusOK, &s)
+	decode(t, a.do(t, alice, http.MethodPost, path+"/cancel", ""), http.StatusConflict, nil)
+
+	// the queue delivers local recipients itself and hands the rest to the remote sender
+	item, err := a.Queue.Get(ctx, resp.QueueID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var remote []string
+	err = a.Delivery.QueueSender(queue.SenderFunc(func(ctx context.Context, item *queue.Item) error {
+		remote = append(remote, item.To...)
+		return nil
+	})).Send(ctx, item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(remote) != "[dave@remote.example]" {
+		t.Errorf("remote recipients = %v, want dave@remote.example", remote)
+	}
+	a.only(t, "bob@example.com", store.Inbox)
+}
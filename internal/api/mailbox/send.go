@@ -0,0 +1,397 @@
+package mailbox
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"YoPost/internal/api/rest"
+	templatesapi "YoPost/internal/api/templates"
+	"YoPost/internal/auth"
+	"YoPost/internal/mail/compose"
+	"YoPost/internal/mail/delivery"
+	"YoPost/internal/mail/message"
+	"YoPost/internal/mail/smtpd"
+	"YoPost/internal/mail/store"
+	"YoPost/internal/ratelimit"
+	"YoPost/internal/templates"
+)
+
+// maxMemory is the part of a multipart upload kept in memory, the rest is
+// buffered in temporary files
+const maxMemory = 8 << 20
+
+// UnmarshalJSON accepts either {"name": "...", "address": "..."} or a string
+// such as "Alice <alice@example.com>"
+func (a *Address) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		parsed, err := mail.ParseAddress(s)
+		if err != nil {
+			return errors.New("invalid address " + s)
+		}
+		a.Name, a.Address = parsed.Name, parsed.Address
+		return nil
+	}
+	type plain Address
+	return json.Unmarshal(b, (*plain)(a))
+}
+
+// AttachmentInput is an attachment of a send request; content is base64 in JSON
+type AttachmentInput struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type,omitempty"`
+	ContentID   string `json:"content_id,omitempty"`
+	Inline      bool   `json:"inline,omitempty"`
+	Content     []byte `json:"content"`
+}
+
+// SendRequest describes a message to send as the caller. It is the JSON body,
+// or the "message" field of a multipart/form-data request whose file parts
+// named "attachments" are added as attachments
+type SendRequest struct {
+	// From defaults to the caller and must be the caller's address or an alias of it
+	From        *Address          `json:"from,omitempty"`
+	To          []Address         `json:"to"`
+	Cc          []Address         `json:"cc,omitempty"`
+	Bcc         []Address         `json:"bcc,omitempty"`
+	ReplyTo     []Address         `json:"reply_to,omitempty"`
+	Subject     string            `json:"subject"`
+	Text        string            `json:"text,omitempty"`
+	HTML        string            `json:"html,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	Attachments []AttachmentInput `json:"attachments,omitempty"`
+	// InReplyTo and References are Message-IDs including angle brackets
+	InReplyTo  string   `json:"in_reply_to,omitempty"`
+	References []string `json:"references,omitempty"`
+	// InReplyToID is the id of a stored message being replied to. It fills in
+	// InReplyTo and References when they are empty and flags the message \Answered
+	InReplyToID string `json:"in_reply_to_id,omitempty"`
+	// SaveCopy stores the message in the caller's Sent mailbox, default true
+	SaveCopy *bool `json:"save_copy,omitempty"`
+	// SendAt holds the message in the outbound queue until then, see /scheduled
+	SendAt *time.Time `json:"send_at,omitempty"`
+	// Template renders subject, text and html from a stored template; they
+	// must be empty when it is set
+	Template *TemplateRef `json:"template,omitempty"`
+}
+
+// TemplateRef names a stored template and the variables to render it with
+type TemplateRef struct {
+	ID string `json:"id"`
+	// Locale is a language tag or an Accept-Language list, defaulting to the
+	// Accept-Language header of the request
+	Locale    string                 `json:"locale,omitempty"`
+	Variables map[string]interface{} `json:"variables,omitempty"`
+}
+
+// SendForm documents the multipart/form-data variant of SendRequest
+type SendForm struct {
+	// Message is the JSON encoded SendRequest
+	Message     string      `json:"message"`
+	Attachments []rest.File `json:"attachments"`
+}
+
+// SendResponse describes an accepted message
+type SendResponse struct {
+	MessageID  string   `json:"message_id"`
+	Recipients []string `json:"recipients"`
+	// SentID is the id of the copy in the Sent mailbox
+	SentID string `json:"sent_id,omitempty"`
+	// QueueID and SendAt are set when the message is held for undo or
+	// scheduled; it can be cancelled through /scheduled/{queue_id} until then
+	QueueID string     `json:"queue_id,omitempty"`
+	SendAt  *time.Time `json:"send_at,omitempty"`
+}
+
+func mailAddresses(list []Address) []*mail.Address {
+	out := make([]*mail.Address, 0, len(list))
+	for _, a := range list {
+		out = append(out, &mail.Address{Name: a.Name, Address: strings.TrimSpace(a.Address)})
+	}
+	return out
+}
+
+// decodeSend reads a JSON or multipart/form-data send request
+func decodeSend(r *http.Request) (*SendRequest, error) {
+	var req SendRequest
+	if !isMultipart(r) {
+		if err := rest.Decode(r, &req); err != nil {
+			return nil, err
+		}
+		return &req, nil
+	}
+
+	if err := parseMultipart(r); err != nil {
+		return nil, err
+	}
+	defer r.MultipartForm.RemoveAll()
+	if err := rest.DecodeReader(strings.NewReader(r.FormValue("message")), &req); err != nil {
+		return nil, err
+	}
+	files, err := formAttachments(r)
+	if err != nil {
+		return nil, err
+	}
+	req.Attachments = append(req.Attachments, files...)
+	return &req, nil
+}
+
+func isMultipart(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == "multipart/form-data"
+}
+
+// parseMultipart parses a multipart/form-data body; the caller removes the
+// temporary files with r.MultipartForm.RemoveAll
+func parseMultipart(r *http.Request) error {
+	if err := r.ParseMultipartForm(maxMemory); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return rest.Errorf(http.StatusRequestEntityTooLarge, rest.CodePayloadTooLarge, "request body exceeds %d bytes", tooLarge.Limit)
+		}
+		return rest.BadRequest("invalid multipart form: %v", err)
+	}
+	return nil
+}
+
+// formAttachments reads the file parts named "attachments" of a parsed multipart form
+func formAttachments(r *http.Request) ([]AttachmentInput, error) {
+	var out []AttachmentInput
+	for _, fh := range r.MultipartForm.File["attachments"] {
+		f, err := fh.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		// browsers send application/octet-stream for unknown files, let compose infer the type
+		contentType := fh.Header.Get("Content-Type")
+		if contentType == "application/octet-stream" {
+			contentType = ""
+		}
+		out = append(out, AttachmentInput{
+			Filename:    fh.Filename,
+			ContentType: contentType,
+			Content:     data,
+		})
+	}
+	return out, nil
+}
+
+// render fills in subject, text and html of req from its template
+func (a *API) render(r *http.Request, req *SendRequest) error {
+	ref := req.Template
+	if req.Subject != "" || req.Text != "" || req.HTML != "" {
+		return rest.InvalidParameter("template", "subject, text and html must be empty when a template is used")
+	}
+	t, err := a.Templates.Get(r.Context(), ref.ID)
+	if errors.Is(err, templates.ErrNotFound) {
+		return rest.InvalidParameter("template", "template %s not found", ref.ID)
+	}
+	if err != nil {
+		return err
+	}
+	locale := ref.Locale
+	if locale == "" {
+		locale = r.Header.Get("Accept-Language")
+	}
+	out, err := t.Render(locale, ref.Variables)
+	if err != nil {
+		return templatesapi.RenderError(err)
+	}
+	req.Subject, req.Text, req.HTML = out.Subject, out.Text, out.HTML
+	return nil
+}
+
+// compose builds the message of req sent by user
+func (a *API) compose(r *http.Request, user string, req *SendRequest) (*compose.Message, error) {
+	if req.Template != nil {
+		if err := a.render(r, req); err != nil {
+			return nil, err
+		}
+	}
+	from := &mail.Address{Address: user}
+	if req.From != nil {
+		from = &mail.Address{Name: req.From.Name, Address: strings.TrimSpace(req.From.Address)}
+		if !a.Delivery.Owns(user, from.Address) {
+			return nil, rest.Errorf(http.StatusForbidden, rest.CodeForbidden, "%s is not an address of %s", from.Address, user)
+		}
+	}
+	m := &compose.Message{
+		From:       from,
+		To:         mailAddresses(req.To),
+		Cc:         mailAddresses(req.Cc),
+		Bcc:        mailAddresses(req.Bcc),
+		ReplyTo:    mailAddresses(req.ReplyTo),
+		Subject:    req.Subject,
+		Text:       req.Text,
+		HTML:       req.HTML,
+		Headers:    req.Headers,
+		InReplyTo:  req.InReplyTo,
+		References: req.References,
+	}
+	for _, att := range req.Attachments {
+		m.Attachments = append(m.Attachments, compose.Attachment{
+			Filename:    att.Filename,
+			ContentType: att.ContentType,
+			ContentID:   att.ContentID,
+			Inline:      att.Inline,
+			Data:        att.Content,
+		})
+	}
+
+	if req.InReplyToID != "" && m.InReplyTo == "" {
+		parent, err := a.Store.Get(r.Context(), user, req.InReplyToID)
+		if err != nil {
+			return nil, storeError(err, req.InReplyToID)
+		}
+		if p, err := message.ParseHeader(parent.Raw); err == nil {
+			m.InReplyTo, m.References = compose.Reply(p.MessageID, p.Header.Get("References"), p.Header.Get("In-Reply-To"))
+		}
+	}
+	return m, nil
+}
+
+// submitError maps submissions over the rate limit to 429 and rejected
+// submissions, including those larger than the hourly limit itself, to 422
+// responses
+func submitError(err error) error {
+	var le *ratelimit.LimitError
+	var re *delivery.RecipientError
+	var se *smtpd.Error
+	switch {
+	case errors.As(err, &le) && le.Permanent():
+		e := rest.Errorf(http.StatusUnprocessableEntity, rest.CodeUnprocessable, "%s", le.Error())
+		e.Details = map[string]interface{}{"limit": le.Limit, "per_hour": le.PerHour, "requested": le.Requested}
+		return e
+	case errors.As(err, &le):
+		return rest.RateLimited(le.RetryAfter, "%s", le.Error())
+	case errors.As(err, &re) && errors.As(err, &se):
+		e := rest.Errorf(http.StatusUnprocessableEntity, rest.CodeUnprocessable, "recipient %s rejected: %s", re.Recipient, se.Message)
+		e.Details = map[string]interface{}{"recipient": re.Recipient, "smtp_code": se.Code, "enhanced_code": se.Enhanced}
+		return e
+	case errors.As(err, &se):
+		e := rest.Errorf(http.StatusUnprocessableEntity, rest.CodeUnprocessable, "message rejected: %s", se.Message)
+		e.Details = map[string]interface{}{"smtp_code": se.Code, "enhanced_code": se.Enhanced}
+		return e
+	}
+	return err
+}
+
+// holdUntil returns when a message sent now leaves the outbound queue: the end
+// of the undo window or sendAt, whichever is later. It is zero when the
+// message is sent immediately
+func (a *API) holdUntil(sendAt *time.Time) (time.Time, error) {
+	cfg := a.Config.Get().API.Send
+	now := time.Now()
+	var at time.Time
+	if cfg.UndoSeconds > 0 {
+		at = now.Add(time.Duration(cfg.UndoSeconds) * time.Second)
+	}
+	if sendAt != nil && sendAt.After(now) {
+		if sendAt.After(now.AddDate(0, 0, cfg.MaxScheduleDays)) {
+			return time.Time{}, rest.InvalidParameter("send_at", "send_at must be within %d days", cfg.MaxScheduleDays)
+		}
+		if sendAt.After(at) {
+			at = *sendAt
+		}
+	}
+	return at, nil
+}
+
+// send handles POST /api/v1/messages/send. Local recipients get the message
+// immediately, remote recipients through the outbound queue; with send_at or
+// an undo window the whole message waits in the queue
+func (a *API) send(w http.ResponseWriter, r *http.Request) error {
+	req, err := decodeSend(r)
+	if err != nil {
+		return err
+	}
+	at, err := a.holdUntil(req.SendAt)
+	if err != nil {
+		return err
+	}
+	user := strings.ToLower(auth.FromContext(r.Context()).Subject)
+	m, err := a.compose(r, user, req)
+	if err != nil {
+		return err
+	}
+	raw, err := a.build(m)
+	if err != nil {
+		return err
+	}
+
+	recipients := m.Recipients()
+	resp := SendResponse{MessageID: m.MessageID, Recipients: recipients}
+	saveCopy := req.SaveCopy == nil || *req.SaveCopy
+	if at.IsZero() {
+		if err := a.Delivery.Submit(r.Context(), user, m.From.Address, recipients, raw); err != nil {
+			return submitError(err)
+		}
+		log.Printf("INFO: User %s sent message %s to %d recipients", user, m.MessageID, len(recipients))
+		if saveCopy {
+			resp.SentID = a.saveSent(r, user, m, raw)
+		}
+	} else {
+		// the Sent copy is saved first so the queue item can refer to it
+		if saveCopy {
+			resp.SentID = a.saveSent(r, user, m, raw)
+		}
+		item, err := a.Delivery.Schedule(r.Context(), user, m.From.Address, recipients, raw, at, resp.SentID)
+		if err != nil {
+			if resp.SentID != "" {
+				a.Store.Delete(r.Context(), user, resp.SentID)
+			}
+			return submitError(err)
+		}
+		resp.QueueID, resp.SendAt = item.ID, &at
+	}
+	if req.InReplyToID != "" {
+		a.markAnswered(r, user, req.InReplyToID)
+	}
+	return rest.JSON(w, http.StatusAccepted, resp)
+}
+
+// sentCopy returns raw with the Bcc header the recipients do not see
+func sentCopy(m *compose.Message, raw []byte) []byte {
+	if len(m.Bcc) == 0 {
+		return raw
+	}
+	bcc := make([]string, len(m.Bcc))
+	for i, addr := range m.Bcc {
+		bcc[i] = addr.String()
+	}
+	return append([]byte("Bcc: "+strings.Join(bcc, ", ")+"\r\n"), raw...)
+}
+
+// saveSent stores a copy in the Sent mailbox, including the Bcc header. The
+// message is already sent, so failures are only logged
+func (a *API) saveSent(r *http.Request, user string, m *compose.Message, raw []byte) string {
+	msg := &store.Message{Owner: user, Mailbox: store.Sent, Flags: []string{store.FlagSeen}, Raw: sentCopy(m, raw)}
+	if err := a.Store.Append(r.Context(), msg); err != nil {
+		log.Printf("ERROR: Failed to save sent message %s of %s - %v", m.MessageID, user, err)
+		return ""
+	}
+	return msg.ID
+}
+
+func (a *API) markAnswered(r *http.Request, user, id string) {
+	msg, err := a.Store.Get(r.Context(), user, id)
+	if err == nil {
+		msg.Flags = FlagsUpdate{Add: []string{store.FlagAnswered}}.apply(msg.Flags)
+		err = a.Store.Update(r.Context(), msg)
+	}
+	if err != nil {
+		log.Printf("WARNING: Failed to flag message %s of %s as answered - %v", id, user, err)
+	}
+}
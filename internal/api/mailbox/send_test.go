@@ -0,0 +1,181 @@
+package mailbox
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"YoPost/internal/mail/message"
+	"YoPost/internal/mail/store"
+	"YoPost/internal/templates"
+)
+
+// only returns the only message in the mailbox of owner
+func (a *testAPI) only(t *testing.T, owner, mailbox string) *store.Message {
+	t.Helper()
+	msgs, err := a.Store.List(context.Background(), owner, mailbox)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 {
+		t.Fatalf("%s of %s has %d messages, want 1", mailbox, owner, len(msgs))
+	}
+	return msgs[0]
+}
+
+func TestSendCcBcc(t *testing.T) {
+	a := newTestAPI(t, nil)
+	var resp SendResponse
+	decode(t, a.do(t, alice, http.MethodPost, "/messages/send", `{"to":["Bob <bob@example.com>"],
+		"cc":[{"name":"Dave","address":"dave@remote.example"}],"bcc":["carol@example.com","erin@remote.example"],
+		"subject":"plans","text":"see you"}`), http.StatusAccepted, &resp)
+
+	want := "bob@example.com,dave@remote.example,carol@example.com,erin@remote.example"
+	if got := strings.Join(resp.Recipients, ","); got != want {
+		t.Errorf("recipients = %s, want %s", got, want)
+	}
+
+	// recipients never see the Bcc header, the Sent copy keeps it
+	for _, owner := range []string{"bob@example.com", "carol@example.com"} {
+		raw := string(a.only(t, owner, store.Inbox).Raw)
+		if strings.Contains(raw, "Bcc:") || !strings.Contains(raw, "Cc: \"Dave\" <dave@remote.example>") {
+			t.Errorf("message delivered to %s:\n%s\nwant Cc and no Bcc", owner, raw)
+		}
+	}
+	items, err := a.Queue.List(context.Background())
+	if err != nil || len(items) != 1 {
+		t.Fatalf("queue has %d items, %v, want 1", len(items), err)
+	}
+	if got := strings.Join(items[0].To, ","); got != "dave@remote.example,erin@remote.example" {
+		t.Errorf("queued recipients = %s, want the remote cc and bcc", got)
+	}
+	if strings.Contains(string(items[0].Raw), "Bcc:") {
+		t.Errorf("queued message has a Bcc header:\n%s", items[0].Raw)
+	}
+	sent := a.only(t, "alice@example.com", store.Sent)
+	if sent.ID != resp.SentID || !strings.Contains(string(sent.Raw), "Bcc: <carol@example.com>, <erin@remote.example>\r\n") {
+		t.Errorf("Sent copy %s:\n%s\nwant id %s with the Bcc header", sent.ID, sent.Raw, resp.SentID)
+	}
+}
+
+func TestSendFrom(t *testing.T) {
+	tests := []struct {
+		name   string
+		from   string
+		status int
+	}{
+		{"default", ``, http.StatusAccepted},
+		{"alias", `"from":"Hello <hello@example.com>",`, http.StatusAccepted},
+		{"other user", `"from":"bob@example.com",`, http.StatusForbidden},
+		{"remote address", `"from":"alice@remote.example",`, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestAPI(t, nil)
+			w := a.do(t, alice, http.MethodPost, "/messages/send", `{`+tt.from+`"to":["bob@example.com"],"subject":"hi","text":"hi"}`)
+			decode(t, w, tt.status, nil)
+		})
+	}
+}
+
+func TestSendReply(t *testing.T) {
+	a := newTestAPI(t, nil)
+	parent := &store.Message{Owner: "alice@example.com", Mailbox: store.Inbox, Raw: []byte("From: bob@example.com\r\nTo: alice@example.com\r\n" +
+		"Subject: plans\r\nMessage-ID: <c@example.com>\r\nIn-Reply-To: <b@example.com>\r\nReferences: <a@example.com> <b@example.com>\r\n\r\nhi\r\n")}
+	if err := a.Store.Append(context.Background(), parent); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		status     int
+		inReplyTo  string
+		references string
+	}{
+		{"in_reply_to_id", `"in_reply_to_id":"` + parent.ID + `"`, http.StatusAccepted, "<c@example.com>", "<a@example.com> <b@example.com> <c@example.com>"},
+		{"explicit headers win", `"in_reply_to_id":"` + parent.ID + `","in_reply_to":"<x@example.com>","references":["<x@example.com>"]`,
+			http.StatusAccepted, "<x@example.com>", "<x@example.com>"},
+		{"unknown parent", `"in_reply_to_id":"000000000000000000000000"`, http.StatusNotFound, "", ""},
+		{"invalid message id", `"in_reply_to":"not-an-id"`, http.StatusBadRequest, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp SendResponse
+			decode(t, a.do(t, alice, http.MethodPost, "/messages/send", `{"to":["bob@example.com"],"subject":"Re: plans","text":"ok",`+tt.body+`}`), tt.status, &resp)
+			if tt.status != http.StatusAccepted {
+				return
+			}
+			sent, err := a.Store.Get(context.Background(), "alice@example.com", resp.SentID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p, err := message.ParseHeader(sent.Raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := p.Header.Get("In-Reply-To"); got != tt.inReplyTo {
+				t.Errorf("In-Reply-To = %q, want %q", got, tt.inReplyTo)
+			}
+			if got := p.Header.Get("References"); got != tt.references {
+				t.Errorf("References = %q, want %q", got, tt.references)
+			}
+		})
+	}
+
+	msg, err := a.Store.Get(context.Background(), "alice@example.com", parent.ID)
+	if err != nil || !msg.HasFlag(store.FlagAnswered) {
+		t.Errorf("parent flags = %v, %v, want \\Answered", msg.Flags, err)
+	}
+}
+
+func TestSendTemplateLocale(t *testing.T) {
+	a := newTestAPI(t, nil)
+	tpl := &templates.Template{ID: "welcome", DefaultLocale: "en", Variants: []templates.Variant{
+		{Locale: "en", Subject: "Welcome {{.name}}", Text: "Hello"},
+		{Locale: "zh-CN", Subject: "欢迎 {{.name}}", Text: "你好"},
+	}}
+	if err := tpl.Normalize(); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Templates.Create(context.Background(), tpl); err != nil {
+		t.Fatal(err)
+	}
+
+	const bobVars = `"variables":{"name":"Bob"}`
+	tests := []struct {
+		name           string
+		ref            string
+		acceptLanguage string
+		status         int
+		subject        string
+	}{
+		{"locale", `"locale":"zh",` + bobVars, "", http.StatusAccepted, "欢迎 Bob"},
+		{"Accept-Language", bobVars, "fr-FR, zh-CN;q=0.8", http.StatusAccepted, "欢迎 Bob"},
+		{"locale over Accept-Language", `"locale":"en-GB",` + bobVars, "zh-CN", http.StatusAccepted, "Welcome Bob"},
+		{"default locale", `"locale":"de",` + bobVars, "", http.StatusAccepted, "Welcome Bob"},
+		{"missing variable", `"variables":{}`, "", http.StatusUnprocessableEntity, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp SendResponse
+			decode(t, a.do(t, alice, http.MethodPost, "/messages/send", `{"to":["bob@example.com"],"template":{"id":"welcome",`+tt.ref+`}}`,
+				"Accept-Language", tt.acceptLanguage), tt.status, &resp)
+			if tt.status != http.StatusAccepted {
+				return
+			}
+			sent, err := a.Store.Get(context.Background(), "alice@example.com", resp.SentID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p, err := message.ParseHeader(sent.Raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Subject != tt.subject {
+				t.Errorf("subject = %q, want %q", p.Subject, tt.subject)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"YoPost/internal/api/rest"
+	"YoPost/internal/auth"
+	"YoPost/internal/mail/queue"
+)
+
+// API exposes the outbound queue
+type API struct {
+	Queue queue.Queue
+}
+
+// FlushResponse defines the response structure for queue flushes
+type FlushResponse struct {
+	Rescheduled int `json:"rescheduled"`
+}
+
+// Routes registers the queue endpoints on r
+func (a *API) Routes(r *rest.Router) {
+	admin := string(auth.RoleSuperAdmin)
+	r.GET("/queue", a.list).Require(admin).
+		Paged("owner", "from").
+		Response(http.StatusOK, rest.List[*queue.Item]{}).
+		Describe("List queued messages, oldest first")
+	r.GET("/queue/{id}", a.get).Require(admin).Response(http.StatusOK, queue.Item{}).Describe("Get a queued message")
+	r.DELETE("/queue/{id}", a.delete).Require(admin).Response(http.StatusNoContent, nil).Describe("Remove a message from the queue")
+	r.POST("/queue/flush", a.flush).Require(admin).Response(http.StatusOK, FlushResponse{}).Describe("Retry all queued messages now")
+}
+
+// itemKey orders items by creation time as ascending cursor keys
+func itemKey(item *queue.Item) string {
+	return fmt.Sprintf("%019d|%s", item.CreatedAt.UnixNano(), item.ID)
+}
+
+// list handles GET /api/v1/queue?owner=&from=&limit=&cursor=
+func (a *API) list(w http.ResponseWriter, r *http.Request) error {
+	p, err := rest.ParseList(r, "owner", "from")
+	if err != nil {
+		return err
+	}
+	items, err := a.Queue.List(r.Context())
+	if err != nil {
+		return err
+	}
+
+	matched := items[:0]
+	for _, item := range items {
+		if v, ok := p.Filters["owner"]; ok && item.Owner != v {
+			continue
+		}
+		if v, ok := p.Filters["from"]; ok && item.From != v {
+			continue
+		}
+		matched = append(matched, item)
+	}
+	sort.Slice(matched, func(i, j int) bool { return itemKey(matched[i]) < itemKey(matched[j]) })
+	return rest.JSON(w, http.StatusOK, rest.Paginate(matched, p, itemKey))
+}
+
+func (a *API) get(w http.ResponseWriter, r *http.Request) error {
+	item, err := a.Queue.Get(r.Context(), r.PathValue("id"))
+	if errors.Is(err, queue.ErrNotFound) {
+		return rest.NotFound("queued message %s not found", r.PathValue("id"))
+	}
+	if err != nil {
+		return err
+	}
+	return rest.JSON(w, http.StatusOK, item)
+}
+
+func (a *API) delete(w http.ResponseWriter, r *http.Request) error {
+	id := r.PathValue("id")
+	err := a.Queue.Delete(r.Context(), id)
+	if errors.Is(err, queue.ErrNotFound) {
+		return rest.NotFound("queued message %s not found", id)
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("INFO: Removed message %s from the outbound queue", id)
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (a *API) flush(w http.ResponseWriter, r *http.Request) error {
+	n, err := a.Queue.Reschedule(r.Context(), time.Now())
+	if err != nil {
+		return err
+	}
+	log.Printf("INFO: Rescheduled %d queued messages", n)
+	return rest.JSON(w, http.StatusOK, FlushResponse{Rescheduled: n})
+}
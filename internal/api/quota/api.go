@@ -0,0 +1,197 @@
+package quota
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"YoPost/internal/api/rest"
+	"YoPost/internal/auth"
+	"YoPost/internal/quota"
+)
+
+// API exposes quota usage and limit management endpoints
+type API struct {
+	Manager *quota.Manager
+}
+
+// SetLimitsRequest defines the request structure for setting quota limits
+type SetLimitsRequest struct {
+	Address  string `json:"address,omitempty"`
+	Domain   string `json:"domain,omitempty"`
+	Bytes    int64  `json:"bytes"`
+	Messages int64  `json:"messages"`
+}
+
+// UsageResponse defines the response structure for quota usage
+type UsageResponse struct {
+	User    *quota.Status `json:"user,omitempty"`
+	Domain  *quota.Status `json:"domain,omitempty"`
+	Percent int           `json:"percent"`
+}
+
+// Register registers the quota routes on mux
+func (a *API) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/api/quota/user", a.UserHandler)
+	mux.HandleFunc("/api/quota/domain", a.DomainHandler)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// UserHandler returns (GET ?address=) or sets (PUT) the quota of a mailbox
+func (a *API) UserHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		address := r.URL.Query().Get("address")
+		if address == "" {
+			http.Error(w, "address is required", http.StatusBadRequest)
+			return
+		}
+		log.Printf("INFO: Handling quota usage request for %s", address)
+		st, err := a.Manager.User(r.Context(), address)
+		if err != nil {
+			log.Printf("ERROR: Failed to load quota for %s - %v", address, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, UsageResponse{User: &st, Percent: st.Percent()})
+
+	case http.MethodPut, http.MethodPost:
+		var req SetLimitsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Address == "" {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		log.Printf("INFO: Setting quota for %s - bytes: %d, messages: %d", req.Address, req.Bytes, req.Messages)
+		if err := a.Manager.SetUserLimits(r.Context(), req.Address, quota.Limits{Bytes: req.Bytes, Messages: req.Messages}); err != nil {
+			log.Printf("ERROR: Failed to set quota for %s - %v", req.Address, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		st, _ := a.Manager.User(r.Context(), req.Address)
+		writeJSON(w, http.StatusOK, UsageResponse{User: &st, Percent: st.Percent()})
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// DomainHandler returns (GET ?domain=) or sets (PUT) the quota of a domain
+func (a *API) DomainHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		domain := r.URL.Query().Get("domain")
+		if domain == "" {
+			http.Error(w, "domain is required", http.StatusBadRequest)
+			return
+		}
+		log.Printf("INFO: Handling quota usage request for domain %s", domain)
+		st, err := a.Manager.Domain(r.Context(), domain)
+		if err != nil {
+			log.Printf("ERROR: Failed to load quota for domain %s - %v", domain, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, UsageResponse{Domain: &st, Percent: st.Percent()})
+
+	case http.MethodPut, http.MethodPost:
+		var req SetLimitsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Domain == "" {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		log.Printf("INFO: Setting quota for domain %s - bytes: %d, messages: %d", req.Domain, req.Bytes, req.Messages)
+		if err := a.Manager.SetDomainLimits(r.Context(), req.Domain, quota.Limits{Bytes: req.Bytes, Messages: req.Messages}); err != nil {
+			log.Printf("ERROR: Failed to set quota for domain %s - %v", req.Domain, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		st, _ := a.Manager.Domain(r.Context(), req.Domain)
+		writeJSON(w, http.StatusOK, UsageResponse{Domain: &st, Percent: st.Percent()})
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// LimitsRequest defines the request body of the versioned quota endpoints
+type LimitsRequest struct {
+	Bytes    int64 `json:"bytes"`
+	Messages int64 `json:"messages"`
+}
+
+// Routes registers the versioned quota endpoints on r
+func (a *API) Routes(r *rest.Router) {
+	r.GET("/quota/users/{address}", a.getUser).Response(http.StatusOK, UsageResponse{}).Describe("Get mailbox quota usage")
+	r.PUT("/quota/users/{address}", a.putUser).Require(string(auth.RoleDomainAdmin)).
+		Request(LimitsRequest{}).
+		Response(http.StatusOK, UsageResponse{}).
+		Describe("Set mailbox quota limits")
+	r.GET("/quota/domains/{domain}", a.getDomain).Require(string(auth.RoleDomainAdmin)).
+		Response(http.StatusOK, UsageResponse{}).
+		Describe("Get domain quota usage")
+	r.PUT("/quota/domains/{domain}", a.putDomain).Require(string(auth.RoleSuperAdmin)).
+		Request(LimitsRequest{}).
+		Response(http.StatusOK, UsageResponse{}).
+		Describe("Set domain quota limits")
+}
+
+func decodeLimits(r *http.Request) (quota.Limits, error) {
+	var req LimitsRequest
+	if err := rest.Decode(r, &req); err != nil {
+		return quota.Limits{}, err
+	}
+	if req.Bytes < 0 {
+		return quota.Limits{}, rest.InvalidParameter("bytes", "bytes must not be negative")
+	}
+	if req.Messages < 0 {
+		return quota.Limits{}, rest.InvalidParameter("messages", "messages must not be negative")
+	}
+	return quota.Limits{Bytes: req.Bytes, Messages: req.Messages}, nil
+}
+
+func (a *API) getUser(w http.ResponseWriter, r *http.Request) error {
+	st, err := a.Manager.User(r.Context(), r.PathValue("address"))
+	if err != nil {
+		return err
+	}
+	return rest.JSON(w, http.StatusOK, UsageResponse{User: &st, Percent: st.Percent()})
+}
+
+func (a *API) putUser(w http.ResponseWriter, r *http.Request) error {
+	limits, err := decodeLimits(r)
+	if err != nil {
+		return err
+	}
+	address := r.PathValue("address")
+	log.Printf("INFO: Setting quota for %s - bytes: %d, messages: %d", address, limits.Bytes, limits.Messages)
+	if err := a.Manager.SetUserLimits(r.Context(), address, limits); err != nil {
+		return err
+	}
+	return a.getUser(w, r)
+}
+
+func (a *API) getDomain(w http.ResponseWriter, r *http.Request) error {
+	st, err := a.Manager.Domain(r.Context(), r.PathValue("domain"))
+	if err != nil {
+		return err
+	}
+	return rest.JSON(w, http.StatusOK, UsageResponse{Domain: &st, Percent: st.Percent()})
+}
+
+func (a *API) putDomain(w http.ResponseWriter, r *http.Request) error {
+	limits, err := decodeLimits(r)
+	if err != nil {
+		return err
+	}
+	domain := r.PathValue("domain")
+	log.Printf("INFO: Setting quota for domain %s - bytes: %d, messages: %d", domain, limits.Bytes, limits.Messages)
+	if err := a.Manager.SetDomainLimits(r.Context(), domain, limits); err != nil {
+		return err
+	}
+	return a.getDomain(w, r)
+}
@@ -0,0 +1,125 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Error codes; clients should branch on the code, never on the message
+const (
+	CodeBadRequest           = "bad_request"
+	CodeInvalidJSON          = "invalid_json"
+	CodeInvalidParameter     = "invalid_parameter"
+	CodeUnauthorized         = "unauthorized"
+	CodeForbidden            = "forbidden"
+	CodeNotFound             = "not_found"
+	CodeMethodNotAllowed     = "method_not_allowed"
+	CodeConflict             = "conflict"
+	CodePayloadTooLarge      = "payload_too_large"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodeUnprocessable        = "unprocessable_entity"
+	CodeRateLimited          = "rate_limited"
+	CodeInternal             = "internal_error"
+)
+
+// Error is an API error; handlers return it to control the status code and error object
+type Error struct {
+	Status  int         `json:"-"`
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+	// retryAfter is sent as the Retry-After header when set
+	retryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.Status, e.Code, e.Message)
+}
+
+// Errorf creates an API error
+func Errorf(status int, code, format string, args ...interface{}) *Error {
+	return &Error{Status: status, Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// BadRequest returns a 400 bad_request error
+func BadRequest(format string, args ...interface{}) *Error {
+	return Errorf(http.StatusBadRequest, CodeBadRequest, format, args...)
+}
+
+// InvalidParameter returns a 400 invalid_parameter error naming the offending parameter
+func InvalidParameter(name, format string, args ...interface{}) *Error {
+	e := Errorf(http.StatusBadRequest, CodeInvalidParameter, format, args...)
+	e.Details = map[string]string{"parameter": name}
+	return e
+}
+
+// NotFound returns a 404 not_found error
+func NotFound(format string, args ...interface{}) *Error {
+	return Errorf(http.StatusNotFound, CodeNotFound, format, args...)
+}
+
+// Conflict returns a 409 conflict error
+func Conflict(format string, args ...interface{}) *Error {
+	return Errorf(http.StatusConflict, CodeConflict, format, args...)
+}
+
+// RateLimited returns a 429 rate_limited error; the response carries a
+// Retry-After header and details.retry_after, both in whole seconds
+func RateLimited(retryAfter time.Duration, format string, args ...interface{}) *Error {
+	e := Errorf(http.StatusTooManyRequests, CodeRateLimited, format, args...)
+	e.retryAfter = retryAfter
+	e.Details = map[string]int{"retry_after": retrySeconds(retryAfter)}
+	return e
+}
+
+// retrySeconds rounds d up to whole seconds, at least 1
+func retrySeconds(d time.Duration) int {
+	s := int((d + time.Second - 1) / time.Second)
+	if s < 1 {
+		s = 1
+	}
+	return s
+}
+
+// errorEnvelope is the body of every error response
+type errorEnvelope struct {
+	Error struct {
+		*Error
+		RequestID string `json:"request_id"`
+	} `json:"error"`
+}
+
+// WriteError writes err as an error envelope. Errors that are not *Error are
+// logged and reported as 500 without exposing their text to the client
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	var e *Error
+	if !errors.As(err, &e) {
+		logf(r, "ERROR: %s %s failed - %v", r.Method, r.URL.Path, err)
+		e = Errorf(http.StatusInternalServerError, CodeInternal, "internal server error")
+	} else if e.Status >= 500 {
+		logf(r, "ERROR: %s %s failed - %v", r.Method, r.URL.Path, e)
+	}
+
+	if e.retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(retrySeconds(e.retryAfter)))
+	}
+
+	var env errorEnvelope
+	env.Error.Error = e
+	env.Error.RequestID = RequestID(r.Context())
+	JSON(w, e.Status, env)
+}
+
+// JSON writes v as a JSON response
+func JSON(w http.ResponseWriter, status int, v interface{}) error {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if v == nil {
+		return nil
+	}
+	return json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,393 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OpenAPIVersion is the OpenAPI version of generated documents
+const OpenAPIVersion = "3.1.0"
+
+// Raw documents a response body that is not JSON by its media type,
+// e.g. Response(http.StatusOK, Raw("message/rfc822"))
+type Raw string
+
+// File is a file part of a multipart/form-data request body
+type File []byte
+
+type response struct {
+	status int
+	body   interface{}
+}
+
+// Request documents the request body of the route with a value of its type,
+// one per media type in the order given to Consumes; multipart/form-data
+// bodies are documented with a struct whose fields are the form fields
+func (rt *Route) Request(bodies ...interface{}) *Route {
+	rt.requests = bodies
+	return rt
+}
+
+// Response documents a response of the route with a value of the body type;
+// nil means the response has no body
+func (rt *Route) Response(status int, body interface{}) *Route {
+	rt.responses = append(rt.responses, response{status, body})
+	return rt
+}
+
+// Query documents optional query parameters of the route
+func (rt *Route) Query(names ...string) *Route {
+	rt.query = append(rt.query, names...)
+	return rt
+}
+
+// Paged documents a list endpoint read with ParseList: the limit and cursor
+// parameters and the accepted filters
+func (rt *Route) Paged(filters ...string) *Route {
+	rt.paged = true
+	return rt.Query(filters...)
+}
+
+// Document is an OpenAPI document
+type Document struct {
+	OpenAPI    string                           `json:"openapi"`
+	Info       Info                             `json:"info"`
+	Servers    []Server                         `json:"servers"`
+	Security   []map[string][]string            `json:"security"`
+	Paths      map[string]map[string]*Operation `json:"paths"`
+	Components Components                       `json:"components"`
+}
+
+// Info describes the API
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// Server is the base URL of the paths
+type Server struct {
+	URL string `json:"url"`
+}
+
+// Components holds the schemas referenced by operations
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes"`
+}
+
+// SecurityScheme describes how callers authenticate
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	In           string `json:"in,omitempty"`
+	Name         string `json:"name,omitempty"`
+	Description  string `json:"description,omitempty"`
+}
+
+// Operation is a documented route
+type Operation struct {
+	OperationID string               `json:"operationId"`
+	Summary     string               `json:"summary,omitempty"`
+	Tags        []string             `json:"tags"`
+	Parameters  []*Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+	// Security is empty for public routes and omitted otherwise
+	Security *[]map[string][]string `json:"security,omitempty"`
+	// Access is the permission required to call the route
+	Access string `json:"x-yopost-access,omitempty"`
+}
+
+// Parameter is a path or query parameter
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required,omitempty"`
+	Schema   *Schema `json:"schema"`
+}
+
+// RequestBody is the request body of an operation by media type
+type RequestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+// Response is a response of an operation
+type Response struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+// MediaType holds the schema of a body
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Schema is a JSON Schema; the zero value accepts any JSON value
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	ContentEncoding      string             `json:"contentEncoding,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Minimum              *int               `json:"minimum,omitempty"`
+	Maximum              *int               `json:"maximum,omitempty"`
+	Default              interface{}        `json:"default,omitempty"`
+}
+
+// errorSchema is the component name of the error envelope
+const errorSchema = "Error"
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	rawJSONType = reflect.TypeOf(json.RawMessage{})
+	fileType    = reflect.TypeOf(File{})
+	// internalPrefix is stripped from package paths in schema names, so
+	// YoPost/internal/api/auth.KeyResponse becomes api.auth.KeyResponse
+	internalPrefix = strings.TrimSuffix(reflect.TypeOf(Route{}).PkgPath(), "api/rest")
+	invalidName    = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+)
+
+// schemas derives JSON Schemas from Go types the way encoding/json encodes them
+type schemas struct {
+	defs  map[string]*Schema
+	names map[reflect.Type]string
+}
+
+func schemaName(t reflect.Type) string {
+	name := strings.ReplaceAll(t.PkgPath()+"."+t.Name(), internalPrefix, "")
+	name = strings.ReplaceAll(strings.TrimSuffix(name, "]"), "/", ".")
+	return invalidName.ReplaceAllString(name, "_")
+}
+
+func (s *schemas) of(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case rawJSONType:
+		return &Schema{}
+	case fileType:
+		return &Schema{Type: "string", Format: "binary"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", ContentEncoding: "base64"}
+		}
+		return &Schema{Type: "array", Items: s.of(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: s.of(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t)
+		}
+		name, ok := s.names[t]
+		if !ok {
+			name = schemaName(t)
+			s.names[t] = name
+			// registered before the fields so recursive types terminate
+			s.defs[name] = &Schema{}
+			*s.defs[name] = *s.object(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + name}
+	}
+	return &Schema{}
+}
+
+// object lists the JSON fields of a struct; fields of embedded structs are
+// promoted unless a shallower field has the same name
+func (s *schemas) object(t reflect.Type) *Schema {
+	obj := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	var embedded []reflect.Type
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		ft := f.Type
+		for ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			embedded = append(embedded, ft)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		obj.Properties[name] = s.of(f.Type)
+	}
+	for _, et := range embedded {
+		for name, prop := range s.object(et).Properties {
+			if _, ok := obj.Properties[name]; !ok {
+				obj.Properties[name] = prop
+			}
+		}
+	}
+	return obj
+}
+
+func (s *schemas) body(v interface{}) map[string]*MediaType {
+	if raw, ok := v.(Raw); ok {
+		return map[string]*MediaType{string(raw): {Schema: &Schema{Type: "string", Format: "binary"}}}
+	}
+	return map[string]*MediaType{"application/json": {Schema: s.of(reflect.TypeOf(v))}}
+}
+
+// operationID derives an identifier from the method and pattern, e.g.
+// GET /webhooks/{id}/deliveries is getWebhooksByIdDeliveries
+func operationID(method, pattern string) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(method))
+	for _, seg := range splitPath(pattern) {
+		if strings.HasPrefix(seg, "{") {
+			b.WriteString("By")
+			seg = strings.Trim(seg, "{}")
+		}
+		for _, word := range strings.FieldsFunc(seg, func(c rune) bool { return c == '-' || c == '_' || c == '.' }) {
+			b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+		}
+	}
+	return b.String()
+}
+
+// OpenAPI documents the registered routes. public is the Access value of
+// routes that do not require authentication
+func (rt *Router) OpenAPI(info Info, public string) *Document {
+	s := &schemas{defs: make(map[string]*Schema), names: make(map[reflect.Type]string)}
+	s.defs[errorSchema] = s.object(reflect.TypeOf(errorEnvelope{}))
+	errorResponse := &Response{
+		Description: "Error",
+		Content:     map[string]*MediaType{"application/json": {Schema: &Schema{Ref: "#/components/schemas/" + errorSchema}}},
+	}
+
+	doc := &Document{
+		OpenAPI:  OpenAPIVersion,
+		Info:     info,
+		Servers:  []Server{{URL: rt.prefix}},
+		Security: []map[string][]string{{"bearerAuth": {}}, {"apiKey": {}}},
+		Paths:    make(map[string]map[string]*Operation),
+		Components: Components{
+			Schemas: s.defs,
+			SecuritySchemes: map[string]*SecurityScheme{
+				"bearerAuth": {Type: "http", Scheme: "bearer", Description: "Access token from /auth/login or an API key"},
+				"apiKey":     {Type: "apiKey", In: "header", Name: "X-API-Key", Description: "API key"},
+			},
+		},
+	}
+	for _, route := range rt.routes {
+		op := &Operation{
+			OperationID: operationID(route.Method, route.Pattern),
+			Summary:     route.Summary,
+			Tags:        []string{strings.TrimSuffix(route.segments[0], path.Ext(route.segments[0]))},
+			Responses:   map[string]*Response{"default": errorResponse},
+			Access:      route.Access,
+		}
+		if route.Access == public {
+			op.Security = &[]map[string][]string{}
+		}
+		for _, seg := range route.segments {
+			if strings.HasPrefix(seg, "{") {
+				op.Parameters = append(op.Parameters, &Parameter{Name: strings.Trim(seg, "{}"), In: "path", Required: true, Schema: &Schema{Type: "string"}})
+			}
+		}
+		if route.paged {
+			min, max := 1, MaxLimit
+			op.Parameters = append(op.Parameters,
+				&Parameter{Name: "limit", In: "query", Schema: &Schema{Type: "integer", Minimum: &min, Maximum: &max, Default: DefaultLimit}},
+				&Parameter{Name: "cursor", In: "query", Schema: &Schema{Type: "string"}})
+		}
+		for _, name := range route.query {
+			op.Parameters = append(op.Parameters, &Parameter{Name: name, In: "query", Schema: &Schema{Type: "string"}})
+		}
+		for i, body := range route.requests {
+			if i >= len(route.consumes) {
+				break
+			}
+			if op.RequestBody == nil {
+				op.RequestBody = &RequestBody{Required: true, Content: make(map[string]*MediaType)}
+			}
+			op.RequestBody.Content[route.consumes[i]] = &MediaType{Schema: s.of(reflect.TypeOf(body))}
+		}
+		for _, resp := range route.responses {
+			r := &Response{Description: http.StatusText(resp.status)}
+			if resp.body != nil {
+				r.Content = s.body(resp.body)
+			}
+			op.Responses[strconv.Itoa(resp.status)] = r
+		}
+
+		p := "/" + strings.Join(route.segments, "/")
+		if doc.Paths[p] == nil {
+			doc.Paths[p] = make(map[string]*Operation)
+		}
+		doc.Paths[p][strings.ToLower(route.Method)] = op
+	}
+	return doc
+}
+
+// CheckDocs lists routes whose documentation is incomplete: every route must
+// document at least one response and at most one request body per media type
+func (rt *Router) CheckDocs() []string {
+	var problems []string
+	for _, route := range rt.routes {
+		name := route.Method + " " + rt.prefix + route.Pattern
+		if len(route.responses) == 0 {
+			problems = append(problems, fmt.Sprintf("%s: no documented response", name))
+		}
+		if len(route.requests) > len(route.consumes) {
+			problems = append(problems, fmt.Sprintf("%s: %d request bodies documented for %d media types", name, len(route.requests), len(route.consumes)))
+		}
+		if len(route.requests) > 0 && route.Method == http.MethodGet {
+			problems = append(problems, fmt.Sprintf("%s: GET request with a body", name))
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+// Marshal encodes the document as indented JSON ending with a newline
+func (doc *Document) Marshal() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,88 @@
+package rest
+
+import (
+	"encoding/base64"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Default and maximum page sizes of list endpoints
+const (
+	DefaultLimit = 50
+	MaxLimit     = 200
+)
+
+// ListParams holds the common query parameters of list endpoints
+//
+//	limit   page size, 1..MaxLimit, default DefaultLimit
+//	cursor  next_cursor of the previous page, an opaque string
+//	other   equality filters; only fields declared by the endpoint are
+//	        accepted, unknown parameters yield 400
+type ListParams struct {
+	Limit   int
+	Cursor  string // decoded cursor: sort key of the last item of the previous page
+	Filters map[string]string
+}
+
+// List is a page of a list response; an empty next_cursor means no more data
+type List[T any] struct {
+	Data       []T    `json:"data"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// EncodeCursor encodes a sort key as a cursor
+func EncodeCursor(key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(key))
+}
+
+// ParseList parses list query parameters; filters are the accepted filter fields
+func ParseList(r *http.Request, filters ...string) (ListParams, error) {
+	p := ListParams{Limit: DefaultLimit, Filters: make(map[string]string)}
+	for name, values := range r.URL.Query() {
+		value := values[0]
+		switch name {
+		case "limit":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > MaxLimit {
+				return p, InvalidParameter("limit", "limit must be between 1 and %d", MaxLimit)
+			}
+			p.Limit = n
+		case "cursor":
+			key, err := base64.RawURLEncoding.DecodeString(value)
+			if err != nil {
+				return p, InvalidParameter("cursor", "invalid cursor")
+			}
+			p.Cursor = string(key)
+		default:
+			if !contains(filters, name) {
+				allowed := "none"
+				if len(filters) > 0 {
+					allowed = strings.Join(filters, ", ")
+				}
+				return p, InvalidParameter(name, "unknown parameter %q (filters: %s)", name, allowed)
+			}
+			p.Filters[name] = value
+		}
+	}
+	return p, nil
+}
+
+// Paginate returns the page after the cursor from items sorted ascending by key
+func Paginate[T any](items []T, p ListParams, key func(T) string) List[T] {
+	start := 0
+	if p.Cursor != "" {
+		start = sort.Search(len(items), func(i int) bool { return key(items[i]) > p.Cursor })
+	}
+	end := start + p.Limit
+	if end > len(items) {
+		end = len(items)
+	}
+
+	page := List[T]{Data: append([]T{}, items[start:end]...)}
+	if end < len(items) && end > start {
+		page.NextCursor = EncodeCursor(key(items[end-1]))
+	}
+	return page
+}
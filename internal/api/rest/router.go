@@ -0,0 +1,315 @@
+// Package rest provides the router, error envelope, request validation and
+// pagination conventions shared by the versioned /api/v1 endpoints
+package rest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// HandlerFunc handles a request; a returned error is written by the Router as an error envelope
+type HandlerFunc func(w http.ResponseWriter, r *http.Request) error
+
+// Middleware wraps a HandlerFunc
+type Middleware func(next HandlerFunc) HandlerFunc
+
+// Route is a single registered endpoint
+type Route struct {
+	Method  string
+	Pattern string
+	// Summary is a one-line description of the endpoint
+	Summary string
+	// Access is the permission required to call the route; it is interpreted
+	// by the authentication middleware, empty means any authenticated caller
+	Access string
+
+	segments []string
+	handler  HandlerFunc
+	consumes []string
+	maxBody  int64
+
+	// documentation, see openapi.go
+	requests  []interface{}
+	responses []response
+	query     []string
+	paged     bool
+}
+
+// Consumes sets the accepted request media types (default application/json)
+func (rt *Route) Consumes(types ...string) *Route {
+	rt.consumes = types
+	return rt
+}
+
+// MaxBody overrides the request body size limit for this route
+func (rt *Route) MaxBody(n int64) *Route {
+	rt.maxBody = n
+	return rt
+}
+
+// Require sets the permission required to call the route
+func (rt *Route) Require(access string) *Route {
+	rt.Access = access
+	return rt
+}
+
+// Describe sets the route summary
+func (rt *Route) Describe(summary string) *Route {
+	rt.Summary = summary
+	return rt
+}
+
+// match matches path segments and returns the path parameters
+func (rt *Route) match(segments []string) (map[string]string, bool) {
+	if len(segments) != len(rt.segments) {
+		return nil, false
+	}
+	var params map[string]string
+	for i, s := range rt.segments {
+		if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") {
+			if segments[i] == "" {
+				return nil, false
+			}
+			if params == nil {
+				params = make(map[string]string)
+			}
+			params[s[1:len(s)-1]] = segments[i]
+			continue
+		}
+		if s != segments[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// Router routes requests of a versioned API
+//
+// Handlers read path parameters with r.PathValue and return *Error to control
+// the error response. Unknown paths get 404, unsupported methods get 405 with
+// an Allow header
+type Router struct {
+	prefix       string
+	maxBodyBytes int64
+	routes       []*Route
+	middleware   []Middleware
+}
+
+// NewRouter creates a router mounted at prefix (e.g. /api/v1) with a default
+// request body limit of maxBodyBytes
+func NewRouter(prefix string, maxBodyBytes int64) *Router {
+	return &Router{prefix: strings.TrimSuffix(prefix, "/"), maxBodyBytes: maxBodyBytes}
+}
+
+// Prefix returns the mount prefix
+func (rt *Router) Prefix() string {
+	return rt.prefix
+}
+
+// Use adds middleware applied to every route; earlier middleware runs first
+func (rt *Router) Use(mw ...Middleware) {
+	rt.middleware = append(rt.middleware, mw...)
+}
+
+func splitPath(p string) []string {
+	return strings.Split(strings.Trim(p, "/"), "/")
+}
+
+// Handle registers a route; pattern is relative to the prefix and path
+// parameters are written as {name}
+func (rt *Router) Handle(method, pattern string, h HandlerFunc) *Route {
+	route := &Route{
+		Method:   method,
+		Pattern:  pattern,
+		segments: splitPath(pattern),
+		handler:  h,
+		consumes: []string{"application/json"},
+	}
+	rt.routes = append(rt.routes, route)
+	return route
+}
+
+func (rt *Router) GET(pattern string, h HandlerFunc) *Route {
+	return rt.Handle(http.MethodGet, pattern, h)
+}
+
+func (rt *Router) POST(pattern string, h HandlerFunc) *Route {
+	return rt.Handle(http.MethodPost, pattern, h)
+}
+
+func (rt *Router) PUT(pattern string, h HandlerFunc) *Route {
+	return rt.Handle(http.MethodPut, pattern, h)
+}
+
+func (rt *Router) PATCH(pattern string, h HandlerFunc) *Route {
+	return rt.Handle(http.MethodPatch, pattern, h)
+}
+
+func (rt *Router) DELETE(pattern string, h HandlerFunc) *Route {
+	return rt.Handle(http.MethodDelete, pattern, h)
+}
+
+// Routes returns all registered routes
+func (rt *Router) Routes() []*Route {
+	return append([]*Route(nil), rt.routes...)
+}
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	routeKey
+)
+
+// RequestID returns the ID of the current request
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// CurrentRoute returns the route matched by the current request
+func CurrentRoute(ctx context.Context) *Route {
+	route, _ := ctx.Value(routeKey).(*Route)
+	return route
+}
+
+func logf(r *http.Request, format string, args ...interface{}) {
+	log.Printf(format+" (request %s)", append(args, RequestID(r.Context()))...)
+}
+
+// requestID reuses a well-formed client X-Request-ID or generates a new one
+func requestID(r *http.Request) string {
+	id := r.Header.Get("X-Request-ID")
+	if id != "" && len(id) <= 128 && !strings.ContainsFunc(id, func(c rune) bool { return c <= ' ' || c > '~' }) {
+		return id
+	}
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func hasBody(r *http.Request) bool {
+	return r.ContentLength > 0 || (r.ContentLength < 0 && r.Body != nil && r.Body != http.NoBody)
+}
+
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := requestID(r)
+	w.Header().Set("X-Request-ID", id)
+	r = r.WithContext(context.WithValue(r.Context(), requestIDKey, id))
+
+	defer func() {
+		if v := recover(); v != nil {
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			logf(r, "ERROR: panic serving %s %s - %v", r.Method, r.URL.Path, v)
+			WriteError(w, r, Errorf(http.StatusInternalServerError, CodeInternal, "internal server error"))
+		}
+	}()
+
+	if err := rt.serve(w, r); err != nil {
+		WriteError(w, r, err)
+	}
+}
+
+func (rt *Router) serve(w http.ResponseWriter, r *http.Request) error {
+	path := r.URL.Path
+	if path != rt.prefix && !strings.HasPrefix(path, rt.prefix+"/") {
+		return NotFound("no route for %s", path)
+	}
+	segments := splitPath(strings.TrimPrefix(path, rt.prefix))
+
+	var route *Route
+	var params map[string]string
+	var allowed []string
+	for _, candidate := range rt.routes {
+		p, ok := candidate.match(segments)
+		if !ok {
+			continue
+		}
+		if candidate.Method == r.Method {
+			route, params = candidate, p
+			break
+		}
+		allowed = append(allowed, candidate.Method)
+	}
+	if route == nil {
+		if len(allowed) == 0 {
+			return NotFound("no route for %s", path)
+		}
+		sort.Strings(allowed)
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		return Errorf(http.StatusMethodNotAllowed, CodeMethodNotAllowed, "method %s not allowed, use %s", r.Method, strings.Join(allowed, ", "))
+	}
+	for k, v := range params {
+		r.SetPathValue(k, v)
+	}
+
+	if hasBody(r) {
+		mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil || !contains(route.consumes, mediaType) {
+			return Errorf(http.StatusUnsupportedMediaType, CodeUnsupportedMediaType,
+				"Content-Type must be %s", strings.Join(route.consumes, " or "))
+		}
+		limit := rt.maxBodyBytes
+		if route.maxBody > 0 {
+			limit = route.maxBody
+		}
+		if limit > 0 {
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+		}
+	}
+
+	r = r.WithContext(context.WithValue(r.Context(), routeKey, route))
+	h := route.handler
+	for i := len(rt.middleware) - 1; i >= 0; i-- {
+		h = rt.middleware[i](h)
+	}
+	return h(w, r)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Decode parses a JSON request body into v, rejecting unknown fields;
+// bodies over the size limit yield 413
+func Decode(r *http.Request, v interface{}) error {
+	return DecodeReader(r.Body, v)
+}
+
+// DecodeReader is Decode for JSON read from body, e.g. a multipart form field
+func DecodeReader(body io.Reader, v interface{}) error {
+	dec := json.NewDecoder(body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(v)
+	if err == nil {
+		if dec.More() {
+			return Errorf(http.StatusBadRequest, CodeInvalidJSON, "request body must contain a single JSON object")
+		}
+		return nil
+	}
+
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return Errorf(http.StatusRequestEntityTooLarge, CodePayloadTooLarge, "request body exceeds %d bytes", tooLarge.Limit)
+	}
+	if errors.Is(err, io.EOF) {
+		return Errorf(http.StatusBadRequest, CodeInvalidJSON, "request body is empty")
+	}
+	return Errorf(http.StatusBadRequest, CodeInvalidJSON, "invalid JSON: %v", err)
+}
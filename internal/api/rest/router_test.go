@@ -0,0 +1,130 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// testRouter registers a small resource with a JSON body and a raw upload route
+func testRouter() *Router {
+	rt := NewRouter("/api/v1", 64)
+	type item struct {
+		Name string `json:"name"`
+	}
+	rt.GET("/items/{id}", func(w http.ResponseWriter, r *http.Request) error {
+		return JSON(w, http.StatusOK, item{Name: r.PathValue("id")})
+	})
+	rt.PUT("/items/{id}", func(w http.ResponseWriter, r *http.Request) error {
+		var req item
+		if err := Decode(r, &req); err != nil {
+			return err
+		}
+		return JSON(w, http.StatusOK, req)
+	})
+	rt.POST("/uploads", func(w http.ResponseWriter, r *http.Request) error {
+		var req item
+		if err := Decode(r, &req); err != nil {
+			return err
+		}
+		return JSON(w, http.StatusCreated, req)
+	}).MaxBody(1024)
+	rt.GET("/panic", func(w http.ResponseWriter, r *http.Request) error {
+		panic("boom")
+	})
+	return rt
+}
+
+func TestRouter(t *testing.T) {
+	rt := testRouter()
+	long := `{"name":"` + strings.Repeat("x", 100) + `"}`
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		body        string
+		status      int
+		code        string
+		allow       string
+	}{
+		{"get", http.MethodGet, "/api/v1/items/42", "", "", http.StatusOK, "", ""},
+		{"put", http.MethodPut, "/api/v1/items/42", "application/json", `{"name":"a"}`, http.StatusOK, "", ""},
+		{"outside prefix", http.MethodGet, "/api/v2/items/42", "", "", http.StatusNotFound, CodeNotFound, ""},
+		{"unknown path", http.MethodGet, "/api/v1/things", "", "", http.StatusNotFound, CodeNotFound, ""},
+		{"empty path parameter", http.MethodGet, "/api/v1/items/", "", "", http.StatusNotFound, CodeNotFound, ""},
+		{"method not allowed", http.MethodDelete, "/api/v1/items/42", "", "", http.StatusMethodNotAllowed, CodeMethodNotAllowed, "GET, PUT"},
+		{"wrong content type", http.MethodPut, "/api/v1/items/42", "text/plain", `{"name":"a"}`, http.StatusUnsupportedMediaType, CodeUnsupportedMediaType, ""},
+		{"content type parameters", http.MethodPut, "/api/v1/items/42", "application/json; charset=utf-8", `{"name":"a"}`, http.StatusOK, "", ""},
+		{"unknown field", http.MethodPut, "/api/v1/items/42", "application/json", `{"name":"a","admin":true}`, http.StatusBadRequest, CodeInvalidJSON, ""},
+		{"trailing data", http.MethodPut, "/api/v1/items/42", "application/json", `{"name":"a"}{}`, http.StatusBadRequest, CodeInvalidJSON, ""},
+		{"empty body", http.MethodPut, "/api/v1/items/42", "application/json", "", http.StatusBadRequest, CodeInvalidJSON, ""},
+		{"body over default limit", http.MethodPut, "/api/v1/items/42", "application/json", long, http.StatusRequestEntityTooLarge, CodePayloadTooLarge, ""},
+		{"route limit override", http.MethodPost, "/api/v1/uploads", "application/json", long, http.StatusCreated, "", ""},
+		{"panic", http.MethodGet, "/api/v1/panic", "", "", http.StatusInternalServerError, CodeInternal, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.body == "" {
+				req.Body, req.ContentLength = http.NoBody, 0
+			}
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			w := httptest.NewRecorder()
+			rt.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d (body %s)", w.Code, tt.status, w.Body)
+			}
+			if got := w.Header().Get("Allow"); got != tt.allow {
+				t.Errorf("Allow = %q, want %q", got, tt.allow)
+			}
+			if tt.code == "" {
+				return
+			}
+			var env struct {
+				Error struct {
+					Code      string `json:"code"`
+					RequestID string `json:"request_id"`
+				} `json:"error"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &env); err != nil {
+				t.Fatalf("error body %s - %v", w.Body, err)
+			}
+			if env.Error.Code != tt.code {
+				t.Errorf("error code = %q, want %q", env.Error.Code, tt.code)
+			}
+			if env.Error.RequestID == "" || env.Error.RequestID != w.Header().Get("X-Request-ID") {
+				t.Errorf("error request_id = %q, want X-Request-ID %q", env.Error.RequestID, w.Header().Get("X-Request-ID"))
+			}
+		})
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		keep   bool
+	}{
+		{"client id", "abc-123", true},
+		{"none", "", false},
+		{"control characters", "abc\x00def", false},
+		{"too long", strings.Repeat("a", 129), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("X-Request-ID", tt.header)
+			got := requestID(req)
+			if (got == tt.header) != tt.keep || got == "" {
+				t.Errorf("requestID() = %q, want client id kept = %v", got, tt.keep)
+			}
+		})
+	}
+}
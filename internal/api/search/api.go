@@ -0,0 +1,118 @@
+package search
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"YoPost/internal/api/rest"
+	"YoPost/internal/auth"
+	"YoPost/internal/mail/message"
+	"YoPost/internal/mail/store"
+	"YoPost/internal/search"
+)
+
+// API exposes full-text search over a user's mailboxes
+type API struct {
+	Store store.Store
+	Index search.Index
+}
+
+// Result defines a single search result
+type Result struct {
+	ID      string    `json:"id"`
+	Mailbox string    `json:"mailbox"`
+	UID     uint32    `json:"uid"`
+	Date    time.Time `json:"date"`
+	From    string    `json:"from"`
+	Subject string    `json:"subject"`
+}
+
+// SearchResponse defines the response structure for search requests
+type SearchResponse struct {
+	Query   string   `json:"query"`
+	Total   int      `json:"total"` // matches, capped at searchWindow
+	Results []Result `json:"results"`
+	// NextCursor continues the result list, empty on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+var searchFields = map[string]string{
+	"":           search.FieldAll,
+	"all":        search.FieldAll,
+	"subject":    search.FieldSubject,
+	"from":       search.FieldFrom,
+	"to":         search.FieldTo,
+	"body":       search.FieldBody,
+	"attachment": search.FieldAttachment,
+}
+
+// searchWindow caps the number of hits a query is paginated over
+const searchWindow = 1000
+
+// Routes registers the search endpoint on r
+func (a *API) Routes(r *rest.Router) {
+	r.GET("/search", a.search).
+		Paged("user", "q", "field", "mailbox").
+		Response(http.StatusOK, SearchResponse{}).
+		Describe("Full-text search over a user's mailboxes")
+}
+
+// hitKey orders hits newest first as ascending cursor keys
+func hitKey(h search.Hit) string {
+	return fmt.Sprintf("%019d|%s", math.MaxInt64-h.Date.UnixNano(), h.ID)
+}
+
+// search handles GET /api/v1/search?user=&q=&field=&mailbox=&limit=&cursor=;
+// user defaults to the caller
+func (a *API) search(w http.ResponseWriter, r *http.Request) error {
+	p, err := rest.ParseList(r, "user", "q", "field", "mailbox")
+	if err != nil {
+		return err
+	}
+	caller := auth.FromContext(r.Context())
+	owner, text := p.Filters["user"], p.Filters["q"]
+	if owner == "" {
+		owner = caller.Subject
+	}
+	if !caller.CanAccessAddress(owner) {
+		return rest.Errorf(http.StatusForbidden, rest.CodeForbidden, "no access to mailbox %s", owner)
+	}
+	if text == "" {
+		return rest.InvalidParameter("q", "q is required")
+	}
+	field, ok := searchFields[p.Filters["field"]]
+	if !ok {
+		return rest.InvalidParameter("field", "unknown search field %q", p.Filters["field"])
+	}
+
+	log.Printf("INFO: Handling search request for %s - field: %s", owner, field)
+	hits, err := a.Index.Search(r.Context(), owner, search.Query{
+		Mailbox: p.Filters["mailbox"],
+		Terms:   map[string]string{field: text},
+		Limit:   searchWindow,
+	})
+	if err != nil {
+		return fmt.Errorf("search failed for %s: %w", owner, err)
+	}
+	sort.Slice(hits, func(i, j int) bool { return hitKey(hits[i]) < hitKey(hits[j]) })
+	page := rest.Paginate(hits, p, hitKey)
+
+	resp := SearchResponse{Query: text, Total: len(hits), Results: []Result{}, NextCursor: page.NextCursor}
+	for _, hit := range page.Data {
+		res := Result{ID: hit.ID, Mailbox: hit.Mailbox, UID: hit.UID, Date: hit.Date}
+		if msg, err := a.Store.Get(r.Context(), owner, hit.ID); err == nil {
+			if p, err := message.ParseHeader(msg.Raw); err == nil {
+				res.Subject = p.Subject
+				if len(p.From) > 0 {
+					res.From = p.From[0].String()
+				}
+			}
+		}
+		resp.Results = append(resp.Results, res)
+	}
+	return rest.JSON(w, http.StatusOK, resp)
+}
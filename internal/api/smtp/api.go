@@ -1,12 +1,40 @@
 package smtp
 
 import (
+	"YoPost/internal/api/rest"
+	"YoPost/internal/auth"
 	"YoPost/internal/mail/core"
+	"YoPost/internal/ratelimit"
 	"encoding/json"
+	"errors"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
 )
 
+// API exposes sending through the configured relay
+type API struct {
+	Relay *core.Relay
+	// Limiter may be nil; sends count against the caller's submission limits
+	Limiter *ratelimit.Limiter
+}
+
+// limit counts one message to a single recipient against the submission
+// limits of user
+func (a *API) limit(r *http.Request, user string) error {
+	if a.Limiter == nil {
+		return nil
+	}
+	return a.Limiter.Submit(r.Context(), user, 1)
+}
+
+// Register adds the SMTP routes to mux
+func (a *API) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/api/smtp/send", a.SendEmailHandler)
+	mux.HandleFunc("/api/smtp/config", a.GetConfigHandler)
+}
+
 // SendEmailRequest defines the request structure for sending emails
 type SendEmailRequest struct {
 	To       string `json:"to"`
@@ -30,7 +58,7 @@ type ConfigResponse struct {
 }
 
 // SendEmailHandler handles email sending requests
-func SendEmailHandler(w http.ResponseWriter, r *http.Request) {
+func (a *API) SendEmailHandler(w http.ResponseWriter, r *http.Request) {
 	// Parse request
 	log.Printf("INFO: Handling email send request")
 	var req SendEmailRequest
@@ -48,9 +76,24 @@ func SendEmailHandler(w http.ResponseWriter, r *http.Request) {
 		req.Body + "\r\n")
 	log.Printf("DEBUG: Built message (%d bytes)", len(msg))
 
+	// Check rate limits
+	sender := req.Username
+	if sender == "" {
+		sender = auth.FromContext(r.Context()).Subject
+	}
+	var limitErr *ratelimit.LimitError
+	if errors.As(a.limit(r, sender), &limitErr) {
+		log.Printf("INFO: Rejecting email from %s - %v", sender, limitErr)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(limitErr.RetryAfter.Seconds()))))
+		w.WriteHeader(http.StatusTooManyRequests)
+		json.NewEncoder(w).Encode(SendEmailResponse{Success: false, Message: limitErr.Error()})
+		return
+	}
+
 	// Send email
 	log.Printf("INFO: Attempting to send email to %s", req.To)
-	err := core.TLSstatus(req.Username, []string{req.To}, msg, req.Username, req.Password)
+	err := a.Relay.Send(req.Username, []string{req.To}, msg, req.Username, req.Password)
 	if err != nil {
 		log.Printf("ERROR: Failed to send email to %s - %v", req.To, err)
 		response := SendEmailResponse{
@@ -75,9 +118,9 @@ func SendEmailHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // GetConfigHandler returns SMTP server configuration
-func GetConfigHandler(w http.ResponseWriter, r *http.Request) {
+func (a *API) GetConfigHandler(w http.ResponseWriter, r *http.Request) {
 	log.Printf("INFO: Handling SMTP config request")
-	config := core.GetMailServerConfig()
+	config := a.Relay.Config()
 	if config == nil {
 		log.Printf("ERROR: SMTP configuration not initialized")
 		http.Error(w, "SMTP configuration not initialized", http.StatusInternalServerError)
@@ -96,3 +139,62 @@ func GetConfigHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(response)
 }
+
+// Routes registers the versioned SMTP endpoints on r
+func (a *API) Routes(r *rest.Router) {
+	r.GET("/smtp/config", a.getConfig).Require(string(auth.RoleSuperAdmin)).
+		Response(http.StatusOK, ConfigResponse{}).
+		Describe("Get the outbound relay configuration")
+	r.POST("/smtp/send", a.send).
+		Request(SendRequest{}).
+		Response(http.StatusOK, SendEmailResponse{}).
+		Describe("Send a plain text message through the relay as the caller")
+}
+
+func (a *API) getConfig(w http.ResponseWriter, r *http.Request) error {
+	config := a.Relay.Config()
+	if config == nil {
+		return errors.New("SMTP configuration not initialized")
+	}
+	return rest.JSON(w, http.StatusOK, ConfigResponse{
+		Host:      config.Host,
+		TLSPort:   config.TLSPort,
+		NoTLSPort: config.NoTLSPort,
+	})
+}
+
+// SendRequest defines the request structure of the versioned send endpoint;
+// the sender is always the authenticated caller
+type SendRequest struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+func (a *API) send(w http.ResponseWriter, r *http.Request) error {
+	var req SendRequest
+	if err := rest.Decode(r, &req); err != nil {
+		return err
+	}
+	if req.To == "" {
+		return rest.InvalidParameter("to", "to is required")
+	}
+
+	from := auth.FromContext(r.Context()).Subject
+	msg := []byte("From: " + from + "\r\n" +
+		"To: " + req.To + "\r\n" +
+		"Subject: " + req.Subject + "\r\n" +
+		"\r\n" +
+		req.Body + "\r\n")
+	var limitErr *ratelimit.LimitError
+	if errors.As(a.limit(r, from), &limitErr) {
+		log.Printf("INFO: Rejecting email from %s - %v", from, limitErr)
+		return rest.RateLimited(limitErr.RetryAfter, "%s", limitErr.Error())
+	}
+	log.Printf("INFO: Attempting to send email from %s to %s", from, req.To)
+	if err := a.Relay.Send(from, []string{req.To}, msg, "", ""); err != nil {
+		log.Printf("ERROR: Failed to send email to %s - %v", req.To, err)
+		return rest.Errorf(http.StatusBadGateway, "relay_error", "relay rejected the message: %v", err)
+	}
+	return rest.JSON(w, http.StatusOK, SendEmailResponse{Success: true, Message: "Email sent successfully"})
+}
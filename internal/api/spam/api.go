@@ -0,0 +1,122 @@
+// Package spam exposes the training state of the per-mailbox Bayesian spam
+// classifier and scores messages against the spam filter. The classifier
+// itself learns when messages are moved into or out of Junk
+package spam
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"YoPost/internal/api/rest"
+	"YoPost/internal/auth"
+	"YoPost/internal/mail/smtpd"
+	"YoPost/internal/spam"
+)
+
+// API serves the spam filter endpoints
+type API struct {
+	// Filter may be nil, the endpoints then return 404
+	Filter *spam.Filter
+}
+
+// CheckRequest scores a message as if it had arrived over SMTP
+type CheckRequest struct {
+	// Raw is the complete RFC 5322 message
+	Raw string `json:"raw"`
+	// User selects the Bayesian classifier, defaults to the caller
+	User string `json:"user,omitempty"`
+	// IP, Helo and From are the client address, HELO name and envelope
+	// sender looked up in the DNS lists
+	IP   string `json:"ip,omitempty"`
+	Helo string `json:"helo,omitempty"`
+	From string `json:"from,omitempty"`
+}
+
+// Routes registers the spam filter endpoints on r. The training endpoints
+// take an optional ?user= naming the mailbox, defaulting to the caller
+func (a *API) Routes(r *rest.Router) {
+	r.GET("/spam/training", a.training).
+		Query("user").
+		Response(http.StatusOK, spam.Training{}).
+		Describe("Get how many messages the Bayesian spam classifier of a mailbox has learned")
+	r.DELETE("/spam/training", a.reset).
+		Query("user").
+		Response(http.StatusNoContent, nil).
+		Describe("Forget everything the Bayesian spam classifier of a mailbox has learned")
+	r.POST("/spam/check", a.check).Require(string(auth.RoleSuperAdmin)).
+		Request(CheckRequest{}).
+		Response(http.StatusOK, spam.Result{}).
+		Describe("Score a message against the spam filter without delivering it")
+}
+
+// owner returns the mailbox named by user, defaulting to the caller
+func owner(r *http.Request, user string) (string, error) {
+	caller := auth.FromContext(r.Context())
+	if user == "" {
+		user = caller.Subject
+	}
+	user = strings.ToLower(strings.TrimSpace(user))
+	if !caller.CanAccessAddress(user) {
+		return "", rest.Errorf(http.StatusForbidden, rest.CodeForbidden, "no access to mailbox %s", user)
+	}
+	return user, nil
+}
+
+func (a *API) training(w http.ResponseWriter, r *http.Request) error {
+	if a.Filter == nil {
+		return rest.NotFound("spam filtering is not available")
+	}
+	user, err := owner(r, r.URL.Query().Get("user"))
+	if err != nil {
+		return err
+	}
+	t, err := a.Filter.Training(r.Context(), user)
+	if err != nil {
+		return err
+	}
+	return rest.JSON(w, http.StatusOK, t)
+}
+
+func (a *API) reset(w http.ResponseWriter, r *http.Request) error {
+	if a.Filter == nil {
+		return rest.NotFound("spam filtering is not available")
+	}
+	user, err := owner(r, r.URL.Query().Get("user"))
+	if err != nil {
+		return err
+	}
+	if err := a.Filter.Reset(r.Context(), user); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// check handles POST /api/v1/spam/check. Scoring works while spam.enabled is
+// off so that thresholds and rules can be tuned before enabling the filter
+func (a *API) check(w http.ResponseWriter, r *http.Request) error {
+	if a.Filter == nil {
+		return rest.NotFound("spam filtering is not available")
+	}
+	var req CheckRequest
+	if err := rest.Decode(r, &req); err != nil {
+		return err
+	}
+	if strings.TrimSpace(req.Raw) == "" {
+		return rest.InvalidParameter("raw", "is required")
+	}
+	user, err := owner(r, req.User)
+	if err != nil {
+		return err
+	}
+	env := &smtpd.Envelope{Helo: req.Helo, From: req.From, To: []string{user}, Data: []byte(req.Raw)}
+	if req.IP != "" {
+		ip := net.ParseIP(req.IP)
+		if ip == nil {
+			return rest.InvalidParameter("ip", "invalid IP address %q", req.IP)
+		}
+		env.RemoteAddr = &net.TCPAddr{IP: ip}
+	}
+	return rest.JSON(w, http.StatusOK, a.Filter.Analyze(r.Context(), env).Check(r.Context(), user))
+}
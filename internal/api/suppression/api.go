@@ -0,0 +1,258 @@
+// Package suppression manages the suppression list over the API and serves the
+// one-click unsubscribe links (RFC 8058) carried by bulk mail
+package suppression
+
+import (
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"net/mail"
+	"strings"
+
+	"YoPost/internal/api/rest"
+	"YoPost/internal/auth"
+	"YoPost/internal/suppression"
+)
+
+// API manages the suppression list. Users manage the entries of their own
+// mail; global entries, which apply to every sender, require superadmin to
+// change
+type API struct {
+	Manager *suppression.Manager
+}
+
+// EntryRequest adds an address to the suppression list
+type EntryRequest struct {
+	Address string `json:"address"`
+	// Owner defaults to the caller; Global adds an entry for every sender
+	Owner  string `json:"owner,omitempty"`
+	Global bool   `json:"global,omitempty"`
+	// Reason defaults to manual
+	Reason suppression.Reason `json:"reason,omitempty"`
+	Detail string             `json:"detail,omitempty"`
+}
+
+// Routes registers the suppression list endpoints and the public unsubscribe
+// endpoints on r
+func (a *API) Routes(r *rest.Router) {
+	r.GET("/suppressions", a.list).
+		Paged("owner", "address", "reason").
+		Response(http.StatusOK, rest.List[*suppression.Entry]{}).
+		Describe("List suppressed addresses")
+	r.POST("/suppressions", a.create).
+		Request(EntryRequest{}).
+		Response(http.StatusCreated, suppression.Entry{}).
+		Describe("Suppress an address")
+	r.GET("/suppressions/{id}", a.get).Response(http.StatusOK, suppression.Entry{}).Describe("Get a suppression entry")
+	r.DELETE("/suppressions/{id}", a.delete).Response(http.StatusNoContent, nil).Describe("Remove an address from the suppression list")
+	r.GET("/unsubscribe/{token}", a.confirm).Require(auth.Public).
+		Response(http.StatusOK, rest.Raw("text/html")).
+		Describe("Show the unsubscribe confirmation page of a List-Unsubscribe link")
+	r.POST("/unsubscribe/{token}", a.unsubscribe).Require(auth.Public).
+		Consumes("application/x-www-form-urlencoded", "multipart/form-data").
+		Response(http.StatusOK, rest.Raw("text/html")).
+		Describe("Unsubscribe with a List-Unsubscribe link (RFC 8058 one-click)")
+}
+
+func entryKey(e *suppression.Entry) string {
+	return e.Address + "\x00" + e.Owner + "\x00" + e.ID
+}
+
+// list handles GET /api/v1/suppressions?owner=&address=&reason=&limit=&cursor=,
+// ordered by address. Without owner superadmins see every entry and other
+// callers their own and the global ones
+func (a *API) list(w http.ResponseWriter, r *http.Request) error {
+	p, err := rest.ParseList(r, "owner", "address", "reason")
+	if err != nil {
+		return err
+	}
+	caller := auth.FromContext(r.Context())
+	var owners []string
+	if v, ok := p.Filters["owner"]; ok {
+		owner := suppression.Normalize(v)
+		if !caller.CanAccessAddress(owner) {
+			return rest.Errorf(http.StatusForbidden, rest.CodeForbidden, "no access to the suppression list of %s", owner)
+		}
+		owners = []string{owner}
+	} else if caller.Role != auth.RoleSuperAdmin {
+		owners = []string{suppression.Normalize(caller.Subject), ""}
+	}
+	all, err := a.Manager.Store().List(r.Context(), owners...)
+	if err != nil {
+		return err
+	}
+
+	matched := all[:0]
+	for _, e := range all {
+		if v, ok := p.Filters["address"]; ok && e.Address != suppression.Normalize(v) {
+			continue
+		}
+		if v, ok := p.Filters["reason"]; ok && string(e.Reason) != v {
+			continue
+		}
+		matched = append(matched, e)
+	}
+	page := rest.Paginate(matched, p, entryKey)
+	if page.Data == nil {
+		page.Data = []*suppression.Entry{}
+	}
+	return rest.JSON(w, http.StatusOK, page)
+}
+
+// decode reads an EntryRequest into an entry; the owner must be accessible to
+// the caller and global entries require superadmin
+func decode(r *http.Request) (*suppression.Entry, error) {
+	var req EntryRequest
+	if err := rest.Decode(r, &req); err != nil {
+		return nil, err
+	}
+	addr, err := mail.ParseAddress(strings.TrimSpace(req.Address))
+	if err != nil {
+		return nil, rest.InvalidParameter("address", "invalid address %q", req.Address)
+	}
+	e := &suppression.Entry{Address: suppression.Normalize(addr.Address), Reason: req.Reason, Detail: req.Detail}
+	if e.Reason == "" {
+		e.Reason = suppression.ReasonManual
+	}
+	if !validReason(e.Reason) {
+		return nil, rest.InvalidParameter("reason", "unknown reason %q", req.Reason)
+	}
+
+	caller := auth.FromContext(r.Context())
+	switch {
+	case req.Global && req.Owner != "":
+		return nil, rest.InvalidParameter("owner", "owner and global are mutually exclusive")
+	case req.Global:
+		if caller.Role != auth.RoleSuperAdmin {
+			return nil, rest.Errorf(http.StatusForbidden, rest.CodeForbidden, "global entries require %s", auth.RoleSuperAdmin)
+		}
+	case req.Owner != "":
+		e.Owner = suppression.Normalize(req.Owner)
+		if !caller.CanAccessAddress(e.Owner) {
+			return nil, rest.Errorf(http.StatusForbidden, rest.CodeForbidden, "no access to the suppression list of %s", e.Owner)
+		}
+	default:
+		e.Owner = suppression.Normalize(caller.Subject)
+	}
+	return e, nil
+}
+
+func validReason(reason suppression.Reason) bool {
+	for _, v := range suppression.Reasons {
+		if v == reason {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *API) create(w http.ResponseWriter, r *http.Request) error {
+	e, err := decode(r)
+	if err != nil {
+		return err
+	}
+	err = a.Manager.Store().Add(r.Context(), e)
+	if errors.Is(err, suppression.ErrExists) {
+		return rest.Conflict("%s is already suppressed", e.Address)
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("INFO: User %s suppressed %s for %s (%s)", auth.FromContext(r.Context()).Subject, e.Address, scope(e), e.Reason)
+	return rest.JSON(w, http.StatusCreated, e)
+}
+
+// scope describes the senders an entry applies to in log messages
+func scope(e *suppression.Entry) string {
+	if e.Owner == "" {
+		return "all senders"
+	}
+	return e.Owner
+}
+
+// load reads the entry {id}; entries of other users are reported as missing,
+// global entries are visible to everyone
+func (a *API) load(r *http.Request) (*suppression.Entry, error) {
+	id := r.PathValue("id")
+	e, err := a.Manager.Store().Get(r.Context(), id)
+	if err == nil && e.Owner != "" && !auth.FromContext(r.Context()).CanAccessAddress(e.Owner) {
+		err = suppression.ErrNotFound
+	}
+	if errors.Is(err, suppression.ErrNotFound) {
+		return nil, rest.NotFound("suppression entry %s not found", id)
+	}
+	return e, err
+}
+
+func (a *API) get(w http.ResponseWriter, r *http.Request) error {
+	e, err := a.load(r)
+	if err != nil {
+		return err
+	}
+	return rest.JSON(w, http.StatusOK, e)
+}
+
+func (a *API) delete(w http.ResponseWriter, r *http.Request) error {
+	e, err := a.load(r)
+	if err != nil {
+		return err
+	}
+	caller := auth.FromContext(r.Context())
+	if e.Owner == "" && caller.Role != auth.RoleSuperAdmin {
+		return rest.Errorf(http.StatusForbidden, rest.CodeForbidden, "global entries require %s", auth.RoleSuperAdmin)
+	}
+	if err := a.Manager.Store().Delete(r.Context(), e.ID); err != nil && !errors.Is(err, suppression.ErrNotFound) {
+		return err
+	}
+	log.Printf("INFO: User %s removed %s from the suppression list of %s", caller.Subject, e.Address, scope(e))
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+var page = template.Must(template.New("unsubscribe").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width"><title>Unsubscribe</title></head>
+<body style="font-family: sans-serif; max-width: 32em; margin: 4em auto">
+{{if .Done}}<p>{{.Address}} will no longer receive mail from {{.Sender}}.</p>
+{{else}}<p>Stop sending mail from {{.Sender}} to {{.Address}}?</p>
+<form method="post"><input type="hidden" name="List-Unsubscribe" value="One-Click"><button type="submit">Unsubscribe</button></form>
+{{end}}</body></html>
+`))
+
+// render writes the unsubscribe page
+func render(w http.ResponseWriter, sub *suppression.Subscription, done bool) error {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; form-action 'self'")
+	return page.Execute(w, map[string]interface{}{"Sender": sub.Sender, "Address": sub.Address, "Done": done})
+}
+
+func tokenError(err error) error {
+	if errors.Is(err, suppression.ErrInvalidToken) {
+		return rest.NotFound("unsubscribe link is invalid")
+	}
+	return err
+}
+
+// confirm handles GET /api/v1/unsubscribe/{token}. Opening the link does not
+// unsubscribe, since mail scanners follow links; the page posts to the same URL
+func (a *API) confirm(w http.ResponseWriter, r *http.Request) error {
+	sub, err := a.Manager.Parse(r.PathValue("token"))
+	if err != nil {
+		return tokenError(err)
+	}
+	return render(w, sub, false)
+}
+
+// unsubscribe handles POST /api/v1/unsubscribe/{token}, sent by mail clients
+// with the body List-Unsubscribe=One-Click or by the confirmation page
+func (a *API) unsubscribe(w http.ResponseWriter, r *http.Request) error {
+	token := r.PathValue("token")
+	sub, err := a.Manager.Parse(token)
+	if err != nil {
+		return tokenError(err)
+	}
+	if _, err := a.Manager.Unsubscribe(r.Context(), token); err != nil {
+		return tokenError(err)
+	}
+	return render(w, sub, true)
+}
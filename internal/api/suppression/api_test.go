@@ -0,0 +1,60 @@
+package suppression
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"YoPost/internal/api/rest"
+	"YoPost/internal/config"
+	"YoPost/internal/suppression"
+)
+
+func TestOneClickUnsubscribe(t *testing.T) {
+	ctx := context.Background()
+	cfg := config.Default()
+	cfg.Suppression.Secret = "0123456789abcdef0123456789abcdef"
+	m, err := suppression.NewManager(suppression.NewMemoryStore(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := rest.NewRouter("/api/v1", 1<<20)
+	(&API{Manager: m}).Routes(router)
+	token := m.Token("alice@example.com", "bob@remote.example", "")
+
+	tests := []struct {
+		name         string
+		method       string
+		token        string
+		body         string
+		status       int
+		unsubscribed bool
+	}{
+		{"confirmation page", http.MethodGet, token, "", http.StatusOK, false},
+		{"invalid link", http.MethodPost, token + "x", "List-Unsubscribe=One-Click", http.StatusNotFound, false},
+		{"one-click", http.MethodPost, token, "List-Unsubscribe=One-Click", http.StatusOK, true},
+		{"repeated", http.MethodPost, token, "List-Unsubscribe=One-Click", http.StatusOK, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/v1/unsubscribe/"+tt.token, strings.NewReader(tt.body))
+			if tt.body != "" {
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d (body %s)", w.Code, tt.status, w.Body)
+			}
+			e, err := m.Suppressed(ctx, "alice@example.com", "bob@remote.example")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (e != nil) != tt.unsubscribed {
+				t.Errorf("suppressed = %+v, want %v", e, tt.unsubscribed)
+			}
+		})
+	}
+}
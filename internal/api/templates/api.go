@@ -0,0 +1,186 @@
+package templates
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"YoPost/internal/api/rest"
+	"YoPost/internal/auth"
+	"YoPost/internal/templates"
+)
+
+// API manages transactional email templates. Any caller can read and preview
+// templates and send with them; changing them requires superadmin
+type API struct {
+	Store templates.Store
+}
+
+// TemplateRequest creates a template or replaces its content. The id is
+// required on create and must match the path, if given, on update
+type TemplateRequest struct {
+	ID          string `json:"id,omitempty"`
+	Description string `json:"description"`
+	// DefaultLocale defaults to the locale of the first variant
+	DefaultLocale string              `json:"default_locale"`
+	Variants      []templates.Variant `json:"variants"`
+}
+
+// PreviewRequest renders a template without sending it. Locale is a language
+// tag or an Accept-Language list; it defaults to the Accept-Language header
+type PreviewRequest struct {
+	Locale    string                 `json:"locale"`
+	Variables map[string]interface{} `json:"variables"`
+}
+
+// Routes registers the template endpoints on r
+func (a *API) Routes(r *rest.Router) {
+	admin := string(auth.RoleSuperAdmin)
+	r.GET("/templates", a.list).
+		Paged().
+		Response(http.StatusOK, rest.List[*templates.Template]{}).
+		Describe("List email templates")
+	r.POST("/templates", a.create).Require(admin).
+		Request(TemplateRequest{}).
+		Response(http.StatusCreated, templates.Template{}).
+		Describe("Create an email template")
+	r.GET("/templates/{id}", a.get).Response(http.StatusOK, templates.Template{}).Describe("Get an email template")
+	r.PUT("/templates/{id}", a.update).Require(admin).
+		Request(TemplateRequest{}).
+		Response(http.StatusOK, templates.Template{}).
+		Describe("Replace the content of an email template")
+	r.DELETE("/templates/{id}", a.delete).Require(admin).Response(http.StatusNoContent, nil).Describe("Delete an email template")
+	r.POST("/templates/{id}/preview", a.preview).
+		Request(PreviewRequest{}).
+		Response(http.StatusOK, templates.Rendered{}).
+		Describe("Render an email template with variables")
+}
+
+func notFound(err error, id string) error {
+	if errors.Is(err, templates.ErrNotFound) {
+		return rest.NotFound("template %s not found", id)
+	}
+	return err
+}
+
+// RenderError maps a failed rendering, e.g. a missing variable, to 422
+func RenderError(err error) error {
+	return rest.Errorf(http.StatusUnprocessableEntity, rest.CodeUnprocessable, "failed to render template: %v", err)
+}
+
+func templateKey(t *templates.Template) string {
+	return t.ID
+}
+
+// list handles GET /api/v1/templates?limit=&cursor=, ordered by id
+func (a *API) list(w http.ResponseWriter, r *http.Request) error {
+	p, err := rest.ParseList(r)
+	if err != nil {
+		return err
+	}
+	all, err := a.Store.List(r.Context())
+	if err != nil {
+		return err
+	}
+	page := rest.Paginate(all, p, templateKey)
+	if page.Data == nil {
+		page.Data = []*templates.Template{}
+	}
+	return rest.JSON(w, http.StatusOK, page)
+}
+
+// decode reads and validates a TemplateRequest
+func decode(r *http.Request) (*templates.Template, error) {
+	var req TemplateRequest
+	if err := rest.Decode(r, &req); err != nil {
+		return nil, err
+	}
+	t := &templates.Template{
+		ID:            req.ID,
+		Description:   req.Description,
+		DefaultLocale: req.DefaultLocale,
+		Variants:      req.Variants,
+	}
+	if err := t.Normalize(); err != nil {
+		return nil, rest.InvalidParameter("variants", "%v", err)
+	}
+	return t, nil
+}
+
+func (a *API) create(w http.ResponseWriter, r *http.Request) error {
+	t, err := decode(r)
+	if err != nil {
+		return err
+	}
+	if !templates.ValidID(t.ID) {
+		return rest.InvalidParameter("id", "id must be 1-64 lowercase letters, digits, '.', '_' or '-'")
+	}
+	if err := a.Store.Create(r.Context(), t); err != nil {
+		if errors.Is(err, templates.ErrExists) {
+			return rest.Conflict("template %s already exists", t.ID)
+		}
+		return err
+	}
+	log.Printf("INFO: Created template %s with %d variants", t.ID, len(t.Variants))
+	return rest.JSON(w, http.StatusCreated, t)
+}
+
+func (a *API) get(w http.ResponseWriter, r *http.Request) error {
+	id := r.PathValue("id")
+	t, err := a.Store.Get(r.Context(), id)
+	if err != nil {
+		return notFound(err, id)
+	}
+	return rest.JSON(w, http.StatusOK, t)
+}
+
+func (a *API) update(w http.ResponseWriter, r *http.Request) error {
+	t, err := decode(r)
+	if err != nil {
+		return err
+	}
+	id := r.PathValue("id")
+	if t.ID != "" && t.ID != id {
+		return rest.InvalidParameter("id", "id cannot be changed")
+	}
+	t.ID = id
+	if err := a.Store.Update(r.Context(), t); err != nil {
+		return notFound(err, id)
+	}
+	log.Printf("INFO: Updated template %s to revision %d", t.ID, t.Revision)
+	return rest.JSON(w, http.StatusOK, t)
+}
+
+func (a *API) delete(w http.ResponseWriter, r *http.Request) error {
+	id := r.PathValue("id")
+	if err := a.Store.Delete(r.Context(), id); err != nil {
+		return notFound(err, id)
+	}
+	log.Printf("INFO: Deleted template %s", id)
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// preview handles POST /api/v1/templates/{id}/preview; the body is optional
+func (a *API) preview(w http.ResponseWriter, r *http.Request) error {
+	var req PreviewRequest
+	if r.ContentLength != 0 {
+		if err := rest.Decode(r, &req); err != nil {
+			return err
+		}
+	}
+	id := r.PathValue("id")
+	t, err := a.Store.Get(r.Context(), id)
+	if err != nil {
+		return notFound(err, id)
+	}
+	locale := req.Locale
+	if locale == "" {
+		locale = r.Header.Get("Accept-Language")
+	}
+	out, err := t.Render(locale, req.Variables)
+	if err != nil {
+		return RenderError(err)
+	}
+	return rest.JSON(w, http.StatusOK, out)
+}
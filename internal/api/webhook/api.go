@@ -0,0 +1,303 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"YoPost/internal/api/rest"
+	"YoPost/internal/auth"
+	"YoPost/internal/webhook"
+)
+
+// API manages webhook endpoints and their delivery log
+type API struct {
+	Dispatcher *webhook.Dispatcher
+}
+
+// EndpointRequest creates or updates an endpoint. On PATCH omitted fields keep
+// their value; events [] subscribes to every event
+type EndpointRequest struct {
+	URL         *string  `json:"url"`
+	Description *string  `json:"description"`
+	Events      []string `json:"events"`
+	Enabled     *bool    `json:"enabled"`
+	// RotateSecret replaces the signing secret; the new one is returned once
+	RotateSecret bool `json:"rotate_secret"`
+}
+
+// Endpoint is an endpoint in responses; Secret is only returned when the
+// endpoint is created or its secret is rotated
+type Endpoint struct {
+	*webhook.Endpoint
+	Secret string `json:"secret,omitempty"`
+}
+
+// Delivery is a delivery log entry with the event body that was sent
+type Delivery struct {
+	*webhook.Delivery
+	Payload json.RawMessage `json:"payload"`
+}
+
+// Routes registers the webhook endpoints on r
+func (a *API) Routes(r *rest.Router) {
+	admin := string(auth.RoleSuperAdmin)
+	r.GET("/webhooks", a.list).Require(admin).
+		Response(http.StatusOK, rest.List[Endpoint]{}).
+		Describe("List webhook endpoints")
+	r.POST("/webhooks", a.create).Require(admin).
+		Request(EndpointRequest{}).
+		Response(http.StatusCreated, Endpoint{}).
+		Describe("Create a webhook endpoint and return its signing secret")
+	r.GET("/webhooks/{id}", a.get).Require(admin).Response(http.StatusOK, Endpoint{}).Describe("Get a webhook endpoint")
+	r.PATCH("/webhooks/{id}", a.update).Require(admin).
+		Request(EndpointRequest{}).
+		Response(http.StatusOK, Endpoint{}).
+		Describe("Update a webhook endpoint or rotate its secret")
+	r.DELETE("/webhooks/{id}", a.delete).Require(admin).
+		Response(http.StatusNoContent, nil).
+		Describe("Delete a webhook endpoint and its delivery log")
+	r.POST("/webhooks/{id}/test", a.test).Require(admin).
+		Response(http.StatusOK, Delivery{}).
+		Describe("Send a ping event to a webhook endpoint now")
+	r.GET("/webhooks/{id}/deliveries", a.deliveries).Require(admin).
+		Paged("status", "event").
+		Response(http.StatusOK, rest.List[*webhook.Delivery]{}).
+		Describe("List deliveries of a webhook endpoint, newest first")
+	r.GET("/webhooks/{id}/deliveries/{delivery}", a.getDelivery).Require(admin).
+		Response(http.StatusOK, Delivery{}).
+		Describe("Get a webhook delivery with its payload")
+	r.POST("/webhooks/{id}/deliveries/{delivery}/retry", a.retry).Require(admin).
+		Response(http.StatusAccepted, Delivery{}).
+		Describe("Queue a webhook delivery again")
+}
+
+func notFound(err error, format string, args ...interface{}) error {
+	if errors.Is(err, webhook.ErrNotFound) {
+		return rest.NotFound(format, args...)
+	}
+	return err
+}
+
+// validate checks the fields present in req
+func validate(req *EndpointRequest) error {
+	if req.URL != nil {
+		u, err := url.Parse(*req.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return rest.InvalidParameter("url", "url must be an absolute http or https URL")
+		}
+	}
+	for _, ev := range req.Events {
+		known := false
+		for _, e := range webhook.Events {
+			known = known || e == ev
+		}
+		if !known {
+			return rest.InvalidParameter("events", "unknown event %q (events: %s)", ev, strings.Join(webhook.Events, ", "))
+		}
+	}
+	return nil
+}
+
+func (a *API) load(r *http.Request) (*webhook.Endpoint, error) {
+	id := r.PathValue("id")
+	e, err := a.Dispatcher.Store().GetEndpoint(r.Context(), id)
+	if err != nil {
+		return nil, notFound(err, "webhook %s not found", id)
+	}
+	return e, nil
+}
+
+func (a *API) list(w http.ResponseWriter, r *http.Request) error {
+	endpoints, err := a.Dispatcher.Store().ListEndpoints(r.Context())
+	if err != nil {
+		return err
+	}
+	out := make([]Endpoint, len(endpoints))
+	for i, e := range endpoints {
+		out[i] = Endpoint{Endpoint: e}
+	}
+	return rest.JSON(w, http.StatusOK, rest.List[Endpoint]{Data: out})
+}
+
+// create handles POST /api/v1/webhooks; endpoints are enabled unless enabled is false
+func (a *API) create(w http.ResponseWriter, r *http.Request) error {
+	var req EndpointRequest
+	if err := rest.Decode(r, &req); err != nil {
+		return err
+	}
+	if req.URL == nil {
+		return rest.InvalidParameter("url", "url is required")
+	}
+	if err := validate(&req); err != nil {
+		return err
+	}
+
+	e := &webhook.Endpoint{URL: *req.URL, Events: req.Events, Enabled: true, Secret: webhook.NewSecret()}
+	if e.Events == nil {
+		e.Events = []string{}
+	}
+	if req.Description != nil {
+		e.Description = *req.Description
+	}
+	if req.Enabled != nil {
+		e.Enabled = *req.Enabled
+	}
+	if err := a.Dispatcher.Store().CreateEndpoint(r.Context(), e); err != nil {
+		return err
+	}
+	log.Printf("INFO: Created webhook %s for %s", e.ID, e.URL)
+	return rest.JSON(w, http.StatusCreated, Endpoint{Endpoint: e, Secret: e.Secret})
+}
+
+func (a *API) get(w http.ResponseWriter, r *http.Request) error {
+	e, err := a.load(r)
+	if err != nil {
+		return err
+	}
+	return rest.JSON(w, http.StatusOK, Endpoint{Endpoint: e})
+}
+
+func (a *API) update(w http.ResponseWriter, r *http.Request) error {
+	var req EndpointRequest
+	if err := rest.Decode(r, &req); err != nil {
+		return err
+	}
+	if err := validate(&req); err != nil {
+		return err
+	}
+	e, err := a.load(r)
+	if err != nil {
+		return err
+	}
+
+	if req.URL != nil {
+		e.URL = *req.URL
+	}
+	if req.Description != nil {
+		e.Description = *req.Description
+	}
+	if req.Events != nil {
+		e.Events = req.Events
+	}
+	if req.Enabled != nil {
+		e.Enabled = *req.Enabled
+	}
+	resp := Endpoint{Endpoint: e}
+	if req.RotateSecret {
+		e.Secret = webhook.NewSecret()
+		resp.Secret = e.Secret
+	}
+	if err := a.Dispatcher.Store().UpdateEndpoint(r.Context(), e); err != nil {
+		return notFound(err, "webhook %s not found", e.ID)
+	}
+	log.Printf("INFO: Updated webhook %s", e.ID)
+	return rest.JSON(w, http.StatusOK, resp)
+}
+
+func (a *API) delete(w http.ResponseWriter, r *http.Request) error {
+	id := r.PathValue("id")
+	if err := a.Dispatcher.Store().DeleteEndpoint(r.Context(), id); err != nil {
+		return notFound(err, "webhook %s not found", id)
+	}
+	log.Printf("INFO: Deleted webhook %s", id)
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func deliveryView(d *webhook.Delivery) Delivery {
+	return Delivery{Delivery: d, Payload: json.RawMessage(d.Payload)}
+}
+
+// test handles POST /api/v1/webhooks/{id}/test. The ping is sent even when
+// the endpoint is disabled; the response is the resulting delivery
+func (a *API) test(w http.ResponseWriter, r *http.Request) error {
+	e, err := a.load(r)
+	if err != nil {
+		return err
+	}
+	d, err := a.Dispatcher.Ping(r.Context(), e)
+	if err != nil {
+		return err
+	}
+	return rest.JSON(w, http.StatusOK, deliveryView(d))
+}
+
+// deliveryKey orders deliveries newest first as ascending cursor keys
+func deliveryKey(d *webhook.Delivery) string {
+	return fmt.Sprintf("%019d|%s", math.MaxInt64-d.CreatedAt.UnixNano(), d.ID)
+}
+
+// deliveries handles GET /api/v1/webhooks/{id}/deliveries?status=&event=&limit=&cursor=
+func (a *API) deliveries(w http.ResponseWriter, r *http.Request) error {
+	p, err := rest.ParseList(r, "status", "event")
+	if err != nil {
+		return err
+	}
+	e, err := a.load(r)
+	if err != nil {
+		return err
+	}
+	all, err := a.Dispatcher.Store().ListDeliveries(r.Context(), e.ID)
+	if err != nil {
+		return err
+	}
+
+	matched := all[:0]
+	for _, d := range all {
+		if v, ok := p.Filters["status"]; ok && string(d.Status) != v {
+			continue
+		}
+		if v, ok := p.Filters["event"]; ok && d.Event != v {
+			continue
+		}
+		matched = append(matched, d)
+	}
+	sort.Slice(matched, func(i, j int) bool { return deliveryKey(matched[i]) < deliveryKey(matched[j]) })
+	page := rest.Paginate(matched, p, deliveryKey)
+	if page.Data == nil {
+		page.Data = []*webhook.Delivery{}
+	}
+	return rest.JSON(w, http.StatusOK, page)
+}
+
+// loadDelivery reads the delivery named by {delivery} of the endpoint {id}
+func (a *API) loadDelivery(r *http.Request) (*webhook.Delivery, error) {
+	id := r.PathValue("delivery")
+	d, err := a.Dispatcher.Store().GetDelivery(r.Context(), id)
+	if err == nil && d.EndpointID != r.PathValue("id") {
+		err = webhook.ErrNotFound
+	}
+	if err != nil {
+		return nil, notFound(err, "delivery %s not found", id)
+	}
+	return d, nil
+}
+
+func (a *API) getDelivery(w http.ResponseWriter, r *http.Request) error {
+	d, err := a.loadDelivery(r)
+	if err != nil {
+		return err
+	}
+	return rest.JSON(w, http.StatusOK, deliveryView(d))
+}
+
+// retry handles POST /api/v1/webhooks/{id}/deliveries/{delivery}/retry. The
+// delivery is sent again with its original payload and a fresh attempt count
+func (a *API) retry(w http.ResponseWriter, r *http.Request) error {
+	d, err := a.loadDelivery(r)
+	if err != nil {
+		return err
+	}
+	if err := a.Dispatcher.Retry(r.Context(), d); err != nil {
+		return notFound(err, "delivery %s not found", d.ID)
+	}
+	log.Printf("INFO: Queued webhook delivery %s again", d.ID)
+	return rest.JSON(w, http.StatusAccepted, deliveryView(d))
+}
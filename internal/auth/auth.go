@@ -0,0 +1,119 @@
+// Package auth 提供 API 认证与授权：API 密钥、JWT 访问令牌与刷新令牌、基于角色的访问控制
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Role 用户或 API 密钥的角色
+type Role string
+
+// 角色由低到高：普通用户只能访问自己的邮箱，域管理员管理指定域名，超级管理员不受限制
+const (
+	RoleUser        Role = "user"
+	RoleDomainAdmin Role = "domainadmin"
+	RoleSuperAdmin  Role = "superadmin"
+)
+
+// Public 路由访问级别：无需认证，用于登录和刷新令牌
+const Public = "public"
+
+var roleRank = map[Role]int{RoleUser: 1, RoleDomainAdmin: 2, RoleSuperAdmin: 3}
+
+var (
+	// ErrInvalidCredentials 用户名或密码错误
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	// ErrInvalidToken 令牌或 API 密钥无效、过期或已吊销
+	ErrInvalidToken = errors.New("invalid or expired credentials")
+	// ErrNoCredentials 请求未携带认证信息
+	ErrNoCredentials = errors.New("authentication required")
+	// ErrForbidden 调用方无权执行该操作
+	ErrForbidden = errors.New("forbidden")
+	// ErrInvalid 请求参数不合法
+	ErrInvalid = errors.New("invalid request")
+	// ErrNotFound 用户或 API 密钥不存在
+	ErrNotFound = errors.New("not found")
+)
+
+// ParseRole 解析角色名
+func ParseRole(s string) (Role, error) {
+	r := Role(s)
+	if _, ok := roleRank[r]; !ok {
+		return "", fmt.Errorf("%w: unknown role %q (roles: user, domainadmin, superadmin)", ErrInvalid, s)
+	}
+	return r, nil
+}
+
+// AtLeast 判断角色是否不低于 min
+func (r Role) AtLeast(min Role) bool {
+	return roleRank[r] >= roleRank[min] && roleRank[r] > 0
+}
+
+// Principal 已认证的调用方
+type Principal struct {
+	Subject string   `json:"subject"` // 用户名 (邮箱地址)
+	Role    Role     `json:"role"`
+	Domains []string `json:"domains,omitempty"` // 域管理员可管理的域名
+	Scopes  []string `json:"scopes,omitempty"`  // API 密钥的作用域，为空表示不限制
+	KeyID   string   `json:"key_id,omitempty"`  // 通过 API 密钥认证时为密钥 ID
+}
+
+// System 命令行等本地管理操作使用的超级管理员身份
+var System = &Principal{Subject: "system", Role: RoleSuperAdmin}
+
+// CanManageDomain 判断能否管理域名
+func (p *Principal) CanManageDomain(domain string) bool {
+	if p.Role == RoleSuperAdmin {
+		return true
+	}
+	if p.Role != RoleDomainAdmin {
+		return false
+	}
+	for _, d := range p.Domains {
+		if strings.EqualFold(d, domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// CanAccessAddress 判断能否访问邮箱：用户只能访问自己的邮箱，域管理员可访问所管理域名下的邮箱
+func (p *Principal) CanAccessAddress(address string) bool {
+	if strings.EqualFold(address, p.Subject) || p.Role == RoleSuperAdmin {
+		return true
+	}
+	at := strings.LastIndexByte(address, '@')
+	return at >= 0 && p.CanManageDomain(address[at+1:])
+}
+
+// HasScope 判断 API 密钥作用域是否包含 scope
+//
+// scope 形如 "queue:read"，密钥作用域 "queue" 包含 queue 的读写，"*" 包含全部
+func (p *Principal) HasScope(scope string) bool {
+	if p.Scopes == nil {
+		return true
+	}
+	area, _, _ := strings.Cut(scope, ":")
+	for _, s := range p.Scopes {
+		if s == "*" || s == scope || s == area {
+			return true
+		}
+	}
+	return false
+}
+
+type contextKey struct{}
+
+// NewContext 返回携带 p 的 ctx
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// FromContext 返回 ctx 中的调用方，未认证时为 nil
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(contextKey{}).(*Principal)
+	return p
+}
@@ -0,0 +1,218 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"YoPost/internal/auth/oidc"
+	"YoPost/internal/auth/oidc/oidctest"
+	"YoPost/internal/config"
+)
+
+func TestParseJWT(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	now := time.Unix(1700000000, 0)
+	valid := claims{Issuer: issuer, Subject: "alice@example.com", Role: RoleUser, IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Hour).Unix()}
+	sign := func(secret []byte, c claims) string {
+		token, err := signJWT(secret, c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	expired := valid
+	expired.ExpiresAt = now.Unix()
+	foreign := valid
+	foreign.Issuer = "other"
+	good := sign(secret, valid)
+	parts := strings.Split(good, ".")
+	none := b64.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`)) + "." + parts[1]
+	none += "." + b64.EncodeToString(jwtSignature(secret, none))
+
+	tests := []struct {
+		name  string
+		token string
+		ok    bool
+	}{
+		{"valid", good, true},
+		{"wrong secret", sign([]byte("another secret of thirty-two bytes"), valid), false},
+		{"expired", sign(secret, expired), false},
+		{"wrong issuer", sign(secret, foreign), false},
+		{"tampered payload", parts[0] + "." + b64.EncodeToString([]byte(`{"iss":"yopost","sub":"mallory@example.com","role":"superadmin","exp":9999999999}`)) + "." + parts[2], false},
+		{"unsupported algorithm", none, false},
+		{"malformed", "not-a-token", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := parseJWT(secret, tt.token, issuer, now)
+			if !tt.ok {
+				if !errors.Is(err, ErrInvalidToken) {
+					t.Fatalf("parseJWT() error = %v, want ErrInvalidToken", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseJWT() error = %v", err)
+			}
+			if c.Subject != valid.Subject || c.Role != valid.Role {
+				t.Errorf("parseJWT() = %+v, want subject %s role %s", c, valid.Subject, valid.Role)
+			}
+		})
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	ctx := context.Background()
+	st := NewMemoryStore()
+	if err := st.AddUser("admin@example.com", "secret", RoleSuperAdmin); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.AddUser("ops@example.com", "secret", RoleDomainAdmin, "example.com"); err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewService(st, config.AuthConfig{JWTSecret: "0123456789abcdef0123456789abcdef", AccessTokenTTL: 60, RefreshTokenTTL: 3600})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pair, err := s.Login(ctx, "admin@example.com", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin := &Principal{Subject: "admin@example.com", Role: RoleSuperAdmin}
+	newKey := func(subject string) (*APIKey, string) {
+		k, token, err := s.CreateKey(ctx, admin, KeyRequest{Name: "test", Subject: subject, Scopes: []string{"queue"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k, token
+	}
+	key, token := newKey("admin@example.com")
+	_, revoked := newKey("admin@example.com")
+	if err := s.RevokeKey(ctx, admin, strings.Split(revoked, "_")[1]); err != nil {
+		t.Fatal(err)
+	}
+	expiredKey, expired := newKey("admin@example.com")
+	expiredKey.ExpiresAt = time.Now().Add(-time.Minute)
+	st.CreateKey(ctx, expiredKey)
+	_, demoted := newKey("ops@example.com")
+	if err := st.AddUser("ops@example.com", "secret", RoleUser); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		authorization string
+		apiKey        string
+		want          *Principal
+		err           error
+	}{
+		{"access token", "Bearer " + pair.AccessToken, "", &Principal{Subject: "admin@example.com", Role: RoleSuperAdmin}, nil},
+		{"api key header", "", token, &Principal{Subject: "admin@example.com", Role: RoleSuperAdmin, Scopes: []string{"queue"}, KeyID: key.ID}, nil},
+		{"api key as bearer", "Bearer " + token, "", &Principal{Subject: "admin@example.com", Role: RoleSuperAdmin, Scopes: []string{"queue"}, KeyID: key.ID}, nil},
+		{"wrong key secret", "", token[:len(token)-4] + "AAAA", nil, ErrInvalidToken},
+		{"revoked key", "", revoked, nil, ErrInvalidToken},
+		{"expired key", "", expired, nil, ErrInvalidToken},
+		{"owner demoted", "", demoted, nil, ErrInvalidToken},
+		{"unknown key", "", "yp_0000_secret", nil, ErrInvalidToken},
+		{"malformed key", "", "yp_", nil, ErrInvalidToken},
+		{"basic scheme", "Basic YWRtaW46c2VjcmV0", "", nil, ErrInvalidToken},
+		{"no credentials", "", "", nil, ErrNoCredentials},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := s.Authenticate(ctx, tt.authorization, tt.apiKey)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("Authenticate() error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Authenticate() error = %v", err)
+			}
+			if p.Subject != tt.want.Subject || p.Role != tt.want.Role || p.KeyID != tt.want.KeyID ||
+				strings.Join(p.Scopes, ",") != strings.Join(tt.want.Scopes, ",") {
+				t.Errorf("Authenticate() = %+v, want %+v", p, tt.want)
+			}
+		})
+	}
+}
+
+// idpAuthorize 请求模拟 IdP 的授权端点，返回回调中的 code 和 state
+func idpAuthorize(t *testing.T, location string) (code, state string) {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	callback, err := resp.Location()
+	if err != nil {
+		t.Fatalf("authorize: %s without redirect - %v", resp.Status, err)
+	}
+	return callback.Query().Get("code"), callback.Query().Get("state")
+}
+
+func TestOIDCLogin(t *testing.T) {
+	ctx := context.Background()
+	idp := oidctest.NewServer("yopost")
+	defer idp.Close()
+	idp.SetUser(map[string]interface{}{"sub": "1", "email": "Alice@Example.com", "email_verified": true})
+
+	st := NewMemoryStore()
+	s, err := NewService(st, config.AuthConfig{JWTSecret: "0123456789abcdef0123456789abcdef", AccessTokenTTL: 60, RefreshTokenTTL: 3600})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.EnableOIDC(oidc.NewClient(config.OIDCConfig{Enabled: true, Issuer: idp.URL, ClientID: "yopost",
+		RedirectURL: "http://localhost/api/v1/auth/oidc/callback", Scopes: []string{"openid", "email"},
+		UsernameClaim: "email", AutoProvision: true}))
+
+	tests := []struct {
+		name    string
+		browser func(state string) string
+		replay  bool
+		err     error
+	}{
+		{"same browser", func(state string) string { return state }, false, nil},
+		{"no state cookie", func(string) string { return "" }, false, ErrInvalidToken},
+		{"state of another login", func(string) string { return "attacker-state" }, false, ErrInvalidToken},
+		{"state used twice", func(state string) string { return state }, true, ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			location, state, err := s.StartOIDC(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			code, returned := idpAuthorize(t, location)
+			if returned != state {
+				t.Fatalf("callback state = %q, want %q", returned, state)
+			}
+			if tt.replay {
+				if _, err := s.FinishOIDC(ctx, code, state, state); err != nil {
+					t.Fatal(err)
+				}
+			}
+			pair, err := s.FinishOIDC(ctx, code, returned, tt.browser(state))
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("FinishOIDC() error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FinishOIDC() error = %v", err)
+			}
+			p, err := s.Authenticate(ctx, "Bearer "+pair.AccessToken, "")
+			if err != nil || p.Subject != "alice@example.com" || p.Role != RoleUser {
+				t.Errorf("Authenticate() = %+v, %v, want provisioned user alice@example.com", p, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"YoPost/internal/api/rest"
+)
+
+// Middleware 返回 /api/v1 使用的认证与授权中间件
+//
+// 路由的 Access 为 Public 时不认证，为角色名时要求不低于该角色，为空时要求 RoleUser；
+// API 密钥还需包含路由的作用域 "<第一段路径>:read|write"；
+// 路径参数 {address} 和 {domain} 分别用 CanAccessAddress 和 CanManageDomain 校验
+func (s *Service) Middleware() rest.Middleware {
+	return func(next rest.HandlerFunc) rest.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) error {
+			route := rest.CurrentRoute(r.Context())
+			if route != nil && route.Access == Public {
+				return next(w, r)
+			}
+
+			p, err := s.authenticateRequest(r)
+			if err != nil {
+				return authError(w, err)
+			}
+			if route != nil {
+				if err := authorize(p, route, r); err != nil {
+					return err
+				}
+			}
+			return next(w, r.WithContext(NewContext(r.Context(), p)))
+		}
+	}
+}
+
+// Protect 要求调用方至少为 min 角色，用于 /api/v1 之外的 http.Handler
+func (s *Service) Protect(min Role, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, err := s.authenticateRequest(r)
+		if err != nil {
+			rest.WriteError(w, r, authError(w, err))
+			return
+		}
+		if !p.Role.AtLeast(min) {
+			rest.WriteError(w, r, rest.Errorf(http.StatusForbidden, rest.CodeForbidden, "requires role %s", min))
+			return
+		}
+		h.ServeHTTP(w, r.WithContext(NewContext(r.Context(), p)))
+	})
+}
+
+func (s *Service) authenticateRequest(r *http.Request) (*Principal, error) {
+	return s.Authenticate(r.Context(), r.Header.Get("Authorization"), r.Header.Get("X-API-Key"))
+}
+
+// authError 将认证失败转换为 401，其他错误原样返回
+func authError(w http.ResponseWriter, err error) error {
+	if !errors.Is(err, ErrNoCredentials) && !errors.Is(err, ErrInvalidToken) {
+		return err
+	}
+	w.Header().Set("WWW-Authenticate", `Bearer realm="yopost"`)
+	if errors.Is(err, ErrNoCredentials) {
+		return rest.Errorf(http.StatusUnauthorized, rest.CodeUnauthorized, "authentication required")
+	}
+	return rest.Errorf(http.StatusUnauthorized, rest.CodeUnauthorized, "invalid or expired credentials")
+}
+
+// authorize 校验角色、API 密钥作用域和路径中的资源
+func authorize(p *Principal, route *rest.Route, r *http.Request) error {
+	min := RoleUser
+	if route.Access != "" {
+		min = Role(route.Access)
+	}
+	if !p.Role.AtLeast(min) {
+		return rest.Errorf(http.StatusForbidden, rest.CodeForbidden, "requires role %s", min)
+	}
+	if scope := RouteScope(route); !p.HasScope(scope) {
+		return rest.Errorf(http.StatusForbidden, rest.CodeForbidden, "api key lacks scope %s", scope)
+	}
+	if address := r.PathValue("address"); address != "" && !p.CanAccessAddress(address) {
+		return rest.Errorf(http.StatusForbidden, rest.CodeForbidden, "no access to mailbox %s", address)
+	}
+	if domain := r.PathValue("domain"); domain != "" && !p.CanManageDomain(domain) {
+		return rest.Errorf(http.StatusForbidden, rest.CodeForbidden, "no access to domain %s", domain)
+	}
+	return nil
+}
+
+// RouteScope 返回路由对应的 API 密钥作用域，如 GET /queue/{id} 为 "queue:read"
+func RouteScope(route *rest.Route) string {
+	area, _, _ := strings.Cut(strings.Trim(route.Pattern, "/"), "/")
+	if route.Method == http.MethodGet || route.Method == http.MethodHead {
+		return area + ":read"
+	}
+	return area + ":write"
+}
+
+// Error 将本包的错误转换为 API 错误
+func Error(err error) error {
+	switch {
+	case errors.Is(err, ErrInvalidCredentials):
+		return rest.Errorf(http.StatusUnauthorized, rest.CodeUnauthorized, "invalid username or password")
+	case errors.Is(err, ErrInvalidToken):
+		return rest.Errorf(http.StatusUnauthorized, rest.CodeUnauthorized, "invalid or expired token")
+	case errors.Is(err, ErrForbidden):
+		return rest.Errorf(http.StatusForbidden, rest.CodeForbidden, "%s", detail(err, ErrForbidden))
+	case errors.Is(err, ErrInvalid):
+		return rest.BadRequest("%s", detail(err, ErrInvalid))
+	case errors.Is(err, ErrNotFound):
+		return rest.NotFound("%s", detail(err, ErrNotFound))
+	case errors.Is(err, ErrOIDCDisabled):
+		return rest.NotFound("%s", err)
+	}
+	return err
+}
+
+// detail 去掉错误信息中的 "<sentinel>: " 前缀
+func detail(err, sentinel error) string {
+	return strings.TrimPrefix(err.Error(), sentinel.Error()+": ")
+}
@@ -0,0 +1,240 @@
+// Package oidc 实现 OpenID Connect 授权码 + PKCE 登录，以及基于 JWKS 的 JWT 校验
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"YoPost/internal/config"
+)
+
+// Provider discovery 文档中使用的字段
+type Provider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Discover 读取 issuer 的 /.well-known/openid-configuration
+func Discover(ctx context.Context, client *http.Client, issuer string) (*Provider, error) {
+	wellKnown := strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, wellKnown, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("oidc discovery failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oidc discovery failed: %s", resp.Status)
+	}
+
+	var p Provider
+	if err := json.NewDecoder(resp.Body).Decode(&p); err != nil {
+		return nil, fmt.Errorf("invalid oidc discovery document: %v", err)
+	}
+	if p.Issuer != issuer {
+		return nil, fmt.Errorf("oidc discovery issuer %q does not match %q", p.Issuer, issuer)
+	}
+	if p.AuthorizationEndpoint == "" || p.TokenEndpoint == "" || p.JWKSURI == "" {
+		return nil, errors.New("oidc discovery document is missing endpoints")
+	}
+	return &p, nil
+}
+
+// NewVerifier 生成 PKCE code_verifier
+func NewVerifier() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return b64.EncodeToString(b)
+}
+
+// Challenge 计算 S256 code_challenge
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return b64.EncodeToString(sum[:])
+}
+
+// Client OIDC 依赖方 (relying party)
+//
+// discovery 在第一次使用时进行，失败时下次请求重试，IdP 暂时不可用不影响服务启动
+type Client struct {
+	cfg  config.OIDCConfig
+	http *http.Client
+
+	mu       sync.Mutex
+	provider *Provider
+	keys     *KeySet
+}
+
+// NewClient 根据配置创建 OIDC 客户端
+func NewClient(cfg config.OIDCConfig) *Client {
+	return &Client{cfg: cfg, http: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Config 返回客户端配置
+func (c *Client) Config() config.OIDCConfig {
+	return c.cfg
+}
+
+func (c *Client) discover(ctx context.Context) (*Provider, *KeySet, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.provider == nil {
+		p, err := Discover(ctx, c.http, c.cfg.Issuer)
+		if err != nil {
+			return nil, nil, err
+		}
+		jwksURL := p.JWKSURI
+		if c.cfg.JWKSURL != "" {
+			jwksURL = c.cfg.JWKSURL
+		}
+		c.provider, c.keys = p, NewKeySet(jwksURL, c.http)
+	}
+	return c.provider, c.keys, nil
+}
+
+// AuthCodeURL 返回授权端点地址，使用 S256 PKCE
+func (c *Client) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	p, _, err := c.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {c.cfg.ClientID},
+		"redirect_uri":          {c.cfg.RedirectURL},
+		"scope":                 {strings.Join(c.cfg.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {Challenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(p.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return p.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Exchange 用授权码换取令牌，校验 ID Token 并返回其声明
+func (c *Client) Exchange(ctx context.Context, code, verifier, nonce string) (Claims, error) {
+	p, _, err := c.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {c.cfg.RedirectURL},
+		"client_id":     {c.cfg.ClientID},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if c.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(c.cfg.ClientID), url.QueryEscape(c.cfg.ClientSecret))
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("oidc token request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	var tokens struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.Unmarshal(body, &tokens); err != nil {
+		return nil, fmt.Errorf("invalid oidc token response (%s)", resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK || tokens.Error != "" {
+		return nil, fmt.Errorf("oidc token request rejected: %s %s", tokens.Error, tokens.ErrorDescription)
+	}
+	if tokens.IDToken == "" {
+		return nil, errors.New("oidc token response has no id_token")
+	}
+
+	claims, err := c.verify(ctx, tokens.IDToken, []string{c.cfg.ClientID})
+	if err != nil {
+		return nil, err
+	}
+	if claims.String("nonce") != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidToken)
+	}
+	return claims, nil
+}
+
+// VerifyAccessToken 校验 IdP 签发给客户端的 JWT 访问令牌，用于 SASL XOAUTH2/OAUTHBEARER
+func (c *Client) VerifyAccessToken(ctx context.Context, token string) (Claims, error) {
+	audiences := c.cfg.Audiences
+	if len(audiences) == 0 {
+		audiences = []string{c.cfg.ClientID}
+	}
+	return c.verify(ctx, token, audiences)
+}
+
+func (c *Client) verify(ctx context.Context, token string, audiences []string) (Claims, error) {
+	_, keys, err := c.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := keys.Verify(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkClaims(claims, c.cfg.Issuer, audiences, time.Now()); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// Username 从声明中取出用户名 (邮箱地址)；
+// 使用 email 声明时要求 email_verified 不为 false，并检查 allowed_domains
+func (c *Client) Username(claims Claims) (string, error) {
+	username := strings.ToLower(strings.TrimSpace(claims.String(c.cfg.UsernameClaim)))
+	at := strings.LastIndexByte(username, '@')
+	if at <= 0 || at == len(username)-1 {
+		return "", fmt.Errorf("%w: claim %s is not an email address", ErrInvalidToken, c.cfg.UsernameClaim)
+	}
+	if c.cfg.UsernameClaim == "email" {
+		if verified, ok := claims["email_verified"].(bool); ok && !verified {
+			return "", fmt.Errorf("%w: email %s is not verified", ErrInvalidToken, username)
+		}
+	}
+	if len(c.cfg.AllowedDomains) > 0 {
+		domain := username[at+1:]
+		allowed := false
+		for _, d := range c.cfg.AllowedDomains {
+			if strings.EqualFold(d, domain) {
+				allowed = true
+			}
+		}
+		if !allowed {
+			return "", fmt.Errorf("%w: domain %s is not allowed", ErrInvalidToken, domain)
+		}
+	}
+	return username, nil
+}
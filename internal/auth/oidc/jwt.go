@@ -0,0 +1,171 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// ErrInvalidToken 令牌格式、签名或声明无效
+var ErrInvalidToken = errors.New("oidc: invalid token")
+
+// clockSkew 校验 exp/nbf 时允许的时钟偏差
+const clockSkew = time.Minute
+
+var b64 = base64.RawURLEncoding
+
+// Claims JWT 声明
+type Claims map[string]interface{}
+
+// String 返回字符串声明，不存在或类型不符时为空
+func (c Claims) String(name string) string {
+	s, _ := c[name].(string)
+	return s
+}
+
+func (c Claims) time(name string) (time.Time, bool) {
+	switch v := c[name].(type) {
+	case float64:
+		return time.Unix(int64(v), 0), true
+	case json.Number:
+		n, err := v.Int64()
+		return time.Unix(n, 0), err == nil
+	}
+	return time.Time{}, false
+}
+
+// audiences 返回 aud 声明，aud 可以是字符串或字符串数组
+func (c Claims) audiences() []string {
+	switch v := c["aud"].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var list []string
+		for _, a := range v {
+			if s, ok := a.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+type jwsHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// parseJWS 解析 JWS Compact 格式，返回头部、声明、签名输入和签名
+func parseJWS(token string) (*jwsHeader, Claims, string, []byte, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, nil, "", nil, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+	rawHeader, err := b64.DecodeString(parts[0])
+	if err != nil {
+		return nil, nil, "", nil, fmt.Errorf("%w: malformed header", ErrInvalidToken)
+	}
+	var h jwsHeader
+	if err := json.Unmarshal(rawHeader, &h); err != nil {
+		return nil, nil, "", nil, fmt.Errorf("%w: malformed header", ErrInvalidToken)
+	}
+	payload, err := b64.DecodeString(parts[1])
+	if err != nil {
+		return nil, nil, "", nil, fmt.Errorf("%w: malformed payload", ErrInvalidToken)
+	}
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, nil, "", nil, fmt.Errorf("%w: malformed payload", ErrInvalidToken)
+	}
+	sig, err := b64.DecodeString(parts[2])
+	if err != nil {
+		return nil, nil, "", nil, fmt.Errorf("%w: malformed signature", ErrInvalidToken)
+	}
+	return &h, claims, parts[0] + "." + parts[1], sig, nil
+}
+
+// verifySignature 使用公钥校验签名，只接受非对称算法
+func verifySignature(alg string, key crypto.PublicKey, signed string, sig []byte) error {
+	var h hash.Hash
+	var ch crypto.Hash
+	switch alg {
+	case "RS256", "ES256", "PS256":
+		h, ch = sha256.New(), crypto.SHA256
+	case "RS384", "ES384", "PS384":
+		h, ch = sha512.New384(), crypto.SHA384
+	case "RS512", "ES512", "PS512":
+		h, ch = sha512.New(), crypto.SHA512
+	default:
+		return fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, alg)
+	}
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		var err error
+		switch alg[:2] {
+		case "RS":
+			err = rsa.VerifyPKCS1v15(k, ch, digest, sig)
+		case "PS":
+			err = rsa.VerifyPSS(k, ch, digest, sig, nil)
+		default:
+			err = errors.New("algorithm does not match key type")
+		}
+		if err != nil {
+			return fmt.Errorf("%w: bad signature", ErrInvalidToken)
+		}
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if alg[:2] != "ES" || len(sig) != 2*size {
+			return fmt.Errorf("%w: bad signature", ErrInvalidToken)
+		}
+		r, s := new(big.Int).SetBytes(sig[:size]), new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return fmt.Errorf("%w: bad signature", ErrInvalidToken)
+		}
+	default:
+		return fmt.Errorf("%w: unsupported key type", ErrInvalidToken)
+	}
+	return nil
+}
+
+// checkClaims 校验 iss、aud、exp、nbf，audiences 中任一匹配即可
+func checkClaims(c Claims, issuer string, audiences []string, now time.Time) error {
+	if c.String("iss") != issuer {
+		return fmt.Errorf("%w: unexpected issuer %q", ErrInvalidToken, c.String("iss"))
+	}
+	matched := false
+	for _, aud := range c.audiences() {
+		for _, want := range audiences {
+			if aud == want {
+				matched = true
+			}
+		}
+	}
+	if !matched {
+		return fmt.Errorf("%w: unexpected audience", ErrInvalidToken)
+	}
+	exp, ok := c.time("exp")
+	if !ok {
+		return fmt.Errorf("%w: missing exp", ErrInvalidToken)
+	}
+	if now.After(exp.Add(clockSkew)) {
+		return fmt.Errorf("%w: token expired", ErrInvalidToken)
+	}
+	if nbf, ok := c.time("nbf"); ok && now.Add(clockSkew).Before(nbf) {
+		return fmt.Errorf("%w: token not yet valid", ErrInvalidToken)
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"YoPost/internal/auth/oidc/oidctest"
+	"YoPost/internal/config"
+)
+
+func newTestClient(idp *oidctest.Server, audiences ...string) *Client {
+	return NewClient(config.OIDCConfig{Enabled: true, Issuer: idp.URL, ClientID: idp.ClientID,
+		RedirectURL: "http://localhost/api/v1/auth/oidc/callback", Scopes: []string{"openid", "email"},
+		UsernameClaim: "email", Audiences: audiences})
+}
+
+func TestDiscover(t *testing.T) {
+	idp := oidctest.NewServer("yopost")
+	defer idp.Close()
+
+	tests := []struct {
+		name   string
+		issuer string
+		ok     bool
+	}{
+		{"issuer", idp.URL, true},
+		{"issuer mismatch", idp.URL + "/", false},
+		{"no discovery document", idp.URL + "/tenant", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Discover(context.Background(), http.DefaultClient, tt.issuer)
+			if !tt.ok {
+				if err == nil {
+					t.Errorf("Discover() = %+v, want error", p)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Discover() error = %v", err)
+			}
+			if p.Issuer != idp.URL || p.TokenEndpoint != idp.URL+"/token" || p.JWKSURI != idp.URL+"/jwks" {
+				t.Errorf("Discover() = %+v", p)
+			}
+		})
+	}
+}
+
+func TestChallenge(t *testing.T) {
+	// RFC 7636 附录 B 的示例
+	if got := Challenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"); got != "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM" {
+		t.Errorf("Challenge() = %q", got)
+	}
+	if a, b := NewVerifier(), NewVerifier(); a == b || len(a) < 43 {
+		t.Errorf("NewVerifier() = %q, %q, want distinct verifiers of at least 43 characters", a, b)
+	}
+}
+
+func TestCheckClaims(t *testing.T) {
+	const issuer = "https://idp.example.com"
+	now := time.Unix(1700000000, 0)
+	claims := func(extra map[string]interface{}) Claims {
+		c := Claims{"iss": issuer, "aud": "yopost", "exp": float64(now.Add(time.Hour).Unix())}
+		for k, v := range extra {
+			c[k] = v
+		}
+		return c
+	}
+	tests := []struct {
+		name   string
+		claims Claims
+		ok     bool
+	}{
+		{"valid", claims(nil), true},
+		{"audience list", claims(map[string]interface{}{"aud": []interface{}{"other", "yopost"}}), true},
+		{"wrong audience", claims(map[string]interface{}{"aud": "other"}), false},
+		{"no audience", claims(map[string]interface{}{"aud": nil}), false},
+		{"wrong issuer", claims(map[string]interface{}{"iss": "https://evil.example.com"}), false},
+		{"expired", claims(map[string]interface{}{"exp": float64(now.Add(-2 * time.Minute).Unix())}), false},
+		{"expired within skew", claims(map[string]interface{}{"exp": float64(now.Add(-30 * time.Second).Unix())}), true},
+		{"missing exp", claims(map[string]interface{}{"exp": nil}), false},
+		{"not yet valid", claims(map[string]interface{}{"nbf": float64(now.Add(2 * time.Minute).Unix())}), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkClaims(tt.claims, issuer, []string{"yopost"}, now)
+			if tt.ok && err != nil {
+				t.Errorf("checkClaims() error = %v", err)
+			}
+			if !tt.ok && !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("checkClaims() error = %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+func TestKeySetRotation(t *testing.T) {
+	ctx := context.Background()
+	idp := oidctest.NewServer("yopost")
+	defer idp.Close()
+	ks := NewKeySet(idp.URL+"/jwks", http.DefaultClient)
+
+	old := idp.Token(map[string]interface{}{"sub": "1"})
+	if _, err := ks.Verify(ctx, old); err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	idp.RotateKey()
+	rotated := idp.Token(map[string]interface{}{"sub": "1"})
+
+	// 刚获取过 JWKS 时不会因未知 kid 立即重新获取
+	if _, err := ks.Verify(ctx, rotated); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Verify() right after fetch error = %v, want ErrInvalidToken", err)
+	}
+	ks.mu.Lock()
+	ks.fetched = time.Now().Add(-jwksRefetchDelay - time.Second)
+	ks.mu.Unlock()
+	if _, err := ks.Verify(ctx, rotated); err != nil {
+		t.Fatalf("Verify() after rotation error = %v", err)
+	}
+	if _, err := ks.Verify(ctx, old); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Verify() with retired key error = %v, want ErrInvalidToken", err)
+	}
+}
+
+// authorize 请求模拟 IdP 的授权端点，返回授权码
+func authorize(t *testing.T, location string) string {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	callback, err := resp.Location()
+	if err != nil {
+		t.Fatalf("authorize: %s without redirect - %v", resp.Status, err)
+	}
+	return callback.Query().Get("code")
+}
+
+func TestExchange(t *testing.T) {
+	ctx := context.Background()
+	idp := oidctest.NewServer("yopost")
+	defer idp.Close()
+	idp.SetUser(map[string]interface{}{"sub": "1", "email": "alice@example.com"})
+	c := newTestClient(idp)
+
+	tests := []struct {
+		name     string
+		verifier func(verifier string) string
+		nonce    func(nonce string) string
+		replay   bool
+		ok       bool
+	}{
+		{"valid", func(v string) string { return v }, func(n string) string { return n }, false, true},
+		{"wrong verifier", func(string) string { return NewVerifier() }, func(n string) string { return n }, false, false},
+		{"nonce mismatch", func(v string) string { return v }, func(string) string { return "other" }, false, false},
+		{"code used twice", func(v string) string { return v }, func(n string) string { return n }, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier, nonce := NewVerifier(), "nonce-"+tt.name
+			location, err := c.AuthCodeURL(ctx, "state", nonce, verifier)
+			if err != nil {
+				t.Fatal(err)
+			}
+			code := authorize(t, location)
+			if tt.replay {
+				if _, err := c.Exchange(ctx, code, verifier, nonce); err != nil {
+					t.Fatal(err)
+				}
+			}
+			claims, err := c.Exchange(ctx, code, tt.verifier(verifier), tt.nonce(nonce))
+			if !tt.ok {
+				if err == nil {
+					t.Errorf("Exchange() = %v, want error", claims)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Exchange() error = %v", err)
+			}
+			if user, err := c.Username(claims); err != nil || user != "alice@example.com" {
+				t.Errorf("Username() = %q, %v", user, err)
+			}
+		})
+	}
+}
+
+func TestVerifyAccessToken(t *testing.T) {
+	ctx := context.Background()
+	idp := oidctest.NewServer("yopost")
+	defer idp.Close()
+
+	tests := []struct {
+		name      string
+		audiences []string
+		claims    map[string]interface{}
+		ok        bool
+	}{
+		{"client id", nil, nil, true},
+		{"configured audience", []string{"smtp"}, map[string]interface{}{"aud": "smtp"}, true},
+		{"client id not in audiences", []string{"smtp"}, nil, false},
+		{"wrong audience", nil, map[string]interface{}{"aud": "other"}, false},
+		{"expired", nil, map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()}, false},
+		{"wrong issuer", nil, map[string]interface{}{"iss": "https://evil.example.com"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := map[string]interface{}{"email": "alice@example.com"}
+			for k, v := range tt.claims {
+				claims[k] = v
+			}
+			_, err := newTestClient(idp, tt.audiences...).VerifyAccessToken(ctx, idp.Token(claims))
+			if tt.ok && err != nil {
+				t.Errorf("VerifyAccessToken() error = %v", err)
+			}
+			if !tt.ok && !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("VerifyAccessToken() error = %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
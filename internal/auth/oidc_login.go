@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"YoPost/internal/auth/oidc"
+	"YoPost/internal/config"
+)
+
+// OIDC 登录请求的有效期和同时进行的上限
+const (
+	OIDCLoginTTL     = 10 * time.Minute
+	maxPendingLogins = 10000
+)
+
+// ErrOIDCDisabled 未启用 OIDC 登录
+var ErrOIDCDisabled = errors.New("oidc login is not enabled")
+
+// oidcLogin 进行中的授权码登录，按 state 保存 PKCE verifier 和 nonce
+type oidcLogin struct {
+	client *oidc.Client
+
+	mu      sync.Mutex
+	pending map[string]pendingLogin
+}
+
+type pendingLogin struct {
+	verifier string
+	nonce    string
+	expires  time.Time
+}
+
+// EnableOIDC 启用 OIDC 授权码登录
+func (s *Service) EnableOIDC(client *oidc.Client) {
+	s.oidc = &oidcLogin{client: client, pending: make(map[string]pendingLogin)}
+}
+
+// OIDC 返回 OIDC 客户端，未启用时为 nil
+func (s *Service) OIDC() *oidc.Client {
+	if s.oidc == nil {
+		return nil
+	}
+	return s.oidc.client
+}
+
+// OIDCConfig 返回 OIDC 配置，未启用时 Enabled 为 false
+func (s *Service) OIDCConfig() config.OIDCConfig {
+	if s.oidc == nil {
+		return config.OIDCConfig{}
+	}
+	return s.oidc.client.Config()
+}
+
+// StartOIDC 开始授权码登录，返回跳转到 IdP 的地址和 state；
+// 调用方须将 state 保存在发起登录的浏览器中 (如 HttpOnly Cookie)，回调时传给 FinishOIDC
+func (s *Service) StartOIDC(ctx context.Context) (location, state string, err error) {
+	if s.oidc == nil {
+		return "", "", ErrOIDCDisabled
+	}
+	if state, err = randomToken(24); err != nil {
+		return "", "", err
+	}
+	nonce, err := randomToken(24)
+	if err != nil {
+		return "", "", err
+	}
+	login := pendingLogin{verifier: oidc.NewVerifier(), nonce: nonce, expires: time.Now().Add(OIDCLoginTTL)}
+
+	o := s.oidc
+	o.mu.Lock()
+	now := time.Now()
+	for k, p := range o.pending {
+		if now.After(p.expires) {
+			delete(o.pending, k)
+		}
+	}
+	if len(o.pending) >= maxPendingLogins {
+		o.mu.Unlock()
+		return "", "", errors.New("too many pending oidc logins")
+	}
+	o.pending[state] = login
+	o.mu.Unlock()
+
+	location, err = o.client.AuthCodeURL(ctx, state, nonce, login.verifier)
+	return location, state, err
+}
+
+// FinishOIDC 处理 IdP 回调：换取并校验 ID Token，按需创建用户，签发本地令牌。
+// browserState 为 StartOIDC 时保存在浏览器中的 state，须与回调的 state 一致，
+// 防止攻击者让用户用攻击者的授权码登录 (登录 CSRF)
+func (s *Service) FinishOIDC(ctx context.Context, code, state, browserState string) (*TokenPair, error) {
+	if s.oidc == nil {
+		return nil, ErrOIDCDisabled
+	}
+	if browserState == "" || subtle.ConstantTimeCompare([]byte(state), []byte(browserState)) != 1 {
+		return nil, fmt.Errorf("%w: login state does not match this browser", ErrInvalidToken)
+	}
+	o := s.oidc
+	o.mu.Lock()
+	login, ok := o.pending[state]
+	delete(o.pending, state)
+	o.mu.Unlock()
+	if !ok || time.Now().After(login.expires) {
+		return nil, fmt.Errorf("%w: unknown or expired login state", ErrInvalidToken)
+	}
+
+	claims, err := o.client.Exchange(ctx, code, login.verifier, login.nonce)
+	if errors.Is(err, oidc.ErrInvalidToken) {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	username, err := o.client.Username(claims)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrForbidden, err)
+	}
+
+	role, domains, err := s.store.UserRole(ctx, username)
+	if errors.Is(err, ErrNotFound) {
+		if !o.client.Config().AutoProvision {
+			return nil, fmt.Errorf("%w: user %s does not exist", ErrForbidden, username)
+		}
+		if err := s.store.ProvisionUser(ctx, username); err != nil {
+			return nil, err
+		}
+		log.Printf("INFO: Provisioned user %s from oidc login", username)
+		role, domains, err = RoleUser, nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("INFO: User %s logged in via oidc", username)
+	return s.issue(ctx, username, role, domains)
+}
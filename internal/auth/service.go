@@ -0,0 +1,367 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"YoPost/internal/config"
+)
+
+// 令牌前缀，便于识别和密钥扫描
+const (
+	apiKeyPrefix  = "yp_"
+	refreshPrefix = "ypr_"
+	issuer        = "yopost"
+)
+
+// touchInterval 最近使用时间的更新间隔，避免每个请求都写数据库
+const touchInterval = time.Minute
+
+// TokenPair 登录或刷新返回的令牌
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"` // 访问令牌有效期 (秒)
+	RefreshToken string `json:"refresh_token"`
+}
+
+// KeyRequest 创建 API 密钥的参数
+type KeyRequest struct {
+	Name string `json:"name"`
+	// Subject 密钥所属用户，为空时为调用方本人，只有超级管理员可以为他人创建
+	Subject string `json:"subject,omitempty"`
+	// Role 为空时继承所属用户的角色，不能高于所属用户和调用方
+	Role Role `json:"role,omitempty"`
+	// Domains 域管理员密钥可管理的域名，为空时继承所属用户的域名
+	Domains []string `json:"domains,omitempty"`
+	// Scopes 如 "queue"、"quota:read"、"*"
+	Scopes []string `json:"scopes"`
+	// ExpiresIn 有效期 (秒)，0 表示不过期
+	ExpiresIn int64 `json:"expires_in,omitempty"`
+}
+
+var scopePattern = regexp.MustCompile(`^(\*|[a-z][a-z0-9_-]*(:(read|write))?)$`)
+
+// Service 签发和校验访问令牌、刷新令牌与 API 密钥
+type Service struct {
+	store  Store
+	secret []byte
+	// 有效期可热加载
+	accessTTL  atomic.Int64
+	refreshTTL atomic.Int64
+	// oidc 为空表示未启用 OIDC 登录
+	oidc *oidcLogin
+}
+
+// NewService 根据配置创建认证服务，未配置签名密钥时随机生成
+func NewService(store Store, cfg config.AuthConfig) (*Service, error) {
+	s := &Service{store: store, secret: []byte(cfg.JWTSecret)}
+	if len(s.secret) == 0 {
+		log.Printf("WARNING: auth.jwt_secret is not set, using a random key; sessions will not survive a restart")
+		s.secret = make([]byte, 32)
+		if _, err := rand.Read(s.secret); err != nil {
+			return nil, err
+		}
+	}
+	s.setTTL(cfg)
+	return s, nil
+}
+
+func (s *Service) setTTL(cfg config.AuthConfig) {
+	s.accessTTL.Store(int64(time.Duration(cfg.AccessTokenTTL) * time.Second))
+	s.refreshTTL.Store(int64(time.Duration(cfg.RefreshTokenTTL) * time.Second))
+}
+
+// PrepareReload 实现 config.Reloadable，热加载令牌有效期
+func (s *Service) PrepareReload(cfg *config.Config) (func(), error) {
+	return func() { s.setTTL(cfg.Auth) }, nil
+}
+
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return b64.EncodeToString(b), nil
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// issue 为用户签发访问令牌和刷新令牌
+func (s *Service) issue(ctx context.Context, username string, role Role, domains []string) (*TokenPair, error) {
+	now := time.Now()
+	accessTTL := time.Duration(s.accessTTL.Load())
+	access, err := signJWT(s.secret, claims{
+		Issuer:    issuer,
+		Subject:   username,
+		Role:      role,
+		Domains:   domains,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(accessTTL).Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	refresh := refreshPrefix + secret
+	expires := now.Add(time.Duration(s.refreshTTL.Load()))
+	if err := s.store.SaveRefreshToken(ctx, hashSecret(refresh), username, expires); err != nil {
+		return nil, err
+	}
+	return &TokenPair{
+		AccessToken:  access,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(accessTTL / time.Second),
+		RefreshToken: refresh,
+	}, nil
+}
+
+// Login 校验用户名密码并签发令牌
+func (s *Service) Login(ctx context.Context, username, password string) (*TokenPair, error) {
+	ok, err := s.store.CheckPassword(ctx, username, password)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+	role, domains, err := s.store.UserRole(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("INFO: User %s logged in", username)
+	return s.issue(ctx, username, role, domains)
+}
+
+// Refresh 使用刷新令牌换取新的令牌，旧的刷新令牌随即失效；角色按数据库中的当前值签发
+func (s *Service) Refresh(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	username, err := s.store.ConsumeRefreshToken(ctx, hashSecret(refreshToken))
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	role, domains, err := s.store.UserRole(ctx, username)
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.issue(ctx, username, role, domains)
+}
+
+// Logout 吊销刷新令牌，已签发的访问令牌在有效期内仍然可用
+func (s *Service) Logout(ctx context.Context, refreshToken string) error {
+	_, err := s.store.ConsumeRefreshToken(ctx, hashSecret(refreshToken))
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// Authenticate 校验 "Authorization: Bearer <token>" 或 "X-API-Key" 头，token 可以是访问令牌或 API 密钥
+func (s *Service) Authenticate(ctx context.Context, authorization, apiKey string) (*Principal, error) {
+	token := apiKey
+	if token == "" {
+		scheme, value, ok := strings.Cut(authorization, " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") {
+			if authorization == "" {
+				return nil, ErrNoCredentials
+			}
+			return nil, fmt.Errorf("%w: unsupported authorization scheme", ErrInvalidToken)
+		}
+		token = strings.TrimSpace(value)
+	}
+
+	if strings.HasPrefix(token, apiKeyPrefix) {
+		return s.authenticateKey(ctx, token)
+	}
+	c, err := parseJWT(s.secret, token, issuer, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return &Principal{Subject: c.Subject, Role: c.Role, Domains: c.Domains}, nil
+}
+
+// authenticateKey 校验 API 密钥 "yp_<id>_<secret>"
+//
+// 密钥的权限不会超过所属用户的当前权限，用户被删除或降级后其密钥随即失效
+func (s *Service) authenticateKey(ctx context.Context, token string) (*Principal, error) {
+	id, _, ok := strings.Cut(strings.TrimPrefix(token, apiKeyPrefix), "_")
+	if !ok || id == "" {
+		return nil, fmt.Errorf("%w: malformed api key", ErrInvalidToken)
+	}
+	k, err := s.store.GetKey(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if subtle.ConstantTimeCompare([]byte(hashSecret(token)), []byte(k.SecretHash)) != 1 || !k.Active(now) {
+		return nil, ErrInvalidToken
+	}
+
+	role, domains, err := s.store.UserRole(ctx, k.Subject)
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	owner := &Principal{Subject: k.Subject, Role: role, Domains: domains}
+	if !role.AtLeast(k.Role) || (k.Role == RoleDomainAdmin && !owner.canManageAll(k.Domains)) {
+		return nil, fmt.Errorf("%w: api key exceeds the permissions of its owner", ErrInvalidToken)
+	}
+
+	if now.Sub(k.LastUsedAt) > touchInterval {
+		if err := s.store.TouchKey(ctx, k.ID, now); err != nil {
+			log.Printf("WARNING: Failed to update last use of api key %s - %v", k.ID, err)
+		}
+	}
+	return &Principal{Subject: k.Subject, Role: k.Role, Domains: k.Domains, Scopes: k.Scopes, KeyID: k.ID}, nil
+}
+
+func (p *Principal) canManageAll(domains []string) bool {
+	for _, d := range domains {
+		if !p.CanManageDomain(d) {
+			return false
+		}
+	}
+	return true
+}
+
+// CreateKey 创建 API 密钥，返回密钥记录和只显示一次的完整密钥
+func (s *Service) CreateKey(ctx context.Context, p *Principal, req KeyRequest) (*APIKey, string, error) {
+	if p.KeyID != "" {
+		return nil, "", fmt.Errorf("%w: api keys cannot create api keys", ErrForbidden)
+	}
+	subject := req.Subject
+	if subject == "" {
+		subject = p.Subject
+	}
+	if !strings.EqualFold(subject, p.Subject) && p.Role != RoleSuperAdmin {
+		return nil, "", fmt.Errorf("%w: only a superadmin can create keys for other users", ErrForbidden)
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		return nil, "", fmt.Errorf("%w: name is required", ErrInvalid)
+	}
+	if len(req.Scopes) == 0 {
+		return nil, "", fmt.Errorf("%w: at least one scope is required", ErrInvalid)
+	}
+	for _, sc := range req.Scopes {
+		if !scopePattern.MatchString(sc) {
+			return nil, "", fmt.Errorf("%w: invalid scope %q", ErrInvalid, sc)
+		}
+	}
+	if req.ExpiresIn < 0 {
+		return nil, "", fmt.Errorf("%w: expires_in must not be negative", ErrInvalid)
+	}
+
+	ownerRole, ownerDomains, err := s.store.UserRole(ctx, subject)
+	if err != nil {
+		return nil, "", err
+	}
+	owner := &Principal{Subject: subject, Role: ownerRole, Domains: ownerDomains}
+	role := req.Role
+	if role == "" {
+		role = ownerRole
+	}
+	if _, err := ParseRole(string(role)); err != nil {
+		return nil, "", err
+	}
+	if !ownerRole.AtLeast(role) || !p.Role.AtLeast(role) {
+		return nil, "", fmt.Errorf("%w: role %s exceeds the permissions of %s", ErrForbidden, role, subject)
+	}
+	var domains []string
+	if role == RoleDomainAdmin {
+		domains = req.Domains
+		if len(domains) == 0 {
+			domains = ownerDomains
+		}
+		if len(domains) == 0 {
+			return nil, "", fmt.Errorf("%w: a domainadmin key needs at least one domain", ErrInvalid)
+		}
+		if !owner.canManageAll(domains) || !p.canManageAll(domains) {
+			return nil, "", fmt.Errorf("%w: domains exceed the permissions of %s", ErrForbidden, subject)
+		}
+	}
+
+	idBytes := make([]byte, 12)
+	if _, err := rand.Read(idBytes); err != nil {
+		return nil, "", err
+	}
+	secret, err := randomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+	id := hex.EncodeToString(idBytes)
+	token := apiKeyPrefix + id + "_" + secret
+
+	k := &APIKey{
+		ID:         id,
+		Name:       strings.TrimSpace(req.Name),
+		Subject:    subject,
+		Role:       role,
+		Domains:    domains,
+		Scopes:     req.Scopes,
+		SecretHash: hashSecret(token),
+		CreatedAt:  time.Now().UTC().Truncate(time.Second),
+	}
+	if req.ExpiresIn > 0 {
+		k.ExpiresAt = k.CreatedAt.Add(time.Duration(req.ExpiresIn) * time.Second)
+	}
+	if err := s.store.CreateKey(ctx, k); err != nil {
+		return nil, "", err
+	}
+	log.Printf("INFO: Created api key %s (%s) for %s by %s", k.ID, k.Name, k.Subject, p.Subject)
+	return k, token, nil
+}
+
+// ListKeys 列出调用方可见的密钥：超级管理员可指定 subject 或查看全部，其他用户只能查看自己的
+func (s *Service) ListKeys(ctx context.Context, p *Principal, subject string) ([]*APIKey, error) {
+	if p.Role != RoleSuperAdmin {
+		if subject != "" && !strings.EqualFold(subject, p.Subject) {
+			return nil, fmt.Errorf("%w: cannot list keys of other users", ErrForbidden)
+		}
+		subject = p.Subject
+	}
+	return s.store.ListKeys(ctx, subject)
+}
+
+// RevokeKey 吊销密钥，只有所属用户和超级管理员可以吊销
+func (s *Service) RevokeKey(ctx context.Context, p *Principal, id string) error {
+	k, err := s.store.GetKey(ctx, id)
+	if err != nil {
+		return err
+	}
+	if p.Role != RoleSuperAdmin && !strings.EqualFold(k.Subject, p.Subject) {
+		// 不暴露他人密钥是否存在
+		return fmt.Errorf("%w: api key %s", ErrNotFound, id)
+	}
+	if err := s.store.RevokeKey(ctx, id); err != nil {
+		return err
+	}
+	log.Printf("INFO: Revoked api key %s by %s", id, p.Subject)
+	return nil
+}
@@ -0,0 +1,301 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"YoPost/internal/db/mysql"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// APIKey API 密钥，服务器只保存密钥的 SHA-256 哈希
+type APIKey struct {
+	ID         string
+	Name       string
+	Subject    string // 密钥所属用户
+	Role       Role
+	Domains    []string
+	Scopes     []string
+	SecretHash string
+	CreatedAt  time.Time
+	ExpiresAt  time.Time // 零值表示不过期
+	LastUsedAt time.Time // 零值表示从未使用
+	RevokedAt  time.Time // 零值表示未吊销
+}
+
+// Active 判断密钥在 now 时是否可用
+func (k *APIKey) Active(now time.Time) bool {
+	return k.RevokedAt.IsZero() && (k.ExpiresAt.IsZero() || now.Before(k.ExpiresAt))
+}
+
+// Store 认证数据存储
+type Store interface {
+	// CheckPassword 校验用户密码，用户不存在时返回 false
+	CheckPassword(ctx context.Context, username, password string) (bool, error)
+	// UserRole 返回用户的角色和可管理的域名，用户不存在时返回 ErrNotFound
+	UserRole(ctx context.Context, username string) (Role, []string, error)
+	// ProvisionUser 创建没有可用密码的普通用户，用于 OIDC 首次登录
+	ProvisionUser(ctx context.Context, username string) error
+
+	CreateKey(ctx context.Context, k *APIKey) error
+	// GetKey 按 ID 读取密钥，包括已吊销的，不存在时返回 ErrNotFound
+	GetKey(ctx context.Context, id string) (*APIKey, error)
+	// ListKeys 按创建时间列出 subject 的密钥，subject 为空时列出全部
+	ListKeys(ctx context.Context, subject string) ([]*APIKey, error)
+	// RevokeKey 吊销密钥，不存在或已吊销时返回 ErrNotFound
+	RevokeKey(ctx context.Context, id string) error
+	TouchKey(ctx context.Context, id string, at time.Time) error
+
+	SaveRefreshToken(ctx context.Context, hash, username string, expires time.Time) error
+	// ConsumeRefreshToken 删除刷新令牌并返回所属用户，不存在或已过期时返回 ErrNotFound
+	ConsumeRefreshToken(ctx context.Context, hash string) (string, error)
+}
+
+// mysqlStore 基于 MySQL users/domain_admins/api_keys/refresh_tokens 表的存储
+type mysqlStore struct {
+	c *mysql.MySQLClient
+}
+
+// NewMySQLStore 创建基于 MySQL 的认证存储
+func NewMySQLStore(c *mysql.MySQLClient) Store {
+	return mysqlStore{c}
+}
+
+// mysqlErr 将 mysql.ErrNotFound 转换为 ErrNotFound
+func mysqlErr(err error) error {
+	if errors.Is(err, mysql.ErrNotFound) {
+		return fmt.Errorf("%w: %v", ErrNotFound, err)
+	}
+	return err
+}
+
+func (s mysqlStore) CheckPassword(ctx context.Context, username, password string) (bool, error) {
+	return s.c.CheckPassword(ctx, username, password)
+}
+
+func (s mysqlStore) UserRole(ctx context.Context, username string) (Role, []string, error) {
+	role, domains, err := s.c.UserRole(ctx, username)
+	return Role(role), domains, mysqlErr(err)
+}
+
+func (s mysqlStore) ProvisionUser(ctx context.Context, username string) error {
+	password, err := randomToken(32)
+	if err != nil {
+		return err
+	}
+	return s.c.AddUser(ctx, username, password)
+}
+
+func (s mysqlStore) CreateKey(ctx context.Context, k *APIKey) error {
+	return s.c.CreateAPIKey(ctx, &mysql.APIKey{
+		ID:         k.ID,
+		Name:       k.Name,
+		Subject:    k.Subject,
+		Role:       string(k.Role),
+		Domains:    k.Domains,
+		Scopes:     k.Scopes,
+		SecretHash: k.SecretHash,
+		CreatedAt:  k.CreatedAt,
+		ExpiresAt:  k.ExpiresAt,
+	})
+}
+
+func fromMySQLKey(k *mysql.APIKey) *APIKey {
+	return &APIKey{
+		ID:         k.ID,
+		Name:       k.Name,
+		Subject:    k.Subject,
+		Role:       Role(k.Role),
+		Domains:    k.Domains,
+		Scopes:     k.Scopes,
+		SecretHash: k.SecretHash,
+		CreatedAt:  k.CreatedAt,
+		ExpiresAt:  k.ExpiresAt,
+		LastUsedAt: k.LastUsedAt,
+		RevokedAt:  k.RevokedAt,
+	}
+}
+
+func (s mysqlStore) GetKey(ctx context.Context, id string) (*APIKey, error) {
+	k, err := s.c.GetAPIKey(ctx, id)
+	if err != nil {
+		return nil, mysqlErr(err)
+	}
+	return fromMySQLKey(k), nil
+}
+
+func (s mysqlStore) ListKeys(ctx context.Context, subject string) ([]*APIKey, error) {
+	list, err := s.c.ListAPIKeys(ctx, subject)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]*APIKey, len(list))
+	for i, k := range list {
+		keys[i] = fromMySQLKey(k)
+	}
+	return keys, nil
+}
+
+func (s mysqlStore) RevokeKey(ctx context.Context, id string) error {
+	return mysqlErr(s.c.RevokeAPIKey(ctx, id))
+}
+
+func (s mysqlStore) TouchKey(ctx context.Context, id string, at time.Time) error {
+	return s.c.TouchAPIKey(ctx, id, at)
+}
+
+func (s mysqlStore) SaveRefreshToken(ctx context.Context, hash, username string, expires time.Time) error {
+	return s.c.SaveRefreshToken(ctx, hash, username, expires)
+}
+
+func (s mysqlStore) ConsumeRefreshToken(ctx context.Context, hash string) (string, error) {
+	username, err := s.c.ConsumeRefreshToken(ctx, hash)
+	return username, mysqlErr(err)
+}
+
+// MemoryStore 进程内认证存储，用于测试和嵌入式场景
+type MemoryStore struct {
+	mu      sync.Mutex
+	users   map[string]*memoryUser
+	keys    map[string]*APIKey
+	refresh map[string]refreshToken
+}
+
+type memoryUser struct {
+	hash    []byte
+	role    Role
+	domains []string
+}
+
+type refreshToken struct {
+	username string
+	expires  time.Time
+}
+
+// NewMemoryStore 创建空的内存认证存储
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users:   make(map[string]*memoryUser),
+		keys:    make(map[string]*APIKey),
+		refresh: make(map[string]refreshToken),
+	}
+}
+
+// AddUser 添加或替换用户，domains 为域管理员可管理的域名
+func (s *MemoryStore) AddUser(username, password string, role Role, domains ...string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.users[strings.ToLower(username)] = &memoryUser{hash: hash, role: role, domains: domains}
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MemoryStore) CheckPassword(ctx context.Context, username, password string) (bool, error) {
+	s.mu.Lock()
+	u, ok := s.users[strings.ToLower(username)]
+	s.mu.Unlock()
+	return ok && bcrypt.CompareHashAndPassword(u.hash, []byte(password)) == nil, nil
+}
+
+func (s *MemoryStore) UserRole(ctx context.Context, username string) (Role, []string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[strings.ToLower(username)]
+	if !ok {
+		return "", nil, fmt.Errorf("%w: user %s", ErrNotFound, username)
+	}
+	return u.role, append([]string(nil), u.domains...), nil
+}
+
+func (s *MemoryStore) ProvisionUser(ctx context.Context, username string) error {
+	password, err := randomToken(32)
+	if err != nil {
+		return err
+	}
+	return s.AddUser(username, password, RoleUser)
+}
+
+func (s *MemoryStore) CreateKey(ctx context.Context, k *APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := *k
+	s.keys[k.ID] = &c
+	return nil
+}
+
+func (s *MemoryStore) GetKey(ctx context.Context, id string) (*APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, ok := s.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: api key %s", ErrNotFound, id)
+	}
+	c := *k
+	return &c, nil
+}
+
+func (s *MemoryStore) ListKeys(ctx context.Context, subject string) ([]*APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var keys []*APIKey
+	for _, k := range s.keys {
+		if subject == "" || k.Subject == subject {
+			c := *k
+			keys = append(keys, &c)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+		}
+		return keys[i].ID < keys[j].ID
+	})
+	return keys, nil
+}
+
+func (s *MemoryStore) RevokeKey(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, ok := s.keys[id]
+	if !ok || !k.RevokedAt.IsZero() {
+		return fmt.Errorf("%w: api key %s", ErrNotFound, id)
+	}
+	k.RevokedAt = time.Now()
+	return nil
+}
+
+func (s *MemoryStore) TouchKey(ctx context.Context, id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if k, ok := s.keys[id]; ok {
+		k.LastUsedAt = at
+	}
+	return nil
+}
+
+func (s *MemoryStore) SaveRefreshToken(ctx context.Context, hash, username string, expires time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refresh[hash] = refreshToken{username: username, expires: expires}
+	return nil
+}
+
+func (s *MemoryStore) ConsumeRefreshToken(ctx context.Context, hash string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.refresh[hash]
+	delete(s.refresh, hash)
+	if !ok || time.Now().After(t.expires) {
+		return "", ErrNotFound
+	}
+	return t.username, nil
+}
@@ -0,0 +1,239 @@
+// Package bulk 批量发送 (邮件合并)：一个模板加一组收件人，每个收件人用自己的变量渲染出
+// 一封独立的邮件放入出站队列，按收件人域名限速，批次进度和每个收件人的状态持久化保存
+package bulk
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/mail"
+	"strings"
+	"time"
+
+	"YoPost/internal/mail/compose"
+	"YoPost/internal/mail/queue"
+	"YoPost/internal/templates"
+)
+
+// ErrNotFound 批次不存在
+var ErrNotFound = errors.New("bulk: batch not found")
+
+// BatchStatus 批次状态
+type BatchStatus string
+
+const (
+	// BatchSending 仍有收件人等待放入队列或等待投递结果
+	BatchSending BatchStatus = "sending"
+	// BatchCompleted 全部收件人都已投递、失败或取消
+	BatchCompleted BatchStatus = "completed"
+	// BatchCancelled 批次已取消，已放入队列的邮件继续投递
+	BatchCancelled BatchStatus = "cancelled"
+)
+
+// Status 收件人状态
+type Status string
+
+const (
+	// StatusPending 等待按域名限速放入出站队列
+	StatusPending Status = "pending"
+	// StatusQueued 已放入出站队列，尚无投递结果
+	StatusQueued Status = "queued"
+	// StatusDeferred 投递临时失败，等待队列重试
+	StatusDeferred  Status = "deferred"
+	StatusDelivered Status = "delivered"
+	// StatusFailed 渲染失败、提交时被拒绝或退信
+	StatusFailed Status = "failed"
+	// StatusCancelled 批次取消时尚未放入队列
+	StatusCancelled Status = "cancelled"
+)
+
+// Statuses 全部收件人状态
+var Statuses = []Status{StatusPending, StatusQueued, StatusDeferred, StatusDelivered, StatusFailed, StatusCancelled}
+
+// Batch 一次批量发送
+type Batch struct {
+	ID    string `bson:"-" json:"id"`
+	Owner string `bson:"owner" json:"owner"`
+	// From 发件人地址，必须是 Owner 本人或指向 Owner 的别名
+	From     string `bson:"from" json:"from"`
+	FromName string `bson:"from_name,omitempty" json:"from_name,omitempty"`
+	// Template 创建时的模板副本，之后修改或删除模板不影响批次
+	Template         templates.Template `bson:"template" json:"-"`
+	TemplateID       string             `bson:"template_id" json:"template_id"`
+	TemplateRevision int64              `bson:"template_revision" json:"template_revision"`
+	// Locale 收件人没有指定语言时使用
+	Locale string `bson:"locale,omitempty" json:"locale,omitempty"`
+	// Variables 全部收件人共用的变量，收件人的同名变量优先
+	Variables map[string]interface{} `bson:"-" json:"variables,omitempty"`
+	Headers   map[string]string      `bson:"headers,omitempty" json:"headers,omitempty"`
+	Status    BatchStatus            `bson:"status" json:"status"`
+	Total     int                    `bson:"total" json:"total"`
+	// Counts 各状态的收件人数，由存储在读取时统计
+	Counts      Counts     `bson:"-" json:"counts"`
+	CreatedAt   time.Time  `bson:"created_at" json:"created_at"`
+	CompletedAt *time.Time `bson:"completed_at,omitempty" json:"completed_at,omitempty"`
+}
+
+// Recipient 批次中的一个收件人
+type Recipient struct {
+	BatchID string `bson:"batch_id" json:"-"`
+	// Index 收件人在请求中的序号，从 0 开始
+	Index   int    `bson:"index" json:"index"`
+	Address string `bson:"address" json:"address"`
+	Name    string `bson:"name,omitempty" json:"name,omitempty"`
+	Locale  string `bson:"locale,omitempty" json:"locale,omitempty"`
+	// Variables 该收件人的变量
+	Variables map[string]interface{} `bson:"-" json:"variables,omitempty"`
+	Status    Status                 `bson:"status" json:"status"`
+	// MessageID 在取走时设置，QueueID 在放入出站队列后设置
+	QueueID   string `bson:"queue_id,omitempty" json:"queue_id,omitempty"`
+	MessageID string `bson:"message_id,omitempty" json:"message_id,omitempty"`
+	Attempts  int    `bson:"attempts" json:"attempts"`
+	// Error 最后一次失败的原因
+	Error     string    `bson:"error,omitempty" json:"error,omitempty"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// Domain 返回收件人地址的域名 (小写)
+func (r *Recipient) Domain() string {
+	return strings.ToLower(r.Address[strings.LastIndexByte(r.Address, '@')+1:])
+}
+
+// Counts 各状态的收件人数
+type Counts struct {
+	Pending   int `json:"pending"`
+	Queued    int `json:"queued"`
+	Deferred  int `json:"deferred"`
+	Delivered int `json:"delivered"`
+	Failed    int `json:"failed"`
+	Cancelled int `json:"cancelled"`
+}
+
+func (c *Counts) add(status Status, n int) {
+	switch status {
+	case StatusPending:
+		c.Pending += n
+	case StatusQueued:
+		c.Queued += n
+	case StatusDeferred:
+		c.Deferred += n
+	case StatusDelivered:
+		c.Delivered += n
+	case StatusFailed:
+		c.Failed += n
+	case StatusCancelled:
+		c.Cancelled += n
+	}
+}
+
+// Done 判断是否全部收件人都已有最终结果
+func (c Counts) Done() bool {
+	return c.Pending+c.Queued+c.Deferred == 0
+}
+
+// Store 批次与收件人存储
+type Store interface {
+	// Create 保存批次及其收件人，设置批次 ID 和 CreatedAt，收件人的 BatchID 和 UpdatedAt
+	Create(ctx context.Context, b *Batch, rcpts []*Recipient) error
+	// Get 返回批次并统计 Counts
+	Get(ctx context.Context, id string) (*Batch, error)
+	// List 按创建时间从新到旧列出批次并统计 Counts，owner 为空时列出全部
+	List(ctx context.Context, owner string) ([]*Batch, error)
+	// Sending 按创建时间从早到晚列出 sending 状态的批次并统计 Counts
+	Sending(ctx context.Context) ([]*Batch, error)
+	// Finish 将 sending 状态的批次改为 status 并设置 CompletedAt，批次已结束时返回 false
+	Finish(ctx context.Context, b *Batch, status BatchStatus) (bool, error)
+	// Recipients 按序号列出批次的收件人，status 为空时不过滤
+	Recipients(ctx context.Context, batchID string, status Status) ([]*Recipient, error)
+	// Claim 将 pending 状态的收件人改为 queued 并设置 MessageID；收件人已不是 pending
+	// (批次已取消或被其他进程取走) 时返回 false
+	Claim(ctx context.Context, batchID string, index int, messageID string) (bool, error)
+	// SetQueueID 记录收件人的出站队列 ID，不改变状态和 UpdatedAt
+	SetQueueID(ctx context.Context, batchID string, index int, queueID string) error
+	// Record 记录收件人的状态、尝试次数和失败原因
+	Record(ctx context.Context, batchID string, index int, status Status, attempts int, reason string) error
+	// Reclaim 将批次中 queued 状态、没有 QueueID 且 UpdatedAt 早于 before 的收件人改回 pending
+	// 并清除 MessageID，返回修改数量；用于取走后未放入出站队列就退出的进程
+	Reclaim(ctx context.Context, batchID string, before time.Time) (int, error)
+	// CancelPending 将批次中 pending 状态的收件人改为 cancelled，返回修改数量
+	CancelPending(ctx context.Context, batchID string) (int, error)
+}
+
+// merge 合并批次和收件人的变量，并提供收件人地址 email 和姓名 name，变量中的同名值优先
+func merge(b *Batch, r *Recipient) map[string]interface{} {
+	vars := map[string]interface{}{"email": r.Address, "name": r.Name}
+	for k, v := range b.Variables {
+		vars[k] = v
+	}
+	for k, v := range r.Variables {
+		vars[k] = v
+	}
+	return vars
+}
+
+// Renderer 渲染批次中收件人的邮件，按语言缓存编译后的模板
+type Renderer struct {
+	batch    *Batch
+	compiled map[string]*templates.Compiled
+}
+
+// Renderer 返回批次的 Renderer
+func (b *Batch) Renderer() *Renderer {
+	return &Renderer{batch: b, compiled: make(map[string]*templates.Compiled)}
+}
+
+// Message 渲染模板并返回发给 r 的邮件，返回的错误均为渲染错误
+func (rd *Renderer) Message(r *Recipient) (*compose.Message, error) {
+	b := rd.batch
+	locale := r.Locale
+	if locale == "" {
+		locale = b.Locale
+	}
+	c, ok := rd.compiled[locale]
+	if !ok {
+		var err error
+		if c, err = b.Template.Compile(locale); err != nil {
+			return nil, err
+		}
+		rd.compiled[locale] = c
+	}
+	out, err := c.Render(merge(b, r))
+	if err != nil {
+		return nil, err
+	}
+	return &compose.Message{
+		From:    &mail.Address{Name: b.FromName, Address: b.From},
+		To:      []*mail.Address{{Name: r.Name, Address: r.Address}},
+		Subject: out.Subject,
+		Text:    out.Text,
+		HTML:    out.HTML,
+		Headers: b.Headers,
+	}, nil
+}
+
+// result 出站队列投递结果对应的收件人状态
+var result = map[queue.Result]Status{
+	queue.Delivered: StatusDelivered,
+	queue.Deferred:  StatusDeferred,
+	queue.Bounced:   StatusFailed,
+}
+
+// Notifier 返回将出站队列中批量邮件的投递结果写回收件人状态的 queue.Notifier
+func Notifier(st Store) queue.Notifier {
+	return func(ctx context.Context, item *queue.Item, res queue.Result, err error) {
+		if item.Batch == "" || st == nil {
+			return
+		}
+		// 投递成功时队列不增加 Attempts
+		attempts, reason := item.Attempts, ""
+		if res == queue.Delivered {
+			attempts++
+		}
+		if err != nil {
+			reason = err.Error()
+		}
+		if rerr := st.Record(ctx, item.Batch, item.BatchIndex, result[res], attempts, reason); rerr != nil {
+			log.Printf("ERROR: Failed to record delivery result of batch %s recipient %d - %v", item.Batch, item.BatchIndex, rerr)
+		}
+	}
+}
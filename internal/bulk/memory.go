@@ -0,0 +1,226 @@
+package bulk
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"YoPost/internal/templates"
+)
+
+// MemoryStore 进程内存储，用于开发环境和嵌入式场景
+type MemoryStore struct {
+	mu         sync.Mutex
+	nextID     int64
+	batches    map[string]*Batch
+	recipients map[string][]*Recipient
+}
+
+// NewMemoryStore 创建内存存储
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{batches: make(map[string]*Batch), recipients: make(map[string][]*Recipient)}
+}
+
+func copyBatch(b *Batch) *Batch {
+	c := *b
+	c.Template.Variants = append([]templates.Variant(nil), b.Template.Variants...)
+	return &c
+}
+
+func copyRecipient(r *Recipient) *Recipient {
+	c := *r
+	return &c
+}
+
+// counts 统计批次中各状态的收件人数，调用方需持有锁
+func (s *MemoryStore) counts(id string) Counts {
+	var c Counts
+	for _, r := range s.recipients[id] {
+		c.add(r.Status, 1)
+	}
+	return c
+}
+
+func (s *MemoryStore) Create(ctx context.Context, b *Batch, rcpts []*Recipient) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	b.ID = strconv.FormatInt(s.nextID, 16)
+	if b.CreatedAt.IsZero() {
+		b.CreatedAt = time.Now()
+	}
+	b.Total = len(rcpts)
+	list := make([]*Recipient, len(rcpts))
+	for i, r := range rcpts {
+		r.BatchID, r.UpdatedAt = b.ID, b.CreatedAt
+		list[i] = copyRecipient(r)
+	}
+	s.batches[b.ID] = copyBatch(b)
+	s.recipients[b.ID] = list
+	return nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id string) (*Batch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.batches[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	c := copyBatch(b)
+	c.Counts = s.counts(id)
+	return c, nil
+}
+
+func (s *MemoryStore) List(ctx context.Context, owner string) ([]*Batch, error) {
+	return s.list(func(b *Batch) bool { return owner == "" || b.Owner == owner }, true), nil
+}
+
+func (s *MemoryStore) Sending(ctx context.Context) ([]*Batch, error) {
+	return s.list(func(b *Batch) bool { return b.Status == BatchSending }, false), nil
+}
+
+// list 按创建时间排序返回满足条件的批次
+func (s *MemoryStore) list(match func(*Batch) bool, newest bool) []*Batch {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var out []*Batch
+	for id, b := range s.batches {
+		if !match(b) {
+			continue
+		}
+		c := copyBatch(b)
+		c.Counts = s.counts(id)
+		out = append(out, c)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if newest {
+			a, b = b, a
+		}
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		return a.ID < b.ID
+	})
+	return out
+}
+
+func (s *MemoryStore) Finish(ctx context.Context, b *Batch, status BatchStatus) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, ok := s.batches[b.ID]
+	if !ok {
+		return false, ErrNotFound
+	}
+	if old.Status != BatchSending {
+		return false, nil
+	}
+	now := time.Now()
+	old.Status, old.CompletedAt = status, &now
+	b.Status, b.CompletedAt = status, &now
+	return true, nil
+}
+
+func (s *MemoryStore) Recipients(ctx context.Context, batchID string, status Status) ([]*Recipient, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.batches[batchID]; !ok {
+		return nil, ErrNotFound
+	}
+	var out []*Recipient
+	for _, r := range s.recipients[batchID] {
+		if status == "" || r.Status == status {
+			out = append(out, copyRecipient(r))
+		}
+	}
+	return out, nil
+}
+
+// recipient 返回批次中的收件人，调用方需持有锁
+func (s *MemoryStore) recipient(batchID string, index int) (*Recipient, error) {
+	list := s.recipients[batchID]
+	if index < 0 || index >= len(list) {
+		return nil, ErrNotFound
+	}
+	return list[index], nil
+}
+
+func (s *MemoryStore) Claim(ctx context.Context, batchID string, index int, messageID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, err := s.recipient(batchID, index)
+	if err != nil {
+		return false, err
+	}
+	if r.Status != StatusPending {
+		return false, nil
+	}
+	r.Status, r.MessageID, r.UpdatedAt = StatusQueued, messageID, time.Now()
+	return true, nil
+}
+
+func (s *MemoryStore) SetQueueID(ctx context.Context, batchID string, index int, queueID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, err := s.recipient(batchID, index)
+	if err != nil {
+		return err
+	}
+	r.QueueID = queueID
+	return nil
+}
+
+func (s *MemoryStore) Record(ctx context.Context, batchID string, index int, status Status, attempts int, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, err := s.recipient(batchID, index)
+	if err != nil {
+		return err
+	}
+	r.Status, r.Attempts, r.Error, r.UpdatedAt = status, attempts, reason, time.Now()
+	return nil
+}
+
+func (s *MemoryStore) Reclaim(ctx context.Context, batchID string, before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	now := time.Now()
+	for _, r := range s.recipients[batchID] {
+		if r.Status == StatusQueued && r.QueueID == "" && r.UpdatedAt.Before(before) {
+			r.Status, r.MessageID, r.UpdatedAt = StatusPending, "", now
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *MemoryStore) CancelPending(ctx context.Context, batchID string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.batches[batchID]; !ok {
+		return 0, ErrNotFound
+	}
+	n := 0
+	now := time.Now()
+	for _, r := range s.recipients[batchID] {
+		if r.Status == StatusPending {
+			r.Status, r.UpdatedAt = StatusCancelled, now
+			n++
+		}
+	}
+	return n, nil
+}
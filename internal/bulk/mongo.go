@@ -0,0 +1,309 @@
+package bulk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// insertChunk 每次 InsertMany 写入的收件人数
+const insertChunk = 1000
+
+// MongoStore 基于 MongoDB bulk_batches 和 bulk_recipients 集合的存储
+type MongoStore struct {
+	batches    *mongo.Collection
+	recipients *mongo.Collection
+}
+
+// 变量以 JSON 保存，读取时与请求中的类型一致 (BSON 中的嵌套文档会被解码为 primitive.D)
+type mongoBatch struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	Batch     `bson:",inline"`
+	Variables []byte `bson:"variables,omitempty"`
+}
+
+func (d *mongoBatch) batch() *Batch {
+	d.Batch.ID = d.ID.Hex()
+	d.Batch.Variables = decodeVariables(d.Variables)
+	return &d.Batch
+}
+
+type mongoRecipient struct {
+	Recipient `bson:",inline"`
+	Variables []byte `bson:"variables,omitempty"`
+}
+
+func (d *mongoRecipient) recipient() *Recipient {
+	d.Recipient.Variables = decodeVariables(d.Variables)
+	return &d.Recipient
+}
+
+func encodeVariables(vars map[string]interface{}) []byte {
+	if len(vars) == 0 {
+		return nil
+	}
+	b, _ := json.Marshal(vars)
+	return b
+}
+
+func decodeVariables(b []byte) map[string]interface{} {
+	if len(b) == 0 {
+		return nil
+	}
+	var vars map[string]interface{}
+	json.Unmarshal(b, &vars)
+	return vars
+}
+
+// NewMongoStore 创建 MongoDB 存储
+func NewMongoStore(db *mongo.Database) *MongoStore {
+	return &MongoStore{
+		batches:    db.Collection("bulk_batches"),
+		recipients: db.Collection("bulk_recipients"),
+	}
+}
+
+// EnsureIndexes 创建按批次查询收件人和按用户列出批次所需的索引
+func (s *MongoStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.recipients.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "batch_id", Value: 1}, {Key: "index", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "batch_id", Value: 1}, {Key: "status", Value: 1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create bulk recipient indexes: %v", err)
+	}
+	_, err = s.batches.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "owner", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create bulk batch indexes: %v", err)
+	}
+	return nil
+}
+
+func (s *MongoStore) Create(ctx context.Context, b *Batch, rcpts []*Recipient) error {
+	if b.CreatedAt.IsZero() {
+		b.CreatedAt = time.Now()
+	}
+	b.Total = len(rcpts)
+	oid := primitive.NewObjectID()
+	b.ID = oid.Hex()
+
+	// 先写入收件人，批次可见时收件人已经完整
+	for start := 0; start < len(rcpts); start += insertChunk {
+		end := start + insertChunk
+		if end > len(rcpts) {
+			end = len(rcpts)
+		}
+		docs := make([]interface{}, 0, end-start)
+		for _, r := range rcpts[start:end] {
+			r.BatchID, r.UpdatedAt = b.ID, b.CreatedAt
+			docs = append(docs, mongoRecipient{Recipient: *r, Variables: encodeVariables(r.Variables)})
+		}
+		if _, err := s.recipients.InsertMany(ctx, docs); err != nil {
+			s.recipients.DeleteMany(context.WithoutCancel(ctx), bson.M{"batch_id": b.ID})
+			return err
+		}
+	}
+	if _, err := s.batches.InsertOne(ctx, mongoBatch{ID: oid, Batch: *b, Variables: encodeVariables(b.Variables)}); err != nil {
+		s.recipients.DeleteMany(context.WithoutCancel(ctx), bson.M{"batch_id": b.ID})
+		return err
+	}
+	return nil
+}
+
+// counts 统计批次中各状态的收件人数
+func (s *MongoStore) counts(ctx context.Context, batches []*Batch) error {
+	if len(batches) == 0 {
+		return nil
+	}
+	byID := make(map[string]*Batch, len(batches))
+	ids := make([]string, len(batches))
+	for i, b := range batches {
+		byID[b.ID], ids[i] = b, b.ID
+	}
+	cur, err := s.recipients.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"batch_id": bson.M{"$in": ids}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id": bson.M{"batch": "$batch_id", "status": "$status"},
+			"n":   bson.M{"$sum": 1},
+		}}},
+	})
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		var row struct {
+			ID struct {
+				Batch  string `bson:"batch"`
+				Status Status `bson:"status"`
+			} `bson:"_id"`
+			N int `bson:"n"`
+		}
+		if err := cur.Decode(&row); err != nil {
+			return err
+		}
+		if b, ok := byID[row.ID.Batch]; ok {
+			b.Counts.add(row.ID.Status, row.N)
+		}
+	}
+	return cur.Err()
+}
+
+func (s *MongoStore) Get(ctx context.Context, id string) (*Batch, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	var doc mongoBatch
+	err = s.batches.FindOne(ctx, bson.M{"_id": oid}).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	b := doc.batch()
+	if err := s.counts(ctx, []*Batch{b}); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (s *MongoStore) List(ctx context.Context, owner string) ([]*Batch, error) {
+	filter := bson.M{}
+	if owner != "" {
+		filter["owner"] = owner
+	}
+	return s.find(ctx, filter, -1)
+}
+
+func (s *MongoStore) Sending(ctx context.Context) ([]*Batch, error) {
+	return s.find(ctx, bson.M{"status": BatchSending}, 1)
+}
+
+// find 按创建时间排序返回批次并统计 Counts，order 为 1 时从早到晚
+func (s *MongoStore) find(ctx context.Context, filter bson.M, order int) ([]*Batch, error) {
+	cur, err := s.batches.Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: order}, {Key: "_id", Value: order}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var out []*Batch
+	for cur.Next(ctx) {
+		var doc mongoBatch
+		if err := cur.Decode(&doc); err != nil {
+			return nil, err
+		}
+		out = append(out, doc.batch())
+	}
+	if err := cur.Err(); err != nil {
+		return nil, err
+	}
+	return out, s.counts(ctx, out)
+}
+
+func (s *MongoStore) Finish(ctx context.Context, b *Batch, status BatchStatus) (bool, error) {
+	oid, err := primitive.ObjectIDFromHex(b.ID)
+	if err != nil {
+		return false, ErrNotFound
+	}
+
+	now := time.Now()
+	res, err := s.batches.UpdateOne(ctx, bson.M{"_id": oid, "status": BatchSending},
+		bson.M{"$set": bson.M{"status": status, "completed_at": now}})
+	if err != nil {
+		return false, err
+	}
+	if res.MatchedCount == 0 {
+		return false, nil
+	}
+	b.Status, b.CompletedAt = status, &now
+	return true, nil
+}
+
+func (s *MongoStore) Recipients(ctx context.Context, batchID string, status Status) ([]*Recipient, error) {
+	filter := bson.M{"batch_id": batchID}
+	if status != "" {
+		filter["status"] = status
+	}
+	cur, err := s.recipients.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "index", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var out []*Recipient
+	for cur.Next(ctx) {
+		var doc mongoRecipient
+		if err := cur.Decode(&doc); err != nil {
+			return nil, err
+		}
+		out = append(out, doc.recipient())
+	}
+	return out, cur.Err()
+}
+
+// update 修改一个收件人，返回是否匹配
+func (s *MongoStore) update(ctx context.Context, filter bson.M, set bson.M) (bool, error) {
+	res, err := s.recipients.UpdateOne(ctx, filter, bson.M{"$set": set})
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
+
+func (s *MongoStore) Claim(ctx context.Context, batchID string, index int, messageID string) (bool, error) {
+	return s.update(ctx,
+		bson.M{"batch_id": batchID, "index": index, "status": StatusPending},
+		bson.M{"status": StatusQueued, "message_id": messageID, "updated_at": time.Now()})
+}
+
+func (s *MongoStore) SetQueueID(ctx context.Context, batchID string, index int, queueID string) error {
+	ok, err := s.update(ctx, bson.M{"batch_id": batchID, "index": index}, bson.M{"queue_id": queueID})
+	if err == nil && !ok {
+		err = ErrNotFound
+	}
+	return err
+}
+
+func (s *MongoStore) Record(ctx context.Context, batchID string, index int, status Status, attempts int, reason string) error {
+	ok, err := s.update(ctx, bson.M{"batch_id": batchID, "index": index},
+		bson.M{"status": status, "attempts": attempts, "error": reason, "updated_at": time.Now()})
+	if err == nil && !ok {
+		err = ErrNotFound
+	}
+	return err
+}
+
+func (s *MongoStore) Reclaim(ctx context.Context, batchID string, before time.Time) (int, error) {
+	// queue_id 为 null 时也匹配没有该字段的文档
+	res, err := s.recipients.UpdateMany(ctx,
+		bson.M{"batch_id": batchID, "status": StatusQueued, "queue_id": nil, "updated_at": bson.M{"$lt": before}},
+		bson.M{"$set": bson.M{"status": StatusPending, "updated_at": time.Now()}, "$unset": bson.M{"message_id": ""}})
+	if err != nil {
+		return 0, err
+	}
+	return int(res.ModifiedCount), nil
+}
+
+func (s *MongoStore) CancelPending(ctx context.Context, batchID string) (int, error) {
+	res, err := s.recipients.UpdateMany(ctx,
+		bson.M{"batch_id": batchID, "status": StatusPending},
+		bson.M{"$set": bson.M{"status": StatusCancelled, "updated_at": time.Now()}})
+	if err != nil {
+		return 0, err
+	}
+	return int(res.ModifiedCount), nil
+}
@@ -0,0 +1,274 @@
+package bulk
+
+import (
+	"context"
+	"log"
+	"net/textproto"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"YoPost/internal/config"
+	"YoPost/internal/mail/compose"
+	"YoPost/internal/mail/queue"
+	"YoPost/internal/ratelimit"
+)
+
+// Submitter 校验收件人后将邮件放入出站队列，由 delivery.Local 实现
+type Submitter interface {
+	Enqueue(ctx context.Context, user string, item *queue.Item) error
+}
+
+// UnsubscribeFunc 返回发给 address 的批量邮件附加的退订头部
+type UnsubscribeFunc func(owner, address, batch string) map[string]string
+
+// Runner 按收件人域名限速，将批次中 pending 状态的收件人逐个渲染后放入出站队列，
+// 并在全部收件人都有结果后将批次标记为 completed
+type Runner struct {
+	store  Store
+	submit Submitter
+	config atomic.Pointer[config.BulkConfig]
+	wake   chan struct{}
+	mu     sync.Mutex
+	// buckets 每个收件人域名的令牌桶，容量为每分钟的邮件数
+	buckets map[string]*ratelimit.Bucket
+
+	// Interval 轮询间隔，默认 5 秒；Wake 会立即唤醒后台循环
+	Interval time.Duration
+	// Logger 为空时使用 log 包的默认 Logger
+	Logger *log.Logger
+	// Unsubscribe 可为空；批次已设置同名头部时保留批次的值
+	Unsubscribe UnsubscribeFunc
+}
+
+// NewRunner 创建 Runner，注册到 config.Holder 后支持热加载
+func NewRunner(st Store, submit Submitter, cfg config.BulkConfig) *Runner {
+	r := &Runner{store: st, submit: submit, wake: make(chan struct{}, 1), buckets: make(map[string]*ratelimit.Bucket)}
+	r.config.Store(&cfg)
+	return r
+}
+
+// Store 返回批次存储
+func (r *Runner) Store() Store {
+	return r.store
+}
+
+func (r *Runner) PrepareReload(cfg *config.Config) (func(), error) {
+	c := cfg.API.Bulk
+	return func() { r.config.Store(&c) }, nil
+}
+
+func (r *Runner) logf(format string, args ...interface{}) {
+	if r.Logger != nil {
+		r.Logger.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+func (r *Runner) interval() time.Duration {
+	if r.Interval > 0 {
+		return r.Interval
+	}
+	return 5 * time.Second
+}
+
+// Wake 唤醒后台循环，用于新建批次后立即开始发送
+func (r *Runner) Wake() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// rate 返回域名每分钟的邮件数，0 表示不限制
+func (r *Runner) rate(domain string) int {
+	cfg := r.config.Load()
+	for d, n := range cfg.DomainRates {
+		if strings.EqualFold(d, domain) {
+			return n
+		}
+	}
+	return cfg.DomainRate
+}
+
+// allow 从域名的令牌桶中取一个令牌，桶以每分钟 rate 个的速度补充，最多存 rate 个
+func (r *Runner) allow(domain string, now time.Time) bool {
+	rate := r.rate(domain)
+	if rate <= 0 {
+		return true
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b, ok := r.buckets[domain]
+	if !ok {
+		b = &ratelimit.Bucket{}
+		r.buckets[domain] = b
+	}
+	return b.Take(1, rate, time.Minute, now, true) == 0
+}
+
+// Run 处理批次直到 ctx 取消
+func (r *Runner) Run(ctx context.Context) {
+	r.logf("INFO: Bulk sender started (interval %s)", r.interval())
+	ticker := time.NewTicker(r.interval())
+	defer ticker.Stop()
+	for {
+		if _, err := r.ProcessDue(ctx); err != nil && ctx.Err() == nil {
+			r.logf("ERROR: Bulk send processing failed - %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			r.logf("INFO: Bulk sender stopped")
+			return
+		case <-ticker.C:
+		case <-r.wake:
+		}
+	}
+}
+
+// claimLease 收件人取走后放入出站队列的最长时间，超过后视为进程已退出，收件人改回 pending 重新发送
+const claimLease = 10 * time.Minute
+
+// ProcessDue 将限速允许的 pending 收件人放入出站队列，返回放入的数量
+func (r *Runner) ProcessDue(ctx context.Context) (int, error) {
+	batches, err := r.store.Sending(ctx)
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, b := range batches {
+		if ctx.Err() != nil {
+			break
+		}
+		if b.Counts.Queued > 0 {
+			r.reclaim(ctx, b)
+		}
+		if b.Counts.Pending > 0 {
+			n, err := r.process(ctx, b)
+			total += n
+			if err != nil {
+				return total, err
+			}
+			if n > 0 {
+				continue
+			}
+		}
+		if b.Counts.Done() {
+			r.complete(ctx, b)
+		}
+	}
+	return total, nil
+}
+
+// reclaim 将取走超过 claimLease 仍未放入出站队列的收件人改回 pending 并更新 b.Counts
+func (r *Runner) reclaim(ctx context.Context, b *Batch) {
+	n, err := r.store.Reclaim(ctx, b.ID, time.Now().Add(-claimLease))
+	if err != nil {
+		r.logf("ERROR: Failed to reclaim stale recipients of batch %s - %v", b.ID, err)
+		return
+	}
+	if n > 0 {
+		r.logf("WARNING: Reclaimed %d recipients of batch %s claimed more than %s ago but never queued", n, b.ID, claimLease)
+		b.Counts.Queued -= n
+		b.Counts.Pending += n
+	}
+}
+
+// process 处理一个批次的 pending 收件人，被限速的域名留到下一轮
+func (r *Runner) process(ctx context.Context, b *Batch) (int, error) {
+	rcpts, err := r.store.Recipients(ctx, b.ID, StatusPending)
+	if err != nil {
+		return 0, err
+	}
+	domain := b.From[strings.LastIndexByte(b.From, '@')+1:]
+	render := b.Renderer()
+	throttled := make(map[string]bool)
+	n := 0
+	for _, rcpt := range rcpts {
+		if ctx.Err() != nil {
+			break
+		}
+		d := rcpt.Domain()
+		if throttled[d] {
+			continue
+		}
+		if !r.allow(d, time.Now()) {
+			throttled[d] = true
+			continue
+		}
+		messageID := compose.NewMessageID(domain)
+		ok, err := r.store.Claim(ctx, b.ID, rcpt.Index, messageID)
+		if err != nil {
+			return n, err
+		}
+		if !ok {
+			continue
+		}
+		r.send(ctx, b, render, rcpt, messageID)
+		n++
+	}
+	return n, nil
+}
+
+// send 渲染一个已取走的收件人并放入出站队列，失败时记录到收件人状态
+func (r *Runner) send(ctx context.Context, b *Batch, render *Renderer, rcpt *Recipient, messageID string) {
+	// 收件人已取走，结果必须写回
+	ctx = context.WithoutCancel(ctx)
+	fail := func(reason string) {
+		r.logf("WARNING: Batch %s recipient %d (%s) failed - %s", b.ID, rcpt.Index, rcpt.Address, reason)
+		if err := r.store.Record(ctx, b.ID, rcpt.Index, StatusFailed, 0, reason); err != nil {
+			r.logf("ERROR: Failed to record batch %s recipient %d - %v", b.ID, rcpt.Index, err)
+		}
+	}
+
+	m, err := render.Message(rcpt)
+	if err != nil {
+		fail("failed to render template: " + err.Error())
+		return
+	}
+	m.MessageID = messageID
+	if r.Unsubscribe != nil {
+		m.Headers = withDefaults(m.Headers, r.Unsubscribe(b.Owner, rcpt.Address, b.ID))
+	}
+	raw, err := m.Build()
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+	item := &queue.Item{From: b.From, To: []string{rcpt.Address}, Raw: raw, Batch: b.ID, BatchIndex: rcpt.Index}
+	if err := r.submit.Enqueue(ctx, b.Owner, item); err != nil {
+		fail(err.Error())
+		return
+	}
+	if err := r.store.SetQueueID(ctx, b.ID, rcpt.Index, item.ID); err != nil {
+		r.logf("ERROR: Failed to record queue id of batch %s recipient %d - %v", b.ID, rcpt.Index, err)
+	}
+}
+
+// withDefaults 返回 headers 加上其中没有的 defaults，不修改 headers
+func withDefaults(headers, defaults map[string]string) map[string]string {
+	out := make(map[string]string, len(headers)+len(defaults))
+	for name, value := range defaults {
+		out[textproto.CanonicalMIMEHeaderKey(name)] = value
+	}
+	for name, value := range headers {
+		out[textproto.CanonicalMIMEHeaderKey(name)] = value
+	}
+	return out
+}
+
+// complete 将全部收件人都有结果的批次标记为 completed
+func (r *Runner) complete(ctx context.Context, b *Batch) {
+	ok, err := r.store.Finish(ctx, b, BatchCompleted)
+	if err != nil {
+		r.logf("ERROR: Failed to complete batch %s - %v", b.ID, err)
+		return
+	}
+	if ok {
+		c := b.Counts
+		r.logf("INFO: Batch %s of %s completed: %d delivered, %d failed, %d cancelled", b.ID, b.Owner, c.Delivered, c.Failed, c.Cancelled)
+	}
+}
@@ -0,0 +1,114 @@
+package bulk
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"YoPost/internal/config"
+	"YoPost/internal/mail/queue"
+	"YoPost/internal/templates"
+)
+
+func TestRunnerAllow(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	type allow struct {
+		domain string
+		after  time.Duration
+		want   bool
+	}
+	tests := []struct {
+		name   string
+		cfg    config.BulkConfig
+		allows []allow
+	}{
+		{"unlimited", config.BulkConfig{}, []allow{{"a.example", 0, true}, {"a.example", 0, true}}},
+		{"domain rate", config.BulkConfig{DomainRate: 2}, []allow{
+			{"a.example", 0, true}, {"a.example", 0, true}, {"a.example", 0, false},
+			{"b.example", 0, true},
+			{"a.example", 30 * time.Second, true}, {"a.example", 0, false},
+		}},
+		{"per domain override", config.BulkConfig{DomainRate: 1, DomainRates: map[string]int{"Big.example": 3}}, []allow{
+			{"big.example", 0, true}, {"big.example", 0, true}, {"big.example", 0, true}, {"big.example", 0, false},
+			{"a.example", 0, true}, {"a.example", 0, false},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRunner(NewMemoryStore(), nil, tt.cfg)
+			at := now
+			for i, a := range tt.allows {
+				at = at.Add(a.after)
+				if got := r.allow(a.domain, at); got != a.want {
+					t.Errorf("allow %d: allow(%s) = %v, want %v", i, a.domain, got, a.want)
+				}
+			}
+		})
+	}
+}
+
+// enqueuer 记录放入队列的邮件
+type enqueuer struct {
+	items []*queue.Item
+}
+
+func (e *enqueuer) Enqueue(ctx context.Context, user string, item *queue.Item) error {
+	item.ID = fmt.Sprintf("q%d", len(e.items))
+	e.items = append(e.items, item)
+	return nil
+}
+
+func TestProcessDueReclaim(t *testing.T) {
+	ctx := context.Background()
+	st := NewMemoryStore()
+	b := &Batch{
+		Owner:    "alice@example.com",
+		From:     "alice@example.com",
+		Template: templates.Template{Variants: []templates.Variant{{Locale: "en", Subject: "Hi {{.name}}", Text: "Hello {{.name}}"}}},
+		Status:   BatchSending,
+	}
+	rcpts := []*Recipient{
+		{Index: 0, Address: "a@example.net", Name: "A", Status: StatusPending},
+		{Index: 1, Address: "b@example.net", Name: "B", Status: StatusPending},
+		{Index: 2, Address: "c@example.net", Name: "C", Status: StatusPending},
+	}
+	if err := st.Create(ctx, b, rcpts); err != nil {
+		t.Fatal(err)
+	}
+	// 0 在放入队列前进程退出，1 已放入队列，都早于租约
+	for _, i := range []int{0, 1} {
+		if ok, err := st.Claim(ctx, b.ID, i, fmt.Sprintf("<m%d@example.com>", i)); !ok || err != nil {
+			t.Fatalf("Claim(%d) = %v, %v", i, ok, err)
+		}
+	}
+	st.SetQueueID(ctx, b.ID, 1, "old")
+	for _, r := range st.recipients[b.ID][:2] {
+		r.UpdatedAt = time.Now().Add(-2 * claimLease)
+	}
+
+	q := &enqueuer{}
+	n, err := NewRunner(st, q, config.BulkConfig{}).ProcessDue(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("ProcessDue() = %d, want 2", n)
+	}
+	var sent []int
+	for _, item := range q.items {
+		sent = append(sent, item.BatchIndex)
+	}
+	if fmt.Sprint(sent) != "[0 2]" {
+		t.Errorf("queued recipients %v, want [0 2]", sent)
+	}
+	got, err := st.Recipients(ctx, b.ID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []string{"q0", "old", "q1"} {
+		if got[i].Status != StatusQueued || got[i].QueueID != want {
+			t.Errorf("recipient %d = %s queue id %q, want queued %q", i, got[i].Status, got[i].QueueID, want)
+		}
+	}
+}
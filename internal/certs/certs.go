@@ -0,0 +1,73 @@
+package certs
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"sync/atomic"
+
+	"YoPost/internal/config"
+)
+
+// Store 持有当前服务端证书，支持热加载时原子替换
+// 已建立的 TLS 连接不受影响，新的握手使用新证书
+type Store struct {
+	cert atomic.Pointer[tls.Certificate]
+}
+
+// NewStore 加载证书，cfg 未配置证书时返回空的 Store
+func NewStore(cfg config.TLSConfig) (*Store, error) {
+	s := &Store{}
+	if cfg.CertFile == "" {
+		return s, nil
+	}
+	cert, err := load(cfg)
+	if err != nil {
+		return nil, err
+	}
+	s.cert.Store(cert)
+	return s, nil
+}
+
+func load(cfg config.TLSConfig) (*tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		log.Printf("ERROR: Failed to load certificate %s - %v", cfg.CertFile, err)
+		return nil, fmt.Errorf("tls: %v", err)
+	}
+	return &cert, nil
+}
+
+// Available 是否已加载证书
+func (s *Store) Available() bool {
+	return s.cert.Load() != nil
+}
+
+// TLSConfig 返回从 Store 动态获取证书的 tls.Config
+func (s *Store) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			cert := s.cert.Load()
+			if cert == nil {
+				return nil, fmt.Errorf("no certificate configured")
+			}
+			return cert, nil
+		},
+	}
+}
+
+// PrepareReload 实现 config.Reloadable，新证书加载失败时拒绝热加载
+func (s *Store) PrepareReload(cfg *config.Config) (func(), error) {
+	if cfg.TLS.CertFile == "" {
+		return func() { s.cert.Store(nil) }, nil
+	}
+	cert, err := load(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		s.cert.Store(cert)
+		log.Printf("INFO: Loaded new certificate from %s", cfg.TLS.CertFile)
+	}, nil
+}
@@ -1,58 +1,412 @@
 package config
 
 import (
+	"fmt"
 	"io/ioutil"
 	"log"
+	"os"
 	"path/filepath"
 
 	"gopkg.in/yaml.v2"
 )
 
-// MailServerConfig 邮件服务器配置结构
-type MailServerConfig struct {
-	Mailserver struct {
-		Host string `yaml:"host"`
-		Smtp struct {
-			TlsPort   string `yaml:"tls_port"`
-			NotlsPort string `yaml:"notls_port"`
-		} `yaml:"smtp"`
-	} `yaml:"mailserver"`
+// EnvConfigPath 指定配置文件路径的环境变量
+const EnvConfigPath = "YOPOST_CONFIG"
+
+// DefaultPaths 未指定配置文件时依次查找的路径
+var DefaultPaths = []string{
+	"yopost.yml",
+	filepath.Join("internal", "config", "yopost.yml"),
+	"/etc/yopost/yopost.yml",
 }
 
-// TestConfig 测试配置结构
-type TestConfig struct {
-	Userinfo []struct {
-		Username string `yaml:"username"`
-		Password string `yaml:"password"`
-		Email    string `yaml:"email"`
-	} `yaml:"userinfo"`
-	Email struct {
-		TestSubject string `yaml:"test_subject"`
-		TestBody    string `yaml:"test_body"`
-	} `yaml:"email"`
+// Config YoPost 统一配置
+// 每个键都可以用环境变量覆盖，见 ApplyEnv
+type Config struct {
+	Server    ServerConfig    `yaml:"server"`
+	Storage   StorageConfig   `yaml:"storage"`
+	TLS       TLSConfig       `yaml:"tls"`
+	Listeners ListenersConfig `yaml:"listeners"`
+	Relay     RelayConfig     `yaml:"relay"`
+	API       APIConfig       `yaml:"api"`
+	Quota     QuotaConfig     `yaml:"quota"`
+	Limits    LimitsConfig    `yaml:"limits"`
+	Auth      AuthConfig      `yaml:"auth"`
+	Webhooks  WebhooksConfig  `yaml:"webhooks"`
+	// Suppression 抑制列表本身通过 /api/v1/suppressions 管理
+	Suppression SuppressionConfig `yaml:"suppression"`
+	Spam        SpamConfig        `yaml:"spam"`
+}
+
+// ServerConfig 服务器基础配置
+type ServerConfig struct {
+	Hostname        string            `yaml:"hostname"`
+	Domains         []string          `yaml:"domains"`
+	Aliases         map[string]string `yaml:"aliases"`          // 别名地址 -> 目标地址
+	Routes          []InboundRoute    `yaml:"routes"`           // 转交给 HTTP 端点而不存入邮箱的地址
+	LogLevel        string            `yaml:"log_level"`        // debug | info | warn | error
+	ShutdownTimeout int               `yaml:"shutdown_timeout"` // 优雅关闭的最长等待时间 (秒)
 }
 
-// TLSConfig TLS配置结构
+// InboundRoute 发往 Match 的邮件解析后 POST 到 URL，不存入邮箱；
+// 推送失败时经出站队列重试，重试用尽后存入 Fallback 邮箱并发布 Webhook 事件
+type InboundRoute struct {
+	Match    string `yaml:"match"`    // 完整地址 support@example.com，或 *@inbound.example.com 匹配整个域名
+	URL      string `yaml:"url"`      // https 地址，本机地址允许 http
+	Format   string `yaml:"format"`   // json (默认) | multipart
+	Secret   string `yaml:"secret"`   // 非空时请求带 X-YoPost-Signature 签名
+	Timeout  int    `yaml:"timeout"`  // 单次请求超时 (秒)，0 表示 30 秒
+	Retries  int    `yaml:"retries"`  // 首次失败后的重试次数，间隔同出站队列 (1m、2m、4m …)
+	Fallback string `yaml:"fallback"` // 重试用尽后存入的本地邮箱，为空时为收件人本身
+}
+
+// StorageConfig 存储配置
+type StorageConfig struct {
+	MySQL      DatabaseConfig   `yaml:"mysql"`
+	MongoDB    DatabaseConfig   `yaml:"mongodb"`
+	Encryption EncryptionConfig `yaml:"encryption"`
+}
+
+// DatabaseConfig 数据库连接配置，字段与 mysql.MySQLConfig / mongodb.MongoDBConfig 一致，可直接类型转换
+type DatabaseConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	Database string `yaml:"database"`
+}
+
+// TLSConfig 服务端证书配置
 type TLSConfig struct {
-	Enabled bool              `yaml:"enabled"`
-	Servers map[string]string `yaml:"servers"` // 格式: "host:port": status
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+}
+
+// ListenersConfig 协议监听配置
+type ListenersConfig struct {
+	SMTP InboundConfig `yaml:"smtp"`
+}
+
+// InboundConfig 入站 SMTP 配置
+type InboundConfig struct {
+	Enabled         bool   `yaml:"enabled"`
+	Listen          string `yaml:"listen"`
+	MaxMessageBytes int64  `yaml:"max_message_bytes"`
+	MaxRecipients   int    `yaml:"max_recipients"`
+	StartTLS        bool   `yaml:"starttls"`
+	// PasswordAuth 接受用户密码的 PLAIN/LOGIN 认证，关闭后只能使用 auth.oidc.sasl 的令牌认证
+	PasswordAuth bool `yaml:"password_auth"`
+	// AllowInsecureAuth 允许未加密连接上的 AUTH，仅用于测试
+	AllowInsecureAuth bool         `yaml:"allow_insecure_auth"`
+	Policy            PolicyConfig `yaml:"policy"`
+	DNSBL             DNSBLConfig  `yaml:"dnsbl"`
+}
+
+// DNSBLConfig 对未认证客户端查询 DNS 黑名单和白名单，支持热加载。
+// 各列表命中的权重相加，白名单使用负权重
+type DNSBLConfig struct {
+	Enabled     bool        `yaml:"enabled"`
+	Nameserver  string      `yaml:"nameserver"`   // host:port，为空时使用系统 DNS；公共 DNS 通常会被黑名单服务拒绝
+	Timeout     int         `yaml:"timeout"`      // 每次查询的超时 (秒)
+	CacheTTL    int         `yaml:"cache_ttl"`    // 查询结果的缓存秒数
+	RejectScore float64     `yaml:"reject_score"` // 总分不低于该值时拒绝收件人，0 表示不拒绝
+	TagScore    float64     `yaml:"tag_score"`    // 总分不低于该值时添加 X-YoPost-DNSBL 头部，0 表示不添加
+	Lists       []DNSBLList `yaml:"lists"`
+}
+
+// DNSBLList 一个 DNS 列表
+type DNSBLList struct {
+	Zone string `yaml:"zone"`
+	// Type 为 ip 时查询客户端 IP (DNSBL/DNSWL)，为 domain 时查询 HELO 和发件人域名 (URIBL)
+	Type   string  `yaml:"type"`
+	Weight float64 `yaml:"weight"`
+	// Codes 只计入这些返回地址，为空时计入 127.0.0.0/8 中除 127.255.255.0/24 (查询错误) 以外的全部地址
+	Codes []string `yaml:"codes"`
+}
+
+// PolicyConfig 入站连接策略，支持热加载；计数在每个进程内单独计算，0 表示不限制
+type PolicyConfig struct {
+	MaxConnectionsPerIP int            `yaml:"max_connections_per_ip"` // 每个客户端 IP 同时打开的连接数
+	CommandsPerMinute   int            `yaml:"commands_per_minute"`    // 每个客户端 IP 每分钟的命令数
+	PregreetDelay       int            `yaml:"pregreet_delay"`         // 发送问候前等待的秒数，期间发送数据的客户端被断开
+	Tarpit              TarpitConfig   `yaml:"tarpit"`
+	Greylist            GreylistConfig `yaml:"greylist"`
+}
+
+// TarpitConfig 对无效收件人过多的未认证连接延迟回复
+type TarpitConfig struct {
+	After    int `yaml:"after"`     // 同一连接被拒绝的收件人超过该数量后开始延迟，0 表示不启用
+	Delay    int `yaml:"delay"`     // 首次延迟的秒数，之后每个被拒绝的收件人加倍
+	MaxDelay int `yaml:"max_delay"` // 单次延迟的最大秒数
+}
+
+// GreylistConfig 灰名单 (RFC 6647)：未认证客户端首次发来的 (网段, 发件人, 收件人) 组合被临时拒绝，
+// 在 delay 之后、retry_window 之内重试才会接受
+type GreylistConfig struct {
+	Enabled     bool `yaml:"enabled"`
+	Delay       int  `yaml:"delay"`        // 首次尝试后至少等待的秒数
+	RetryWindow int  `yaml:"retry_window"` // 首次尝试后接受重试的秒数，超过后重新计时
+	ExpireDays  int  `yaml:"expire_days"`  // 通过的组合在最后一次收信后保留的天数
+	// Whitelist 不做灰名单的客户端 IP 或网段 (CIDR)，以及发件人域名或收件人地址
+	Whitelist []string `yaml:"whitelist"`
+}
+
+// RelayConfig 外发 SMTP 中继配置
+type RelayConfig struct {
+	Host      string `yaml:"host"`
+	TLSPort   string `yaml:"tls_port"`
+	NoTLSPort string `yaml:"notls_port"`
+}
+
+// APIConfig 管理 API 配置
+type APIConfig struct {
+	Listen       string     `yaml:"listen"`
+	MaxBodyBytes int64      `yaml:"max_body_bytes"`
+	Send         SendConfig `yaml:"send"`
+	Bulk         BulkConfig `yaml:"bulk"`
+}
+
+// SendConfig 通过 API 发送邮件的撤销与定时发送配置，支持热加载
+type SendConfig struct {
+	UndoSeconds     int `yaml:"undo_seconds"`      // 发送后可撤销的秒数，期间邮件保留在出站队列中；0 表示立即发送
+	MaxScheduleDays int `yaml:"max_schedule_days"` // send_at 最多可以设置到多少天之后
+}
+
+// BulkConfig 批量发送配置，支持热加载；限速在每个 serve 进程内单独计算
+type BulkConfig struct {
+	MaxRecipients int            `yaml:"max_recipients"` // 每个批次最多的收件人数
+	DomainRate    int            `yaml:"domain_rate"`    // 每个收件人域名每分钟最多放入出站队列的邮件数，0 表示不限制
+	DomainRates   map[string]int `yaml:"domain_rates"`   // 按域名覆盖 domain_rate
+}
+
+// AuthConfig API 认证配置
+type AuthConfig struct {
+	JWTSecret       string     `yaml:"jwt_secret"`        // 访问令牌的 HMAC-SHA256 签名密钥，至少 32 字节；为空时每次启动随机生成
+	AccessTokenTTL  int        `yaml:"access_token_ttl"`  // 访问令牌有效期 (秒)
+	RefreshTokenTTL int        `yaml:"refresh_token_ttl"` // 刷新令牌有效期 (秒)
+	OIDC            OIDCConfig `yaml:"oidc"`
+}
+
+// OIDCConfig OpenID Connect 登录，以及 SMTP XOAUTH2/OAUTHBEARER 认证配置
+type OIDCConfig struct {
+	Enabled        bool     `yaml:"enabled"`
+	Issuer         string   `yaml:"issuer"` // 用于 discovery，须与令牌 iss 一致
+	ClientID       string   `yaml:"client_id"`
+	ClientSecret   string   `yaml:"client_secret"` // 公共客户端可为空，仅使用 PKCE
+	RedirectURL    string   `yaml:"redirect_url"`  // 指向 /api/v1/auth/oidc/callback
+	Scopes         []string `yaml:"scopes"`
+	JWKSURL        string   `yaml:"jwks_url"`        // 为空时使用 discovery 中的 jwks_uri
+	UsernameClaim  string   `yaml:"username_claim"`  // 作为用户名 (邮箱地址) 的声明
+	AllowedDomains []string `yaml:"allowed_domains"` // 只允许这些域名的用户登录，为空不限制
+	AutoProvision  bool     `yaml:"auto_provision"`  // 首次登录时自动创建邮箱用户
+	// PostLoginRedirect 登录成功后跳转的前端地址，令牌放在 URL fragment 中；为空时回调直接返回 JSON
+	PostLoginRedirect string `yaml:"post_login_redirect"`
+	// SASL 为 true 时 SMTP 接受 IdP 签发的令牌进行 XOAUTH2/OAUTHBEARER 认证
+	SASL bool `yaml:"sasl"`
+	// Audiences SASL 令牌接受的 aud，为空时为 client_id
+	Audiences []string `yaml:"audiences"`
+}
+
+// QuotaConfig 默认配额与告警阈值，0 表示不限制
+type QuotaConfig struct {
+	UserBytes      int64 `yaml:"user_bytes"`
+	UserMessages   int64 `yaml:"user_messages"`
+	DomainBytes    int64 `yaml:"domain_bytes"`
+	DomainMessages int64 `yaml:"domain_messages"`
+	WarnThresholds []int `yaml:"warn_thresholds"` // 百分比，如 [80, 95]
+}
+
+// WebhooksConfig 外发 Webhook 投递配置，端点本身通过管理 API 维护
+type WebhooksConfig struct {
+	Timeout       int `yaml:"timeout"`        // 单次 HTTP 请求超时 (秒)
+	MaxAttempts   int `yaml:"max_attempts"`   // 最大尝试次数，之后投递标记为 failed
+	RetentionDays int `yaml:"retention_days"` // 已结束投递记录的保留天数
+}
+
+// LimitsConfig 出站限速，除 delivery.concurrency 外支持热加载；计数在每个进程内单独计算
+type LimitsConfig struct {
+	User     SubmitLimits   `yaml:"user"`    // 每个已认证用户
+	APIKey   SubmitLimits   `yaml:"api_key"` // 每个 API 密钥，与所属用户的限制同时生效
+	Delivery DeliveryLimits `yaml:"delivery"`
+}
+
+// SubmitLimits 提交邮件的令牌桶，容量为每小时的数量，0 表示不限制
+type SubmitLimits struct {
+	MessagesPerHour   int `yaml:"messages_per_hour"`
+	RecipientsPerHour int `yaml:"recipients_per_hour"`
 }
 
-// LoadMailServerConfig 加载邮件服务器配置
-func LoadMailServerConfig() (*MailServerConfig, error) {
-	data, err := ioutil.ReadFile(filepath.Join("internal", "config", "mailserver.yml"))
+// DeliveryLimits 出站队列按收件人域名的投递限制，0 表示不限制
+type DeliveryLimits struct {
+	Concurrency         int            `yaml:"concurrency"`          // 出站队列同时投递的邮件数
+	DomainConcurrency   int            `yaml:"domain_concurrency"`   // 每个收件人域名同时投递的邮件数
+	DomainRate          int            `yaml:"domain_rate"`          // 每个收件人域名每分钟投递的邮件数
+	DomainConcurrencies map[string]int `yaml:"domain_concurrencies"` // 按域名覆盖 domain_concurrency
+	DomainRates         map[string]int `yaml:"domain_rates"`         // 按域名覆盖 domain_rate
+}
+
+// SuppressionConfig 批量邮件退订链接 (List-Unsubscribe) 配置，支持热加载
+type SuppressionConfig struct {
+	UnsubscribeURL string `yaml:"unsubscribe_url"` // 退订链接前缀，为空时为 https://<server.hostname>/api/v1/unsubscribe
+	Secret         string `yaml:"secret"`          // 退订令牌的 HMAC-SHA256 签名密钥，至少 32 字节；为空时每次启动随机生成，重启后已发出的链接失效
+}
+
+// SpamConfig 入站垃圾邮件评分，支持热加载；只检查未认证会话投递到本地邮箱的邮件
+type SpamConfig struct {
+	Enabled     bool    `yaml:"enabled"`
+	TagScore    float64 `yaml:"tag_score"`    // 总分达到时 X-Spam-Status 为 Yes
+	RejectScore float64 `yaml:"reject_score"` // 不含贝叶斯的得分达到时在 DATA 结束时拒绝，0 表示不拒绝
+	MoveToJunk  bool    `yaml:"move_to_junk"` // 总分达到 tag_score 的邮件存入 Junk 而不是 INBOX
+	DNSBLWeight float64 `yaml:"dnsbl_weight"` // listeners.smtp.dnsbl 的总分乘以该系数计入
+	// TrustedAuthservIDs 只采信这些 authserv-id 的 Authentication-Results 头部，为空时不采信任何头部
+	TrustedAuthservIDs []string        `yaml:"trusted_authserv_ids"`
+	Bayes              SpamBayesConfig `yaml:"bayes"`
+	Rules              []SpamRule      `yaml:"rules"`
+}
+
+// SpamBayesConfig 每个用户的贝叶斯分类器，用户将邮件移入或移出 Junk 时学习
+type SpamBayesConfig struct {
+	Enabled     bool    `yaml:"enabled"`
+	MinMessages int     `yaml:"min_messages"` // 垃圾邮件和正常邮件各学习到该数量后才参与评分
+	Weight      float64 `yaml:"weight"`       // 垃圾邮件概率为 1 时的得分，概率为 0 时为其负值
+	// AutoLearn 投递时按不含贝叶斯的得分自动学习：不高于 auto_learn_ham 的作为正常邮件，不低于 auto_learn_spam 的作为垃圾邮件
+	AutoLearn     bool    `yaml:"auto_learn"`
+	AutoLearnHam  float64 `yaml:"auto_learn_ham"`
+	AutoLearnSpam float64 `yaml:"auto_learn_spam"`
+}
+
+// SpamRule 自定义规则，正则表达式匹配时计入 score；pattern 为空时改为覆盖同名内置检查的分数
+type SpamRule struct {
+	Name    string  `yaml:"name"`
+	Header  string  `yaml:"header"`  // 匹配解码后的头部值，为空时匹配正文的纯文本
+	Pattern string  `yaml:"pattern"` // Go 正则表达式，不区分大小写需加 (?i)
+	Score   float64 `yaml:"score"`
+}
+
+// EncryptionConfig 邮件静态加密配置
+type EncryptionConfig struct {
+	Enabled        bool   `yaml:"enabled"`
+	Mode           string `yaml:"mode"`             // master: 服务器主密钥派生，目前唯一支持的模式；password 模式尚未实现
+	MasterKeysFile string `yaml:"master_keys_file"` // 主密钥文件，格式: keys: {id: base64}
+	ActiveKey      string `yaml:"active_key"`       // 新邮件使用的主密钥 ID
+}
+
+// Default 返回默认配置
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Hostname:        "localhost",
+			LogLevel:        "info",
+			ShutdownTimeout: 30,
+		},
+		Storage: StorageConfig{
+			MySQL:      DatabaseConfig{Host: "127.0.0.1", Port: 3306, Database: "yopost"},
+			MongoDB:    DatabaseConfig{Host: "127.0.0.1", Port: 27017, Database: "yopost"},
+			Encryption: EncryptionConfig{Mode: "master"},
+		},
+		Listeners: ListenersConfig{
+			SMTP: InboundConfig{
+				Listen:          ":25",
+				MaxMessageBytes: 25 << 20,
+				MaxRecipients:   100,
+				PasswordAuth:    true,
+				Policy: PolicyConfig{
+					MaxConnectionsPerIP: 10,
+					CommandsPerMinute:   600,
+					Tarpit:              TarpitConfig{After: 3, Delay: 1, MaxDelay: 30},
+					Greylist:            GreylistConfig{Delay: 300, RetryWindow: 2 * 24 * 3600, ExpireDays: 36},
+				},
+				DNSBL: DNSBLConfig{Timeout: 2, CacheTTL: 300, RejectScore: 10, TagScore: 5},
+			},
+		},
+		Relay: RelayConfig{Host: "127.0.0.1", TLSPort: "465", NoTLSPort: "25"},
+		API: APIConfig{
+			Listen:       ":8080",
+			MaxBodyBytes: 10 << 20,
+			Send:         SendConfig{MaxScheduleDays: 365},
+			Bulk:         BulkConfig{MaxRecipients: 10000, DomainRate: 120},
+		},
+		Auth: AuthConfig{
+			AccessTokenTTL:  900,
+			RefreshTokenTTL: 30 * 24 * 3600,
+			OIDC:            OIDCConfig{Scopes: []string{"openid", "email", "profile"}, UsernameClaim: "email"},
+		},
+		Limits: LimitsConfig{
+			User:     SubmitLimits{MessagesPerHour: 1000, RecipientsPerHour: 5000},
+			APIKey:   SubmitLimits{MessagesPerHour: 1000, RecipientsPerHour: 5000},
+			Delivery: DeliveryLimits{Concurrency: 4, DomainConcurrency: 2},
+		},
+		Webhooks: WebhooksConfig{Timeout: 10, MaxAttempts: 8, RetentionDays: 7},
+		Spam: SpamConfig{
+			TagScore:    5,
+			MoveToJunk:  true,
+			DNSBLWeight: 0.5,
+			Bayes: SpamBayesConfig{Enabled: true, MinMessages: 20, Weight: 4,
+				AutoLearn: true, AutoLearnHam: 0.5, AutoLearnSpam: 12},
+		},
+	}
+}
+
+// ResolvePath 按 参数 > YOPOST_CONFIG > DefaultPaths 的顺序确定配置文件
+func ResolvePath(path string) (string, error) {
+	if path != "" {
+		return path, nil
+	}
+	if env := os.Getenv(EnvConfigPath); env != "" {
+		return env, nil
+	}
+	for _, p := range DefaultPaths {
+		if _, err := os.Stat(p); err == nil {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("no config file found (use --config or %s)", EnvConfigPath)
+}
+
+// Load 加载配置文件，依次应用环境变量覆盖、读取文件中的密钥并校验
+func Load(path string) (*Config, error) {
+	path, err := ResolvePath(path)
 	if err != nil {
-		log.Printf("ERROR: Failed to read mailserver config - %v", err)
+		log.Printf("ERROR: %v", err)
 		return nil, err
 	}
 
-	var cfg MailServerConfig
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
-		log.Printf("ERROR: Failed to unmarshal mailserver config - %v", err)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		log.Printf("ERROR: Failed to read config %s - %v", path, err)
 		return nil, err
 	}
 
-	return &cfg, nil
+	cfg := Default()
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		log.Printf("ERROR: Failed to unmarshal config %s - %v", path, err)
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if err := ApplyEnv(cfg, os.LookupEnv); err != nil {
+		return nil, err
+	}
+	if err := ResolveSecrets(cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	log.Printf("INFO: Loaded configuration from %s", path)
+	return cfg, nil
+}
+
+// TestConfig 测试配置结构
+type TestConfig struct {
+	Userinfo []struct {
+		Username string `yaml:"username"`
+		Password string `yaml:"password"`
+		Email    string `yaml:"email"`
+	} `yaml:"userinfo"`
+	Email struct {
+		TestSubject string `yaml:"test_subject"`
+		TestBody    string `yaml:"test_body"`
+	} `yaml:"email"`
 }
 
 // LoadTestConfig 加载测试配置
@@ -71,20 +425,3 @@ func LoadTestConfig() (*TestConfig, error) {
 
 	return &cfg, nil
 }
-
-// LoadTLSConfig 加载TLS配置
-func LoadTLSConfig() (*TLSConfig, error) {
-	data, err := ioutil.ReadFile(filepath.Join("internal", "config", "services.yml"))
-	if err != nil {
-		log.Printf("ERROR: Failed to read TLS config - %v", err)
-		return nil, err
-	}
-
-	var cfg TLSConfig
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
-		log.Printf("ERROR: Failed to unmarshal TLS config - %v", err)
-		return nil, err
-	}
-
-	return &cfg, nil
-}
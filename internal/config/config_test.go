@@ -0,0 +1,168 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestApplyEnv(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(secret, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		env  map[string]string
+		get  func(c *Config) interface{}
+		want interface{}
+		err  bool
+	}{
+		{"string", map[string]string{"YOPOST_STORAGE_MYSQL_PASSWORD": "s3cret"}, func(c *Config) interface{} { return c.Storage.MySQL.Password }, "s3cret", false},
+		{"int", map[string]string{"YOPOST_STORAGE_MYSQL_PORT": "3307"}, func(c *Config) interface{} { return c.Storage.MySQL.Port }, 3307, false},
+		{"bool", map[string]string{"YOPOST_LISTENERS_SMTP_STARTTLS": "false"}, func(c *Config) interface{} { return c.Listeners.SMTP.StartTLS }, false, false},
+		{"float", map[string]string{"YOPOST_SPAM_TAG_SCORE": "6.5"}, func(c *Config) interface{} { return c.Spam.TagScore }, 6.5, false},
+		{"list", map[string]string{"YOPOST_SERVER_DOMAINS": "a.example, b.example"}, func(c *Config) interface{} { return c.Server.Domains }, []string{"a.example", "b.example"}, false},
+		{"empty list", map[string]string{"YOPOST_SERVER_DOMAINS": ""}, func(c *Config) interface{} { return len(c.Server.Domains) }, 0, false},
+		{"map", map[string]string{"YOPOST_SERVER_ALIASES": "postmaster@a.example=admin@a.example"}, func(c *Config) interface{} { return c.Server.Aliases },
+			map[string]string{"postmaster@a.example": "admin@a.example"}, false},
+		{"struct list element", map[string]string{"YOPOST_SERVER_ROUTES_0_SECRET": "hook"}, func(c *Config) interface{} { return c.Server.Routes[0].Secret }, "hook", false},
+		{"file", map[string]string{"YOPOST_AUTH_JWT_SECRET_FILE": secret}, func(c *Config) interface{} { return c.Auth.JWTSecret }, "from-file", false},
+		{"value wins over file", map[string]string{"YOPOST_AUTH_JWT_SECRET_FILE": secret, "YOPOST_AUTH_JWT_SECRET": "direct"}, func(c *Config) interface{} { return c.Auth.JWTSecret }, "direct", false},
+		{"invalid int", map[string]string{"YOPOST_STORAGE_MYSQL_PORT": "many"}, nil, nil, true},
+		{"invalid map", map[string]string{"YOPOST_SERVER_ALIASES": "postmaster"}, nil, nil, true},
+		{"missing file", map[string]string{"YOPOST_AUTH_JWT_SECRET_FILE": secret + ".missing"}, nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.Server.Routes = []InboundRoute{{Match: "*@in.example", URL: "https://hooks.example/in"}}
+			err := ApplyEnv(cfg, func(key string) (string, bool) {
+				v, ok := tt.env[key]
+				return v, ok
+			})
+			if tt.err {
+				if err == nil {
+					t.Error("ApplyEnv() succeeded, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ApplyEnv() error = %v", err)
+			}
+			if got := tt.get(cfg); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ApplyEnv() value = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeys(t *testing.T) {
+	keys := Keys()
+	if got := keys["storage.mysql.password"]; got != "YOPOST_STORAGE_MYSQL_PASSWORD" {
+		t.Errorf("Keys()[storage.mysql.password] = %q", got)
+	}
+	if got := keys["auth.oidc.client_id"]; got != "YOPOST_AUTH_OIDC_CLIENT_ID" {
+		t.Errorf("Keys()[auth.oidc.client_id] = %q", got)
+	}
+}
+
+func TestResolveSecrets(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "db_password")
+	if err := os.WriteFile(secret, []byte("hunter2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := Default()
+	cfg.Storage.MySQL.Password = "file:" + secret
+	cfg.Storage.MongoDB.Password = "plain"
+	if err := ResolveSecrets(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Storage.MySQL.Password != "hunter2" || cfg.Storage.MongoDB.Password != "plain" {
+		t.Errorf("ResolveSecrets() passwords = %q, %q", cfg.Storage.MySQL.Password, cfg.Storage.MongoDB.Password)
+	}
+	cfg.Auth.JWTSecret = "file:" + secret + ".missing"
+	if err := ResolveSecrets(cfg); err == nil || !strings.HasPrefix(err.Error(), "auth.jwt_secret:") {
+		t.Errorf("ResolveSecrets() error = %v, want auth.jwt_secret error", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	base, err := Load("yopost.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+		want   []string
+	}{
+		{"example config", func(c *Config) {}, nil},
+		{"missing hostname", func(c *Config) { c.Server.Hostname = " " }, []string{"server.hostname"}},
+		{"invalid domain", func(c *Config) { c.Server.Domains = []string{"user@example.com"} }, []string{"server.domains[0]"}},
+		{"bad log level", func(c *Config) { c.Server.LogLevel = "verbose" }, []string{"server.log_level"}},
+		{"bad port", func(c *Config) { c.Storage.MySQL.Port = 70000 }, []string{"storage.mysql.port"}},
+		{"bad listen address", func(c *Config) { c.API.Listen = "8080" }, []string{"api.listen"}},
+		{"route", func(c *Config) {
+			c.Server.Routes = []InboundRoute{{Match: "a*b@example.com", URL: "http://hooks.example/in", Retries: 10}}
+		}, []string{"server.routes[0].match", "server.routes[0].url", "server.routes[0].retries"}},
+		{"short jwt secret", func(c *Config) { c.Auth.JWTSecret = "short" }, []string{"auth.jwt_secret"}},
+		{"refresh not longer than access", func(c *Config) { c.Auth.RefreshTokenTTL = c.Auth.AccessTokenTTL }, []string{"auth.refresh_token_ttl"}},
+		{"oidc", func(c *Config) {
+			c.Auth.OIDC = OIDCConfig{Enabled: true, Issuer: "http://idp.example.com", RedirectURL: "http://127.0.0.1:8080/cb", UsernameClaim: "email"}
+		}, []string{"auth.oidc.issuer", "auth.oidc.client_id"}},
+		{"password encryption mode", func(c *Config) {
+			c.Storage.Encryption = EncryptionConfig{Enabled: true, Mode: "password", MasterKeysFile: "keys.yml", ActiveKey: "k1"}
+		}, []string{"storage.encryption.mode"}},
+		{"starttls without certificate", func(c *Config) {
+			c.Listeners.SMTP.Enabled, c.Listeners.SMTP.StartTLS, c.TLS.CertFile, c.TLS.KeyFile = true, true, "", ""
+		}, []string{"listeners.smtp.starttls"}},
+		{"several problems", func(c *Config) { c.Server.Hostname, c.API.MaxBodyBytes = "", 0 }, []string{"server.hostname", "api.max_body_bytes"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := *base
+			tt.modify(&cfg)
+			err := cfg.Validate()
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("Validate() error = %v", err)
+				}
+				return
+			}
+			var ve *ValidationError
+			if !errors.As(err, &ve) {
+				t.Fatalf("Validate() error = %v, want *ValidationError", err)
+			}
+			var keys []string
+			for _, p := range ve.Problems {
+				keys = append(keys, p[:strings.Index(p, ":")])
+			}
+			if !reflect.DeepEqual(keys, tt.want) {
+				t.Errorf("Validate() problems = %q, want keys %q", ve.Problems, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadEnvOverride(t *testing.T) {
+	t.Setenv("YOPOST_SERVER_HOSTNAME", "mx.example.net")
+	t.Setenv("YOPOST_API_MAX_BODY_BYTES", "0")
+	_, err := Load("yopost.yml")
+	var ve *ValidationError
+	if !errors.As(err, &ve) || len(ve.Problems) != 1 || !strings.HasPrefix(ve.Problems[0], "api.max_body_bytes:") {
+		t.Fatalf("Load() error = %v, want api.max_body_bytes problem", err)
+	}
+
+	t.Setenv("YOPOST_API_MAX_BODY_BYTES", "1024")
+	cfg, err := Load("yopost.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Hostname != "mx.example.net" || cfg.API.MaxBodyBytes != 1024 {
+		t.Errorf("Load() hostname = %q, max_body_bytes = %d", cfg.Server.Hostname, cfg.API.MaxBodyBytes)
+	}
+}
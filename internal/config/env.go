@@ -0,0 +1,166 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// EnvPrefix 环境变量前缀
+const EnvPrefix = "YOPOST"
+
+// secretPrefix 字符串值以此开头时从文件读取实际内容
+const secretPrefix = "file:"
+
+// field 配置树中的一个叶子键
+type field struct {
+	Key   string // 点分路径，如 storage.mysql.password
+	Env   string // 对应环境变量，如 YOPOST_STORAGE_MYSQL_PASSWORD
+	Value reflect.Value
+}
+
+// walk 遍历配置结构体的全部叶子字段
+func walk(v reflect.Value, path []string, fn func(f field) error) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name := strings.Split(sf.Tag.Get("yaml"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		p := append(append([]string(nil), path...), name)
+		fv := v.Field(i)
+		if fv.Kind() == reflect.Struct {
+			if err := walk(fv, p, fn); err != nil {
+				return err
+			}
+			continue
+		}
+		// 结构体列表按下标展开，如 server.routes.0.secret
+		if fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() == reflect.Struct {
+			for j := 0; j < fv.Len(); j++ {
+				if err := walk(fv.Index(j), append(p, strconv.Itoa(j)), fn); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if err := fn(field{
+			Key:   strings.Join(p, "."),
+			Env:   EnvPrefix + "_" + strings.ToUpper(strings.Join(p, "_")),
+			Value: fv,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Keys 返回全部配置键及其环境变量名
+func Keys() map[string]string {
+	keys := make(map[string]string)
+	walk(reflect.ValueOf(Default()).Elem(), nil, func(f field) error {
+		keys[f.Key] = f.Env
+		return nil
+	})
+	return keys
+}
+
+// setValue 将字符串解析为字段类型并赋值，切片和映射以逗号分隔
+func setValue(v reflect.Value, s string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		var parts []string
+		if strings.TrimSpace(s) != "" {
+			parts = strings.Split(s, ",")
+		}
+		slice := reflect.MakeSlice(v.Type(), len(parts), len(parts))
+		for i, p := range parts {
+			if err := setValue(slice.Index(i), strings.TrimSpace(p)); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+	case reflect.Map:
+		// 映射以 "key=value,key2=value2" 表示
+		m := reflect.MakeMap(v.Type())
+		for _, p := range strings.Split(s, ",") {
+			if strings.TrimSpace(p) == "" {
+				continue
+			}
+			k, val, ok := strings.Cut(p, "=")
+			if !ok {
+				return fmt.Errorf("expected key=value, got %q", p)
+			}
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := setValue(elem, strings.TrimSpace(val)); err != nil {
+				return err
+			}
+			m.SetMapIndex(reflect.ValueOf(strings.TrimSpace(k)), elem)
+		}
+		v.Set(m)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// ApplyEnv 用环境变量覆盖配置
+// YOPOST_<PATH> 直接提供值，YOPOST_<PATH>_FILE 从文件读取值（用于密钥）
+func ApplyEnv(cfg *Config, lookup func(string) (string, bool)) error {
+	return walk(reflect.ValueOf(cfg).Elem(), nil, func(f field) error {
+		if path, ok := lookup(f.Env + "_FILE"); ok {
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("%s_FILE: %v", f.Env, err)
+			}
+			if err := setValue(f.Value, strings.TrimSpace(string(data))); err != nil {
+				return fmt.Errorf("%s_FILE: invalid value for %s: %v", f.Env, f.Key, err)
+			}
+		}
+		if s, ok := lookup(f.Env); ok {
+			if err := setValue(f.Value, s); err != nil {
+				return fmt.Errorf("%s: invalid value for %s: %v", f.Env, f.Key, err)
+			}
+		}
+		return nil
+	})
+}
+
+// ResolveSecrets 将形如 "file:/run/secrets/db_password" 的字符串值替换为文件内容
+func ResolveSecrets(cfg *Config) error {
+	return walk(reflect.ValueOf(cfg).Elem(), nil, func(f field) error {
+		if f.Value.Kind() != reflect.String || !strings.HasPrefix(f.Value.String(), secretPrefix) {
+			return nil
+		}
+		path := strings.TrimPrefix(f.Value.String(), secretPrefix)
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("%s: failed to read secret file: %v", f.Key, err)
+		}
+		f.Value.SetString(strings.TrimSpace(string(data)))
+		return nil
+	})
+}
@@ -0,0 +1,131 @@
+package config
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"syscall"
+)
+
+// Reloadable 支持配置热加载的组件
+type Reloadable interface {
+	// PrepareReload 校验新配置并准备好需要的资源（如证书），返回应用函数
+	// 任一组件返回错误时本次热加载整体放弃，旧配置继续生效
+	PrepareReload(cfg *Config) (apply func(), err error)
+}
+
+// ReloadFunc 将函数适配为 Reloadable
+type ReloadFunc func(cfg *Config) (func(), error)
+
+func (f ReloadFunc) PrepareReload(cfg *Config) (func(), error) {
+	return f(cfg)
+}
+
+// Holder 持有当前生效的配置，支持原子替换
+type Holder struct {
+	path    string
+	current atomic.Pointer[Config]
+
+	mu          sync.Mutex
+	subscribers []Reloadable
+}
+
+// NewHolder 创建配置持有者，path 为热加载时重新读取的配置文件
+func NewHolder(path string, cfg *Config) *Holder {
+	h := &Holder{path: path}
+	h.current.Store(cfg)
+	return h
+}
+
+// Get 返回当前配置，调用方不应修改返回值
+func (h *Holder) Get() *Config {
+	return h.current.Load()
+}
+
+// Subscribe 注册热加载组件
+func (h *Holder) Subscribe(r Reloadable) {
+	h.mu.Lock()
+	h.subscribers = append(h.subscribers, r)
+	h.mu.Unlock()
+}
+
+// Reload 重新加载配置文件
+// 先由全部组件校验新配置，全部通过后才依次应用并替换当前配置；
+// 已建立的连接不受影响，新连接和新事务使用新配置
+func (h *Holder) Reload() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	log.Printf("INFO: Reloading configuration")
+	cfg, err := Load(h.path)
+	if err != nil {
+		log.Printf("ERROR: Configuration reload rejected, keeping current configuration - %v", err)
+		return err
+	}
+
+	applies := make([]func(), 0, len(h.subscribers))
+	for _, s := range h.subscribers {
+		apply, err := s.PrepareReload(cfg)
+		if err != nil {
+			log.Printf("ERROR: Configuration reload rejected, keeping current configuration - %v", err)
+			return err
+		}
+		if apply != nil {
+			applies = append(applies, apply)
+		}
+	}
+
+	old := h.current.Load()
+	for _, apply := range applies {
+		apply()
+	}
+	h.current.Store(cfg)
+
+	warnRestart(old, cfg)
+	log.Printf("INFO: Configuration reloaded")
+	return nil
+}
+
+// warnRestart 提示无法热加载、需要重启才能生效的配置变更
+func warnRestart(old, cfg *Config) {
+	checks := []struct {
+		key      string
+		old, new interface{}
+	}{
+		{"storage", old.Storage, cfg.Storage},
+		{"listeners.smtp.enabled", old.Listeners.SMTP.Enabled, cfg.Listeners.SMTP.Enabled},
+		{"listeners.smtp.listen", old.Listeners.SMTP.Listen, cfg.Listeners.SMTP.Listen},
+		{"api.listen", old.API.Listen, cfg.API.Listen},
+		{"api.max_body_bytes", old.API.MaxBodyBytes, cfg.API.MaxBodyBytes},
+		{"limits.delivery.concurrency", old.Limits.Delivery.Concurrency, cfg.Limits.Delivery.Concurrency},
+		{"auth.jwt_secret", old.Auth.JWTSecret, cfg.Auth.JWTSecret},
+		{"auth.oidc", old.Auth.OIDC, cfg.Auth.OIDC},
+		{"listeners.smtp.allow_insecure_auth", old.Listeners.SMTP.AllowInsecureAuth, cfg.Listeners.SMTP.AllowInsecureAuth},
+	}
+	for _, c := range checks {
+		if !reflect.DeepEqual(c.old, c.new) {
+			log.Printf("WARNING: Changes to %s require a restart to take effect", c.key)
+		}
+	}
+}
+
+// WatchSignals 收到 SIGHUP 时热加载配置，直到 ctx 结束
+func (h *Holder) WatchSignals(ctx context.Context) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(ch)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ch:
+				h.Reload()
+			}
+		}
+	}()
+}
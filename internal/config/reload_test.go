@@ -0,0 +1,113 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// writeConfig 将示例配置中的 hostname 替换后写入临时文件
+func writeConfig(t *testing.T, path, hostname string) {
+	t.Helper()
+	data, err := os.ReadFile("yopost.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = []byte(strings.Replace(string(data), `hostname: "mail.yopost.com"`, `hostname: "`+hostname+`"`, 1))
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReload(t *testing.T) {
+	errRejected := errors.New("rejected")
+	tests := []struct {
+		name     string
+		hostname string
+		reject   bool
+		err      bool
+		want     string
+	}{
+		{"applied", "mx.example.net", false, false, "mx.example.net"},
+		{"invalid file", "", false, true, "mail.yopost.com"},
+		{"rejected by subscriber", "mx.example.net", true, true, "mail.yopost.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "yopost.yml")
+			writeConfig(t, path, "mail.yopost.com")
+			cfg, err := Load(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			h := NewHolder(path, cfg)
+
+			var applied []string
+			h.Subscribe(ReloadFunc(func(cfg *Config) (func(), error) {
+				return func() { applied = append(applied, "first:"+cfg.Server.Hostname) }, nil
+			}))
+			h.Subscribe(ReloadFunc(func(cfg *Config) (func(), error) {
+				if tt.reject {
+					return nil, errRejected
+				}
+				return func() { applied = append(applied, "second:"+cfg.Server.Hostname) }, nil
+			}))
+			// 没有需要应用的内容时可以返回 nil
+			h.Subscribe(ReloadFunc(func(cfg *Config) (func(), error) { return nil, nil }))
+
+			writeConfig(t, path, tt.hostname)
+			err = h.Reload()
+			if (err != nil) != tt.err {
+				t.Fatalf("Reload() error = %v, want error %v", err, tt.err)
+			}
+			if tt.reject && !errors.Is(err, errRejected) {
+				t.Errorf("Reload() error = %v, want %v", err, errRejected)
+			}
+			if got := h.Get().Server.Hostname; got != tt.want {
+				t.Errorf("Get().Server.Hostname = %q, want %q", got, tt.want)
+			}
+			// 任一组件拒绝时不应用任何组件
+			if tt.err && len(applied) != 0 {
+				t.Errorf("applied %v after a rejected reload", applied)
+			}
+			if !tt.err && strings.Join(applied, ",") != "first:"+tt.want+",second:"+tt.want {
+				t.Errorf("applied %v, want both subscribers in order", applied)
+			}
+		})
+	}
+}
+
+func TestWatchSignals(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "yopost.yml")
+	writeConfig(t, path, "mail.yopost.com")
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewHolder(path, cfg)
+	reloaded := make(chan string, 1)
+	h.Subscribe(ReloadFunc(func(cfg *Config) (func(), error) {
+		return func() { reloaded <- cfg.Server.Hostname }, nil
+	}))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	h.WatchSignals(ctx)
+
+	writeConfig(t, path, "mx.example.net")
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-reloaded:
+		if got != "mx.example.net" {
+			t.Errorf("reloaded hostname = %q, want mx.example.net", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("configuration not reloaded after SIGHUP")
+	}
+}
@@ -0,0 +1,402 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ValidationError 配置校验失败时返回，包含全部问题
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+type validator struct {
+	problems []string
+}
+
+func (v *validator) errorf(key, format string, args ...interface{}) {
+	v.problems = append(v.problems, key+": "+fmt.Sprintf(format, args...))
+}
+
+func (v *validator) required(key, value string) {
+	if strings.TrimSpace(value) == "" {
+		v.errorf(key, "is required")
+	}
+}
+
+func (v *validator) port(key string, port int) {
+	if port < 1 || port > 65535 {
+		v.errorf(key, "must be between 1 and 65535, got %d", port)
+	}
+}
+
+func (v *validator) portString(key, port string) {
+	n, err := strconv.Atoi(port)
+	if err != nil {
+		v.errorf(key, "must be a port number, got %q", port)
+		return
+	}
+	v.port(key, n)
+}
+
+func (v *validator) listen(key, addr string) {
+	if _, port, err := net.SplitHostPort(addr); err != nil {
+		v.errorf(key, "must be host:port, got %q", addr)
+	} else {
+		v.portString(key, port)
+	}
+}
+
+func (v *validator) oneOf(key, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	v.errorf(key, "must be one of %s, got %q", strings.Join(allowed, ", "), value)
+}
+
+// url 要求 https 地址，本机地址允许 http 以便使用本地测试 IdP
+func (v *validator) url(key, value string) {
+	u, err := url.Parse(value)
+	if value == "" || err != nil || u.Host == "" {
+		v.errorf(key, "must be an absolute URL, got %q", value)
+		return
+	}
+	host := u.Hostname()
+	if u.Scheme != "https" && !(u.Scheme == "http" && (host == "localhost" || net.ParseIP(host).IsLoopback())) {
+		v.errorf(key, "must use https (http is only allowed for localhost), got %q", value)
+	}
+}
+
+func (v *validator) policy(key string, p PolicyConfig) {
+	for _, n := range []struct {
+		key   string
+		value int
+	}{
+		{"max_connections_per_ip", p.MaxConnectionsPerIP},
+		{"commands_per_minute", p.CommandsPerMinute},
+		{"pregreet_delay", p.PregreetDelay},
+		{"tarpit.after", p.Tarpit.After},
+		{"tarpit.delay", p.Tarpit.Delay},
+		{"tarpit.max_delay", p.Tarpit.MaxDelay},
+	} {
+		if n.value < 0 {
+			v.errorf(key+"."+n.key, "must not be negative")
+		}
+	}
+	if p.PregreetDelay > 30 {
+		v.errorf(key+".pregreet_delay", "must be at most 30 seconds, got %d", p.PregreetDelay)
+	}
+	if p.Tarpit.After > 0 && p.Tarpit.MaxDelay < p.Tarpit.Delay {
+		v.errorf(key+".tarpit.max_delay", "must not be less than tarpit.delay")
+	}
+
+	g := p.Greylist
+	if !g.Enabled {
+		return
+	}
+	if g.Delay <= 0 {
+		v.errorf(key+".greylist.delay", "must be positive")
+	}
+	if g.RetryWindow <= g.Delay {
+		v.errorf(key+".greylist.retry_window", "must be longer than greylist.delay")
+	}
+	if g.ExpireDays <= 0 {
+		v.errorf(key+".greylist.expire_days", "must be positive")
+	}
+	for i, w := range g.Whitelist {
+		if strings.Contains(w, "/") {
+			if _, _, err := net.ParseCIDR(w); err != nil {
+				v.errorf(fmt.Sprintf("%s.greylist.whitelist[%d]", key, i), "invalid network %q", w)
+			}
+		} else if strings.TrimSpace(w) == "" {
+			v.errorf(fmt.Sprintf("%s.greylist.whitelist[%d]", key, i), "must not be empty")
+		}
+	}
+}
+
+func (v *validator) dnsbl(key string, c DNSBLConfig) {
+	if !c.Enabled {
+		return
+	}
+	if c.Nameserver != "" {
+		if _, _, err := net.SplitHostPort(c.Nameserver); err != nil {
+			v.errorf(key+".nameserver", "must be host:port, got %q", c.Nameserver)
+		}
+	}
+	if c.Timeout <= 0 {
+		v.errorf(key+".timeout", "must be positive")
+	}
+	if c.CacheTTL < 0 {
+		v.errorf(key+".cache_ttl", "must not be negative")
+	}
+	if c.RejectScore < 0 || c.TagScore < 0 {
+		v.errorf(key, "reject_score and tag_score must not be negative")
+	}
+	if len(c.Lists) == 0 {
+		v.errorf(key+".lists", "must not be empty")
+	}
+	for i, l := range c.Lists {
+		k := fmt.Sprintf("%s.lists[%d]", key, i)
+		v.required(k+".zone", l.Zone)
+		v.oneOf(k+".type", l.Type, "ip", "domain")
+		for _, code := range l.Codes {
+			if ip := net.ParseIP(code); ip == nil || ip.To4() == nil {
+				v.errorf(k+".codes", "invalid return code %q", code)
+			}
+		}
+	}
+}
+
+func (v *validator) spam(key string, c SpamConfig) {
+	if !c.Enabled {
+		return
+	}
+	if c.TagScore <= 0 {
+		v.errorf(key+".tag_score", "must be positive")
+	}
+	if c.RejectScore < 0 {
+		v.errorf(key+".reject_score", "must not be negative")
+	}
+	if c.DNSBLWeight < 0 {
+		v.errorf(key+".dnsbl_weight", "must not be negative")
+	}
+	if c.Bayes.Enabled {
+		if c.Bayes.MinMessages <= 0 {
+			v.errorf(key+".bayes.min_messages", "must be positive")
+		}
+		if c.Bayes.Weight < 0 {
+			v.errorf(key+".bayes.weight", "must not be negative")
+		}
+		if c.Bayes.AutoLearn && c.Bayes.AutoLearnSpam <= c.Bayes.AutoLearnHam {
+			v.errorf(key+".bayes.auto_learn_spam", "must be greater than auto_learn_ham")
+		}
+	}
+	names := make(map[string]bool)
+	for i, r := range c.Rules {
+		k := fmt.Sprintf("%s.rules[%d]", key, i)
+		v.required(k+".name", r.Name)
+		if names[r.Name] {
+			v.errorf(k+".name", "duplicate rule %q", r.Name)
+		}
+		names[r.Name] = true
+		if _, err := regexp.Compile(r.Pattern); err != nil {
+			v.errorf(k+".pattern", "invalid regular expression %q", r.Pattern)
+		}
+	}
+}
+
+func (v *validator) database(key string, db DatabaseConfig) {
+	v.required(key+".host", db.Host)
+	v.port(key+".port", db.Port)
+	v.required(key+".user", db.User)
+	v.required(key+".password", db.Password)
+	v.required(key+".database", db.Database)
+}
+
+// Validate 校验配置，返回 *ValidationError 列出全部问题
+func (c *Config) Validate() error {
+	v := &validator{}
+
+	v.required("server.hostname", c.Server.Hostname)
+	for i, d := range c.Server.Domains {
+		if d == "" || strings.ContainsAny(d, "@ /") {
+			v.errorf(fmt.Sprintf("server.domains[%d]", i), "invalid domain %q", d)
+		}
+	}
+	for alias, target := range c.Server.Aliases {
+		if !strings.Contains(alias, "@") || !strings.Contains(target, "@") {
+			v.errorf("server.aliases."+alias, "alias and target must be email addresses, got %q", target)
+		}
+	}
+	seen := make(map[string]bool)
+	for i, r := range c.Server.Routes {
+		key := fmt.Sprintf("server.routes[%d]", i)
+		local, domain, ok := strings.Cut(strings.ToLower(r.Match), "@")
+		if !ok || local == "" || domain == "" || strings.ContainsAny(domain, "@* ") || (strings.Contains(local, "*") && local != "*") {
+			v.errorf(key+".match", "must be an address or *@domain, got %q", r.Match)
+		} else if seen[local+"@"+domain] {
+			v.errorf(key+".match", "duplicate route for %q", r.Match)
+		}
+		seen[local+"@"+domain] = true
+		v.url(key+".url", r.URL)
+		if r.Format != "" {
+			v.oneOf(key+".format", r.Format, "json", "multipart")
+		}
+		if r.Timeout < 0 {
+			v.errorf(key+".timeout", "must not be negative")
+		}
+		// 出站队列最多尝试 10 次
+		if r.Retries < 0 || r.Retries > 9 {
+			v.errorf(key+".retries", "must be between 0 and 9")
+		}
+		if r.Fallback != "" && !strings.Contains(r.Fallback, "@") {
+			v.errorf(key+".fallback", "must be an email address, got %q", r.Fallback)
+		}
+	}
+	v.oneOf("server.log_level", c.Server.LogLevel, "debug", "info", "warn", "error")
+	if c.Server.ShutdownTimeout <= 0 {
+		v.errorf("server.shutdown_timeout", "must be positive")
+	}
+
+	v.database("storage.mysql", c.Storage.MySQL)
+	v.database("storage.mongodb", c.Storage.MongoDB)
+	if enc := c.Storage.Encryption; enc.Enabled {
+		// 登录密码派生的密钥只在用户在线时可用，无法加密用户离线时收到的邮件
+		if enc.Mode == "password" {
+			v.errorf("storage.encryption.mode", "password mode is not supported, inbound mail must be encrypted while the user is offline")
+		} else {
+			v.oneOf("storage.encryption.mode", enc.Mode, "master")
+		}
+		v.required("storage.encryption.master_keys_file", enc.MasterKeysFile)
+		v.required("storage.encryption.active_key", enc.ActiveKey)
+	}
+
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		v.errorf("tls", "cert_file and key_file must be set together")
+	}
+
+	if smtp := c.Listeners.SMTP; smtp.Enabled {
+		v.listen("listeners.smtp.listen", smtp.Listen)
+		if smtp.MaxMessageBytes <= 0 {
+			v.errorf("listeners.smtp.max_message_bytes", "must be positive")
+		}
+		if smtp.MaxRecipients <= 0 {
+			v.errorf("listeners.smtp.max_recipients", "must be positive")
+		}
+		if smtp.StartTLS && c.TLS.CertFile == "" {
+			v.errorf("listeners.smtp.starttls", "requires tls.cert_file and tls.key_file")
+		}
+		v.policy("listeners.smtp.policy", smtp.Policy)
+		v.dnsbl("listeners.smtp.dnsbl", smtp.DNSBL)
+	}
+
+	v.required("relay.host", c.Relay.Host)
+	v.portString("relay.tls_port", c.Relay.TLSPort)
+	v.portString("relay.notls_port", c.Relay.NoTLSPort)
+
+	v.listen("api.listen", c.API.Listen)
+	if c.API.MaxBodyBytes <= 0 {
+		v.errorf("api.max_body_bytes", "must be positive")
+	}
+	if c.API.Send.UndoSeconds < 0 || c.API.Send.UndoSeconds > 3600 {
+		v.errorf("api.send.undo_seconds", "must be between 0 and 3600")
+	}
+	if c.API.Send.MaxScheduleDays <= 0 {
+		v.errorf("api.send.max_schedule_days", "must be positive")
+	}
+	if c.API.Bulk.MaxRecipients <= 0 {
+		v.errorf("api.bulk.max_recipients", "must be positive")
+	}
+	if c.API.Bulk.DomainRate < 0 {
+		v.errorf("api.bulk.domain_rate", "must not be negative")
+	}
+	for domain, rate := range c.API.Bulk.DomainRates {
+		if rate < 0 {
+			v.errorf("api.bulk.domain_rates."+domain, "must not be negative")
+		}
+	}
+
+	if c.Auth.JWTSecret != "" && len(c.Auth.JWTSecret) < 32 {
+		v.errorf("auth.jwt_secret", "must be at least 32 bytes")
+	}
+	if c.Auth.AccessTokenTTL <= 0 {
+		v.errorf("auth.access_token_ttl", "must be positive")
+	}
+	if c.Auth.RefreshTokenTTL <= c.Auth.AccessTokenTTL {
+		v.errorf("auth.refresh_token_ttl", "must be longer than auth.access_token_ttl")
+	}
+	if oidc := c.Auth.OIDC; oidc.Enabled {
+		v.url("auth.oidc.issuer", oidc.Issuer)
+		v.required("auth.oidc.client_id", oidc.ClientID)
+		v.url("auth.oidc.redirect_url", oidc.RedirectURL)
+		if oidc.JWKSURL != "" {
+			v.url("auth.oidc.jwks_url", oidc.JWKSURL)
+		}
+		v.required("auth.oidc.username_claim", oidc.UsernameClaim)
+		if oidc.PostLoginRedirect != "" {
+			v.url("auth.oidc.post_login_redirect", oidc.PostLoginRedirect)
+		}
+	}
+
+	for _, n := range []struct {
+		key   string
+		value int64
+	}{
+		{"quota.user_bytes", c.Quota.UserBytes},
+		{"quota.user_messages", c.Quota.UserMessages},
+		{"quota.domain_bytes", c.Quota.DomainBytes},
+		{"quota.domain_messages", c.Quota.DomainMessages},
+	} {
+		if n.value < 0 {
+			v.errorf(n.key, "must not be negative")
+		}
+	}
+	for i, t := range c.Quota.WarnThresholds {
+		if t <= 0 || t > 100 {
+			v.errorf(fmt.Sprintf("quota.warn_thresholds[%d]", i), "must be between 1 and 100, got %d", t)
+		}
+	}
+
+	for _, n := range []struct {
+		key   string
+		value int
+	}{
+		{"limits.user.messages_per_hour", c.Limits.User.MessagesPerHour},
+		{"limits.user.recipients_per_hour", c.Limits.User.RecipientsPerHour},
+		{"limits.api_key.messages_per_hour", c.Limits.APIKey.MessagesPerHour},
+		{"limits.api_key.recipients_per_hour", c.Limits.APIKey.RecipientsPerHour},
+		{"limits.delivery.domain_concurrency", c.Limits.Delivery.DomainConcurrency},
+		{"limits.delivery.domain_rate", c.Limits.Delivery.DomainRate},
+	} {
+		if n.value < 0 {
+			v.errorf(n.key, "must not be negative")
+		}
+	}
+	if c.Limits.Delivery.Concurrency <= 0 {
+		v.errorf("limits.delivery.concurrency", "must be positive")
+	}
+	for domain, n := range c.Limits.Delivery.DomainConcurrencies {
+		if n < 0 {
+			v.errorf("limits.delivery.domain_concurrencies."+domain, "must not be negative")
+		}
+	}
+	for domain, n := range c.Limits.Delivery.DomainRates {
+		if n < 0 {
+			v.errorf("limits.delivery.domain_rates."+domain, "must not be negative")
+		}
+	}
+
+	if c.Webhooks.Timeout <= 0 {
+		v.errorf("webhooks.timeout", "must be positive")
+	}
+	if c.Webhooks.MaxAttempts <= 0 {
+		v.errorf("webhooks.max_attempts", "must be positive")
+	}
+	if c.Webhooks.RetentionDays <= 0 {
+		v.errorf("webhooks.retention_days", "must be positive")
+	}
+
+	if c.Suppression.UnsubscribeURL != "" {
+		v.url("suppression.unsubscribe_url", c.Suppression.UnsubscribeURL)
+	}
+	if c.Suppression.Secret != "" && len(c.Suppression.Secret) < 32 {
+		v.errorf("suppression.secret", "must be at least 32 bytes")
+	}
+
+	v.spam("spam", c.Spam)
+
+	if len(v.problems) > 0 {
+		return &ValidationError{Problems: v.problems}
+	}
+	return nil
+}
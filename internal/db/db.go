@@ -1,31 +1,44 @@
 package db
 
 import (
+	"errors"
 	"log"
-	
+
 	"YoPost/internal/db/mongodb"
 	"YoPost/internal/db/mysql"
 )
 
 type DBConfig struct {
-	MySQL    mysql.MySQLConfig
-	MongoDB  mongodb.MongoDBConfig
+	MySQL   mysql.MySQLConfig
+	MongoDB mongodb.MongoDBConfig
+}
+
+// Clients 已建立的数据库连接，由调用方在全部服务停止后关闭
+type Clients struct {
+	MySQL   *mysql.MySQLClient
+	MongoDB *mongodb.MongoDBClient
 }
 
-func InitDB(config DBConfig) {
-	// Initialize MySQL
+// Open 连接 MySQL 和 MongoDB，任一失败时关闭已建立的连接
+func Open(config DBConfig) (*Clients, error) {
 	mysqlClient, err := mysql.NewMySQLClient(config.MySQL)
 	if err != nil {
-		log.Fatalf("Failed to initialize MySQL: %v", err)
+		log.Printf("ERROR: Failed to initialize MySQL - %v", err)
+		return nil, err
 	}
-	defer mysqlClient.Close()
 
-	// Initialize MongoDB
 	mongoClient, err := mongodb.NewMongoDBClient(config.MongoDB)
 	if err != nil {
-		log.Fatalf("Failed to initialize MongoDB: %v", err)
+		log.Printf("ERROR: Failed to initialize MongoDB - %v", err)
+		mysqlClient.Close()
+		return nil, err
 	}
-	defer mongoClient.Close()
 
-	log.Println("Database services initialized successfully")
-}
\ No newline at end of file
+	log.Println("INFO: Database services initialized successfully")
+	return &Clients{MySQL: mysqlClient, MongoDB: mongoClient}, nil
+}
+
+// Close 关闭全部数据库连接
+func (c *Clients) Close() error {
+	return errors.Join(c.MongoDB.Close(), c.MySQL.Close())
+}
@@ -0,0 +1,221 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// APIKey API 密钥记录，只保存密钥的 SHA-256 哈希
+type APIKey struct {
+	ID         string
+	Name       string
+	Subject    string // 密钥所属用户
+	Role       string
+	Domains    []string
+	Scopes     []string
+	SecretHash string
+	CreatedAt  time.Time
+	ExpiresAt  time.Time // 零值表示不过期
+	LastUsedAt time.Time
+	RevokedAt  time.Time // 零值表示未吊销
+}
+
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+// UserRole 返回用户的角色及其可管理的域名
+func (c *MySQLClient) UserRole(ctx context.Context, username string) (string, []string, error) {
+	var role string
+	err := c.db.QueryRowContext(ctx, "SELECT role FROM users WHERE username = ?", username).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil, fmt.Errorf("user %s: %w", username, ErrNotFound)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	rows, err := c.db.QueryContext(ctx, "SELECT domain FROM domain_admins WHERE username = ? ORDER BY domain", username)
+	if err != nil {
+		return "", nil, err
+	}
+	defer rows.Close()
+
+	var domains []string
+	for rows.Next() {
+		var d string
+		if err := rows.Scan(&d); err != nil {
+			return "", nil, err
+		}
+		domains = append(domains, d)
+	}
+	return role, domains, rows.Err()
+}
+
+// SetUserRole 设置用户角色，domains 替换用户原有的可管理域名
+func (c *MySQLClient) SetUserRole(ctx context.Context, username, role string, domains []string) error {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "UPDATE users SET role = ? WHERE username = ?", role, username)
+	if err != nil {
+		return err
+	}
+	// 角色未变化时 RowsAffected 为 0，需单独确认用户存在
+	if n, _ := res.RowsAffected(); n == 0 {
+		var exists int
+		err := tx.QueryRowContext(ctx, "SELECT 1 FROM users WHERE username = ?", username).Scan(&exists)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("user %s: %w", username, ErrNotFound)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM domain_admins WHERE username = ?", username); err != nil {
+		return err
+	}
+	for _, d := range domains {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO domain_admins (username, domain) VALUES (?, ?)", username, d); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// CreateAPIKey 保存新的 API 密钥
+func (c *MySQLClient) CreateAPIKey(ctx context.Context, k *APIKey) error {
+	_, err := c.db.ExecContext(ctx, `
+		INSERT INTO api_keys (id, name, subject, role, domains, scopes, secret_hash, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		k.ID, k.Name, k.Subject, k.Role, strings.Join(k.Domains, ","), strings.Join(k.Scopes, ","),
+		k.SecretHash, k.CreatedAt, nullTime(k.ExpiresAt))
+	if isDuplicate(err) {
+		return fmt.Errorf("api key %s: %w", k.ID, ErrExists)
+	}
+	return err
+}
+
+const apiKeyColumns = "id, name, subject, role, domains, scopes, secret_hash, created_at, expires_at, last_used_at, revoked_at"
+
+func scanAPIKey(row interface{ Scan(...interface{}) error }) (*APIKey, error) {
+	var k APIKey
+	var domains, scopes string
+	var expires, used, revoked sql.NullTime
+	err := row.Scan(&k.ID, &k.Name, &k.Subject, &k.Role, &domains, &scopes, &k.SecretHash,
+		&k.CreatedAt, &expires, &used, &revoked)
+	if err != nil {
+		return nil, err
+	}
+	k.Domains, k.Scopes = splitList(domains), splitList(scopes)
+	k.ExpiresAt, k.LastUsedAt, k.RevokedAt = expires.Time, used.Time, revoked.Time
+	return &k, nil
+}
+
+// GetAPIKey 按 ID 读取 API 密钥，包括已吊销的
+func (c *MySQLClient) GetAPIKey(ctx context.Context, id string) (*APIKey, error) {
+	k, err := scanAPIKey(c.db.QueryRowContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("api key %s: %w", id, ErrNotFound)
+	}
+	return k, err
+}
+
+// ListAPIKeys 按创建时间列出 subject 的 API 密钥，subject 为空时列出全部
+func (c *MySQLClient) ListAPIKeys(ctx context.Context, subject string) ([]*APIKey, error) {
+	query, args := "SELECT "+apiKeyColumns+" FROM api_keys", []interface{}{}
+	if subject != "" {
+		query += " WHERE subject = ?"
+		args = append(args, subject)
+	}
+	rows, err := c.db.QueryContext(ctx, query+" ORDER BY created_at, id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []*APIKey
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// RevokeAPIKey 吊销 API 密钥，密钥不存在或已吊销时返回 ErrNotFound
+func (c *MySQLClient) RevokeAPIKey(ctx context.Context, id string) error {
+	res, err := c.db.ExecContext(ctx, "UPDATE api_keys SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL", time.Now(), id)
+	if err := affected(res, err); err != nil {
+		return fmt.Errorf("api key %s: %w", id, err)
+	}
+	return nil
+}
+
+// TouchAPIKey 记录 API 密钥的最近使用时间
+func (c *MySQLClient) TouchAPIKey(ctx context.Context, id string, at time.Time) error {
+	_, err := c.db.ExecContext(ctx, "UPDATE api_keys SET last_used_at = ? WHERE id = ?", at, id)
+	return err
+}
+
+// SaveRefreshToken 保存刷新令牌的哈希，同时清理已过期的令牌
+func (c *MySQLClient) SaveRefreshToken(ctx context.Context, hash, username string, expires time.Time) error {
+	if _, err := c.db.ExecContext(ctx, "DELETE FROM refresh_tokens WHERE expires_at < ?", time.Now()); err != nil {
+		return err
+	}
+	_, err := c.db.ExecContext(ctx,
+		"INSERT INTO refresh_tokens (token_hash, username, expires_at) VALUES (?, ?, ?)", hash, username, expires)
+	return err
+}
+
+// ConsumeRefreshToken 删除并返回刷新令牌所属用户，令牌只能使用一次
+func (c *MySQLClient) ConsumeRefreshToken(ctx context.Context, hash string) (string, error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var username string
+	var expires time.Time
+	err = tx.QueryRowContext(ctx,
+		"SELECT username, expires_at FROM refresh_tokens WHERE token_hash = ? FOR UPDATE", hash).Scan(&username, &expires)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM refresh_tokens WHERE token_hash = ?", hash); err != nil {
+		return "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	if time.Now().After(expires) {
+		return "", ErrNotFound
+	}
+	return username, nil
+}
+
+// DeleteRefreshTokens 删除用户的全部刷新令牌，用于修改密码或降级角色后使会话失效
+func (c *MySQLClient) DeleteRefreshTokens(ctx context.Context, username string) error {
+	_, err := c.db.ExecContext(ctx, "DELETE FROM refresh_tokens WHERE username = ?", username)
+	return err
+}
@@ -0,0 +1,194 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrNotFound 用户、域名或别名不存在
+var ErrNotFound = errors.New("not found")
+
+// ErrExists 用户、域名或别名已存在
+var ErrExists = errors.New("already exists")
+
+// User 本地邮箱用户
+type User struct {
+	Username  string
+	Role      string
+	CreatedAt string
+}
+
+// Alias 别名地址及其投递目标
+type Alias struct {
+	Address string
+	Target  string
+}
+
+// isDuplicate 判断是否为唯一索引冲突
+func isDuplicate(err error) bool {
+	var me *mysql.MySQLError
+	return errors.As(err, &me) && me.Number == 1062
+}
+
+// affected 将未影响任何行转换为 ErrNotFound
+func affected(res interface{ RowsAffected() (int64, error) }, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// AddUser 创建用户，密码以 bcrypt 哈希保存
+func (c *MySQLClient) AddUser(ctx context.Context, username, password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	_, err = c.db.ExecContext(ctx, "INSERT INTO users (username, password) VALUES (?, ?)", username, string(hash))
+	if isDuplicate(err) {
+		return fmt.Errorf("user %s: %w", username, ErrExists)
+	}
+	return err
+}
+
+// DeleteUser 删除用户
+func (c *MySQLClient) DeleteUser(ctx context.Context, username string) error {
+	res, err := c.db.ExecContext(ctx, "DELETE FROM users WHERE username = ?", username)
+	if err := affected(res, err); err != nil {
+		return fmt.Errorf("user %s: %w", username, err)
+	}
+	return nil
+}
+
+// SetPassword 修改用户密码
+func (c *MySQLClient) SetPassword(ctx context.Context, username, password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	res, err := c.db.ExecContext(ctx, "UPDATE users SET password = ? WHERE username = ?", string(hash), username)
+	if err := affected(res, err); err != nil {
+		return fmt.Errorf("user %s: %w", username, err)
+	}
+	return nil
+}
+
+// CheckPassword 校验用户密码
+func (c *MySQLClient) CheckPassword(ctx context.Context, username, password string) (bool, error) {
+	var hash string
+	err := c.db.QueryRowContext(ctx, "SELECT password FROM users WHERE username = ?", username).Scan(&hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil, nil
+}
+
+// ListUsers 按用户名排序列出用户
+func (c *MySQLClient) ListUsers(ctx context.Context) ([]User, error) {
+	rows, err := c.db.QueryContext(ctx, "SELECT username, role, created_at FROM users ORDER BY username")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var u User
+		var created time.Time
+		if err := rows.Scan(&u.Username, &u.Role, &created); err != nil {
+			return nil, err
+		}
+		u.CreatedAt = created.Format(time.RFC3339)
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// AddDomain 添加本地域名
+func (c *MySQLClient) AddDomain(ctx context.Context, name string) error {
+	_, err := c.db.ExecContext(ctx, "INSERT INTO domains (name) VALUES (?)", name)
+	if isDuplicate(err) {
+		return fmt.Errorf("domain %s: %w", name, ErrExists)
+	}
+	return err
+}
+
+// DeleteDomain 删除本地域名
+func (c *MySQLClient) DeleteDomain(ctx context.Context, name string) error {
+	res, err := c.db.ExecContext(ctx, "DELETE FROM domains WHERE name = ?", name)
+	if err := affected(res, err); err != nil {
+		return fmt.Errorf("domain %s: %w", name, err)
+	}
+	return nil
+}
+
+// ListDomains 列出数据库中的本地域名
+func (c *MySQLClient) ListDomains(ctx context.Context) ([]string, error) {
+	rows, err := c.db.QueryContext(ctx, "SELECT name FROM domains ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var domains []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		domains = append(domains, name)
+	}
+	return domains, rows.Err()
+}
+
+// SetAlias 添加或修改别名
+func (c *MySQLClient) SetAlias(ctx context.Context, address, target string) error {
+	_, err := c.db.ExecContext(ctx,
+		"INSERT INTO aliases (address, target) VALUES (?, ?) ON DUPLICATE KEY UPDATE target = VALUES(target)",
+		address, target)
+	return err
+}
+
+// DeleteAlias 删除别名
+func (c *MySQLClient) DeleteAlias(ctx context.Context, address string) error {
+	res, err := c.db.ExecContext(ctx, "DELETE FROM aliases WHERE address = ?", address)
+	if err := affected(res, err); err != nil {
+		return fmt.Errorf("alias %s: %w", address, err)
+	}
+	return nil
+}
+
+// ListAliases 按地址排序列出别名
+func (c *MySQLClient) ListAliases(ctx context.Context) ([]Alias, error) {
+	rows, err := c.db.QueryContext(ctx, "SELECT address, target FROM aliases ORDER BY address")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var aliases []Alias
+	for rows.Next() {
+		var a Alias
+		if err := rows.Scan(&a.Address, &a.Target); err != nil {
+			return nil, err
+		}
+		aliases = append(aliases, a)
+	}
+	return aliases, rows.Err()
+}
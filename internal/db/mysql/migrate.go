@@ -0,0 +1,113 @@
+package mysql
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+// migration 一次表结构变更，按版本号顺序执行
+type migration struct {
+	Version     int
+	Description string
+	SQL         string
+}
+
+// migrations 全部表结构变更，只能在末尾追加
+var migrations = []migration{
+	{1, "create users table", `
+		CREATE TABLE IF NOT EXISTS users (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			username VARCHAR(255) NOT NULL UNIQUE,
+			password VARCHAR(255) NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+		)`},
+	{2, "create domains table", `
+		CREATE TABLE IF NOT EXISTS domains (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			name VARCHAR(255) NOT NULL UNIQUE,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`},
+	{3, "create aliases table", `
+		CREATE TABLE IF NOT EXISTS aliases (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			address VARCHAR(255) NOT NULL UNIQUE,
+			target VARCHAR(255) NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`},
+	{4, "add role to users", `
+		ALTER TABLE users ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'user'`},
+	{5, "create domain_admins table", `
+		CREATE TABLE IF NOT EXISTS domain_admins (
+			username VARCHAR(255) NOT NULL,
+			domain VARCHAR(255) NOT NULL,
+			PRIMARY KEY (username, domain)
+		)`},
+	{6, "create api_keys table", `
+		CREATE TABLE IF NOT EXISTS api_keys (
+			id VARCHAR(32) PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			subject VARCHAR(255) NOT NULL,
+			role VARCHAR(20) NOT NULL,
+			domains TEXT NOT NULL,
+			scopes TEXT NOT NULL,
+			secret_hash CHAR(64) NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			expires_at TIMESTAMP NULL,
+			last_used_at TIMESTAMP NULL,
+			revoked_at TIMESTAMP NULL,
+			INDEX (subject)
+		)`},
+	{7, "create refresh_tokens table", `
+		CREATE TABLE IF NOT EXISTS refresh_tokens (
+			token_hash CHAR(64) PRIMARY KEY,
+			username VARCHAR(255) NOT NULL,
+			expires_at TIMESTAMP NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			INDEX (username)
+		)`},
+}
+
+// SchemaVersion 返回当前已应用的最高迁移版本
+func (c *MySQLClient) SchemaVersion(ctx context.Context) (int, error) {
+	var version int
+	err := c.db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	return version, err
+}
+
+// Migrate 按顺序执行未应用的迁移，返回本次应用的迁移描述
+func (c *MySQLClient) Migrate(ctx context.Context) ([]string, error) {
+	_, err := c.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INT PRIMARY KEY,
+			description VARCHAR(255) NOT NULL,
+			applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create schema_migrations table: %v", err)
+	}
+
+	current, err := c.SchemaVersion(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema version: %v", err)
+	}
+
+	var applied []string
+	for _, m := range migrations {
+		if m.Version <= current {
+			continue
+		}
+		log.Printf("[INFO] Applying MySQL migration %d: %s", m.Version, m.Description)
+		if _, err := c.db.ExecContext(ctx, m.SQL); err != nil {
+			return applied, fmt.Errorf("migration %d (%s) failed: %v", m.Version, m.Description, err)
+		}
+		if _, err := c.db.ExecContext(ctx,
+			"INSERT INTO schema_migrations (version, description) VALUES (?, ?)",
+			m.Version, m.Description); err != nil {
+			return applied, fmt.Errorf("failed to record migration %d: %v", m.Version, err)
+		}
+		applied = append(applied, fmt.Sprintf("%d %s", m.Version, m.Description))
+	}
+	return applied, nil
+}
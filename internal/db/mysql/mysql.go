@@ -1,6 +1,7 @@
 package mysql
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
@@ -103,35 +104,17 @@ func NewMySQLClient(config MySQLConfig) (*MySQLClient, error) {
 		return nil, fmt.Errorf("failed to connect to MySQL after %d attempts: %v", maxRetries, err)
 	}
 
-	client := &MySQLClient{db: db}
-	if err := client.initTables(); err != nil {
-		db.Close()
-		return nil, fmt.Errorf("failed to initialize tables: %v", err)
-	}
-
-	return client, nil
+	return &MySQLClient{db: db}, nil
 }
 
-// 添加initTables方法实现
-func (c *MySQLClient) initTables() error {
-	log.Println("[DEBUG] Initializing MySQL tables")
-
-	// 创建用户表
-	_, err := c.db.Exec(`
-		CREATE TABLE IF NOT EXISTS users (
-			id INT AUTO_INCREMENT PRIMARY KEY,
-			username VARCHAR(255) NOT NULL UNIQUE,
-			password VARCHAR(255) NOT NULL,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
-		)
-	`)
+// UserExists 判断本地用户是否存在
+func (c *MySQLClient) UserExists(ctx context.Context, username string) (bool, error) {
+	var n int
+	err := c.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE username = ?", username).Scan(&n)
 	if err != nil {
-		return fmt.Errorf("failed to create users table: %v", err)
+		return false, err
 	}
-
-	log.Println("[INFO] MySQL tables initialized successfully")
-	return nil
+	return n > 0, nil
 }
 
 func (c *MySQLClient) GetDB() *sql.DB {
@@ -0,0 +1,122 @@
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Service 由 Manager 按顺序启动、逆序停止的组件
+type Service interface {
+	// Start 完成初始化 (如连接数据库、绑定端口) 后返回，长期运行的工作在后台进行
+	Start(ctx context.Context) error
+	// Stop 停止服务并等待进行中的工作完成，ctx 到期后应尽快返回
+	Stop(ctx context.Context) error
+}
+
+// Hook 将一对函数适配为 Service，OnStop 可为空
+type Hook struct {
+	OnStart func(ctx context.Context) error
+	OnStop  func(ctx context.Context) error
+}
+
+func (h Hook) Start(ctx context.Context) error {
+	if h.OnStart == nil {
+		return nil
+	}
+	return h.OnStart(ctx)
+}
+
+func (h Hook) Stop(ctx context.Context) error {
+	if h.OnStop == nil {
+		return nil
+	}
+	return h.OnStop(ctx)
+}
+
+type entry struct {
+	name string
+	svc  Service
+}
+
+// Manager 按依赖顺序管理服务的启动和关闭
+type Manager struct {
+	// ShutdownTimeout 全部服务停止的最长等待时间，默认 30 秒
+	ShutdownTimeout time.Duration
+	// Logger 为空时使用 log 包的默认 Logger
+	Logger *log.Logger
+
+	services []entry
+	errc     chan error
+}
+
+// NewManager 创建服务管理器
+func NewManager(shutdownTimeout time.Duration) *Manager {
+	return &Manager{ShutdownTimeout: shutdownTimeout, errc: make(chan error, 1)}
+}
+
+// Add 注册服务，先注册的先启动、后停止
+func (m *Manager) Add(name string, svc Service) {
+	m.services = append(m.services, entry{name: name, svc: svc})
+}
+
+// Fail 报告服务在后台运行时出现的致命错误，触发全部服务关闭
+func (m *Manager) Fail(name string, err error) {
+	select {
+	case m.errc <- fmt.Errorf("%s: %w", name, err):
+	default:
+	}
+}
+
+func (m *Manager) logf(format string, args ...interface{}) {
+	if m.Logger != nil {
+		m.Logger.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+func (m *Manager) shutdownTimeout() time.Duration {
+	if m.ShutdownTimeout > 0 {
+		return m.ShutdownTimeout
+	}
+	return 30 * time.Second
+}
+
+// Run 依次启动全部服务，直到 ctx 取消或某个服务失败，然后逆序停止已启动的服务
+func (m *Manager) Run(ctx context.Context) error {
+	var err error
+	started := 0
+	for _, e := range m.services {
+		m.logf("INFO: Starting %s", e.name)
+		if err = e.svc.Start(ctx); err != nil {
+			err = fmt.Errorf("%s: %w", e.name, err)
+			m.logf("ERROR: Failed to start %s - %v", e.name, err)
+			break
+		}
+		started++
+	}
+
+	if err == nil {
+		m.logf("INFO: All services started")
+		select {
+		case <-ctx.Done():
+			m.logf("INFO: Shutdown requested")
+		case err = <-m.errc:
+			m.logf("ERROR: %v, shutting down", err)
+		}
+	}
+
+	stopCtx, cancel := context.WithTimeout(context.Background(), m.shutdownTimeout())
+	defer cancel()
+	for i := started - 1; i >= 0; i-- {
+		e := m.services[i]
+		m.logf("INFO: Stopping %s", e.name)
+		if stopErr := e.svc.Stop(stopCtx); stopErr != nil {
+			m.logf("ERROR: Failed to stop %s cleanly - %v", e.name, stopErr)
+		}
+	}
+	m.logf("INFO: Shutdown complete")
+	return err
+}
@@ -0,0 +1,99 @@
+package logging
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"sync/atomic"
+)
+
+// Level 日志级别
+type Level int32
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// ParseLevel 解析配置中的日志级别
+func ParseLevel(s string) (Level, error) {
+	switch s {
+	case "debug":
+		return LevelDebug, nil
+	case "info", "":
+		return LevelInfo, nil
+	case "warn":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q", s)
+}
+
+// markers 现有日志使用的级别前缀，兼容 "INFO: " 和 "[INFO] " 两种写法
+var markers = []struct {
+	level  Level
+	tokens [][]byte
+}{
+	{LevelDebug, [][]byte{[]byte("DEBUG:"), []byte("[DEBUG]")}},
+	{LevelInfo, [][]byte{[]byte("INFO:"), []byte("[INFO]")}},
+	{LevelWarn, [][]byte{[]byte("WARNING:"), []byte("WARN:"), []byte("[WARN]")}},
+	{LevelError, [][]byte{[]byte("ERROR:"), []byte("[ERROR]")}},
+}
+
+// Filter 按级别过滤日志行的 io.Writer
+// 通过识别 log.Printf 输出中的级别前缀判断级别，没有前缀的行总是输出
+type Filter struct {
+	out   io.Writer
+	level atomic.Int32
+}
+
+// NewFilter 创建日志过滤器
+func NewFilter(out io.Writer, level Level) *Filter {
+	f := &Filter{out: out}
+	f.level.Store(int32(level))
+	return f
+}
+
+// SetLevel 原子修改日志级别，用于配置热加载
+func (f *Filter) SetLevel(level Level) {
+	f.level.Store(int32(level))
+}
+
+// Level 返回当前日志级别
+func (f *Filter) Level() Level {
+	return Level(f.level.Load())
+}
+
+func lineLevel(p []byte) (Level, bool) {
+	// 只检查日志前缀 (时间戳之后) 的开头部分
+	head := p
+	if len(head) > 48 {
+		head = head[:48]
+	}
+	for _, m := range markers {
+		for _, t := range m.tokens {
+			if bytes.Contains(head, t) {
+				return m.level, true
+			}
+		}
+	}
+	return 0, false
+}
+
+func (f *Filter) Write(p []byte) (int, error) {
+	if level, ok := lineLevel(p); ok && level < f.Level() {
+		return len(p), nil
+	}
+	return f.out.Write(p)
+}
+
+// Install 将标准库 log 的输出替换为带级别过滤的输出
+func Install(out io.Writer, level Level) *Filter {
+	f := NewFilter(out, level)
+	log.SetOutput(f)
+	return f
+}
@@ -0,0 +1,338 @@
+// Package compose 根据结构化字段生成 RFC 5322 / MIME 邮件
+package compose
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrInvalid 邮件字段不合法
+var ErrInvalid = errors.New("invalid message")
+
+// Attachment 附件；Inline 且设置了 ContentID 的附件可在 HTML 中以 cid: 引用
+type Attachment struct {
+	Filename    string
+	ContentType string // 为空时按扩展名推断，无法推断时为 application/octet-stream
+	ContentID   string
+	Inline      bool
+	Data        []byte
+}
+
+// Message 待发送的邮件
+type Message struct {
+	From    *mail.Address
+	To      []*mail.Address
+	Cc      []*mail.Address
+	Bcc     []*mail.Address // 只出现在信封中，不写入头部 (草稿除外)
+	ReplyTo []*mail.Address
+	Subject string
+	Text    string
+	HTML    string
+	// InReplyTo 和 References 为带尖括号的 Message-ID
+	InReplyTo   string
+	References  []string
+	Headers     map[string]string // 自定义头部，不能覆盖上面的字段
+	Attachments []Attachment
+	// Date 和 MessageID 为空时由 Build 生成
+	Date      time.Time
+	MessageID string
+	// Draft 为 true 时生成草稿：允许没有收件人，Bcc 写入头部以便再次编辑
+	Draft bool
+}
+
+// reserved 由 Message 字段生成、不允许通过 Headers 设置的头部
+var reserved = map[string]bool{
+	"From": true, "To": true, "Cc": true, "Bcc": true, "Reply-To": true, "Sender": true,
+	"Subject": true, "Date": true, "Message-Id": true, "In-Reply-To": true, "References": true,
+	"Mime-Version": true, "Content-Type": true, "Content-Transfer-Encoding": true,
+	"Content-Disposition": true, "Content-Id": true, "Return-Path": true, "Received": true,
+}
+
+// Reserved 判断头部是否由 Message 字段生成，不能通过 Headers 设置
+func Reserved(name string) bool {
+	return reserved[textproto.CanonicalMIMEHeaderKey(name)]
+}
+
+var (
+	headerNamePattern = regexp.MustCompile(`^[!-9;-~]+$`)
+	msgIDPattern      = regexp.MustCompile(`^<[^<>\s@]+@[^<>\s@]+>$`)
+)
+
+// Recipients 返回信封收件人 (To、Cc、Bcc)，去重并保持顺序
+func (m *Message) Recipients() []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, list := range [][]*mail.Address{m.To, m.Cc, m.Bcc} {
+		for _, a := range list {
+			key := strings.ToLower(a.Address)
+			if !seen[key] {
+				seen[key] = true
+				out = append(out, a.Address)
+			}
+		}
+	}
+	return out
+}
+
+// Validate 检查发件人、收件人、线程头和自定义头部；草稿可以没有收件人
+func (m *Message) Validate() error {
+	if m.From == nil || m.From.Address == "" {
+		return fmt.Errorf("%w: from is required", ErrInvalid)
+	}
+	if !m.Draft && len(m.To)+len(m.Cc)+len(m.Bcc) == 0 {
+		return fmt.Errorf("%w: at least one recipient is required", ErrInvalid)
+	}
+	for _, list := range [][]*mail.Address{{m.From}, m.To, m.Cc, m.Bcc, m.ReplyTo} {
+		for _, a := range list {
+			if _, err := mail.ParseAddress(a.Address); err != nil || strings.ContainsAny(a.Address, "<>\r\n") {
+				return fmt.Errorf("%w: invalid address %q", ErrInvalid, a.Address)
+			}
+			if strings.ContainsAny(a.Name, "\r\n") {
+				return fmt.Errorf("%w: invalid display name %q", ErrInvalid, a.Name)
+			}
+		}
+	}
+	if strings.ContainsAny(m.Subject, "\r\n") {
+		return fmt.Errorf("%w: subject must be a single line", ErrInvalid)
+	}
+	for _, id := range append([]string{m.InReplyTo}, m.References...) {
+		if id != "" && !msgIDPattern.MatchString(id) {
+			return fmt.Errorf("%w: invalid message id %q", ErrInvalid, id)
+		}
+	}
+	for name, value := range m.Headers {
+		if !headerNamePattern.MatchString(name) {
+			return fmt.Errorf("%w: invalid header name %q", ErrInvalid, name)
+		}
+		if Reserved(name) {
+			return fmt.Errorf("%w: header %s cannot be set directly", ErrInvalid, name)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("%w: header %s must be a single line", ErrInvalid, name)
+		}
+	}
+	for _, a := range m.Attachments {
+		if strings.ContainsAny(a.Filename+a.ContentID, "\r\n\"") {
+			return fmt.Errorf("%w: invalid attachment %q", ErrInvalid, a.Filename)
+		}
+		if a.ContentType != "" {
+			if _, _, err := mime.ParseMediaType(a.ContentType); err != nil {
+				return fmt.Errorf("%w: invalid content type %q of attachment %q", ErrInvalid, a.ContentType, a.Filename)
+			}
+		}
+	}
+	return nil
+}
+
+// NewMessageID 生成 "<random@domain>" 形式的 Message-ID
+func NewMessageID(domain string) string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return "<" + hex.EncodeToString(b) + "@" + domain + ">"
+}
+
+func addressList(list []*mail.Address) string {
+	s := make([]string, len(list))
+	for i, a := range list {
+		s[i] = a.String()
+	}
+	return strings.Join(s, ", ")
+}
+
+// encodeWord 对非 ASCII 的头部值做 RFC 2047 编码
+func encodeWord(s string) string {
+	return mime.QEncoding.Encode("utf-8", s)
+}
+
+// Build 校验并生成完整的邮件内容，填充 Date 和 MessageID
+func (m *Message) Build() ([]byte, error) {
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	if m.Date.IsZero() {
+		m.Date = time.Now()
+	}
+	if m.MessageID == "" {
+		m.MessageID = NewMessageID(m.From.Address[strings.LastIndexByte(m.From.Address, '@')+1:])
+	}
+
+	var buf bytes.Buffer
+	header := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(&buf, "%s: %s\r\n", name, value)
+		}
+	}
+	header("From", m.From.String())
+	header("To", addressList(m.To))
+	header("Cc", addressList(m.Cc))
+	if m.Draft {
+		header("Bcc", addressList(m.Bcc))
+	}
+	header("Reply-To", addressList(m.ReplyTo))
+	header("Subject", encodeWord(m.Subject))
+	header("Date", m.Date.Format(time.RFC1123Z))
+	header("Message-ID", m.MessageID)
+	header("In-Reply-To", m.InReplyTo)
+	header("References", strings.Join(m.References, " "))
+	names := make([]string, 0, len(m.Headers))
+	for name := range m.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		header(textproto.CanonicalMIMEHeaderKey(name), encodeWord(m.Headers[name]))
+	}
+	header("MIME-Version", "1.0")
+
+	if err := m.writeBody(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// part 一个 MIME 部分：头部和已编码的内容
+type part struct {
+	header textproto.MIMEHeader
+	body   []byte
+}
+
+// writeBody 写入 Content-Type 及正文，结构为
+// mixed( related( alternative(text, html), inline... ), attachment... )，只有一个部分的层级会被省略
+func (m *Message) writeBody(buf *bytes.Buffer) error {
+	var alternatives []part
+	if m.Text != "" || m.HTML == "" {
+		alternatives = append(alternatives, textPart("text/plain", m.Text))
+	}
+	if m.HTML != "" {
+		alternatives = append(alternatives, textPart("text/html", m.HTML))
+	}
+	body, err := multipartOf("alternative", alternatives)
+	if err != nil {
+		return err
+	}
+
+	var inline, attached []part
+	for _, a := range m.Attachments {
+		if a.Inline && a.ContentID != "" {
+			inline = append(inline, attachmentPart(a))
+		} else {
+			attached = append(attached, attachmentPart(a))
+		}
+	}
+	if body, err = multipartOf("related", append([]part{body}, inline...)); err != nil {
+		return err
+	}
+	if body, err = multipartOf("mixed", append([]part{body}, attached...)); err != nil {
+		return err
+	}
+
+	for _, k := range []string{"Content-Type", "Content-Transfer-Encoding"} {
+		if v := body.header.Get(k); v != "" {
+			fmt.Fprintf(buf, "%s: %s\r\n", k, v)
+		}
+	}
+	buf.WriteString("\r\n")
+	buf.Write(body.body)
+	return nil
+}
+
+// multipartOf 将多个部分组合为 multipart/<subtype>，只有一个部分时原样返回
+func multipartOf(subtype string, parts []part) (part, error) {
+	if len(parts) == 1 {
+		return parts[0], nil
+	}
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for _, p := range parts {
+		pw, err := w.CreatePart(p.header)
+		if err != nil {
+			return part{}, err
+		}
+		pw.Write(p.body)
+	}
+	if err := w.Close(); err != nil {
+		return part{}, err
+	}
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Type", mime.FormatMediaType("multipart/"+subtype, map[string]string{"boundary": w.Boundary()}))
+	return part{header: h, body: body.Bytes()}, nil
+}
+
+// textPart 以 quoted-printable 编码 UTF-8 文本，行尾统一为 CRLF
+func textPart(mediaType, text string) part {
+	text = strings.ReplaceAll(strings.ReplaceAll(text, "\r\n", "\n"), "\n", "\r\n")
+	var body bytes.Buffer
+	qp := quotedprintable.NewWriter(&body)
+	qp.Write([]byte(text))
+	qp.Close()
+
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Type", mediaType+"; charset=utf-8")
+	h.Set("Content-Transfer-Encoding", "quoted-printable")
+	return part{header: h, body: body.Bytes()}
+}
+
+func attachmentPart(a Attachment) part {
+	contentType := a.ContentType
+	if contentType == "" {
+		if i := strings.LastIndexByte(a.Filename, '.'); i >= 0 {
+			contentType = mime.TypeByExtension(a.Filename[i:])
+		}
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	disposition := "attachment"
+	if a.Inline {
+		disposition = "inline"
+	}
+
+	h := textproto.MIMEHeader{}
+	if a.Filename != "" {
+		// FormatMediaType 对非 ASCII 文件名使用 RFC 2231 编码
+		h.Set("Content-Type", mime.FormatMediaType(contentType, map[string]string{"name": a.Filename}))
+		h.Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": a.Filename}))
+	} else {
+		h.Set("Content-Type", contentType)
+		h.Set("Content-Disposition", disposition)
+	}
+	if a.ContentID != "" {
+		h.Set("Content-ID", "<"+strings.Trim(a.ContentID, "<>")+">")
+	}
+	h.Set("Content-Transfer-Encoding", "base64")
+
+	encoded := base64.StdEncoding.EncodeToString(a.Data)
+	var body bytes.Buffer
+	for len(encoded) > 76 {
+		body.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	body.WriteString(encoded + "\r\n")
+	return part{header: h, body: body.Bytes()}
+}
+
+// Reply 返回回复 parent 时使用的 In-Reply-To 和 References (RFC 5322 3.6.4)
+func Reply(parentID, parentReferences, parentInReplyTo string) (string, []string) {
+	parentID = strings.TrimSpace(parentID)
+	if parentID == "" {
+		return "", nil
+	}
+	refs := strings.Fields(parentReferences)
+	if len(refs) == 0 {
+		refs = strings.Fields(parentInReplyTo)
+	}
+	return parentID, append(refs, parentID)
+}
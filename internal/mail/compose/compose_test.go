@@ -0,0 +1,102 @@
+package compose
+
+import (
+	"errors"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+func addrs(list ...string) []*mail.Address {
+	out := make([]*mail.Address, len(list))
+	for i, a := range list {
+		out[i] = &mail.Address{Address: a}
+	}
+	return out
+}
+
+func TestRecipients(t *testing.T) {
+	m := &Message{
+		To:  addrs("bob@example.com", "carol@example.com"),
+		Cc:  addrs("Bob@Example.com", "dave@example.com"),
+		Bcc: addrs("eve@example.com", "carol@example.com"),
+	}
+	want := "bob@example.com,carol@example.com,dave@example.com,eve@example.com"
+	if got := strings.Join(m.Recipients(), ","); got != want {
+		t.Errorf("Recipients() = %s, want %s", got, want)
+	}
+}
+
+func TestBuildBcc(t *testing.T) {
+	tests := []struct {
+		name   string
+		draft  bool
+		to, cc []*mail.Address
+		bcc    bool
+	}{
+		{"message", false, addrs("bob@example.com"), addrs("carol@example.com"), false},
+		{"only bcc", false, nil, nil, false},
+		{"draft", true, addrs("bob@example.com"), addrs("carol@example.com"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &Message{
+				From:    &mail.Address{Name: "Alice", Address: "alice@example.com"},
+				To:      tt.to,
+				Cc:      tt.cc,
+				Bcc:     addrs("eve@example.com"),
+				Subject: "hello",
+				Text:    "hi",
+				Draft:   tt.draft,
+			}
+			raw, err := m.Build()
+			if err != nil {
+				t.Fatalf("Build() error = %v", err)
+			}
+			header := string(raw[:strings.Index(string(raw), "\r\n\r\n")])
+			if got := strings.Contains(header, "\r\nBcc: "); got != tt.bcc {
+				t.Errorf("Build() has Bcc header = %v, want %v\n%s", got, tt.bcc, header)
+			}
+			if got := strings.Contains(header, "\r\nCc: <carol@example.com>"); got != (tt.cc != nil) {
+				t.Errorf("Build() has Cc header = %v, want %v\n%s", got, tt.cc != nil, header)
+			}
+			if !strings.HasSuffix(m.MessageID, "@example.com>") {
+				t.Errorf("MessageID = %q, want one in the sender's domain", m.MessageID)
+			}
+		})
+	}
+
+	if _, err := (&Message{From: &mail.Address{Address: "alice@example.com"}}).Build(); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Build() without recipients error = %v, want ErrInvalid", err)
+	}
+	if _, err := (&Message{From: &mail.Address{Address: "alice@example.com"}, Draft: true}).Build(); err != nil {
+		t.Errorf("Build() of a draft without recipients error = %v", err)
+	}
+}
+
+func TestReply(t *testing.T) {
+	tests := []struct {
+		name                      string
+		id, references, inReplyTo string
+		wantInReplyTo             string
+		wantReferences            string
+	}{
+		{"first reply", "<b@example.com>", "", "", "<b@example.com>", "<b@example.com>"},
+		{"reply to a reply", "<c@example.com>", "<a@example.com> <b@example.com>", "<b@example.com>", "<c@example.com>", "<a@example.com> <b@example.com> <c@example.com>"},
+		{"parent without references", "<c@example.com>", "", "<b@example.com>", "<c@example.com>", "<b@example.com> <c@example.com>"},
+		{"parent without message id", "", "<a@example.com>", "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inReplyTo, refs := Reply(tt.id, tt.references, tt.inReplyTo)
+			if inReplyTo != tt.wantInReplyTo || strings.Join(refs, " ") != tt.wantReferences {
+				t.Errorf("Reply() = %q, %q, want %q, %q", inReplyTo, refs, tt.wantInReplyTo, tt.wantReferences)
+			}
+		})
+	}
+
+	m := &Message{From: &mail.Address{Address: "alice@example.com"}, To: addrs("bob@example.com"), InReplyTo: "not an id"}
+	if _, err := m.Build(); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Build() with invalid In-Reply-To error = %v, want ErrInvalid", err)
+	}
+}
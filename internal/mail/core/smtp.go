@@ -5,6 +5,7 @@ import (
 	service "YoPost/services"
 	"log"
 	"net/smtp"
+	"sync/atomic"
 )
 
 // MailServerConfig holds SMTP server configuration
@@ -14,30 +15,41 @@ type MailServerConfig struct {
 	NoTLSPort string
 }
 
-var mailServerConfig *MailServerConfig
+// Relay 通过上游中继服务器发送邮件，配置可在运行中替换
+type Relay struct {
+	config atomic.Pointer[MailServerConfig]
+}
 
-// InitMailServer loads configuration from mailserver.yml
-func InitMailServer() error {
-	cfg, err := config.LoadMailServerConfig()
-	if err != nil {
-		return err
-	}
+// NewRelay 根据统一配置的 relay 段创建中继
+func NewRelay(cfg config.RelayConfig) *Relay {
+	r := &Relay{}
+	r.SetConfig(cfg)
+	return r
+}
 
-	mailServerConfig = &MailServerConfig{
-		Host:      cfg.Mailserver.Host,
-		TLSPort:   cfg.Mailserver.Smtp.TlsPort,
-		NoTLSPort: cfg.Mailserver.Smtp.NotlsPort,
-	}
+// SetConfig 替换中继配置，进行中的发送继续使用旧配置
+func (r *Relay) SetConfig(cfg config.RelayConfig) {
+	r.config.Store(&MailServerConfig{
+		Host:      cfg.Host,
+		TLSPort:   cfg.TLSPort,
+		NoTLSPort: cfg.NoTLSPort,
+	})
+}
 
-	return nil
+// Config 返回当前中继配置
+func (r *Relay) Config() *MailServerConfig {
+	return r.config.Load()
 }
 
-// GetMailServerConfig returns the initialized mail server configuration
-func GetMailServerConfig() *MailServerConfig {
-	return mailServerConfig
+// PrepareReload 实现 config.Reloadable
+func (r *Relay) PrepareReload(cfg *config.Config) (func(), error) {
+	return func() { r.SetConfig(cfg.Relay) }, nil
 }
 
-func TLSstatus(from string, to []string, msg []byte, username, password string) error {
+// Send 检查中继是否支持TLS，并选择对应方式发送
+func (r *Relay) Send(from string, to []string, msg []byte, username, password string) error {
+	mailServerConfig := r.Config()
+
 	// 检查TLS是否可用
 	log.Printf("INFO: Performing fresh TLS check for %s:%s", mailServerConfig.Host, mailServerConfig.TLSPort)
 
@@ -47,14 +59,14 @@ func TLSstatus(from string, to []string, msg []byte, username, password string)
 	if tlsEnabled {
 		// 使用TLS方式发送
 		log.Printf("INFO: TLS available, attempting secure mail sending to %s:%s", mailServerConfig.Host, mailServerConfig.TLSPort)
-		return SendMailWithTLS(from, to, msg, username, password)
+		return r.SendWithTLS(from, to, msg, username, password)
 	}
 	// 使用非TLS方式发送
 	log.Printf("INFO: TLS not available, attempting unsecured mail sending to %s:%s", mailServerConfig.Host, mailServerConfig.NoTLSPort)
-	return SendMailWithNoTLS(from, to, msg, username, password)
+	return r.SendWithNoTLS(from, to, msg, username, password)
 }
 
-// SendMailwithTLS 发送使用TLS加密的邮件
+// SendWithTLS 发送使用TLS加密的邮件
 // from: 发件人邮箱地址
 // to: 收件人邮箱地址列表
 // msg: 邮件内容
@@ -62,8 +74,8 @@ func TLSstatus(from string, to []string, msg []byte, username, password string)
 // port: SMTP服务器端口
 // username: 认证用户名
 // password: 认证密码
-func SendMailWithTLS(from string, to []string, msg []byte, username, password string) error {
-	// 使用全局配置
+func (r *Relay) SendWithTLS(from string, to []string, msg []byte, username, password string) error {
+	mailServerConfig := r.Config()
 	host := mailServerConfig.Host
 	port := mailServerConfig.TLSPort
 
@@ -99,7 +111,7 @@ func SendMailWithTLS(from string, to []string, msg []byte, username, password st
 	return nil
 }
 
-// SendMailWithNoTLS 发送不使用TLS的邮件
+// SendWithNoTLS 发送不使用TLS的邮件
 // from: 发件人邮箱地址
 // to: 收件人邮箱地址列表
 // msg: 邮件内容
@@ -107,8 +119,8 @@ func SendMailWithTLS(from string, to []string, msg []byte, username, password st
 // port: SMTP服务器端口
 // username: 认证用户名
 // password: 认证密码
-func SendMailWithNoTLS(from string, to []string, msg []byte, username, password string) error {
-	// 使用全局配置
+func (r *Relay) SendWithNoTLS(from string, to []string, msg []byte, username, password string) error {
+	mailServerConfig := r.Config()
 	host := mailServerConfig.Host
 	port := mailServerConfig.NoTLSPort
 
@@ -0,0 +1,549 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"YoPost/internal/mail/inbound"
+	"YoPost/internal/mail/queue"
+	"YoPost/internal/mail/smtpd"
+	"YoPost/internal/mail/store"
+	"YoPost/internal/quota"
+	"YoPost/internal/ratelimit"
+	"YoPost/internal/spam"
+	"YoPost/internal/suppression"
+)
+
+// Directory 本地邮箱目录
+type Directory interface {
+	// UserExists 判断地址是否为本地邮箱
+	UserExists(ctx context.Context, address string) (bool, error)
+}
+
+// DirectoryFunc 将函数适配为 Directory
+type DirectoryFunc func(ctx context.Context, address string) (bool, error)
+
+func (f DirectoryFunc) UserExists(ctx context.Context, address string) (bool, error) {
+	return f(ctx, address)
+}
+
+// Local 将入站邮件投递到本地邮箱的 smtpd.Backend
+type Local struct {
+	store     store.Store
+	quota     *quota.Manager
+	directory Directory
+	routing   atomic.Pointer[routing]
+	// outbound 已认证用户发往外部地址的邮件进入此队列，为空时拒绝中继
+	outbound queue.Queue
+	// router 匹配的收件人不存入邮箱，经出站队列推送到 HTTP 端点
+	router      *inbound.Router
+	received    ReceivedFunc
+	routeFailed RouteFailedFunc
+	// suppression 已认证用户发往抑制列表中地址的收件人被拒绝，为空时不检查
+	suppression *suppression.Manager
+	// limiter 已认证用户提交的邮件计入每小时的提交限制，为空时不限制
+	limiter *ratelimit.Limiter
+	// spam 未认证会话投递到本地邮箱的邮件经过垃圾邮件评分，为空时不检查
+	spam *spam.Filter
+}
+
+// ReceivedFunc 邮件存入本地收件人的 INBOX (垃圾邮件为 Junk) 后调用，from 为信封发件人
+type ReceivedFunc func(ctx context.Context, msg *store.Message, from string)
+
+// RouteFailedFunc 入站路由重试用尽、邮件转存到 stored 后调用，cause 为最后一次推送的错误
+type RouteFailedFunc func(ctx context.Context, route *inbound.Route, from, rcpt string, stored *store.Message, cause error)
+
+// routing 本地域名与别名表，热加载时整体替换
+type routing struct {
+	domains map[string]bool
+	aliases map[string]string
+}
+
+// NewLocal 创建本地投递后端
+// st 应为经过 quota.NewStore 包装的存储，以便投递时计入用量
+func NewLocal(st store.Store, q *quota.Manager, dir Directory) *Local {
+	l := &Local{store: st, quota: q, directory: dir}
+	l.SetRouting(nil, nil)
+	return l
+}
+
+// SetRouting 设置本地域名和别名，domains 为空时接受任意域名
+func (l *Local) SetRouting(domains []string, aliases map[string]string) {
+	r := &routing{domains: make(map[string]bool), aliases: make(map[string]string)}
+	for _, d := range domains {
+		r.domains[strings.ToLower(d)] = true
+	}
+	for alias, target := range aliases {
+		r.aliases[Normalize(alias)] = Normalize(target)
+	}
+	l.routing.Store(r)
+}
+
+// SetOutbound 设置出站队列，启用已认证用户 (SMTP AUTH) 的邮件提交
+func (l *Local) SetOutbound(q queue.Queue) {
+	l.outbound = q
+}
+
+// OnReceived 设置本地投递成功后的回调，用于 Webhook 等通知
+func (l *Local) OnReceived(fn ReceivedFunc) {
+	l.received = fn
+}
+
+// SetRouter 设置入站路由，匹配的收件人不存入邮箱而是推送到 HTTP 端点，需要出站队列
+func (l *Local) SetRouter(r *inbound.Router) {
+	l.router = r
+}
+
+// Router 返回入站路由，未设置时为 nil
+func (l *Local) Router() *inbound.Router {
+	return l.router
+}
+
+// SetSuppression 设置抑制列表，已认证用户提交的邮件逐个检查收件人
+func (l *Local) SetSuppression(m *suppression.Manager) {
+	l.suppression = m
+}
+
+// SetLimiter 设置提交限速，已认证用户的每封邮件在投递或排队前计入限制。
+// 经 Enqueue 放入队列的批量邮件不计入，由批次自身的域名限速控制
+func (l *Local) SetLimiter(r *ratelimit.Limiter) {
+	l.limiter = r
+}
+
+// SetSpamFilter 设置垃圾邮件评分，未认证会话投递到本地邮箱的邮件添加 X-Spam-* 头部，
+// 达到 spam.tag_score 的存入 Junk，达到 spam.reject_score 的整封拒绝
+func (l *Local) SetSpamFilter(f *spam.Filter) {
+	l.spam = f
+}
+
+// limit 将 user 提交的一封有 recipients 个收件人的邮件计入限制，超出时返回 451 4.7.0；
+// 收件人数超过每小时上限本身时返回 552 5.5.3，重试也不会成功
+func (l *Local) limit(ctx context.Context, user string, recipients int) error {
+	if l.limiter == nil {
+		return nil
+	}
+	if err := l.limiter.Submit(ctx, user, recipients); err != nil {
+		log.Printf("INFO: Rejecting message from %s - %v", user, err)
+		var le *ratelimit.LimitError
+		if errors.As(err, &le) && le.Permanent() {
+			return &smtpd.Error{Code: 552, Enhanced: "5.5.3", Message: "Too many recipients for the hourly limit", Err: err}
+		}
+		return &smtpd.Error{Code: 451, Enhanced: "4.7.0", Message: "Rate limit exceeded, try again later", Err: err}
+	}
+	return nil
+}
+
+// OnRouteFailed 设置入站路由转存后的回调
+func (l *Local) OnRouteFailed(fn RouteFailedFunc) {
+	l.routeFailed = fn
+}
+
+// route 返回收件人匹配的入站路由
+func (l *Local) route(address string) *inbound.Route {
+	if l.router == nil {
+		return nil
+	}
+	return l.router.Match(address)
+}
+
+// resolve 展开别名并检查域名是否为本地域名
+func (l *Local) resolve(address string) (string, bool) {
+	r := l.routing.Load()
+	owner := Normalize(address)
+	if target, ok := r.aliases[owner]; ok {
+		owner = target
+	}
+	if len(r.domains) == 0 {
+		return owner, true
+	}
+	return owner, r.domains[owner[strings.LastIndex(owner, "@")+1:]]
+}
+
+// Normalize 规范化邮箱地址作为存储的 owner
+func Normalize(address string) string {
+	return strings.ToLower(strings.TrimSpace(address))
+}
+
+// quotaError 将配额错误转换为 SMTP 响应
+func quotaError(err error) error {
+	var qe *quota.ExceededError
+	if !errors.As(err, &qe) {
+		return err
+	}
+	if qe.Permanent {
+		return &smtpd.Error{Code: 552, Enhanced: "5.2.2", Message: "Message exceeds storage allocation"}
+	}
+	return &smtpd.Error{Code: 452, Enhanced: "4.2.2", Message: "Mailbox full, try again later"}
+}
+
+// Owns 判断 address 是否为 user 本人的地址或指向 user 的别名
+func (l *Local) Owns(user, address string) bool {
+	owner, _ := l.resolve(address)
+	return owner == Normalize(user)
+}
+
+// RecipientError 提交邮件时被拒绝的收件人
+type RecipientError struct {
+	Recipient string
+	Err       error
+}
+
+func (e *RecipientError) Error() string {
+	return fmt.Sprintf("recipient %s rejected: %v", e.Recipient, e.Err)
+}
+
+func (e *RecipientError) Unwrap() error {
+	return e.Err
+}
+
+// Submit 以已认证用户 user 的身份提交邮件，与 SMTP AUTH 会话的规则相同：
+// 逐个校验收件人后，本地收件人直接投递，外部收件人进入出站队列
+func (l *Local) Submit(ctx context.Context, user, from string, to []string, raw []byte) error {
+	ctx = smtpd.WithUser(ctx, user)
+	if err := l.checkRecipients(ctx, from, to, int64(len(raw))); err != nil {
+		return err
+	}
+	return l.Deliver(ctx, &smtpd.Envelope{From: from, To: to, Data: raw, User: user})
+}
+
+// Schedule 按 Submit 的规则校验收件人后，将邮件连同本地收件人一起放入出站队列，
+// 计入提交限制，在 at 之前不投递，期间可以撤销。sentID 为提交者 Sent 邮箱中副本的 ID，可为空
+func (l *Local) Schedule(ctx context.Context, user, from string, to []string, raw []byte, at time.Time, sentID string) (*queue.Item, error) {
+	item := &queue.Item{From: from, To: to, Raw: raw, SendAt: at, SentID: sentID}
+	if l.outbound == nil {
+		return nil, errors.New("delivery: no outbound queue")
+	}
+	if err := l.checkRecipients(smtpd.WithUser(ctx, user), from, to, int64(len(raw))); err != nil {
+		return nil, err
+	}
+	if err := l.limit(ctx, user, len(to)); err != nil {
+		return nil, err
+	}
+	if err := l.enqueue(ctx, user, item); err != nil {
+		return nil, err
+	}
+	log.Printf("INFO: Scheduled message %s from %s for %s", item.ID, item.Owner, at.Format(time.RFC3339))
+	return item, nil
+}
+
+// Enqueue 按 Submit 的规则校验 item 的收件人后，将整封邮件连同本地收件人放入出站队列，
+// 每次投递尝试的结果都经过队列的 Notifier；item.Owner 设为 user
+func (l *Local) Enqueue(ctx context.Context, user string, item *queue.Item) error {
+	if l.outbound == nil {
+		return errors.New("delivery: no outbound queue")
+	}
+	ctx = smtpd.WithUser(ctx, user)
+	if err := l.checkRecipients(ctx, item.From, item.To, int64(len(item.Raw))); err != nil {
+		return err
+	}
+	return l.enqueue(ctx, user, item)
+}
+
+// enqueue 将已校验收件人的 item 放入出站队列
+func (l *Local) enqueue(ctx context.Context, user string, item *queue.Item) error {
+	item.Owner = Normalize(user)
+	if err := l.outbound.Enqueue(ctx, item); err != nil {
+		log.Printf("ERROR: Failed to queue message from %s - %v", user, err)
+		return err
+	}
+	return nil
+}
+
+func (l *Local) checkRecipients(ctx context.Context, from string, to []string, size int64) error {
+	for _, rcpt := range to {
+		if err := l.Rcpt(ctx, from, rcpt, size); err != nil {
+			return &RecipientError{Recipient: rcpt, Err: err}
+		}
+	}
+	return nil
+}
+
+// QueueSender 返回出站队列使用的 Sender：入站路由的收件人推送到 HTTP 端点，
+// 定时邮件中的本地收件人直接投递，其余收件人交给 remote。
+// 失败的路由和本地收件人保留在 item.To 中等待重试
+func (l *Local) QueueSender(remote queue.Sender) queue.Sender {
+	return queue.SenderFunc(func(ctx context.Context, item *queue.Item) error {
+		var pending, remotes []string
+		var firstErr error
+		for _, rcpt := range item.To {
+			if rt := l.route(rcpt); rt != nil {
+				if err := l.post(ctx, rt, item, rcpt); err != nil {
+					pending = append(pending, rcpt)
+					if firstErr == nil {
+						firstErr = err
+					}
+				}
+				continue
+			}
+			if _, local := l.resolve(rcpt); !local {
+				remotes = append(remotes, rcpt)
+				continue
+			}
+			if _, err := l.deliverLocal(ctx, item.From, rcpt, store.Inbox, item.Raw); err != nil {
+				pending = append(pending, rcpt)
+				if firstErr == nil {
+					firstErr = err
+				}
+			}
+		}
+		item.To = append(pending, remotes...)
+		if firstErr != nil {
+			return firstErr
+		}
+		if len(remotes) == 0 {
+			return nil
+		}
+		return remote.Send(ctx, item)
+	})
+}
+
+// post 推送一个路由收件人，重试次数用尽后转存，转存成功视为投递完成
+func (l *Local) post(ctx context.Context, rt *inbound.Route, item *queue.Item, rcpt string) error {
+	err := l.router.Post(ctx, rt, item.From, rcpt, item.Raw)
+	if err == nil {
+		return nil
+	}
+	if item.Attempts < rt.Retries {
+		return err
+	}
+	log.Printf("WARNING: Giving up posting message %s for %s to %s after %d attempts - %v", item.ID, rcpt, rt.URL, item.Attempts+1, err)
+	if ferr := l.fallback(ctx, rt, item.From, rcpt, item.Raw, err); ferr != nil {
+		log.Printf("ERROR: Failed to store message %s for %s in fallback mailbox - %v", item.ID, rcpt, ferr)
+		return err
+	}
+	return nil
+}
+
+// fallback 将路由推送失败的邮件存入 fallback 邮箱 (默认为收件人本身) 并通知
+func (l *Local) fallback(ctx context.Context, rt *inbound.Route, from, rcpt string, data []byte, cause error) error {
+	target := rt.Fallback
+	if target == "" {
+		target = rcpt
+	}
+	owner, local := l.resolve(target)
+	if !local {
+		return fmt.Errorf("fallback %s is not a local address", target)
+	}
+	ok, err := l.directory.UserExists(ctx, owner)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("fallback mailbox %s does not exist", owner)
+	}
+	msg, err := l.deliverLocal(ctx, from, target, store.Inbox, data)
+	if err != nil {
+		return err
+	}
+	if l.routeFailed != nil {
+		l.routeFailed(ctx, rt, from, rcpt, msg, cause)
+	}
+	return nil
+}
+
+func (l *Local) Rcpt(ctx context.Context, from, to string, size int64) error {
+	user := smtpd.User(ctx)
+	if user != "" {
+		// 已认证用户只能使用自己的地址 (或指向自己的别名) 作为发件人
+		if !l.Owns(user, from) {
+			return &smtpd.Error{Code: 553, Enhanced: "5.7.1", Message: "Sender address not owned by authenticated user"}
+		}
+		if l.suppression != nil {
+			e, err := l.suppression.Suppressed(ctx, user, to)
+			if err != nil {
+				return err
+			}
+			if e != nil {
+				log.Printf("INFO: Rejecting suppressed recipient %s for %s (%s)", to, user, e.Reason)
+				return &smtpd.Error{Code: 550, Enhanced: "5.7.1", Message: "Recipient address is on the suppression list"}
+			}
+		}
+	}
+	if l.route(to) != nil {
+		if l.outbound == nil {
+			return &smtpd.Error{Code: 451, Enhanced: "4.3.0", Message: "Requested action aborted: local error in processing"}
+		}
+		return nil
+	}
+	owner, local := l.resolve(to)
+	if !local {
+		if user != "" && l.outbound != nil {
+			return nil
+		}
+		return &smtpd.Error{Code: 550, Enhanced: "5.7.1", Message: "Relaying denied"}
+	}
+	ok, err := l.directory.UserExists(ctx, owner)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return &smtpd.Error{Code: 550, Enhanced: "5.1.1", Message: "No such user here"}
+	}
+
+	if l.quota != nil {
+		if err := l.quota.Check(ctx, owner, size); err != nil {
+			log.Printf("INFO: Rejecting recipient %s - %v", owner, err)
+			return quotaError(err)
+		}
+	}
+	return nil
+}
+
+func (l *Local) Deliver(ctx context.Context, env *smtpd.Envelope) error {
+	size := int64(len(env.Data))
+
+	// 外部收件人只会出现在已认证的会话中 (见 Rcpt)
+	var routed, locals, remotes []string
+	for _, rcpt := range env.To {
+		if l.route(rcpt) != nil {
+			routed = append(routed, rcpt)
+		} else if _, local := l.resolve(rcpt); local {
+			locals = append(locals, rcpt)
+		} else {
+			remotes = append(remotes, rcpt)
+		}
+	}
+
+	// 先检查全部收件人，避免部分投递后整封邮件被发件方重试
+	if l.quota != nil {
+		for _, rcpt := range locals {
+			owner, _ := l.resolve(rcpt)
+			if err := l.quota.Check(ctx, owner, size); err != nil {
+				log.Printf("INFO: Rejecting message for %s - %v", rcpt, err)
+				return quotaError(err)
+			}
+		}
+	}
+
+	if env.User != "" {
+		if err := l.limit(ctx, env.User, len(env.To)); err != nil {
+			return err
+		}
+	}
+
+	var analysis *spam.Analysis
+	if l.spam != nil && l.spam.Enabled() && env.User == "" && len(locals) > 0 {
+		analysis = l.spam.Analyze(ctx, env)
+		if err := analysis.Reject(); err != nil {
+			return err
+		}
+	}
+
+	if len(remotes) > 0 && (env.User == "" || l.outbound == nil) {
+		return &smtpd.Error{Code: 550, Enhanced: "5.7.1", Message: "Relaying denied"}
+	}
+	// 路由收件人由出站队列推送，推送失败时按队列的退避时间重试
+	if len(routed) > 0 && l.outbound == nil {
+		return &smtpd.Error{Code: 451, Enhanced: "4.3.0", Message: "Requested action aborted: local error in processing"}
+	}
+
+	// 先将外部和路由收件人放入出站队列：失败时尚未投递任何本地收件人，发件方重试不会产生重复邮件
+	queued := append(remotes, routed...)
+	if len(queued) > 0 {
+		item := &queue.Item{Owner: Normalize(env.User), From: env.From, To: queued, Raw: env.Data}
+		if err := l.outbound.Enqueue(ctx, item); err != nil {
+			log.Printf("ERROR: Failed to queue message from %s - %v", env.From, err)
+			return err
+		}
+		log.Printf("INFO: Queued message %s from %s for %v", item.ID, env.From, queued)
+	}
+
+	// 再投递本地收件人：没有任何收件人被接收时拒绝整封邮件；否则失败的收件人单独放入出站队列，
+	// 由 QueueSender 重试投递到 INBOX。放入队列也失败时只能返回错误，发件方重试会使已接收的收件人收到重复邮件
+	var failed []string
+	var localErr error
+	for _, rcpt := range locals {
+		if err := l.deliverRecipient(ctx, env, analysis, rcpt); err != nil {
+			failed = append(failed, rcpt)
+			if localErr == nil {
+				localErr = err
+			}
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	if (len(failed) == len(locals) && len(queued) == 0) || l.outbound == nil {
+		return localErr
+	}
+	retry := &queue.Item{Owner: Normalize(env.User), From: env.From, To: failed, Raw: env.Data}
+	if err := l.outbound.Enqueue(ctx, retry); err != nil {
+		log.Printf("ERROR: Failed to queue message from %s for retrying local recipients %v - %v", env.From, failed, err)
+		return localErr
+	}
+	log.Printf("WARNING: Queued message %s for retrying local recipients %v - %v", retry.ID, failed, localErr)
+	return nil
+}
+
+// deliverRecipient 将 Deliver 的邮件存入本地收件人 rcpt 的邮箱，analysis 非空时按收件人评分
+func (l *Local) deliverRecipient(ctx context.Context, env *smtpd.Envelope, analysis *spam.Analysis, rcpt string) error {
+	if analysis == nil {
+		_, err := l.deliverLocal(ctx, env.From, rcpt, store.Inbox, env.Data)
+		return err
+	}
+	// 贝叶斯得分按收件人计算，每个收件人的头部和邮箱可能不同
+	owner, _ := l.resolve(rcpt)
+	res := analysis.Check(ctx, owner)
+	mailbox := store.Inbox
+	if res.Junk {
+		mailbox = store.Junk
+	}
+	msg, err := l.deliverLocal(ctx, env.From, rcpt, mailbox, append([]byte(res.Headers()), spam.StripHeaders(env.Data)...))
+	if err != nil {
+		return err
+	}
+	analysis.AutoLearn(ctx, owner, msg.ID, res)
+	return nil
+}
+
+// deliverLocal 将邮件存入本地收件人的 mailbox
+func (l *Local) deliverLocal(ctx context.Context, from, rcpt, mailbox string, data []byte) (*store.Message, error) {
+	owner, _ := l.resolve(rcpt)
+	msg := &store.Message{
+		Owner:   owner,
+		Mailbox: mailbox,
+		Raw:     append([]byte("Return-Path: <"+from+">\r\n"), data...),
+	}
+	if err := l.store.Append(ctx, msg); err != nil {
+		log.Printf("ERROR: Failed to deliver message to %s - %v", rcpt, err)
+		return nil, quotaError(err)
+	}
+	log.Printf("INFO: Delivered message %s to %s", msg.ID, msg.Owner)
+	if l.received != nil {
+		l.received(ctx, msg, from)
+	}
+	return msg, nil
+}
+
+// QuotaWarning 返回将配额告警邮件投递到用户收件箱的 quota.Notifier
+// st 应为未经过配额包装的存储，告警邮件不受配额限制；启用静态加密时 st 须包含加密层，
+// 否则告警邮件会以明文落库
+func QuotaWarning(st store.Store) quota.Notifier {
+	return func(ctx context.Context, owner string, status quota.Status, threshold int) {
+		domain := owner[strings.LastIndex(owner, "@")+1:]
+		body := fmt.Sprintf("Your mailbox %s has reached %d%% of its quota.\r\n\r\n"+
+			"Storage: %d / %d bytes\r\nMessages: %d / %d\r\n\r\n"+
+			"Please delete unneeded messages to avoid rejected mail.\r\n",
+			owner, status.Percent(),
+			status.Usage.Bytes, status.Limits.Bytes,
+			status.Usage.Messages, status.Limits.Messages)
+
+		raw := "From: Mail Delivery System <postmaster@" + domain + ">\r\n" +
+			"To: " + owner + "\r\n" +
+			"Subject: Mailbox quota warning: " + fmt.Sprint(threshold) + "% used\r\n" +
+			"Date: " + time.Now().Format(time.RFC1123Z) + "\r\n" +
+			"Content-Type: text/plain; charset=utf-8\r\n" +
+			"Auto-Submitted: auto-generated\r\n" +
+			"\r\n" + body
+
+		msg := &store.Message{Owner: owner, Mailbox: store.Inbox, Raw: []byte(raw)}
+		if err := st.Append(ctx, msg); err != nil {
+			log.Printf("ERROR: Failed to deliver quota warning to %s - %v", owner, err)
+		}
+	}
+}
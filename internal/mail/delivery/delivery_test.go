@@ -0,0 +1,138 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"YoPost/internal/config"
+	"YoPost/internal/mail/queue"
+	"YoPost/internal/mail/smtpd"
+	"YoPost/internal/mail/store"
+	"YoPost/internal/spam"
+)
+
+var errInjected = errors.New("injected failure")
+
+// failingStore Append 到 owners 中的用户时失败
+type failingStore struct {
+	store.Store
+	owners []string
+}
+
+func (s *failingStore) Append(ctx context.Context, msg *store.Message) error {
+	if slices.Contains(s.owners, msg.Owner) {
+		return errInjected
+	}
+	return s.Store.Append(ctx, msg)
+}
+
+// failingQueue Enqueue 的收件人包含 rcpt 时失败
+type failingQueue struct {
+	queue.Queue
+	rcpt string
+}
+
+func (q *failingQueue) Enqueue(ctx context.Context, item *queue.Item) error {
+	if q.rcpt != "" && slices.Contains(item.To, q.rcpt) {
+		return errInjected
+	}
+	return q.Queue.Enqueue(ctx, item)
+}
+
+func TestDeliverPartialFailure(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name       string
+		to         []string
+		storeFails []string
+		queueFails string
+		err        bool
+		delivered  []string
+		queued     []string
+	}{
+		{"all accepted", []string{"alice@example.com", "bob@remote.example"}, nil, "", false,
+			[]string{"alice@example.com"}, []string{"bob@remote.example"}},
+		{"enqueue fails before local delivery", []string{"alice@example.com", "bob@remote.example"}, nil, "bob@remote.example", true,
+			nil, nil},
+		{"one local fails", []string{"alice@example.com", "carol@example.com"}, []string{"carol@example.com"}, "", false,
+			[]string{"alice@example.com"}, []string{"carol@example.com"}},
+		{"all locals fail", []string{"alice@example.com", "carol@example.com"}, []string{"alice@example.com", "carol@example.com"}, "", true,
+			nil, nil},
+		{"all locals fail after remote queued", []string{"alice@example.com", "bob@remote.example"}, []string{"alice@example.com"}, "", false,
+			nil, []string{"alice@example.com", "bob@remote.example"}},
+		{"retry enqueue fails", []string{"alice@example.com", "carol@example.com"}, []string{"carol@example.com"}, "carol@example.com", true,
+			[]string{"alice@example.com"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := store.NewMemoryStore()
+			q := queue.NewMemoryQueue()
+			l := NewLocal(&failingStore{Store: base, owners: tt.storeFails}, nil, DirectoryFunc(func(ctx context.Context, address string) (bool, error) {
+				return true, nil
+			}))
+			l.SetRouting([]string{"example.com"}, nil)
+			l.SetOutbound(&failingQueue{Queue: q, rcpt: tt.queueFails})
+
+			err := l.Deliver(ctx, &smtpd.Envelope{From: "sender@example.com", User: "sender@example.com", To: tt.to, Data: []byte("Subject: hi\r\n\r\nhello\r\n")})
+			if (err != nil) != tt.err {
+				t.Fatalf("Deliver() error = %v, want error %v", err, tt.err)
+			}
+			owners, err := base.Owners(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			slices.Sort(owners)
+			if !slices.Equal(owners, tt.delivered) {
+				t.Errorf("delivered to %v, want %v", owners, tt.delivered)
+			}
+			items, err := q.List(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var queued []string
+			for _, item := range items {
+				queued = append(queued, item.To...)
+			}
+			slices.Sort(queued)
+			if !slices.Equal(queued, tt.queued) {
+				t.Errorf("queued %v, want %v", queued, tt.queued)
+			}
+		})
+	}
+}
+
+// TestDeliverForgedSpamHeaders 发件方伪造的 X-Spam-* 和 Authentication-Results 头部不影响评分结果
+func TestDeliverForgedSpamHeaders(t *testing.T) {
+	ctx := context.Background()
+	f, err := spam.NewFilter(config.SpamConfig{Enabled: true, TagScore: 5, TrustedAuthservIDs: []string{"mx.example.com"}}, spam.NewMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := store.NewMemoryStore()
+	l := NewLocal(st, nil, DirectoryFunc(func(ctx context.Context, address string) (bool, error) { return true, nil }))
+	l.SetRouting([]string{"example.com"}, nil)
+	l.SetSpamFilter(f)
+
+	data := "Authentication-Results: mx.example.com; spf=fail smtp.mailfrom=bank.example; dmarc=fail\r\n" +
+		"X-Spam-Status: No, score=-10.0 required=5.0 tests=none\r\n" +
+		"Authentication-Results: mx.example.com; spf=pass smtp.mailfrom=bank.example; dmarc=pass\r\n" +
+		"From: Bank <alerts@bank.example>\r\nTo: alice@example.com\r\nSubject: Account notice\r\n" +
+		"Date: Mon, 19 Oct 2026 08:00:00 +0000\r\nMessage-ID: <1@bank.example>\r\n\r\nPlease verify your account.\r\n"
+	if err := l.Deliver(ctx, &smtpd.Envelope{From: "alerts@bank.example", To: []string{"alice@example.com"}, Data: []byte(data)}); err != nil {
+		t.Fatal(err)
+	}
+	msgs, err := st.List(ctx, "alice@example.com", store.Inbox)
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("List() = %d messages, %v, want 1", len(msgs), err)
+	}
+	raw := string(msgs[0].Raw)
+	if n := strings.Count(raw, "X-Spam-Status:"); n != 1 {
+		t.Errorf("message has %d X-Spam-Status headers, want 1:\n%s", n, raw)
+	}
+	if !strings.Contains(raw, "tests=DMARC_FAIL,SPF_FAIL") {
+		t.Errorf("message scored without the topmost trusted Authentication-Results:\n%s", raw)
+	}
+}
@@ -0,0 +1,339 @@
+// Package dnsbl 查询 DNS 黑名单和白名单：客户端 IP 按反向格式 (IPv4 按字节、IPv6 按半字节) 查询 DNSBL/DNSWL，
+// HELO 和发件人域名查询 URIBL。各列表的命中按权重相加，查询结果在进程内缓存
+package dnsbl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"YoPost/internal/config"
+)
+
+// Resolver 执行 DNS A 记录查询，*net.Resolver 满足该接口
+type Resolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// StaticResolver 按固定表应答的 Resolver，用于离线测试和开发环境；表中没有的名称返回 NXDOMAIN
+type StaticResolver map[string][]string
+
+func (r StaticResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if addrs, ok := r[strings.TrimSuffix(strings.ToLower(host), ".")]; ok {
+		return addrs, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+// Hit 一个列表的命中
+type Hit struct {
+	Zone string `json:"zone"`
+	// Query 被查询的 IP 或域名
+	Query  string   `json:"query"`
+	Codes  []string `json:"codes"`
+	Weight float64  `json:"weight"`
+}
+
+func (h Hit) String() string {
+	return fmt.Sprintf("%s:%s=%s", h.Zone, h.Query, strings.Join(h.Codes, ","))
+}
+
+// Result 查询结果，Score 为命中列表的权重之和，每个列表只计一次
+type Result struct {
+	Score float64 `json:"score"`
+	Hits  []Hit   `json:"hits"`
+}
+
+// Merge 合并 o 中 r 尚未命中的列表
+func (r *Result) Merge(o *Result) {
+	if o == nil {
+		return
+	}
+	for _, h := range o.Hits {
+		if !r.hit(h.Zone) {
+			r.Hits = append(r.Hits, h)
+			r.Score += h.Weight
+		}
+	}
+}
+
+func (r *Result) hit(zone string) bool {
+	for _, h := range r.Hits {
+		if h.Zone == zone {
+			return true
+		}
+	}
+	return false
+}
+
+// Action 按总分对客户端的处理
+type Action int
+
+const (
+	// Accept 不做处理
+	Accept Action = iota
+	// Tag 添加 X-YoPost-DNSBL 头部
+	Tag
+	// Reject 拒绝收件人
+	Reject
+)
+
+func (a Action) String() string {
+	switch a {
+	case Tag:
+		return "tag"
+	case Reject:
+		return "reject"
+	}
+	return "accept"
+}
+
+// settings 解析后的配置，热加载时整体替换
+type settings struct {
+	config.DNSBLConfig
+	resolver Resolver
+}
+
+// entry 缓存的查询结果，addrs 为空表示未列出
+type entry struct {
+	addrs   []string
+	expires time.Time
+}
+
+// Checker 查询配置的列表，注册到 config.Holder 后支持热加载
+type Checker struct {
+	// Resolver 非空时替代 nameserver 配置，用于测试
+	Resolver Resolver
+	// Logger 为空时使用 log 包的默认 Logger
+	Logger *log.Logger
+
+	settings atomic.Pointer[settings]
+	mu       sync.Mutex
+	cache    map[string]entry
+	pruned   time.Time
+}
+
+// New 创建 Checker
+func New(cfg config.DNSBLConfig) *Checker {
+	c := &Checker{cache: make(map[string]entry)}
+	c.settings.Store(newSettings(cfg))
+	return c
+}
+
+func newSettings(cfg config.DNSBLConfig) *settings {
+	s := &settings{DNSBLConfig: cfg, resolver: net.DefaultResolver}
+	if cfg.Nameserver != "" {
+		ns := cfg.Nameserver
+		s.resolver = &net.Resolver{PreferGo: true, Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, ns)
+		}}
+	}
+	return s
+}
+
+// PrepareReload 新的列表和阈值对之后的查询生效，缓存保留
+func (c *Checker) PrepareReload(cfg *config.Config) (func(), error) {
+	s := newSettings(cfg.Listeners.SMTP.DNSBL)
+	return func() { c.settings.Store(s) }, nil
+}
+
+func (c *Checker) logf(format string, args ...interface{}) {
+	if c.Logger != nil {
+		c.Logger.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+// Enabled 判断是否启用了列表查询
+func (c *Checker) Enabled() bool {
+	return c.settings.Load().Enabled
+}
+
+// Classify 按 reject_score 和 tag_score 返回对结果的处理
+func (c *Checker) Classify(r *Result) Action {
+	s := c.settings.Load()
+	switch {
+	case r == nil:
+		return Accept
+	case s.RejectScore > 0 && r.Score >= s.RejectScore:
+		return Reject
+	case s.TagScore > 0 && r.Score >= s.TagScore:
+		return Tag
+	}
+	return Accept
+}
+
+// ReverseIP 返回 IP 在 DNS 列表中的查询前缀：IPv4 为倒序的四个字节，IPv6 为倒序的 32 个半字节
+func ReverseIP(ip net.IP) string {
+	if v4 := ip.To4(); v4 != nil {
+		return fmt.Sprintf("%d.%d.%d.%d", v4[3], v4[2], v4[1], v4[0])
+	}
+	ip = ip.To16()
+	if ip == nil {
+		return ""
+	}
+	const hex = "0123456789abcdef"
+	b := make([]byte, 0, 64)
+	for i := len(ip) - 1; i >= 0; i-- {
+		b = append(b, hex[ip[i]&0xf], '.', hex[ip[i]>>4], '.')
+	}
+	return string(b[:len(b)-1])
+}
+
+// CheckIP 查询类型为 ip 的列表；回环和私有地址不查询
+func (c *Checker) CheckIP(ctx context.Context, ip net.IP) *Result {
+	s := c.settings.Load()
+	r := &Result{}
+	if !s.Enabled || ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() {
+		return r
+	}
+	c.check(ctx, s, "ip", []string{ip.String()}, r)
+	return r
+}
+
+// CheckDomains 查询类型为 domain 的列表，每个域名同时查询其最后两级 (如 mail.example.com 同时查询 example.com)
+func (c *Checker) CheckDomains(ctx context.Context, domains ...string) *Result {
+	s := c.settings.Load()
+	r := &Result{}
+	if !s.Enabled {
+		return r
+	}
+	var names []string
+	seen := make(map[string]bool)
+	for _, d := range domains {
+		d = strings.Trim(strings.ToLower(d), ".[]")
+		if d == "" || !strings.Contains(d, ".") || net.ParseIP(d) != nil {
+			continue
+		}
+		candidates := []string{d}
+		if labels := strings.Split(d, "."); len(labels) > 2 {
+			candidates = append(candidates, strings.Join(labels[len(labels)-2:], "."))
+		}
+		for _, n := range candidates {
+			if !seen[n] {
+				seen[n] = true
+				names = append(names, n)
+			}
+		}
+	}
+	c.check(ctx, s, "domain", names, r)
+	return r
+}
+
+// check 并发查询 queries 在类型为 typ 的每个列表中的记录，合并到 r
+func (c *Checker) check(ctx context.Context, s *settings, typ string, queries []string, r *Result) {
+	resolver := c.Resolver
+	if resolver == nil {
+		resolver = s.resolver
+	}
+	type lookup struct {
+		list  config.DNSBLList
+		query string
+		codes []string
+	}
+	var lookups []*lookup
+	for _, l := range s.Lists {
+		if l.Type != typ {
+			continue
+		}
+		for _, q := range queries {
+			lookups = append(lookups, &lookup{list: l, query: q})
+		}
+	}
+
+	timeout := time.Duration(s.Timeout) * time.Second
+	ttl := time.Duration(s.CacheTTL) * time.Second
+	var wg sync.WaitGroup
+	for _, lk := range lookups {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			prefix := lk.query
+			if typ == "ip" {
+				prefix = ReverseIP(net.ParseIP(lk.query))
+			}
+			addrs, err := c.lookup(ctx, resolver, prefix+"."+strings.TrimSuffix(lk.list.Zone, "."), timeout, ttl)
+			if err != nil {
+				c.logf("WARNING: DNS list %s lookup for %s failed - %v", lk.list.Zone, lk.query, err)
+				return
+			}
+			lk.codes = matching(addrs, lk.list.Codes)
+		}()
+	}
+	wg.Wait()
+
+	for _, lk := range lookups {
+		if len(lk.codes) > 0 {
+			r.Merge(&Result{Hits: []Hit{{Zone: lk.list.Zone, Query: lk.query, Codes: lk.codes, Weight: lk.list.Weight}}})
+		}
+	}
+	sort.Slice(r.Hits, func(i, j int) bool { return r.Hits[i].Zone < r.Hits[j].Zone })
+}
+
+// matching 返回计入命中的返回地址
+func matching(addrs, codes []string) []string {
+	var out []string
+	for _, a := range addrs {
+		ip := net.ParseIP(a).To4()
+		if ip == nil || ip[0] != 127 || (ip[1] == 255 && ip[2] == 255) {
+			continue
+		}
+		if len(codes) == 0 {
+			out = append(out, a)
+			continue
+		}
+		for _, code := range codes {
+			if net.ParseIP(code).Equal(ip) {
+				out = append(out, a)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// lookup 查询 name 的 A 记录，NXDOMAIN 视为未列出；成功的结果缓存 ttl
+func (c *Checker) lookup(ctx context.Context, resolver Resolver, name string, timeout, ttl time.Duration) ([]string, error) {
+	now := time.Now()
+	c.mu.Lock()
+	if e, ok := c.cache[name]; ok && now.Before(e.expires) {
+		c.mu.Unlock()
+		return e.addrs, nil
+	}
+	c.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	addrs, err := resolver.LookupHost(ctx, name)
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		addrs, err = nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if ttl > 0 {
+		c.mu.Lock()
+		if now.Sub(c.pruned) > time.Minute {
+			c.pruned = now
+			for k, e := range c.cache {
+				if now.After(e.expires) {
+					delete(c.cache, k)
+				}
+			}
+		}
+		c.cache[name] = entry{addrs: addrs, expires: now.Add(ttl)}
+		c.mu.Unlock()
+	}
+	return addrs, nil
+}
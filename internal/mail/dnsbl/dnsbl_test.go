@@ -0,0 +1,84 @@
+package dnsbl
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"YoPost/internal/config"
+)
+
+func TestReverseIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{"192.0.2.1", "1.2.0.192"},
+		{"127.0.0.2", "2.0.0.127"},
+		{"::ffff:198.51.100.7", "7.100.51.198"},
+		{"2001:db8::1", "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2"},
+		{"2001:DB8:1234:5678:9abc:def0:1:ff", "f.f.0.0.1.0.0.0.0.f.e.d.c.b.a.9.8.7.6.5.4.3.2.1.8.b.d.0.1.0.0.2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			if got := ReverseIP(net.ParseIP(tt.ip)); got != tt.want {
+				t.Errorf("ReverseIP(%s) = %s, want %s", tt.ip, got, tt.want)
+			}
+		})
+	}
+	if got := ReverseIP(nil); got != "" {
+		t.Errorf("ReverseIP(nil) = %q, want empty", got)
+	}
+}
+
+func TestCheckIP(t *testing.T) {
+	c := New(config.DNSBLConfig{
+		Enabled:     true,
+		Timeout:     1,
+		RejectScore: 5,
+		TagScore:    2,
+		Lists: []config.DNSBLList{
+			{Zone: "bl.example", Type: "ip", Weight: 5},
+			{Zone: "pbl.example", Type: "ip", Weight: 2, Codes: []string{"127.0.0.10"}},
+			{Zone: "wl.example", Type: "ip", Weight: -3},
+			{Zone: "uribl.example", Type: "domain", Weight: 5},
+		},
+	})
+	c.Resolver = StaticResolver{
+		"2.2.0.192.bl.example":  {"127.0.0.2"},
+		"3.2.0.192.pbl.example": {"127.0.0.11"},
+		"4.2.0.192.pbl.example": {"127.0.0.10"},
+		"5.2.0.192.bl.example":  {"127.0.0.2"},
+		"5.2.0.192.wl.example":  {"127.0.0.1"},
+		"6.2.0.192.bl.example":  {"127.255.255.254"},
+		"1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.bl.example": {"127.0.0.2"},
+		"10.1.168.192.bl.example": {"127.0.0.2"},
+	}
+
+	tests := []struct {
+		name   string
+		ip     string
+		score  float64
+		action Action
+	}{
+		{"not listed", "192.0.2.1", 0, Accept},
+		{"blocklisted", "192.0.2.2", 5, Reject},
+		{"code not configured", "192.0.2.3", 0, Accept},
+		{"matching code", "192.0.2.4", 2, Tag},
+		{"allowlist offsets blocklist", "192.0.2.5", 2, Tag},
+		{"query error code", "192.0.2.6", 0, Accept},
+		{"ipv6", "2001:db8::1", 5, Reject},
+		{"private address not queried", "192.168.1.10", 0, Accept},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := c.CheckIP(context.Background(), net.ParseIP(tt.ip))
+			if r.Score != tt.score {
+				t.Errorf("CheckIP(%s) score = %v (hits %v), want %v", tt.ip, r.Score, r.Hits, tt.score)
+			}
+			if got := c.Classify(r); got != tt.action {
+				t.Errorf("Classify() = %s, want %s", got, tt.action)
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package encrypt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"YoPost/internal/mail/store"
+)
+
+func testKeyring(t *testing.T, active string) *MasterKeyring {
+	t.Helper()
+	k, err := NewMasterKeyring(map[string][]byte{
+		"a": bytes.Repeat([]byte{'a'}, 32),
+		"b": bytes.Repeat([]byte{'b'}, 32),
+	}, active)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+// sealV0 按版本 0 的格式加密，附加认证数据只有 owner
+func sealV0(t *testing.T, owner, keyID string, kek, plaintext []byte) *store.Envelope {
+	t.Helper()
+	dek := bytes.Repeat([]byte{'d'}, dataKeySize)
+	nonce, ciphertext, err := gcmSeal(dek, plaintext, contentAAD(owner, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrapped, err := wrapKey(kek, dek, []byte(owner+"\x00"+keyID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &store.Envelope{KeyID: keyID, WrappedKey: wrapped, Nonce: nonce, Ciphertext: ciphertext}
+}
+
+func TestOpen(t *testing.T) {
+	k := testKeyring(t, "a")
+	const owner, id = "alice@example.com", "6530f0a1e4b0c1d2e3f40001"
+	keyID, kek, err := k.CurrentKey(owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext := []byte("Subject: hello\r\n\r\nbody\r\n")
+	env, err := Seal(owner, id, keyID, kek, plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKEK, _ := k.Key(owner, "m:b")
+	tampered := *env
+	tampered.Ciphertext = append([]byte(nil), env.Ciphertext...)
+	tampered.Ciphertext[0] ^= 1
+
+	tests := []struct {
+		name  string
+		owner string
+		id    string
+		kek   []byte
+		env   *store.Envelope
+		ok    bool
+	}{
+		{"same owner and id", owner, id, kek, env, true},
+		{"other owner", "bob@example.com", id, kek, env, false},
+		{"swapped between messages", owner, "6530f0a1e4b0c1d2e3f40002", kek, env, false},
+		{"wrong kek", owner, id, otherKEK, env, false},
+		{"tampered ciphertext", owner, id, kek, &tampered, false},
+		{"version 0 ignores id", owner, "any", kek, sealV0(t, owner, keyID, kek, plaintext), true},
+		{"version 0 other owner", "bob@example.com", "any", kek, sealV0(t, owner, keyID, kek, plaintext), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Open(tt.owner, tt.id, tt.kek, tt.env)
+			if !tt.ok {
+				if !errors.Is(err, ErrDecrypt) {
+					t.Fatalf("Open() error = %v, want ErrDecrypt", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Open() error = %v", err)
+			}
+			if !bytes.Equal(got, plaintext) {
+				t.Errorf("Open() = %q, want %q", got, plaintext)
+			}
+		})
+	}
+
+	if _, err := Seal(owner, "", keyID, kek, plaintext); err == nil {
+		t.Error("Seal() without message id succeeded")
+	}
+}
+
+func TestRotateKeys(t *testing.T) {
+	ctx := context.Background()
+	const owner = "alice@example.com"
+	inner := store.NewMemoryStore()
+	old := NewStore(inner, testKeyring(t, "a"))
+
+	raw := map[string][]byte{}
+	add := func(s store.Store, msg *store.Message, body string) {
+		t.Helper()
+		msg.Owner = owner
+		if err := s.Append(ctx, msg); err != nil {
+			t.Fatal(err)
+		}
+		raw[msg.ID] = []byte(body)
+	}
+	add(old, &store.Message{Mailbox: store.Inbox, Raw: []byte("sealed with key a")}, "sealed with key a")
+	add(old, &store.Message{Mailbox: store.Sent, Raw: []byte("another with key a")}, "another with key a")
+	add(inner, &store.Message{Mailbox: store.Inbox, Raw: []byte("stored before encryption")}, "stored before encryption")
+	_, kekA, _ := testKeyring(t, "a").CurrentKey(owner)
+	add(inner, &store.Message{Mailbox: store.Inbox, Envelope: sealV0(t, owner, "m:a", kekA, []byte("version 0"))}, "version 0")
+
+	s := NewStore(inner, testKeyring(t, "b"))
+	n, err := s.RotateKeys(ctx, owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(raw) {
+		t.Errorf("RotateKeys() = %d, want %d", n, len(raw))
+	}
+	for id, want := range raw {
+		stored, err := inner.Get(ctx, owner, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored.Raw != nil || stored.Envelope == nil || stored.Envelope.KeyID != "m:b" || stored.Envelope.Version != envelopeVersion {
+			t.Errorf("message %s stored as raw %q envelope %+v, want key m:b version %d", id, stored.Raw, stored.Envelope, envelopeVersion)
+		}
+		got, err := s.Get(ctx, owner, id)
+		if err != nil {
+			t.Fatalf("Get(%s) error = %v", id, err)
+		}
+		if !bytes.Equal(got.Raw, want) {
+			t.Errorf("Get(%s) = %q, want %q", id, got.Raw, want)
+		}
+	}
+	if n, err := s.RotateKeys(ctx, owner); err != nil || n != 0 {
+		t.Errorf("second RotateKeys() = %d, %v, want 0", n, err)
+	}
+}
+
+func TestUpdateKeepsContent(t *testing.T) {
+	ctx := context.Background()
+	const owner = "alice@example.com"
+	inner := store.NewMemoryStore()
+	s := NewStore(inner, testKeyring(t, "a"))
+	body := []byte("Subject: hello\r\n\r\nbody\r\n")
+	if err := s.Append(ctx, &store.Message{Owner: owner, Mailbox: store.Inbox, Raw: body}); err != nil {
+		t.Fatal(err)
+	}
+	msgs, err := s.List(ctx, owner, store.Inbox)
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("List() = %d messages, %v", len(msgs), err)
+	}
+	id := msgs[0].ID
+
+	tests := []struct {
+		name   string
+		update func(msg *store.Message)
+		err    error
+	}{
+		{"flags after get", func(msg *store.Message) { msg.Flags = []string{store.FlagSeen} }, nil},
+		{"without content", func(msg *store.Message) { msg.Flags, msg.Raw = []string{store.FlagFlagged}, nil }, store.ErrNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := s.Get(ctx, owner, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.update(msg)
+			if err := s.Update(ctx, msg); !errors.Is(err, tt.err) {
+				t.Fatalf("Update() error = %v, want %v", err, tt.err)
+			}
+			got, err := s.Get(ctx, owner, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got.Raw, body) || !got.HasFlag(store.FlagSeen) || got.Size != int64(len(body)) {
+				t.Errorf("after Update() message = flags %v size %d raw %q, want \\Seen and the original content", got.Flags, got.Size, got.Raw)
+			}
+			stored, err := inner.Get(ctx, owner, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.Raw != nil || stored.Envelope == nil {
+				t.Errorf("stored message raw %q envelope %v, want only the envelope", stored.Raw, stored.Envelope)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package encrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"YoPost/internal/mail/store"
+)
+
+// dataKeySize AES-256 数据密钥长度
+const dataKeySize = 32
+
+// envelopeVersion 新信封的版本: 0 的附加认证数据只有 owner，1 起包含邮件 ID
+const envelopeVersion = 1
+
+// ErrDecrypt 密文被篡改或密钥不匹配
+var ErrDecrypt = errors.New("failed to decrypt message")
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// gcmSeal 使用随机 nonce 加密，返回 nonce 与密文
+func gcmSeal(key, plaintext, aad []byte) (nonce, ciphertext []byte, err error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+	return nonce, aead.Seal(nil, nonce, plaintext, aad), nil
+}
+
+func gcmOpen(key, nonce, ciphertext, aad []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	plaintext, err := aead.Open(nil, nonce, ciphertext, aad)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+// wrapKey 使用 KEK 包装数据密钥，结果为 nonce||密文
+func wrapKey(kek, dek, aad []byte) ([]byte, error) {
+	nonce, wrapped, err := gcmSeal(kek, dek, aad)
+	if err != nil {
+		return nil, err
+	}
+	return append(nonce, wrapped...), nil
+}
+
+func unwrapKey(kek, wrapped, aad []byte) ([]byte, error) {
+	aead, err := newGCM(kek)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	n := aead.NonceSize()
+	return gcmOpen(kek, wrapped[:n], wrapped[n:], aad)
+}
+
+// contentAAD 邮件内容的附加认证数据
+func contentAAD(owner, id string, version int) []byte {
+	if version == 0 {
+		return []byte(owner)
+	}
+	return []byte(owner + "\x00" + id)
+}
+
+// Seal 使用随机数据密钥加密邮件 id 的内容，并用用户 KEK 包装数据密钥
+// owner 和 id 作为附加认证数据，防止密文在用户之间或同一用户的邮件之间被替换
+func Seal(owner, id, keyID string, kek, plaintext []byte) (*store.Envelope, error) {
+	if id == "" {
+		return nil, errors.New("message id is required")
+	}
+	dek := make([]byte, dataKeySize)
+	if _, err := rand.Read(dek); err != nil {
+		return nil, err
+	}
+
+	nonce, ciphertext, err := gcmSeal(dek, plaintext, contentAAD(owner, id, envelopeVersion))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt message: %v", err)
+	}
+	wrapped, err := wrapKey(kek, dek, []byte(owner+"\x00"+keyID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap data key: %v", err)
+	}
+
+	return &store.Envelope{
+		Version:    envelopeVersion,
+		KeyID:      keyID,
+		WrappedKey: wrapped,
+		Nonce:      nonce,
+		Ciphertext: ciphertext,
+	}, nil
+}
+
+// Open 解开数据密钥并解密邮件 id 的内容
+func Open(owner, id string, kek []byte, env *store.Envelope) ([]byte, error) {
+	dek, err := unwrapKey(kek, env.WrappedKey, []byte(owner+"\x00"+env.KeyID))
+	if err != nil {
+		return nil, err
+	}
+	return gcmOpen(dek, env.Nonce, env.Ciphertext, contentAAD(owner, id, env.Version))
+}
+
+// Rewrap 用新的 KEK 重新包装数据密钥，邮件密文保持不变
+func Rewrap(owner string, env *store.Envelope, oldKEK []byte, newKeyID string, newKEK []byte) (*store.Envelope, error) {
+	dek, err := unwrapKey(oldKEK, env.WrappedKey, []byte(owner+"\x00"+env.KeyID))
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := wrapKey(newKEK, dek, []byte(owner+"\x00"+newKeyID))
+	if err != nil {
+		return nil, err
+	}
+
+	return &store.Envelope{
+		Version:    env.Version,
+		KeyID:      newKeyID,
+		WrappedKey: wrapped,
+		Nonce:      env.Nonce,
+		Ciphertext: env.Ciphertext,
+	}, nil
+}
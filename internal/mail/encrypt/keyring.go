@@ -0,0 +1,98 @@
+package encrypt
+
+import (
+	"crypto/hkdf"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"YoPost/internal/config"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ErrUnknownKey 找不到邮件对应的 KEK
+var ErrUnknownKey = errors.New("unknown key id")
+
+// Keyring 为每个用户提供包装数据密钥的 KEK
+type Keyring interface {
+	// CurrentKey 返回新邮件应使用的 KEK 及其 ID
+	CurrentKey(owner string) (id string, kek []byte, err error)
+	// Key 按 ID 查找 KEK，用于解密和轮换旧邮件
+	Key(owner, id string) ([]byte, error)
+}
+
+// MasterKeyring 由服务器主密钥通过 HKDF 为每个用户派生 KEK
+// 主密钥可以有多个版本，active 指定新邮件使用的版本
+type MasterKeyring struct {
+	keys   map[string][]byte
+	active string
+}
+
+// NewMasterKeyring 创建主密钥模式的 Keyring
+func NewMasterKeyring(keys map[string][]byte, active string) (*MasterKeyring, error) {
+	if _, ok := keys[active]; !ok {
+		return nil, fmt.Errorf("active master key %q not found", active)
+	}
+	for id, key := range keys {
+		if len(key) < 32 {
+			return nil, fmt.Errorf("master key %q must be at least 32 bytes", id)
+		}
+	}
+	return &MasterKeyring{keys: keys, active: active}, nil
+}
+
+func (k *MasterKeyring) derive(owner, id string) ([]byte, error) {
+	master, ok := k.keys[id]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	return hkdf.Key(sha256.New, master, nil, "yopost mailbox kek "+owner, 32)
+}
+
+func (k *MasterKeyring) CurrentKey(owner string) (string, []byte, error) {
+	kek, err := k.derive(owner, k.active)
+	return "m:" + k.active, kek, err
+}
+
+func (k *MasterKeyring) Key(owner, id string) ([]byte, error) {
+	if len(id) < 3 || id[:2] != "m:" {
+		return nil, ErrUnknownKey
+	}
+	return k.derive(owner, id[2:])
+}
+
+// masterKeysFile 主密钥文件格式
+type masterKeysFile struct {
+	Keys map[string]string `yaml:"keys"` // id: base64 编码的密钥
+}
+
+// NewKeyringFromConfig 根据配置创建 Keyring
+func NewKeyringFromConfig(cfg config.EncryptionConfig) (Keyring, error) {
+	switch cfg.Mode {
+	case "", "master":
+		data, err := os.ReadFile(cfg.MasterKeysFile)
+		if err != nil {
+			log.Printf("ERROR: Failed to read master keys file - %v", err)
+			return nil, err
+		}
+		var file masterKeysFile
+		if err := yaml.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("failed to parse master keys file: %v", err)
+		}
+		keys := make(map[string][]byte, len(file.Keys))
+		for id, encoded := range file.Keys {
+			key, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil {
+				return nil, fmt.Errorf("invalid master key %q: %v", id, err)
+			}
+			keys[id] = key
+		}
+		return NewMasterKeyring(keys, cfg.ActiveKey)
+	default:
+		return nil, fmt.Errorf("unknown encryption mode %q", cfg.Mode)
+	}
+}
@@ -0,0 +1,164 @@
+package encrypt
+
+import (
+	"context"
+	"log"
+
+	"YoPost/internal/mail/store"
+)
+
+// Store 对底层存储透明加解密的包装
+// 写入时加密邮件正文，读取时自动解密；未加密的历史邮件原样返回
+type Store struct {
+	store.Store
+	keyring Keyring
+}
+
+// NewStore 创建加密存储
+func NewStore(inner store.Store, keyring Keyring) *Store {
+	return &Store{Store: inner, keyring: keyring}
+}
+
+func (s *Store) seal(msg *store.Message) (*store.Message, error) {
+	id, kek, err := s.keyring.CurrentKey(msg.Owner)
+	if err != nil {
+		return nil, err
+	}
+	env, err := Seal(msg.Owner, msg.ID, id, kek, msg.Raw)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed := *msg
+	sealed.Size = int64(len(msg.Raw))
+	sealed.Raw = nil
+	sealed.Envelope = env
+	return &sealed, nil
+}
+
+func (s *Store) open(msg *store.Message) error {
+	if msg.Envelope == nil {
+		return nil
+	}
+	kek, err := s.keyring.Key(msg.Owner, msg.Envelope.KeyID)
+	if err != nil {
+		return err
+	}
+	raw, err := Open(msg.Owner, msg.ID, kek, msg.Envelope)
+	if err != nil {
+		log.Printf("ERROR: Failed to decrypt message %s for %s - %v", msg.ID, msg.Owner, err)
+		return err
+	}
+	msg.Raw = raw
+	msg.Envelope = nil
+	return nil
+}
+
+// Append 在加密前生成邮件 ID，使其成为附加认证数据的一部分
+func (s *Store) Append(ctx context.Context, msg *store.Message) error {
+	if msg.ID == "" {
+		msg.ID = store.NewID()
+	}
+	sealed, err := s.seal(msg)
+	if err != nil {
+		return err
+	}
+	if err := s.Store.Append(ctx, sealed); err != nil {
+		return err
+	}
+	msg.ID, msg.UID, msg.InternalDate, msg.Size = sealed.ID, sealed.UID, sealed.InternalDate, sealed.Size
+	return nil
+}
+
+func (s *Store) Get(ctx context.Context, owner, id string) (*store.Message, error) {
+	msg, err := s.Store.Get(ctx, owner, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.open(msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func (s *Store) List(ctx context.Context, owner, mailbox string) ([]*store.Message, error) {
+	msgs, err := s.Store.List(ctx, owner, mailbox)
+	if err != nil {
+		return nil, err
+	}
+	for _, msg := range msgs {
+		if err := s.open(msg); err != nil {
+			return nil, err
+		}
+	}
+	return msgs, nil
+}
+
+func (s *Store) Update(ctx context.Context, msg *store.Message) error {
+	if msg.Raw == nil {
+		return store.ErrNoContent
+	}
+	sealed, err := s.seal(msg)
+	if err != nil {
+		return err
+	}
+	if err := s.Store.Update(ctx, sealed); err != nil {
+		return err
+	}
+	msg.Revision = sealed.Revision
+	return nil
+}
+
+// RotateKeys 将用户全部邮件的数据密钥重新包装到当前 KEK
+// 未加密的历史邮件会在此过程中被加密，旧版本信封重新加密以绑定邮件 ID，返回被修改的邮件数量
+func (s *Store) RotateKeys(ctx context.Context, owner string) (int, error) {
+	currentID, currentKEK, err := s.keyring.CurrentKey(owner)
+	if err != nil {
+		return 0, err
+	}
+
+	mailboxes, err := s.Store.Mailboxes(ctx, owner)
+	if err != nil {
+		return 0, err
+	}
+
+	rotated := 0
+	for _, mailbox := range mailboxes {
+		msgs, err := s.Store.List(ctx, owner, mailbox)
+		if err != nil {
+			return rotated, err
+		}
+		for _, msg := range msgs {
+			switch {
+			case msg.Envelope == nil:
+				msg.Envelope, err = Seal(owner, msg.ID, currentID, currentKEK, msg.Raw)
+				msg.Raw = nil
+			case msg.Envelope.Version < envelopeVersion:
+				var oldKEK, raw []byte
+				if oldKEK, err = s.keyring.Key(owner, msg.Envelope.KeyID); err == nil {
+					if raw, err = Open(owner, msg.ID, oldKEK, msg.Envelope); err == nil {
+						msg.Envelope, err = Seal(owner, msg.ID, currentID, currentKEK, raw)
+					}
+				}
+			case msg.Envelope.KeyID != currentID:
+				var oldKEK []byte
+				if oldKEK, err = s.keyring.Key(owner, msg.Envelope.KeyID); err == nil {
+					msg.Envelope, err = Rewrap(owner, msg.Envelope, oldKEK, currentID, currentKEK)
+				}
+			default:
+				continue
+			}
+			if err != nil {
+				log.Printf("ERROR: Failed to rotate key for message %s of %s - %v", msg.ID, owner, err)
+				return rotated, err
+			}
+			if err := s.Store.Update(ctx, msg); err != nil {
+				return rotated, err
+			}
+			rotated++
+		}
+	}
+
+	log.Printf("INFO: Rotated %d messages of %s to key %s", rotated, owner, currentID)
+	return rotated, nil
+}
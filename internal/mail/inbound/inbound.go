@@ -0,0 +1,273 @@
+// Package inbound 将发往指定地址或域名的入站邮件解析后 POST 到 HTTP 端点 (mail-to-webhook)，
+// 请求体为 JSON 或 multipart/form-data，包含信封、头部、正文和附件
+package inbound
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"YoPost/internal/config"
+	"YoPost/internal/mail/message"
+	"YoPost/internal/webhook"
+)
+
+// HeaderRoute 请求头，值为匹配的路由 (match)
+const HeaderRoute = "X-YoPost-Route"
+
+// Route 一条入站路由
+type Route struct {
+	config.InboundRoute
+	// local 为 "*" 时匹配整个域名
+	local, domain string
+}
+
+// Router 按收件人地址匹配入站路由并推送邮件，支持热加载
+type Router struct {
+	routes atomic.Pointer[[]*Route]
+	client *http.Client
+}
+
+// NewRouter 创建入站路由表
+func NewRouter(routes []config.InboundRoute) *Router {
+	r := &Router{client: &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}}
+	r.SetRoutes(routes)
+	return r
+}
+
+// SetRoutes 替换全部路由
+func (r *Router) SetRoutes(routes []config.InboundRoute) {
+	compiled := make([]*Route, 0, len(routes))
+	for _, rc := range routes {
+		local, domain, _ := strings.Cut(strings.ToLower(strings.TrimSpace(rc.Match)), "@")
+		compiled = append(compiled, &Route{InboundRoute: rc, local: local, domain: domain})
+	}
+	r.routes.Store(&compiled)
+}
+
+func (r *Router) PrepareReload(cfg *config.Config) (func(), error) {
+	return func() { r.SetRoutes(cfg.Server.Routes) }, nil
+}
+
+// Match 返回收件人匹配的路由，完整地址优先于域名，未匹配时返回 nil
+func (r *Router) Match(address string) *Route {
+	local, domain, ok := strings.Cut(strings.ToLower(strings.TrimSpace(address)), "@")
+	if !ok {
+		return nil
+	}
+	var wildcard *Route
+	for _, rt := range *r.routes.Load() {
+		if rt.domain != domain {
+			continue
+		}
+		if rt.local == local {
+			return rt
+		}
+		if rt.local == "*" {
+			wildcard = rt
+		}
+	}
+	return wildcard
+}
+
+// Address 邮件头部中的地址
+type Address struct {
+	Name    string `json:"name,omitempty"`
+	Address string `json:"address"`
+}
+
+// Envelope SMTP 信封
+type Envelope struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Route 匹配的路由
+	Route string `json:"route"`
+}
+
+// Attachment 附件，JSON 格式中 content 为 base64 编码
+type Attachment struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	ContentID   string `json:"content_id,omitempty"`
+	Inline      bool   `json:"inline"`
+	Size        int    `json:"size"`
+	Content     []byte `json:"content"`
+}
+
+// Payload JSON 格式的请求体
+type Payload struct {
+	Envelope    Envelope            `json:"envelope"`
+	Headers     map[string][]string `json:"headers"`
+	From        []Address           `json:"from"`
+	To          []Address           `json:"to"`
+	Cc          []Address           `json:"cc"`
+	Subject     string              `json:"subject"`
+	Date        *time.Time          `json:"date,omitempty"`
+	MessageID   string              `json:"message_id,omitempty"`
+	Text        string              `json:"text"`
+	HTML        string              `json:"html"`
+	Attachments []Attachment        `json:"attachments"`
+}
+
+func addresses(list []*mail.Address) []Address {
+	out := make([]Address, 0, len(list))
+	for _, a := range list {
+		out = append(out, Address{Name: a.Name, Address: a.Address})
+	}
+	return out
+}
+
+// NewPayload 解析邮件生成请求体
+func NewPayload(rt *Route, from, rcpt string, raw []byte) (*Payload, error) {
+	p, err := message.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	payload := &Payload{
+		Envelope:    Envelope{From: from, To: rcpt, Route: rt.Match},
+		Headers:     make(map[string][]string, len(p.Header)),
+		From:        addresses(p.From),
+		To:          addresses(p.To),
+		Cc:          addresses(p.Cc),
+		Subject:     p.Subject,
+		MessageID:   p.MessageID,
+		Text:        p.Text,
+		HTML:        p.HTML,
+		Attachments: make([]Attachment, 0, len(p.Attachments)),
+	}
+	for k, values := range p.Header {
+		decoded := make([]string, len(values))
+		for i, v := range values {
+			decoded[i] = message.DecodeHeader(v)
+		}
+		payload.Headers[k] = decoded
+	}
+	if !p.Date.IsZero() {
+		payload.Date = &p.Date
+	}
+	for _, a := range p.Attachments {
+		payload.Attachments = append(payload.Attachments, Attachment{
+			Filename:    a.Filename,
+			ContentType: a.ContentType,
+			ContentID:   a.ContentID,
+			Inline:      a.Inline,
+			Size:        a.Size,
+			Content:     a.Data,
+		})
+	}
+	return payload, nil
+}
+
+func formatList(list []Address) string {
+	parts := make([]string, len(list))
+	for i, a := range list {
+		parts[i] = (&mail.Address{Name: a.Name, Address: a.Address}).String()
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Multipart 将请求体编码为 multipart/form-data：envelope 和 headers 为 JSON 字段，
+// 附件为名为 attachments 的文件，其余为文本字段
+func (p *Payload) Multipart() ([]byte, string, error) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	envelope, _ := json.Marshal(p.Envelope)
+	headers, _ := json.Marshal(p.Headers)
+	fields := [][2]string{
+		{"envelope", string(envelope)},
+		{"headers", string(headers)},
+		{"from", formatList(p.From)},
+		{"to", formatList(p.To)},
+		{"cc", formatList(p.Cc)},
+		{"subject", p.Subject},
+		{"message_id", p.MessageID},
+		{"text", p.Text},
+		{"html", p.HTML},
+	}
+	if p.Date != nil {
+		fields = append(fields, [2]string{"date", p.Date.Format(time.RFC3339)})
+	}
+	for _, f := range fields {
+		if err := w.WriteField(f[0], f[1]); err != nil {
+			return nil, "", err
+		}
+	}
+	for _, a := range p.Attachments {
+		h := make(textproto.MIMEHeader)
+		h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="attachments"; filename=%q`, a.Filename))
+		h.Set("Content-Type", a.ContentType)
+		if a.ContentID != "" {
+			h.Set("Content-ID", "<"+a.ContentID+">")
+		}
+		part, err := w.CreatePart(h)
+		if err != nil {
+			return nil, "", err
+		}
+		if _, err := part.Write(a.Content); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), w.FormDataContentType(), nil
+}
+
+// Post 将发往 rcpt 的邮件推送到路由的端点，2xx 为成功
+func (r *Router) Post(ctx context.Context, rt *Route, from, rcpt string, raw []byte) error {
+	payload, err := NewPayload(rt, from, rcpt, raw)
+	if err != nil {
+		return fmt.Errorf("failed to parse message: %v", err)
+	}
+	var body []byte
+	contentType := "application/json"
+	if rt.Format == "multipart" {
+		body, contentType, err = payload.Multipart()
+	} else {
+		body, err = json.Marshal(payload)
+	}
+	if err != nil {
+		return err
+	}
+
+	timeout := time.Duration(rt.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rt.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", "YoPost-Inbound/1.0")
+	req.Header.Set(HeaderRoute, rt.Match)
+	if rt.Secret != "" {
+		req.Header.Set(webhook.HeaderSignature, webhook.Sign(rt.Secret, time.Now(), body))
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("endpoint returned HTTP %d", resp.StatusCode)
+	}
+	log.Printf("INFO: Posted message from %s for %s to %s", from, rcpt, rt.URL)
+	return nil
+}
@@ -0,0 +1,237 @@
+package message
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// maxDepth 嵌套 multipart 的最大解析深度
+const maxDepth = 10
+
+// Attachment 邮件附件
+type Attachment struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	ContentID   string `json:"content_id,omitempty"`
+	Inline      bool   `json:"inline"`
+	Size        int    `json:"size"`
+	Data        []byte `json:"-"`
+}
+
+// Parsed 解析并解码后的邮件
+type Parsed struct {
+	Header      mail.Header
+	Subject     string
+	From        []*mail.Address
+	To          []*mail.Address
+	Cc          []*mail.Address
+	Date        time.Time
+	MessageID   string
+	Text        string
+	HTML        string
+	Attachments []Attachment
+}
+
+var wordDecoder = &mime.WordDecoder{CharsetReader: charsetReader}
+
+// charsetReader 将 GBK/GB18030/Big5 等字符集转换为 UTF-8
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported charset %q", charset)
+	}
+	return enc.NewDecoder().Reader(input), nil
+}
+
+// DecodeHeader 解码 RFC 2047 编码的头部值，失败时返回原值
+func DecodeHeader(v string) string {
+	decoded, err := wordDecoder.DecodeHeader(v)
+	if err != nil {
+		return v
+	}
+	return decoded
+}
+
+// ParseAddressList 解析地址列表头部，解析失败时返回 nil
+func ParseAddressList(v string) []*mail.Address {
+	if v == "" {
+		return nil
+	}
+	parser := mail.AddressParser{WordDecoder: wordDecoder}
+	list, err := parser.ParseList(v)
+	if err != nil {
+		return nil
+	}
+	return list
+}
+
+// ParseHeader 只解析邮件头部，用于生成列表摘要
+func ParseHeader(raw []byte) (*Parsed, error) {
+	if i := bytes.Index(raw, []byte("\r\n\r\n")); i >= 0 {
+		raw = raw[:i+4]
+	}
+	m, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	p := &Parsed{}
+	p.fillHeader(m.Header)
+	return p, nil
+}
+
+// Parse 解析完整邮件，解码正文并提取附件
+func Parse(raw []byte) (*Parsed, error) {
+	m, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Parsed{}
+	p.fillHeader(m.Header)
+	body, err := io.ReadAll(m.Body)
+	if err != nil {
+		return nil, err
+	}
+	p.walk(m.Header.Get("Content-Type"), m.Header.Get("Content-Transfer-Encoding"), m.Header.Get("Content-Disposition"), m.Header.Get("Content-ID"), body, 0)
+	return p, nil
+}
+
+func (p *Parsed) fillHeader(h mail.Header) {
+	p.Header = h
+	p.Subject = DecodeHeader(h.Get("Subject"))
+	p.From = ParseAddressList(h.Get("From"))
+	p.To = ParseAddressList(h.Get("To"))
+	p.Cc = ParseAddressList(h.Get("Cc"))
+	p.MessageID = strings.TrimSpace(h.Get("Message-Id"))
+	if d, err := h.Date(); err == nil {
+		p.Date = d
+	}
+}
+
+// decodeTransfer 处理 Content-Transfer-Encoding
+func decodeTransfer(encoding string, body []byte) []byte {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		clean := bytes.Map(func(r rune) rune {
+			if r == '\r' || r == '\n' || r == ' ' || r == '\t' {
+				return -1
+			}
+			return r
+		}, body)
+		if out, err := base64.StdEncoding.DecodeString(string(clean)); err == nil {
+			return out
+		}
+		return body
+	case "quoted-printable":
+		if out, err := io.ReadAll(quotedprintable.NewReader(bytes.NewReader(body))); err == nil {
+			return out
+		}
+		return body
+	default:
+		return body
+	}
+}
+
+// toUTF8 按 charset 参数将文本转换为 UTF-8
+func toUTF8(charset string, body []byte) string {
+	cs := strings.ToLower(charset)
+	if cs == "" || cs == "utf-8" || cs == "us-ascii" {
+		return string(body)
+	}
+	r, err := charsetReader(cs, bytes.NewReader(body))
+	if err != nil {
+		return string(body)
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		return string(body)
+	}
+	return string(out)
+}
+
+func (p *Parsed) walk(contentType, encoding, disposition, contentID string, body []byte, depth int) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || contentType == "" {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") && depth < maxDepth {
+		mr := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+		for {
+			part, err := mr.NextRawPart()
+			if err != nil {
+				break
+			}
+			data, err := io.ReadAll(part)
+			if err != nil {
+				break
+			}
+			p.walk(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"),
+				part.Header.Get("Content-Disposition"), part.Header.Get("Content-ID"), data, depth+1)
+		}
+		return
+	}
+
+	data := decodeTransfer(encoding, body)
+	disp, dparams, _ := mime.ParseMediaType(disposition)
+	filename := DecodeHeader(dparams["filename"])
+	if filename == "" {
+		filename = DecodeHeader(params["name"])
+	}
+
+	if disp != "attachment" && filename == "" {
+		switch mediaType {
+		case "text/plain":
+			if p.Text == "" {
+				p.Text = toUTF8(params["charset"], data)
+				return
+			}
+		case "text/html":
+			if p.HTML == "" {
+				p.HTML = toUTF8(params["charset"], data)
+				return
+			}
+		}
+	}
+
+	p.Attachments = append(p.Attachments, Attachment{
+		Filename:    filename,
+		ContentType: mediaType,
+		ContentID:   strings.Trim(contentID, "<>"),
+		Inline:      disp == "inline",
+		Size:        len(data),
+		Data:        data,
+	})
+}
+
+var (
+	htmlDropRe = regexp.MustCompile(`(?is)<(script|style|head)[^>]*>.*?</(script|style|head)>`)
+	htmlTagRe  = regexp.MustCompile(`(?s)<[^>]*>`)
+	htmlEntity = strings.NewReplacer("&nbsp;", " ", "&lt;", "<", "&gt;", ">", "&quot;", `"`, "&#39;", "'", "&amp;", "&")
+)
+
+// HTMLToText 去除 HTML 标签，得到用于索引和摘要的纯文本
+func HTMLToText(html string) string {
+	s := htmlDropRe.ReplaceAllString(html, " ")
+	s = htmlTagRe.ReplaceAllString(s, " ")
+	return htmlEntity.Replace(s)
+}
+
+// PlainText 返回邮件的纯文本正文，只有 HTML 时转换为文本
+func (p *Parsed) PlainText() string {
+	if p.Text != "" {
+		return p.Text
+	}
+	return HTMLToText(p.HTML)
+}
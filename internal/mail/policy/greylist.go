@@ -0,0 +1,173 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"YoPost/internal/config"
+	"YoPost/internal/mail/smtpd"
+)
+
+// ErrNotFound 灰名单中没有该组合或已过期
+var ErrNotFound = errors.New("policy: greylist triplet not found")
+
+// Triplet 灰名单中的一个 (客户端网段, 发件人, 收件人) 组合
+type Triplet struct {
+	Key       string    `bson:"_id"`
+	FirstSeen time.Time `bson:"first_seen"`
+	LastSeen  time.Time `bson:"last_seen"`
+	// Passed 在 delay 之后重试过，之后不再延迟
+	Passed bool `bson:"passed"`
+	// Blocked 被临时拒绝的次数
+	Blocked int `bson:"blocked"`
+	// ExpiresAt 之后记录失效：未通过的组合为 retry_window 结束时，通过的为最后一次收信后 expire_days
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+// Store 灰名单组合的存储
+type Store interface {
+	// Get 返回未过期的组合，不存在或已过期时返回 ErrNotFound
+	Get(ctx context.Context, key string) (*Triplet, error)
+	// Put 按 Key 保存组合
+	Put(ctx context.Context, t *Triplet) error
+}
+
+// settings 解析后的策略配置，热加载时整体替换
+type settings struct {
+	config.PolicyConfig
+	networks   []*net.IPNet
+	domains    map[string]bool
+	recipients map[string]bool
+}
+
+func newSettings(cfg config.PolicyConfig) *settings {
+	s := &settings{PolicyConfig: cfg, domains: make(map[string]bool), recipients: make(map[string]bool)}
+	for _, w := range cfg.Greylist.Whitelist {
+		w = strings.ToLower(strings.TrimSpace(w))
+		if _, n, err := net.ParseCIDR(w); err == nil {
+			s.networks = append(s.networks, n)
+		} else if ip := net.ParseIP(w); ip != nil {
+			s.networks = append(s.networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)})
+		} else if strings.Contains(w, "@") {
+			s.recipients[w] = true
+		} else if w != "" {
+			s.domains[w] = true
+		}
+	}
+	return s
+}
+
+// whitelisted 判断客户端 IP、发件人域名或收件人地址是否在灰名单白名单中
+func (s *settings) whitelisted(ip net.IP, from, to string) bool {
+	for _, n := range s.networks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	from = strings.ToLower(from)
+	return s.domains[from[strings.LastIndexByte(from, '@')+1:]] || s.recipients[strings.ToLower(to)]
+}
+
+// network 返回用于灰名单的客户端网段：IPv4 /24、IPv6 /64，
+// 大型发送方的重试通常来自同一网段的其他主机 (RFC 6647 4.2)
+func network(ip net.IP) string {
+	if v4 := ip.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String() + "/24"
+	}
+	return ip.Mask(net.CIDRMask(64, 128)).String() + "/64"
+}
+
+// touchInterval 已通过的组合最多每隔多久更新一次 LastSeen，减少存储写入
+const touchInterval = time.Hour
+
+// greylisted 检查 (网段, 发件人, 收件人) 组合，首次出现或等待时间不足时返回 451 4.7.1。
+// 存储出错时接受收件人，避免存储故障导致拒收全部邮件
+func (p *Policy) greylisted(ctx context.Context, s *settings, ip net.IP, from, to string) error {
+	g := s.Greylist
+	delay := time.Duration(g.Delay) * time.Second
+	key := network(ip) + "\x00" + strings.ToLower(from) + "\x00" + strings.ToLower(to)
+	now := time.Now()
+
+	t, err := p.greylist.Get(ctx, key)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		p.logf("ERROR: Failed to read greylist - %v", err)
+		return nil
+	}
+	if t != nil && now.After(t.ExpiresAt) {
+		t = nil
+	}
+
+	var wait time.Duration
+	switch {
+	case t == nil:
+		t = &Triplet{Key: key, FirstSeen: now, LastSeen: now, Blocked: 1, ExpiresAt: now.Add(time.Duration(g.RetryWindow) * time.Second)}
+		wait = delay
+	case !t.Passed && now.Sub(t.FirstSeen) < delay:
+		t.LastSeen = now
+		t.Blocked++
+		wait = delay - now.Sub(t.FirstSeen)
+	case !t.Passed:
+		p.logf("INFO: Greylist passed for %s from <%s> to <%s> after %s", ip, from, to, now.Sub(t.FirstSeen).Round(time.Second))
+		t.Passed = true
+		t.LastSeen = now
+		t.ExpiresAt = now.AddDate(0, 0, g.ExpireDays)
+	case now.Sub(t.LastSeen) < touchInterval:
+		return nil
+	default:
+		t.LastSeen = now
+		t.ExpiresAt = now.AddDate(0, 0, g.ExpireDays)
+	}
+	if err := p.greylist.Put(ctx, t); err != nil {
+		p.logf("ERROR: Failed to update greylist - %v", err)
+		return nil
+	}
+	if wait == 0 {
+		return nil
+	}
+	p.logf("INFO: Greylisted %s from <%s> to <%s>", ip, from, to)
+	return &smtpd.Error{Code: 451, Enhanced: "4.7.1", Message: fmt.Sprintf("Greylisted, please try again in %d seconds", int(wait.Seconds()+0.5))}
+}
+
+// MemoryStore 进程内灰名单存储
+type MemoryStore struct {
+	mu       sync.Mutex
+	triplets map[string]Triplet
+	pruned   time.Time
+}
+
+// NewMemoryStore 创建内存灰名单存储
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{triplets: make(map[string]Triplet)}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) (*Triplet, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.triplets[key]
+	if !ok || time.Now().After(t.ExpiresAt) {
+		return nil, ErrNotFound
+	}
+	return &t, nil
+}
+
+// Put 保存组合，每小时清理一次过期记录
+func (s *MemoryStore) Put(ctx context.Context, t *Triplet) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if now.Sub(s.pruned) > time.Hour {
+		s.pruned = now
+		for key, old := range s.triplets {
+			if now.After(old.ExpiresAt) {
+				delete(s.triplets, key)
+			}
+		}
+	}
+	s.triplets[t.Key] = *t
+	return nil
+}
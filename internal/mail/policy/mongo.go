@@ -0,0 +1,51 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore 基于 MongoDB greylist 集合的灰名单存储，过期记录由 TTL 索引删除
+type MongoStore struct {
+	coll *mongo.Collection
+}
+
+// NewMongoStore 创建 MongoDB 灰名单存储
+func NewMongoStore(db *mongo.Database) *MongoStore {
+	return &MongoStore{coll: db.Collection("greylist")}
+}
+
+// EnsureIndexes 创建在 expires_at 之后删除记录的 TTL 索引
+func (s *MongoStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create greylist indexes: %v", err)
+	}
+	return nil
+}
+
+// Get TTL 索引每分钟才清理一次，已过期但尚未删除的记录同样返回 ErrNotFound
+func (s *MongoStore) Get(ctx context.Context, key string) (*Triplet, error) {
+	var t Triplet
+	err := s.coll.FindOne(ctx, bson.M{"_id": key, "expires_at": bson.M{"$gt": time.Now()}}).Decode(&t)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (s *MongoStore) Put(ctx context.Context, t *Triplet) error {
+	_, err := s.coll.ReplaceOne(ctx, bson.M{"_id": t.Key}, t, options.Replace().SetUpsert(true))
+	return err
+}
@@ -0,0 +1,271 @@
+// Package policy 入站 SMTP 连接策略：每个客户端 IP 的并发连接数和命令速率、
+// 问候前抢先发送 (pregreet) 检测、对无效收件人过多的连接延迟回复 (tarpit)、DNS 黑名单和灰名单
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"YoPost/internal/config"
+	"YoPost/internal/mail/dnsbl"
+	"YoPost/internal/mail/smtpd"
+)
+
+// client 一个客户端 IP 的连接数和命令令牌桶
+type client struct {
+	conns  int
+	tokens float64
+	last   time.Time
+}
+
+// Policy 实现 smtpd.Policy，注册到 config.Holder 后支持热加载
+type Policy struct {
+	greylist Store
+	dnsbl    *dnsbl.Checker
+	settings atomic.Pointer[settings]
+	// Logger 为空时使用 log 包的默认 Logger
+	Logger *log.Logger
+
+	mu      sync.Mutex
+	clients map[string]*client
+	pruned  time.Time
+}
+
+// New 创建 Policy，greylist 为灰名单组合的存储
+func New(cfg config.PolicyConfig, greylist Store) *Policy {
+	p := &Policy{greylist: greylist, clients: make(map[string]*client)}
+	p.settings.Store(newSettings(cfg))
+	return p
+}
+
+// PrepareReload 新的限制对之后的连接和命令生效，已有的计数保留
+func (p *Policy) PrepareReload(cfg *config.Config) (func(), error) {
+	s := newSettings(cfg.Listeners.SMTP.Policy)
+	return func() { p.settings.Store(s) }, nil
+}
+
+// SetDNSBL 设置 DNS 列表查询，未认证客户端总分达到 reject_score 时拒绝收件人，达到 tag_score 时添加头部，
+// 总分为负 (DNSWL 命中) 的客户端不做灰名单
+func (p *Policy) SetDNSBL(c *dnsbl.Checker) {
+	p.dnsbl = c
+}
+
+func (p *Policy) logf(format string, args ...interface{}) {
+	if p.Logger != nil {
+		p.Logger.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+// remoteIP 返回连接的客户端 IP
+func remoteIP(addr net.Addr) net.IP {
+	if tcp, ok := addr.(*net.TCPAddr); ok {
+		return tcp.IP
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		host = addr.String()
+	}
+	return net.ParseIP(host)
+}
+
+// Connect 实现 smtpd.Policy，客户端 IP 的连接数已满时返回 421
+func (p *Policy) Connect(remote net.Addr) (smtpd.ConnPolicy, error) {
+	s := p.settings.Load()
+	ip := remoteIP(remote)
+	key := remote.String()
+	if ip != nil {
+		key = ip.String()
+	}
+	now := time.Now()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.prune(now)
+	c, ok := p.clients[key]
+	if !ok {
+		c = &client{tokens: float64(s.CommandsPerMinute), last: now}
+		p.clients[key] = c
+	}
+	if s.MaxConnectionsPerIP > 0 && c.conns >= s.MaxConnectionsPerIP {
+		p.logf("INFO: Rejecting SMTP connection from %s - %d connections already open", key, c.conns)
+		return nil, &smtpd.Error{Code: 421, Enhanced: "4.7.0", Message: "Too many connections from your host"}
+	}
+	c.conns++
+	cp := &conn{policy: p, key: key, ip: ip, client: c}
+	if p.dnsbl != nil && p.dnsbl.Enabled() && ip != nil {
+		// 与问候和 pregreet 等待同时进行，RCPT 时才需要结果
+		cp.ipDone = make(chan struct{})
+		go func() {
+			cp.ipResult = p.dnsbl.CheckIP(context.Background(), ip)
+			close(cp.ipDone)
+		}()
+	}
+	return cp, nil
+}
+
+// prune 每分钟清理一次没有连接且命令令牌已恢复的客户端；调用方需持有锁
+func (p *Policy) prune(now time.Time) {
+	if now.Sub(p.pruned) < time.Minute {
+		return
+	}
+	p.pruned = now
+	for key, c := range p.clients {
+		if c.conns == 0 && now.Sub(c.last) > time.Minute {
+			delete(p.clients, key)
+		}
+	}
+}
+
+// command 从客户端的令牌桶取出一个命令，令牌在一分钟内匀速补满
+func (p *Policy) command(c *client, perMinute int) bool {
+	if perMinute <= 0 {
+		return true
+	}
+	now := time.Now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	c.tokens += now.Sub(c.last).Minutes() * float64(perMinute)
+	if max := float64(perMinute); c.tokens > max {
+		c.tokens = max
+	}
+	c.last = now
+	if c.tokens < 1 {
+		return false
+	}
+	c.tokens--
+	return true
+}
+
+// conn 实现 smtpd.ConnPolicy
+type conn struct {
+	policy *Policy
+	key    string
+	ip     net.IP
+	client *client
+	// rejected 被 Backend 永久拒绝的收件人数
+	rejected int
+
+	// ipDone 在客户端 IP 的 DNS 列表查询完成后关闭，未查询时为 nil
+	ipDone   chan struct{}
+	ipResult *dnsbl.Result
+	// listedFor 为 result 对应的 HELO 和发件人，header 为当前事务添加的头部
+	listedFor string
+	result    *dnsbl.Result
+	header    string
+}
+
+func (c *conn) PregreetDelay() time.Duration {
+	return time.Duration(c.policy.settings.Load().PregreetDelay) * time.Second
+}
+
+func (c *conn) Pregreet() error {
+	c.policy.logf("INFO: Rejecting SMTP connection from %s - sent data before greeting", c.key)
+	return &smtpd.Error{Code: 554, Enhanced: "5.5.1", Message: "Protocol error: data sent before greeting"}
+}
+
+func (c *conn) Command(verb string) error {
+	perMinute := c.policy.settings.Load().CommandsPerMinute
+	if c.policy.command(c.client, perMinute) {
+		return nil
+	}
+	c.policy.logf("INFO: Closing SMTP connection from %s - more than %d commands per minute", c.key, perMinute)
+	return &smtpd.Error{Code: 421, Enhanced: "4.7.0", Message: "Too many commands, closing connection"}
+}
+
+func (c *conn) Rcpt(ctx context.Context, helo, from, to string) error {
+	if smtpd.User(ctx) != "" {
+		c.header = ""
+		return nil
+	}
+	result := c.listed(ctx, helo, from)
+	if result != nil {
+		switch c.policy.dnsbl.Classify(result) {
+		case dnsbl.Reject:
+			top := result.Hits[0]
+			for _, h := range result.Hits {
+				if h.Weight > top.Weight {
+					top = h
+				}
+			}
+			c.policy.logf("INFO: Rejecting <%s> from %s - DNS list score %g (%s)", to, c.key, result.Score, hits(result))
+			return &smtpd.Error{Code: 554, Enhanced: "5.7.1", Message: fmt.Sprintf("Service unavailable; %s blocked using %s", top.Query, top.Zone)}
+		case dnsbl.Tag:
+			c.header = fmt.Sprintf("X-YoPost-DNSBL: score=%g; %s\r\n", result.Score, hits(result))
+		}
+	}
+
+	s := c.policy.settings.Load()
+	if !s.Greylist.Enabled || c.ip == nil || s.whitelisted(c.ip, from, to) || (result != nil && result.Score < 0) {
+		return nil
+	}
+	return c.policy.greylisted(ctx, s, c.ip, from, to)
+}
+
+// listed 返回客户端 IP、HELO 和发件人域名的 DNS 列表结果，同一事务只查询一次；未启用时返回 nil
+func (c *conn) listed(ctx context.Context, helo, from string) *dnsbl.Result {
+	if c.ipDone == nil {
+		return nil
+	}
+	if c.result != nil && c.listedFor == helo+"\x00"+from {
+		return c.result
+	}
+	<-c.ipDone
+	r := &dnsbl.Result{}
+	r.Merge(c.ipResult)
+	r.Merge(c.policy.dnsbl.CheckDomains(ctx, helo, from[strings.LastIndexByte(from, '@')+1:]))
+	c.listedFor, c.result, c.header = helo+"\x00"+from, r, ""
+	return r
+}
+
+// hits 以逗号分隔列出命中
+func hits(r *dnsbl.Result) string {
+	parts := make([]string, len(r.Hits))
+	for i, h := range r.Hits {
+		parts[i] = h.String()
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Rejected 对未认证连接，被永久拒绝的收件人超过 tarpit.after 个后，每次拒绝前等待的时间从 tarpit.delay 开始加倍
+func (c *conn) Rejected(ctx context.Context, err error) time.Duration {
+	var se *smtpd.Error
+	if smtpd.User(ctx) != "" || !errors.As(err, &se) || se.Code < 500 {
+		return 0
+	}
+	c.rejected++
+	t := c.policy.settings.Load().Tarpit
+	if t.After <= 0 || c.rejected <= t.After {
+		return 0
+	}
+	d := time.Duration(t.Delay) * time.Second
+	max := time.Duration(t.MaxDelay) * time.Second
+	for i := t.After + 1; i < c.rejected && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	if c.rejected == t.After+1 {
+		c.policy.logf("INFO: Tarpitting SMTP connection from %s after %d rejected recipients", c.key, c.rejected)
+	}
+	return d
+}
+
+func (c *conn) Headers() string {
+	return c.header
+}
+
+func (c *conn) Close() {
+	c.policy.mu.Lock()
+	c.client.conns--
+	c.policy.mu.Unlock()
+}
@@ -0,0 +1,232 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"testing"
+	"time"
+
+	"YoPost/internal/config"
+	"YoPost/internal/mail/smtpd"
+)
+
+func addr(ip string) net.Addr {
+	return &net.TCPAddr{IP: net.ParseIP(ip), Port: 25}
+}
+
+// newPolicy 创建不输出日志的 Policy
+func newPolicy(cfg config.PolicyConfig, greylist Store) *Policy {
+	p := New(cfg, greylist)
+	p.Logger = log.New(io.Discard, "", 0)
+	return p
+}
+
+func connect(t *testing.T, p *Policy, ip string) smtpd.ConnPolicy {
+	t.Helper()
+	c, err := p.Connect(addr(ip))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// code 返回 SMTP 错误的回复码，err 为 nil 时为 0
+func code(err error) int {
+	var se *smtpd.Error
+	if errors.As(err, &se) {
+		return se.Code
+	}
+	if err != nil {
+		return -1
+	}
+	return 0
+}
+
+func TestConnectLimit(t *testing.T) {
+	p := newPolicy(config.PolicyConfig{MaxConnectionsPerIP: 2}, NewMemoryStore())
+	first := connect(t, p, "192.0.2.1")
+	connect(t, p, "192.0.2.1")
+	if _, err := p.Connect(addr("192.0.2.1")); code(err) != 421 {
+		t.Errorf("third Connect() error = %v, want 421", err)
+	}
+	connect(t, p, "192.0.2.2")
+	first.Close()
+	connect(t, p, "192.0.2.1")
+}
+
+func TestCommandRate(t *testing.T) {
+	p := newPolicy(config.PolicyConfig{CommandsPerMinute: 3}, NewMemoryStore())
+	c := connect(t, p, "192.0.2.1")
+	for i := 0; i < 3; i++ {
+		if err := c.Command("RCPT"); err != nil {
+			t.Fatalf("Command() %d error = %v", i+1, err)
+		}
+	}
+	if err := c.Command("RCPT"); code(err) != 421 {
+		t.Errorf("fourth Command() error = %v, want 421", err)
+	}
+	// 令牌桶属于客户端 IP，新连接不会重置
+	if err := connect(t, p, "192.0.2.1").Command("EHLO"); code(err) != 421 {
+		t.Errorf("Command() on a new connection error = %v, want 421", err)
+	}
+	if err := connect(t, p, "192.0.2.2").Command("EHLO"); err != nil {
+		t.Errorf("Command() from another IP error = %v", err)
+	}
+}
+
+func TestTarpit(t *testing.T) {
+	ctx := context.Background()
+	p := newPolicy(config.PolicyConfig{Tarpit: config.TarpitConfig{After: 3, Delay: 1, MaxDelay: 5}}, NewMemoryStore())
+	c := connect(t, p, "192.0.2.1")
+	unknown := &smtpd.Error{Code: 550, Enhanced: "5.1.1", Message: "No such user here"}
+
+	if d := c.Rejected(ctx, &smtpd.Error{Code: 451, Enhanced: "4.3.0", Message: "try later"}); d != 0 {
+		t.Errorf("Rejected() of a temporary error = %v, want 0", d)
+	}
+	if d := c.Rejected(smtpd.WithUser(ctx, "alice@example.com"), unknown); d != 0 {
+		t.Errorf("Rejected() of an authenticated session = %v, want 0", d)
+	}
+	want := []time.Duration{0, 0, 0, time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, w := range want {
+		if d := c.Rejected(ctx, unknown); d != w {
+			t.Errorf("Rejected() #%d = %v, want %v", i+1, d, w)
+		}
+	}
+	if d := connect(t, p, "192.0.2.1").Rejected(ctx, unknown); d != 0 {
+		t.Errorf("Rejected() on a new connection = %v, want 0", d)
+	}
+}
+
+// failingStore 读取灰名单总是失败
+type failingStore struct{}
+
+func (failingStore) Get(ctx context.Context, key string) (*Triplet, error) {
+	return nil, errors.New("store unavailable")
+}
+
+func (failingStore) Put(ctx context.Context, t *Triplet) error {
+	return errors.New("store unavailable")
+}
+
+func TestGreylist(t *testing.T) {
+	ctx := context.Background()
+	const from, to = "bob@remote.example", "alice@example.com"
+	cfg := config.PolicyConfig{Greylist: config.GreylistConfig{Enabled: true, Delay: 300, RetryWindow: 3600, ExpireDays: 36,
+		Whitelist: []string{"198.51.100.0/24", "2001:db8::1", "trusted.example", "postmaster@example.com"}}}
+	key := network(net.ParseIP("192.0.2.1")) + "\x00" + from + "\x00" + to
+
+	// age 将组合的首次出现时间提前 d，模拟等待
+	age := func(st *MemoryStore, d time.Duration) {
+		t.Helper()
+		tr, err := st.Get(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tr.FirstSeen = tr.FirstSeen.Add(-d)
+		st.Put(ctx, tr)
+	}
+	tests := []struct {
+		name  string
+		setup func(st *MemoryStore)
+		ip    string
+		from  string
+		to    string
+		user  string
+		want  int
+	}{
+		{"first attempt", nil, "192.0.2.1", from, to, "", 451},
+		{"retry too early", func(st *MemoryStore) { age(st, time.Minute) }, "192.0.2.1", from, to, "", 451},
+		{"retry after delay", func(st *MemoryStore) { age(st, 301*time.Second) }, "192.0.2.1", from, to, "", 0},
+		{"retry from the same network", func(st *MemoryStore) { age(st, 301*time.Second) }, "192.0.2.200", "Bob@Remote.example", to, "", 0},
+		{"other sender", func(st *MemoryStore) { age(st, 301*time.Second) }, "192.0.2.1", "carol@remote.example", to, "", 451},
+		{"other network", func(st *MemoryStore) { age(st, 301*time.Second) }, "192.0.3.1", from, to, "", 451},
+		{"retry window expired", func(st *MemoryStore) {
+			tr, _ := st.Get(ctx, key)
+			tr.FirstSeen, tr.ExpiresAt = tr.FirstSeen.Add(-2*time.Hour), time.Now().Add(-time.Second)
+			st.Put(ctx, tr)
+		}, "192.0.2.1", from, to, "", 451},
+		{"authenticated", nil, "192.0.2.1", from, to, "bob@example.com", 0},
+		{"whitelisted network", nil, "198.51.100.7", from, to, "", 0},
+		{"whitelisted address", nil, "2001:db8::1", from, to, "", 0},
+		{"whitelisted sender domain", nil, "192.0.2.1", "news@Trusted.example", to, "", 0},
+		{"whitelisted recipient", nil, "192.0.2.1", from, "Postmaster@example.com", "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := NewMemoryStore()
+			p := newPolicy(cfg, st)
+			if tt.setup != nil {
+				if err := connect(t, p, "192.0.2.1").Rcpt(ctx, "mx.remote.example", from, to); code(err) != 451 {
+					t.Fatalf("first Rcpt() error = %v, want 451", err)
+				}
+				tt.setup(st)
+			}
+			rctx := ctx
+			if tt.user != "" {
+				rctx = smtpd.WithUser(ctx, tt.user)
+			}
+			err := connect(t, p, tt.ip).Rcpt(rctx, "mx.remote.example", tt.from, tt.to)
+			if code(err) != tt.want {
+				t.Errorf("Rcpt() error = %v, want code %d", err, tt.want)
+			}
+		})
+	}
+
+	p := newPolicy(cfg, failingStore{})
+	if err := connect(t, p, "192.0.2.1").Rcpt(ctx, "mx.remote.example", from, to); err != nil {
+		t.Errorf("Rcpt() with a failing store error = %v, want accepted", err)
+	}
+}
+
+func TestGreylistPassed(t *testing.T) {
+	ctx := context.Background()
+	const from, to = "bob@remote.example", "alice@example.com"
+	st := NewMemoryStore()
+	p := newPolicy(config.PolicyConfig{Greylist: config.GreylistConfig{Enabled: true, Delay: 300, RetryWindow: 3600, ExpireDays: 36}}, st)
+	c := connect(t, p, "192.0.2.1")
+	c.Rcpt(ctx, "mx.remote.example", from, to)
+
+	key := network(net.ParseIP("192.0.2.1")) + "\x00" + from + "\x00" + to
+	tr, err := st.Get(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr.FirstSeen = tr.FirstSeen.Add(-time.Hour)
+	st.Put(ctx, tr)
+	if err := c.Rcpt(ctx, "mx.remote.example", from, to); err != nil {
+		t.Fatalf("Rcpt() after delay error = %v", err)
+	}
+	if tr, err = st.Get(ctx, key); err != nil || !tr.Passed || time.Until(tr.ExpiresAt) < 35*24*time.Hour {
+		t.Errorf("triplet after passing = %+v, %v, want passed and kept for expire_days", tr, err)
+	}
+
+	// 通过后即使 delay 变长也不再延迟
+	apply, err := p.PrepareReload(&config.Config{Listeners: config.ListenersConfig{SMTP: config.InboundConfig{Policy: config.PolicyConfig{
+		Greylist: config.GreylistConfig{Enabled: true, Delay: 7200, RetryWindow: 3600, ExpireDays: 36}}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	apply()
+	if err := c.Rcpt(ctx, "mx.remote.example", from, to); err != nil {
+		t.Errorf("Rcpt() of a passed triplet error = %v", err)
+	}
+}
+
+func TestNetwork(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{"192.0.2.77", "192.0.2.0/24"},
+		{"::ffff:192.0.2.77", "192.0.2.0/24"},
+		{"2001:db8:1:2:3:4:5:6", "2001:db8:1:2::/64"},
+	}
+	for _, tt := range tests {
+		if got := network(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("network(%s) = %s, want %s", tt.ip, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package queue
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MemoryQueue 进程内出站队列，用于开发环境和嵌入式场景
+type MemoryQueue struct {
+	mu     sync.Mutex
+	nextID int64
+	items  map[string]*Item
+}
+
+// NewMemoryQueue 创建内存队列
+func NewMemoryQueue() *MemoryQueue {
+	return &MemoryQueue{items: make(map[string]*Item)}
+}
+
+func copyItem(item *Item) *Item {
+	c := *item
+	c.To = append([]string(nil), item.To...)
+	c.Raw = append([]byte(nil), item.Raw...)
+	return &c
+}
+
+func (q *MemoryQueue) Enqueue(ctx context.Context, item *Item) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.nextID++
+	item.ID = strconv.FormatInt(q.nextID, 16)
+	prepare(item)
+	q.items[item.ID] = copyItem(item)
+	return nil
+}
+
+func (q *MemoryQueue) Get(ctx context.Context, id string) (*Item, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	item, ok := q.items[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return copyItem(item), nil
+}
+
+// sorted 按加入时间排序返回满足条件的邮件，调用方需持有锁
+func (q *MemoryQueue) sorted(match func(*Item) bool) []*Item {
+	var items []*Item
+	for _, item := range q.items {
+		if match(item) {
+			items = append(items, item)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if !items[i].CreatedAt.Equal(items[j].CreatedAt) {
+			return items[i].CreatedAt.Before(items[j].CreatedAt)
+		}
+		return items[i].ID < items[j].ID
+	})
+	return items
+}
+
+func (q *MemoryQueue) List(ctx context.Context) ([]*Item, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var items []*Item
+	for _, item := range q.sorted(func(*Item) bool { return true }) {
+		items = append(items, copyItem(item))
+	}
+	return items, nil
+}
+
+func (q *MemoryQueue) Update(ctx context.Context, item *Item) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, ok := q.items[item.ID]; !ok {
+		return ErrNotFound
+	}
+	item.Size = int64(len(item.Raw))
+	q.items[item.ID] = copyItem(item)
+	return nil
+}
+
+func (q *MemoryQueue) Delete(ctx context.Context, id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, ok := q.items[id]; !ok {
+		return ErrNotFound
+	}
+	delete(q.items, id)
+	return nil
+}
+
+func (q *MemoryQueue) Lease(ctx context.Context, now, until time.Time, limit int) ([]*Item, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var items []*Item
+	for _, item := range q.sorted(func(i *Item) bool { return !i.NextAttempt.After(now) }) {
+		if len(items) >= limit {
+			break
+		}
+		item.NextAttempt = until
+		items = append(items, copyItem(item))
+	}
+	return items, nil
+}
+
+func (q *MemoryQueue) Reschedule(ctx context.Context, at time.Time) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	n := 0
+	for _, item := range q.items {
+		if !item.Held(at) {
+			item.NextAttempt = at
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (q *MemoryQueue) UpdateHeld(ctx context.Context, item *Item, now time.Time) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	old, ok := q.items[item.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if !old.Held(now) {
+		return ErrNotHeld
+	}
+	item.Size = int64(len(item.Raw))
+	q.items[item.ID] = copyItem(item)
+	return nil
+}
+
+func (q *MemoryQueue) DeleteHeld(ctx context.Context, id string, now time.Time) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	item, ok := q.items[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if !item.Held(now) {
+		return ErrNotHeld
+	}
+	delete(q.items, id)
+	return nil
+}
@@ -0,0 +1,203 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoQueue 基于 MongoDB queue 集合的出站队列
+type MongoQueue struct {
+	items *mongo.Collection
+}
+
+type mongoItem struct {
+	ID   primitive.ObjectID `bson:"_id,omitempty"`
+	Item `bson:",inline"`
+}
+
+func (d *mongoItem) item() *Item {
+	d.Item.ID = d.ID.Hex()
+	return &d.Item
+}
+
+// NewMongoQueue 创建 MongoDB 出站队列
+func NewMongoQueue(db *mongo.Database) *MongoQueue {
+	return &MongoQueue{items: db.Collection("queue")}
+}
+
+// EnsureIndexes 创建按投递时间取邮件所需的索引
+func (q *MongoQueue) EnsureIndexes(ctx context.Context) error {
+	_, err := q.items.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "next_attempt", Value: 1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create queue index: %v", err)
+	}
+	return nil
+}
+
+func (q *MongoQueue) Enqueue(ctx context.Context, item *Item) error {
+	prepare(item)
+	res, err := q.items.InsertOne(ctx, mongoItem{Item: *item})
+	if err != nil {
+		return err
+	}
+	item.ID = res.InsertedID.(primitive.ObjectID).Hex()
+	return nil
+}
+
+func (q *MongoQueue) Get(ctx context.Context, id string) (*Item, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	var doc mongoItem
+	err = q.items.FindOne(ctx, bson.M{"_id": oid}).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return doc.item(), nil
+}
+
+func (q *MongoQueue) List(ctx context.Context) ([]*Item, error) {
+	cur, err := q.items.Find(ctx, bson.M{},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var items []*Item
+	for cur.Next(ctx) {
+		var doc mongoItem
+		if err := cur.Decode(&doc); err != nil {
+			return nil, err
+		}
+		items = append(items, doc.item())
+	}
+	return items, cur.Err()
+}
+
+func (q *MongoQueue) Update(ctx context.Context, item *Item) error {
+	oid, err := primitive.ObjectIDFromHex(item.ID)
+	if err != nil {
+		return ErrNotFound
+	}
+	item.Size = int64(len(item.Raw))
+
+	res, err := q.items.ReplaceOne(ctx, bson.M{"_id": oid}, mongoItem{ID: oid, Item: *item})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (q *MongoQueue) Delete(ctx context.Context, id string) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	res, err := q.items.DeleteOne(ctx, bson.M{"_id": oid})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (q *MongoQueue) Lease(ctx context.Context, now, until time.Time, limit int) ([]*Item, error) {
+	var items []*Item
+	for len(items) < limit {
+		// 逐条原子地推迟 next_attempt，其他进程不会取到同一封邮件
+		var doc mongoItem
+		err := q.items.FindOneAndUpdate(ctx,
+			bson.M{"next_attempt": bson.M{"$lte": now}},
+			bson.M{"$set": bson.M{"next_attempt": until}},
+			options.FindOneAndUpdate().
+				SetSort(bson.D{{Key: "next_attempt", Value: 1}}).
+				SetReturnDocument(options.After),
+		).Decode(&doc)
+		if err == mongo.ErrNoDocuments {
+			break
+		}
+		if err != nil {
+			return items, err
+		}
+		items = append(items, doc.item())
+	}
+	return items, nil
+}
+
+func (q *MongoQueue) Reschedule(ctx context.Context, at time.Time) (int, error) {
+	res, err := q.items.UpdateMany(ctx, notHeld(at), bson.M{"$set": bson.M{"next_attempt": at}})
+	if err != nil {
+		return 0, err
+	}
+	return int(res.ModifiedCount), nil
+}
+
+// notHeld 匹配在 now 时不再等待定时发送的邮件
+func notHeld(now time.Time) bson.M {
+	return bson.M{"send_at": bson.M{"$not": bson.M{"$gt": now}}}
+}
+
+// heldError 区分条件更新未匹配的原因
+func (q *MongoQueue) heldError(ctx context.Context, oid primitive.ObjectID) error {
+	n, err := q.items.CountDocuments(ctx, bson.M{"_id": oid})
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return ErrNotHeld
+}
+
+func (q *MongoQueue) UpdateHeld(ctx context.Context, item *Item, now time.Time) error {
+	oid, err := primitive.ObjectIDFromHex(item.ID)
+	if err != nil {
+		return ErrNotFound
+	}
+	item.Size = int64(len(item.Raw))
+
+	res, err := q.items.ReplaceOne(ctx, bson.M{"_id": oid, "send_at": bson.M{"$gt": now}}, mongoItem{ID: oid, Item: *item})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return q.heldError(ctx, oid)
+	}
+	return nil
+}
+
+func (q *MongoQueue) DeleteHeld(ctx context.Context, id string, now time.Time) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	res, err := q.items.DeleteOne(ctx, bson.M{"_id": oid, "send_at": bson.M{"$gt": now}})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return q.heldError(ctx, oid)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotFound 队列中不存在该邮件
+var ErrNotFound = errors.New("queue: message not found")
+
+// ErrNotHeld 邮件已到达定时发送时间，不能再修改或撤销
+var ErrNotHeld = errors.New("queue: message is no longer held")
+
+// Item 出站队列中的一封邮件
+type Item struct {
+	ID          string    `bson:"-" json:"id"`
+	Owner       string    `bson:"owner" json:"owner,omitempty"` // 提交邮件的本地用户
+	From        string    `bson:"from" json:"from"`
+	To          []string  `bson:"to" json:"to"`
+	Raw         []byte    `bson:"raw" json:"-"`
+	Size        int64     `bson:"size" json:"size"`
+	Attempts    int       `bson:"attempts" json:"attempts"`
+	NextAttempt time.Time `bson:"next_attempt" json:"next_attempt"`
+	LastError   string    `bson:"last_error,omitempty" json:"last_error,omitempty"`
+	CreatedAt   time.Time `bson:"created_at" json:"created_at"`
+	// SendAt 定时发送或撤销窗口的截止时间，此前邮件不会被投递，Reschedule 也不会提前发送；
+	// 这类邮件的 To 可能包含本地收件人
+	SendAt time.Time `bson:"send_at,omitempty" json:"send_at,omitempty"`
+	// SentID 提交者 Sent 邮箱中副本的 ID，撤销发送时移回 Drafts
+	SentID string `bson:"sent_id,omitempty" json:"sent_id,omitempty"`
+	// Batch 和 BatchIndex 为批量发送的批次 ID 和收件人序号，投递结果回写到收件人状态
+	Batch      string `bson:"batch,omitempty" json:"batch,omitempty"`
+	BatchIndex int    `bson:"batch_index,omitempty" json:"batch_index,omitempty"`
+}
+
+// Held 判断邮件在 now 时是否仍在等待定时发送
+func (i *Item) Held(now time.Time) bool {
+	return i.SendAt.After(now)
+}
+
+// Queue 出站邮件队列
+type Queue interface {
+	// Enqueue 加入队列，设置 ID、Size、CreatedAt，NextAttempt 为空时立即可投递
+	Enqueue(ctx context.Context, item *Item) error
+	Get(ctx context.Context, id string) (*Item, error)
+	// List 按加入时间列出全部邮件
+	List(ctx context.Context) ([]*Item, error)
+	Update(ctx context.Context, item *Item) error
+	Delete(ctx context.Context, id string) error
+	// Lease 取出最多 limit 封到期邮件，并将其 NextAttempt 推迟到 until，
+	// 防止多个进程重复投递
+	Lease(ctx context.Context, now, until time.Time, limit int) ([]*Item, error)
+	// Reschedule 将全部邮件的 NextAttempt 设为 at，返回修改数量；SendAt 晚于 at 的邮件不变
+	Reschedule(ctx context.Context, at time.Time) (int, error)
+	// UpdateHeld 覆盖保存仍在等待定时发送 (SendAt 晚于 now) 的邮件，否则返回 ErrNotHeld
+	UpdateHeld(ctx context.Context, item *Item, now time.Time) error
+	// DeleteHeld 删除仍在等待定时发送的邮件，否则返回 ErrNotHeld
+	DeleteHeld(ctx context.Context, id string, now time.Time) error
+}
+
+// prepare 补全新加入邮件的默认字段
+func prepare(item *Item) {
+	item.Size = int64(len(item.Raw))
+	if item.CreatedAt.IsZero() {
+		item.CreatedAt = time.Now()
+	}
+	if item.NextAttempt.IsZero() {
+		item.NextAttempt = item.CreatedAt
+	}
+	if item.NextAttempt.Before(item.SendAt) {
+		item.NextAttempt = item.SendAt
+	}
+}
@@ -0,0 +1,271 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/textproto"
+	"sync"
+	"time"
+
+	"YoPost/internal/mail/core"
+	"YoPost/internal/mail/smtpd"
+)
+
+// Sender 投递一封队列邮件
+type Sender interface {
+	Send(ctx context.Context, item *Item) error
+}
+
+// SenderFunc 将函数适配为 Sender
+type SenderFunc func(ctx context.Context, item *Item) error
+
+func (f SenderFunc) Send(ctx context.Context, item *Item) error {
+	return f(ctx, item)
+}
+
+// RelaySender 返回通过中继服务器投递的 Sender
+func RelaySender(relay *core.Relay) Sender {
+	return SenderFunc(func(ctx context.Context, item *Item) error {
+		return relay.Send(item.From, item.To, item.Raw, "", "")
+	})
+}
+
+// Permanent 判断投递错误是否为永久失败 (5xx)，永久失败的邮件不再重试；
+// 远端回复为 *textproto.Error，本地投递 (如超出配额) 为 *smtpd.Error
+func Permanent(err error) bool {
+	var te *textproto.Error
+	if errors.As(err, &te) {
+		return te.Code >= 500
+	}
+	var se *smtpd.Error
+	return errors.As(err, &se) && se.Code >= 500
+}
+
+// Result 一次投递尝试的结果
+type Result int
+
+const (
+	// Delivered 投递成功，邮件已移出队列
+	Delivered Result = iota
+	// Deferred 临时失败，等待重试
+	Deferred
+	// Bounced 永久失败或达到最大尝试次数，邮件已移出队列
+	Bounced
+)
+
+// Notifier 每次投递尝试后调用，err 为 Deferred 和 Bounced 的失败原因
+type Notifier func(ctx context.Context, item *Item, result Result, err error)
+
+// Throttle 限制出站投递，Acquire 在邮件可以立即投递时返回投递结束后调用的 release，
+// 参数为投递是否成功；否则返回 nil 和可以重试的时间
+type Throttle interface {
+	Acquire(item *Item, now time.Time) (release func(delivered bool), retry time.Time)
+}
+
+// Worker 定期从队列取出到期邮件并投递，失败时按指数退避重试
+type Worker struct {
+	Queue  Queue
+	Sender Sender
+	// Interval 轮询间隔，默认 10 秒
+	Interval time.Duration
+	// MaxAttempts 最大尝试次数，默认 10
+	MaxAttempts int
+	// Batch 每次取出的邮件数量，默认 50
+	Batch int
+	// Logger 为空时使用 log 包的默认 Logger
+	Logger *log.Logger
+	// Notify 可为空
+	Notify Notifier
+	// Concurrency 同时投递的邮件数量，默认 1
+	Concurrency int
+	// Throttle 可为空，被限制的邮件推迟到重试时间，不计入尝试次数
+	Throttle Throttle
+}
+
+func (w *Worker) logf(format string, args ...interface{}) {
+	if w.Logger != nil {
+		w.Logger.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+func (w *Worker) notify(ctx context.Context, item *Item, result Result, err error) {
+	if w.Notify != nil {
+		w.Notify(ctx, item, result, err)
+	}
+}
+
+func (w *Worker) interval() time.Duration {
+	if w.Interval > 0 {
+		return w.Interval
+	}
+	return 10 * time.Second
+}
+
+func (w *Worker) maxAttempts() int {
+	if w.MaxAttempts > 0 {
+		return w.MaxAttempts
+	}
+	return 10
+}
+
+func (w *Worker) concurrency() int {
+	if w.Concurrency > 0 {
+		return w.Concurrency
+	}
+	return 1
+}
+
+func (w *Worker) batch() int {
+	if w.Batch > 0 {
+		return w.Batch
+	}
+	return 50
+}
+
+// backoff 第 n 次失败后的重试间隔: 1m, 2m, 4m ... 最长 4h
+func backoff(attempts int) time.Duration {
+	d := time.Minute
+	for i := 1; i < attempts && d < 4*time.Hour; i++ {
+		d *= 2
+	}
+	if d > 4*time.Hour {
+		d = 4 * time.Hour
+	}
+	return d
+}
+
+// Run 处理队列直到 ctx 取消
+func (w *Worker) Run(ctx context.Context) {
+	w.logf("INFO: Outbound queue worker started (interval %s)", w.interval())
+	ticker := time.NewTicker(w.interval())
+	defer ticker.Stop()
+	for {
+		if _, err := w.ProcessDue(ctx); err != nil && ctx.Err() == nil {
+			w.logf("ERROR: Outbound queue processing failed - %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			w.logf("INFO: Outbound queue worker stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProcessDue 投递全部到期邮件，返回处理的数量
+func (w *Worker) ProcessDue(ctx context.Context) (int, error) {
+	total := 0
+	for ctx.Err() == nil {
+		now := time.Now()
+		// 租约期间进程退出时邮件会在租约到期后被重新投递
+		items, err := w.Queue.Lease(ctx, now, now.Add(10*time.Minute), w.batch())
+		if err != nil {
+			return total, err
+		}
+		sem := make(chan struct{}, w.concurrency())
+		var wg sync.WaitGroup
+		for i, item := range items {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+			}
+			if ctx.Err() != nil {
+				wg.Wait()
+				w.release(items[i:])
+				return total + i, nil
+			}
+			wg.Add(1)
+			go func() {
+				defer func() { <-sem; wg.Done() }()
+				w.process(ctx, item)
+			}()
+		}
+		wg.Wait()
+		total += len(items)
+		if len(items) < w.batch() {
+			break
+		}
+	}
+	return total, nil
+}
+
+// Flush 立即重试全部邮件，忽略退避时间
+func (w *Worker) Flush(ctx context.Context) (int, error) {
+	if _, err := w.Queue.Reschedule(ctx, time.Now()); err != nil {
+		return 0, err
+	}
+	return w.ProcessDue(ctx)
+}
+
+// release 将已取出但未投递的邮件恢复为立即可投递，供重启后或其他进程处理
+func (w *Worker) release(items []*Item) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, item := range items {
+		item.NextAttempt = time.Now()
+		if err := w.Queue.Update(ctx, item); err != nil {
+			w.logf("ERROR: Failed to release queued message %s - %v", item.ID, err)
+		}
+	}
+	w.logf("INFO: Released %d queued messages on shutdown", len(items))
+}
+
+// process 按 Throttle 投递或推迟一封邮件
+func (w *Worker) process(ctx context.Context, item *Item) {
+	if w.Throttle != nil {
+		release, retry := w.Throttle.Acquire(item, time.Now())
+		if release == nil {
+			w.postpone(ctx, item, retry)
+			return
+		}
+		release(w.deliver(ctx, item) == Delivered)
+		return
+	}
+	w.deliver(ctx, item)
+}
+
+// postpone 将被限速的邮件推迟到 retry，不计入尝试次数
+func (w *Worker) postpone(ctx context.Context, item *Item, retry time.Time) {
+	item.NextAttempt = retry
+	if err := w.Queue.Update(context.WithoutCancel(ctx), item); err != nil {
+		w.logf("ERROR: Failed to postpone throttled message %s - %v", item.ID, err)
+	}
+}
+
+// deliver 投递一封邮件并返回结果
+func (w *Worker) deliver(ctx context.Context, item *Item) Result {
+	// 投递结果必须写回队列，即使 ctx 已因关闭而取消
+	ctx = context.WithoutCancel(ctx)
+	err := w.Sender.Send(ctx, item)
+	if err == nil {
+		w.logf("INFO: Delivered queued message %s from %s to %v", item.ID, item.From, item.To)
+		if err := w.Queue.Delete(ctx, item.ID); err != nil && err != ErrNotFound {
+			w.logf("ERROR: Failed to remove delivered message %s from queue - %v", item.ID, err)
+		}
+		w.notify(ctx, item, Delivered, nil)
+		return Delivered
+	}
+
+	item.Attempts++
+	item.LastError = err.Error()
+	if Permanent(err) || item.Attempts >= w.maxAttempts() {
+		w.logf("ERROR: Giving up on queued message %s after %d attempts - %v", item.ID, item.Attempts, err)
+		if err := w.Queue.Delete(ctx, item.ID); err != nil && err != ErrNotFound {
+			w.logf("ERROR: Failed to remove message %s from queue - %v", item.ID, err)
+		}
+		w.notify(ctx, item, Bounced, err)
+		return Bounced
+	}
+
+	item.NextAttempt = time.Now().Add(backoff(item.Attempts))
+	w.logf("WARNING: Delivery of queued message %s deferred until %s - %v",
+		item.ID, item.NextAttempt.Format(time.RFC3339), err)
+	if err := w.Queue.Update(ctx, item); err != nil {
+		w.logf("ERROR: Failed to update queued message %s - %v", item.ID, err)
+	}
+	w.notify(ctx, item, Deferred, err)
+	return Deferred
+}
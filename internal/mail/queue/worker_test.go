@@ -0,0 +1,32 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"net/textproto"
+	"testing"
+
+	"YoPost/internal/mail/smtpd"
+)
+
+func TestPermanent(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"remote 5xx", &textproto.Error{Code: 550, Msg: "no such user"}, true},
+		{"remote 4xx", &textproto.Error{Code: 451, Msg: "try again later"}, false},
+		{"local over quota", &smtpd.Error{Code: 552, Enhanced: "5.2.2", Message: "Mailbox full"}, true},
+		{"local temporary", &smtpd.Error{Code: 452, Enhanced: "4.2.2", Message: "Mailbox full"}, false},
+		{"wrapped", fmt.Errorf("deliver: %w", &smtpd.Error{Code: 550}), true},
+		{"network", errors.New("connection refused"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Permanent(tt.err); got != tt.want {
+				t.Errorf("Permanent(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+// Package sasl 实现与协议无关的 SASL 机制，目前支持 PLAIN、LOGIN、XOAUTH2 和 OAUTHBEARER (RFC 7628)
+//
+// SMTP 通过 smtpd.Authenticator 使用；将来的 IMAP/POP3 服务可以直接复用
+package sasl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// 机制名称
+const (
+	XOAuth2     = "XOAUTH2"
+	OAuthBearer = "OAUTHBEARER"
+)
+
+// ErrMalformed 客户端响应格式错误
+var ErrMalformed = errors.New("sasl: malformed client response")
+
+// ErrUnsupported 不支持的机制
+var ErrUnsupported = errors.New("sasl: unsupported mechanism")
+
+// ErrAuthFailed 令牌无效或与声明的用户不一致
+var ErrAuthFailed = errors.New("sasl: authentication failed")
+
+// 认证失败时返回给客户端的错误信息，客户端需再发送一个空响应
+var (
+	xoauth2Challenge     = []byte(`{"status":"401","schemes":"bearer","scope":"openid email"}`)
+	oauthBearerChallenge = []byte(`{"status":"invalid_token","scope":"openid email"}`)
+)
+
+// ParseXOAUTH2 解析 "user=<user>\x01auth=Bearer <token>\x01\x01"
+func ParseXOAUTH2(resp []byte) (user, token string, err error) {
+	fields, ok := strings.CutSuffix(string(resp), "\x01\x01")
+	if !ok {
+		return "", "", ErrMalformed
+	}
+	for _, f := range strings.Split(fields, "\x01") {
+		k, v, _ := strings.Cut(f, "=")
+		switch k {
+		case "user":
+			user = v
+		case "auth":
+			token = bearer(v)
+		}
+	}
+	if user == "" || token == "" {
+		return "", "", ErrMalformed
+	}
+	return user, token, nil
+}
+
+// ParseOAuthBearer 解析 "n,a=<authzid>,\x01auth=Bearer <token>\x01\x01"，authzid 可以为空
+func ParseOAuthBearer(resp []byte) (authzid, token string, err error) {
+	gs2, rest, ok := strings.Cut(string(resp), "\x01")
+	if !ok {
+		return "", "", ErrMalformed
+	}
+	// gs2 头："n,a=user," 或 "n,,"；不支持通道绑定
+	parts := strings.Split(gs2, ",")
+	if len(parts) != 3 || parts[0] != "n" || parts[2] != "" {
+		return "", "", ErrMalformed
+	}
+	if parts[1] != "" {
+		a, ok := strings.CutPrefix(parts[1], "a=")
+		if !ok {
+			return "", "", ErrMalformed
+		}
+		authzid = strings.NewReplacer("=2C", ",", "=3D", "=").Replace(a)
+	}
+
+	fields, ok := strings.CutSuffix(rest, "\x01\x01")
+	if !ok {
+		return "", "", ErrMalformed
+	}
+	for _, f := range strings.Split(fields, "\x01") {
+		if k, v, _ := strings.Cut(f, "="); k == "auth" {
+			token = bearer(v)
+		}
+	}
+	if token == "" {
+		return "", "", ErrMalformed
+	}
+	return authzid, token, nil
+}
+
+// bearer 取出 "Bearer <token>" 中的令牌
+func bearer(v string) string {
+	scheme, token, ok := strings.Cut(v, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// OAuth 使用 OAuth 2.0 令牌的 XOAUTH2 和 OAUTHBEARER 认证
+type OAuth struct {
+	// Verify 校验令牌，返回令牌所属的用户名
+	Verify func(ctx context.Context, token string) (string, error)
+}
+
+// Mechanisms 返回支持的机制
+func (o *OAuth) Mechanisms() []string {
+	return []string{OAuthBearer, XOAuth2}
+}
+
+// Authenticate 校验客户端的初始响应
+// 失败时 challenge 非空，协议层应将其发送给客户端并等待一个空响应后再回复失败
+func (o *OAuth) Authenticate(ctx context.Context, mech string, resp []byte) (user string, challenge []byte, err error) {
+	var claimed, token string
+	switch strings.ToUpper(mech) {
+	case XOAuth2:
+		claimed, token, err = ParseXOAUTH2(resp)
+		challenge = xoauth2Challenge
+	case OAuthBearer:
+		claimed, token, err = ParseOAuthBearer(resp)
+		challenge = oauthBearerChallenge
+	default:
+		return "", nil, ErrUnsupported
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	user, err = o.Verify(ctx, token)
+	if err != nil {
+		return "", challenge, fmt.Errorf("%w: %v", ErrAuthFailed, err)
+	}
+	if claimed != "" && !strings.EqualFold(claimed, user) {
+		return "", challenge, ErrAuthFailed
+	}
+	return user, nil, nil
+}
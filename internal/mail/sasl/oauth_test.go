@@ -0,0 +1,71 @@
+package sasl
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"YoPost/internal/auth/oidc"
+	"YoPost/internal/auth/oidc/oidctest"
+	"YoPost/internal/config"
+)
+
+func TestOAuthAuthenticate(t *testing.T) {
+	idp := oidctest.NewServer("yopost")
+	defer idp.Close()
+	client := oidc.NewClient(config.OIDCConfig{Enabled: true, Issuer: idp.URL, ClientID: "yopost", UsernameClaim: "email"})
+	o := &OAuth{Verify: func(ctx context.Context, token string) (string, error) {
+		claims, err := client.VerifyAccessToken(ctx, token)
+		if err != nil {
+			return "", err
+		}
+		return client.Username(claims)
+	}}
+	valid := idp.Token(map[string]interface{}{"email": "alice@example.com"})
+	expired := idp.Token(map[string]interface{}{"email": "alice@example.com", "exp": time.Now().Add(-time.Hour).Unix()})
+	foreign := idp.Token(map[string]interface{}{"email": "alice@example.com", "aud": "other"})
+
+	tests := []struct {
+		name      string
+		mech      string
+		resp      string
+		user      string
+		err       error
+		challenge []byte
+	}{
+		{"xoauth2", "XOAUTH2", "user=Alice@example.com\x01auth=Bearer " + valid + "\x01\x01", "alice@example.com", nil, nil},
+		{"xoauth2 expired", "XOAUTH2", "user=alice@example.com\x01auth=Bearer " + expired + "\x01\x01", "", ErrAuthFailed, xoauth2Challenge},
+		{"xoauth2 wrong audience", "xoauth2", "user=alice@example.com\x01auth=Bearer " + foreign + "\x01\x01", "", ErrAuthFailed, xoauth2Challenge},
+		{"xoauth2 as another user", "XOAUTH2", "user=bob@example.com\x01auth=Bearer " + valid + "\x01\x01", "", ErrAuthFailed, xoauth2Challenge},
+		{"xoauth2 without terminator", "XOAUTH2", "user=alice@example.com\x01auth=Bearer " + valid, "", ErrMalformed, nil},
+		{"xoauth2 basic scheme", "XOAUTH2", "user=alice@example.com\x01auth=Basic " + valid + "\x01\x01", "", ErrMalformed, nil},
+		{"oauthbearer", "OAUTHBEARER", "n,a=alice@example.com,\x01auth=Bearer " + valid + "\x01\x01", "alice@example.com", nil, nil},
+		{"oauthbearer without authzid", "OAUTHBEARER", "n,,\x01host=mail.example.com\x01auth=Bearer " + valid + "\x01\x01", "alice@example.com", nil, nil},
+		{"oauthbearer expired", "OAUTHBEARER", "n,,\x01auth=Bearer " + expired + "\x01\x01", "", ErrAuthFailed, oauthBearerChallenge},
+		{"oauthbearer as another user", "OAUTHBEARER", "n,a=bob@example.com,\x01auth=Bearer " + valid + "\x01\x01", "", ErrAuthFailed, oauthBearerChallenge},
+		{"oauthbearer channel binding", "OAUTHBEARER", "p=tls-unique,,\x01auth=Bearer " + valid + "\x01\x01", "", ErrMalformed, nil},
+		{"unsupported mechanism", "PLAIN", "\x00alice@example.com\x00secret", "", ErrUnsupported, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, challenge, err := o.Authenticate(context.Background(), tt.mech, []byte(tt.resp))
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("Authenticate() error = %v, want %v", err, tt.err)
+				}
+				if !bytes.Equal(challenge, tt.challenge) {
+					t.Errorf("Authenticate() challenge = %q, want %q", challenge, tt.challenge)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Authenticate() error = %v", err)
+			}
+			if user != tt.user {
+				t.Errorf("Authenticate() = %q, want %q", user, tt.user)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package sasl
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+)
+
+// 密码机制名称
+const (
+	Plain = "PLAIN"
+	Login = "LOGIN"
+)
+
+// Authenticator 一组 SASL 机制，与 smtpd.Authenticator 方法一致
+type Authenticator interface {
+	Mechanisms() []string
+	Authenticate(ctx context.Context, mech string, resp []byte) (user string, challenge []byte, err error)
+}
+
+// ParsePlain 解析 PLAIN (RFC 4616) 的 "authzid\x00authcid\x00password"，
+// authzid 非空时必须与 authcid 相同，不支持代理其他用户
+func ParsePlain(resp []byte) (user, password string, err error) {
+	parts := bytes.Split(resp, []byte{0})
+	if len(parts) != 3 || len(parts[1]) == 0 {
+		return "", "", ErrMalformed
+	}
+	if len(parts[0]) > 0 && !strings.EqualFold(string(parts[0]), string(parts[1])) {
+		return "", "", ErrAuthFailed
+	}
+	return string(parts[1]), string(parts[2]), nil
+}
+
+// Password 使用用户名和密码的 PLAIN 与 LOGIN 认证。LOGIN 的用户名和密码
+// 由协议层分两次读取，以 "user\x00password" 的形式传入 Authenticate
+type Password struct {
+	// Verify 校验密码，返回规范化的用户名
+	Verify func(ctx context.Context, user, password string) (string, error)
+}
+
+// Mechanisms 返回支持的机制
+func (p *Password) Mechanisms() []string {
+	return []string{Plain, Login}
+}
+
+// Authenticate 校验用户名和密码，失败时没有 challenge
+func (p *Password) Authenticate(ctx context.Context, mech string, resp []byte) (string, []byte, error) {
+	var user, password string
+	switch strings.ToUpper(mech) {
+	case Plain:
+		var err error
+		if user, password, err = ParsePlain(resp); err != nil {
+			return "", nil, err
+		}
+	case Login:
+		u, pw, ok := bytes.Cut(resp, []byte{0})
+		if !ok || len(u) == 0 {
+			return "", nil, ErrMalformed
+		}
+		user, password = string(u), string(pw)
+	default:
+		return "", nil, ErrUnsupported
+	}
+
+	verified, err := p.Verify(ctx, user, password)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: %v", ErrAuthFailed, err)
+	}
+	return verified, nil, nil
+}
+
+// Multi 按机制名称分派到多个 Authenticator，公布的机制按顺序合并
+type Multi []Authenticator
+
+// Mechanisms 返回全部机制
+func (m Multi) Mechanisms() []string {
+	var mechs []string
+	for _, a := range m {
+		mechs = append(mechs, a.Mechanisms()...)
+	}
+	return mechs
+}
+
+// Authenticate 交给支持 mech 的第一个 Authenticator
+func (m Multi) Authenticate(ctx context.Context, mech string, resp []byte) (string, []byte, error) {
+	for _, a := range m {
+		for _, name := range a.Mechanisms() {
+			if strings.EqualFold(name, mech) {
+				return a.Authenticate(ctx, mech, resp)
+			}
+		}
+	}
+	return "", nil, ErrUnsupported
+}
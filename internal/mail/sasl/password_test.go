@@ -0,0 +1,54 @@
+package sasl
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPasswordAuthenticate(t *testing.T) {
+	p := &Password{Verify: func(ctx context.Context, user, password string) (string, error) {
+		if password != "secret" {
+			return "", errors.New("wrong password")
+		}
+		return strings.ToLower(user), nil
+	}}
+	auth := Multi{p}
+
+	tests := []struct {
+		name string
+		mech string
+		resp string
+		user string
+		err  error
+	}{
+		{"plain", "PLAIN", "\x00Alice@example.com\x00secret", "alice@example.com", nil},
+		{"plain with same authzid", "plain", "alice@example.com\x00Alice@example.com\x00secret", "alice@example.com", nil},
+		{"plain as another user", "PLAIN", "bob@example.com\x00alice@example.com\x00secret", "", ErrAuthFailed},
+		{"plain wrong password", "PLAIN", "\x00alice@example.com\x00guess", "", ErrAuthFailed},
+		{"plain without user", "PLAIN", "\x00\x00secret", "", ErrMalformed},
+		{"plain malformed", "PLAIN", "alice@example.com secret", "", ErrMalformed},
+		{"login", "LOGIN", "alice@example.com\x00secret", "alice@example.com", nil},
+		{"login wrong password", "LOGIN", "alice@example.com\x00guess", "", ErrAuthFailed},
+		{"login without user", "LOGIN", "\x00secret", "", ErrMalformed},
+		{"unsupported mechanism", "CRAM-MD5", "", "", ErrUnsupported},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, _, err := auth.Authenticate(context.Background(), tt.mech, []byte(tt.resp))
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("Authenticate() error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Authenticate() error = %v", err)
+			}
+			if user != tt.user {
+				t.Errorf("Authenticate() user = %q, want %q", user, tt.user)
+			}
+		})
+	}
+}
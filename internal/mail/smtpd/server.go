@@ -0,0 +1,295 @@
+package smtpd
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// 会话状态，Shutdown 只关闭空闲会话
+const (
+	stateIdle   int32 = iota // 等待命令且没有进行中的事务
+	stateActive              // 正在处理命令，或 MAIL 事务尚未结束
+	stateClosed              // 已被 Shutdown 关闭
+)
+
+// ErrServerClosed Serve 在服务器关闭后返回
+var ErrServerClosed = errors.New("smtpd: server closed")
+
+// Error 带 SMTP 响应码的错误，Backend 返回它来控制回复内容
+type Error struct {
+	Code     int
+	Enhanced string // 增强状态码，如 "5.2.2"
+	Message  string
+	// Err 可为空，导致该回复的内部错误，不发送给客户端
+	Err error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d %s %s", e.Code, e.Enhanced, e.Message)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Envelope 一次 SMTP 事务的信封和内容
+type Envelope struct {
+	RemoteAddr net.Addr
+	Helo       string
+	From       string
+	To         []string
+	Data       []byte
+	TLS        bool
+	// User 通过 AUTH 认证的用户，未认证为空
+	User string
+}
+
+type userKey struct{}
+
+// WithUser 返回携带已认证用户的 context
+func WithUser(ctx context.Context, user string) context.Context {
+	return context.WithValue(ctx, userKey{}, user)
+}
+
+// User 返回 Backend 调用中已认证的用户，未认证时返回空字符串
+func User(ctx context.Context) string {
+	u, _ := ctx.Value(userKey{}).(string)
+	return u
+}
+
+// Authenticator SASL 认证，见 internal/mail/sasl
+type Authenticator interface {
+	// Mechanisms 返回在 EHLO 中公布的机制
+	Mechanisms() []string
+	// Authenticate 校验客户端响应，返回用户名；LOGIN 的用户名和密码由会话分两次读取后以 "user\x00password" 传入
+	// 失败且 challenge 非空时，服务器先以 334 发送 challenge，客户端回应后再回复 535
+	Authenticate(ctx context.Context, mech string, resp []byte) (user string, challenge []byte, err error)
+}
+
+// Backend 入站邮件的处理后端
+type Backend interface {
+	// Rcpt 校验收件人，size 为 MAIL FROM 中声明的 SIZE (未声明为 0)
+	Rcpt(ctx context.Context, from, to string, size int64) error
+	// Deliver 投递完整邮件，返回错误时整封邮件被拒绝
+	Deliver(ctx context.Context, env *Envelope) error
+}
+
+// Policy 入站连接策略 (连接数、命令速率、灰名单、tarpit 等)，见 internal/mail/policy
+type Policy interface {
+	// Connect 在发送问候之前调用，返回错误时以该错误回复并关闭连接
+	Connect(remote net.Addr) (ConnPolicy, error)
+}
+
+// ConnPolicy 单个连接的策略状态，只在该连接的会话中调用
+type ConnPolicy interface {
+	// PregreetDelay 返回发送问候前等待的时间，期间客户端发送的任何数据都交给 Pregreet；0 表示立即问候
+	PregreetDelay() time.Duration
+	// Pregreet 客户端在问候前发送数据时调用，以返回的错误回复并关闭连接
+	Pregreet() error
+	// Command 每条命令之前调用，返回错误时以该错误回复并关闭连接
+	Command(verb string) error
+	// Rcpt 在 Backend 接受收件人之后调用，返回错误时拒绝该收件人；ctx 携带已认证用户
+	Rcpt(ctx context.Context, helo, from, to string) error
+	// Rejected 在 Backend 拒绝收件人之后调用，返回回复前等待的时间
+	Rejected(ctx context.Context, err error) time.Duration
+	// Headers 返回 DATA 结束时添加到邮件开头的头部 (以 CRLF 结尾)，可为空
+	Headers() string
+	// Close 连接结束时调用
+	Close()
+}
+
+// Server 入站 SMTP 服务器
+type Server struct {
+	Addr            string
+	Hostname        string
+	Backend         Backend
+	MaxMessageBytes int64
+	MaxRecipients   int
+	ReadTimeout     time.Duration
+	// TLSConfig 非空时启用 STARTTLS
+	TLSConfig *tls.Config
+	// Auth 非空时启用 AUTH，默认只在 TLS 连接上提供
+	Auth Authenticator
+	// AllowInsecureAuth 允许在未加密的连接上 AUTH，仅用于测试
+	AllowInsecureAuth bool
+	// Policy 可为空
+	Policy Policy
+	// Logger 为空时使用 log 包的默认 Logger
+	Logger *log.Logger
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	sessions  map[*session]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.Logger != nil {
+		s.Logger.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+func (s *Server) maxMessageBytes() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.MaxMessageBytes > 0 {
+		return s.MaxMessageBytes
+	}
+	return 25 << 20
+}
+
+func (s *Server) maxRecipients() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.MaxRecipients > 0 {
+		return s.MaxRecipients
+	}
+	return 100
+}
+
+// SetLimits 修改邮件大小和收件人数量上限，对新事务生效
+func (s *Server) SetLimits(maxMessageBytes int64, maxRecipients int) {
+	s.mu.Lock()
+	s.MaxMessageBytes = maxMessageBytes
+	s.MaxRecipients = maxRecipients
+	s.mu.Unlock()
+}
+
+func (s *Server) readTimeout() time.Duration {
+	if s.ReadTimeout > 0 {
+		return s.ReadTimeout
+	}
+	return 5 * time.Minute
+}
+
+// ListenAndServe 监听 s.Addr 并处理连接
+func (s *Server) ListenAndServe() error {
+	l, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve 在给定监听器上接受连接，直到服务器关闭
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	if s.listeners == nil {
+		s.listeners = make(map[net.Listener]struct{})
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+
+	s.logf("INFO: SMTP server listening on %s", l.Addr())
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+
+		sess := newSession(s, c)
+		s.mu.Lock()
+		if s.sessions == nil {
+			s.sessions = make(map[*session]struct{})
+		}
+		s.sessions[sess] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go func() {
+			defer s.wg.Done()
+			sess.serve()
+			s.mu.Lock()
+			delete(s.sessions, sess)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+func (s *Server) shuttingDown() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// closeIdle 关闭空闲会话，返回尚未结束的会话数量
+func (s *Server) closeIdle() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sess := range s.sessions {
+		// 会话进入空闲前已完成 STARTTLS，CAS 成功后可以安全地通过 sess.text 回复
+		if sess.state.CompareAndSwap(stateIdle, stateClosed) {
+			sess.raw.SetWriteDeadline(time.Now().Add(time.Second))
+			sess.reply(421, "4.3.2 %s Service shutting down", s.Hostname)
+			sess.raw.Close()
+		}
+	}
+	return len(s.sessions)
+}
+
+// Shutdown 停止接受新连接，关闭空闲连接，并等待进行中的事务完成
+// ctx 到期时强制关闭剩余连接并返回 ctx.Err()
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closed = true
+	for l := range s.listeners {
+		l.Close()
+	}
+	s.mu.Unlock()
+
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		if s.closeIdle() == 0 {
+			s.wg.Wait()
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			s.logf("WARNING: SMTP shutdown deadline exceeded, closing remaining connections")
+			s.Close()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close 立即关闭全部监听器和连接
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for l := range s.listeners {
+		l.Close()
+	}
+	for sess := range s.sessions {
+		sess.raw.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return nil
+}
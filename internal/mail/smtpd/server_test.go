@@ -0,0 +1,124 @@
+package smtpd
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"math/big"
+	"net"
+	"net/textproto"
+	"testing"
+	"time"
+)
+
+type acceptBackend struct{}
+
+func (acceptBackend) Rcpt(ctx context.Context, from, to string, size int64) error { return nil }
+func (acceptBackend) Deliver(ctx context.Context, env *Envelope) error            { return nil }
+
+// testCertificate 生成 localhost 的自签名证书
+func testCertificate(t *testing.T) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// cmd 发送命令并读取回复，回复码不是 code 时测试失败
+func cmd(t *testing.T, c *textproto.Conn, code int, format string, args ...interface{}) {
+	t.Helper()
+	id, err := c.Cmd(format, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.StartResponse(id)
+	defer c.EndResponse(id)
+	if _, _, err := c.ReadResponse(code); err != nil {
+		t.Fatalf("%s: %v", format, err)
+	}
+}
+
+// holdConn 忽略 Close，使会话在 Server.Close 之后还能完成 STARTTLS 握手
+type holdConn struct {
+	net.Conn
+}
+
+func (c *holdConn) Close() error { return nil }
+
+type holdListener struct {
+	net.Listener
+}
+
+func (l *holdListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &holdConn{Conn: c}, nil
+}
+
+// TestCloseDuringStartTLS 用 go test -race 运行：Close 在 STARTTLS 握手期间关闭会话，
+// 握手完成后会话替换连接，两者不应产生数据竞争
+func TestCloseDuringStartTLS(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := &holdListener{Listener: inner}
+	cert := testCertificate(t)
+	srv := &Server{
+		Hostname: "localhost",
+		Backend:  acceptBackend{},
+		TLSConfig: &tls.Config{GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			// 握手进行中等待 Close 执行，不能用 channel 等同步手段，否则竞争检测看不到问题
+			time.Sleep(100 * time.Millisecond)
+			return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
+		}},
+	}
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(l) }()
+
+	conn, err := net.Dial("tcp", inner.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c := textproto.NewConn(conn)
+	if _, _, err := c.ReadResponse(220); err != nil {
+		t.Fatal(err)
+	}
+	cmd(t, c, 220, "STARTTLS")
+
+	closed := make(chan struct{})
+	go func() {
+		srv.Close()
+		close(closed)
+	}()
+	tlsConn := tls.Client(conn, &tls.Config{InsecureSkipVerify: true})
+	if err := tlsConn.Handshake(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := textproto.NewConn(tlsConn).ReadResponse(421); err != nil {
+		t.Errorf("after STARTTLS: %v, want 421", err)
+	}
+	<-closed
+	if err := <-served; !errors.Is(err, ErrServerClosed) {
+		t.Errorf("Serve() error = %v, want ErrServerClosed", err)
+	}
+}
@@ -0,0 +1,493 @@
+package smtpd
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// session 单个 SMTP 连接的状态
+type session struct {
+	srv *Server
+	// raw 接受的原始连接，不会被替换，Server 在其他 goroutine 中关闭会话时使用
+	raw net.Conn
+	// conn 当前连接，STARTTLS 后为 TLS 连接，只在会话自己的 goroutine 中读写
+	conn net.Conn
+	text *textproto.Conn
+
+	helo string
+	tls  bool
+	// user 通过 AUTH 认证的用户
+	user string
+	from string
+	size int64
+	to   []string
+	// inMail 为 true 表示已收到 MAIL FROM，事务尚未结束
+	inMail bool
+	state  atomic.Int32
+	// policy 为空表示不检查连接策略
+	policy ConnPolicy
+}
+
+func newSession(srv *Server, c net.Conn) *session {
+	return &session{srv: srv, raw: c, conn: c, text: textproto.NewConn(c)}
+}
+
+func (s *session) reply(code int, format string, args ...interface{}) {
+	s.text.PrintfLine("%d %s", code, fmt.Sprintf(format, args...))
+}
+
+func (s *session) replyError(err error) {
+	var se *Error
+	if errors.As(err, &se) {
+		s.reply(se.Code, "%s %s", se.Enhanced, se.Message)
+		return
+	}
+	s.srv.logf("ERROR: SMTP backend error from %s - %v", s.conn.RemoteAddr(), err)
+	s.reply(451, "4.3.0 Internal server error")
+}
+
+// ctx 返回调用 Backend 时使用的 context，携带已认证用户
+func (s *session) ctx() context.Context {
+	if s.user == "" {
+		return context.Background()
+	}
+	return WithUser(context.Background(), s.user)
+}
+
+func (s *session) reset() {
+	s.from = ""
+	s.size = 0
+	s.to = nil
+	s.inMail = false
+}
+
+func (s *session) serve() {
+	defer s.conn.Close()
+	s.srv.logf("INFO: SMTP connection from %s", s.conn.RemoteAddr())
+	ok := s.connect()
+	if s.policy != nil {
+		defer s.policy.Close()
+	}
+	if !ok {
+		return
+	}
+	s.reply(220, "%s ESMTP YoPost", s.srv.Hostname)
+
+	for {
+		// 服务器关闭时，当前事务结束后断开连接
+		if !s.inMail && s.srv.shuttingDown() {
+			s.reply(421, "4.3.2 %s Service shutting down", s.srv.Hostname)
+			return
+		}
+		if s.inMail {
+			s.state.Store(stateActive)
+		} else {
+			s.state.Store(stateIdle)
+		}
+
+		s.conn.SetReadDeadline(time.Now().Add(s.srv.readTimeout()))
+		line, err := s.text.ReadLine()
+		if err != nil {
+			if err != io.EOF && s.state.Load() != stateClosed {
+				s.srv.logf("DEBUG: SMTP connection %s closed - %v", s.conn.RemoteAddr(), err)
+			}
+			return
+		}
+		if !s.state.CompareAndSwap(stateIdle, stateActive) && s.state.Load() == stateClosed {
+			return
+		}
+
+		verb, arg := line, ""
+		if i := strings.IndexByte(line, ' '); i >= 0 {
+			verb, arg = line[:i], strings.TrimSpace(line[i+1:])
+		}
+		verb = strings.ToUpper(verb)
+		if s.policy != nil {
+			if err := s.policy.Command(verb); err != nil {
+				s.replyError(err)
+				return
+			}
+		}
+		if !s.handle(verb, arg) {
+			return
+		}
+	}
+}
+
+// connect 应用连接策略并等待 pregreet 时间，返回 false 时关闭连接
+func (s *session) connect() bool {
+	if s.srv.Policy == nil {
+		return true
+	}
+	p, err := s.srv.Policy.Connect(s.conn.RemoteAddr())
+	if err != nil {
+		s.replyError(err)
+		return false
+	}
+	s.policy = p
+
+	delay := p.PregreetDelay()
+	if delay <= 0 {
+		return true
+	}
+	// 客户端必须等待问候 (RFC 5321 3.1)，提前发送数据的通常是不处理回复的群发程序
+	s.conn.SetReadDeadline(time.Now().Add(delay))
+	_, err = s.text.R.Peek(1)
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return true
+	}
+	if err == nil {
+		s.replyError(p.Pregreet())
+	}
+	return false
+}
+
+// handle 处理单条命令，返回 false 时关闭连接
+func (s *session) handle(verb, arg string) bool {
+	switch verb {
+	case "HELO", "EHLO":
+		s.handleHelo(verb, arg)
+	case "MAIL":
+		s.handleMail(arg)
+	case "RCPT":
+		s.handleRcpt(arg)
+	case "DATA":
+		s.handleData()
+	case "RSET":
+		s.reset()
+		s.reply(250, "2.0.0 OK")
+	case "NOOP":
+		s.reply(250, "2.0.0 OK")
+	case "VRFY":
+		s.reply(252, "2.5.0 Cannot VRFY user")
+	case "STARTTLS":
+		return s.handleStartTLS()
+	case "AUTH":
+		return s.handleAuth(arg)
+	case "QUIT":
+		s.reply(221, "2.0.0 Bye")
+		return false
+	default:
+		s.reply(500, "5.5.2 Command not recognized")
+	}
+	return true
+}
+
+func (s *session) handleHelo(verb, arg string) {
+	if arg == "" {
+		s.reply(501, "5.5.4 Domain required")
+		return
+	}
+	s.helo = arg
+	s.reset()
+
+	if verb == "HELO" {
+		s.reply(250, "%s", s.srv.Hostname)
+		return
+	}
+	ext := []string{
+		s.srv.Hostname,
+		"PIPELINING",
+		"8BITMIME",
+		"ENHANCEDSTATUSCODES",
+		"SIZE " + strconv.FormatInt(s.srv.maxMessageBytes(), 10),
+	}
+	if s.srv.TLSConfig != nil && !s.tls {
+		ext = append(ext, "STARTTLS")
+	}
+	if s.authAvailable() {
+		ext = append(ext, "AUTH "+strings.Join(s.srv.Auth.Mechanisms(), " "))
+	}
+	for i, e := range ext {
+		sep := "-"
+		if i == len(ext)-1 {
+			sep = " "
+		}
+		s.text.PrintfLine("250%s%s", sep, e)
+	}
+}
+
+func (s *session) handleStartTLS() bool {
+	if s.srv.TLSConfig == nil || s.tls {
+		s.reply(502, "5.5.1 STARTTLS not available")
+		return true
+	}
+	s.reply(220, "2.0.0 Ready to start TLS")
+
+	tlsConn := tls.Server(s.conn, s.srv.TLSConfig)
+	if err := tlsConn.Handshake(); err != nil {
+		s.srv.logf("ERROR: STARTTLS handshake with %s failed - %v", s.conn.RemoteAddr(), err)
+		return false
+	}
+	s.conn = tlsConn
+	s.text = textproto.NewConn(tlsConn)
+	s.tls = true
+	s.helo = ""
+	s.user = ""
+	s.reset()
+	return true
+}
+
+func (s *session) authAvailable() bool {
+	return s.srv.Auth != nil && (s.tls || s.srv.AllowInsecureAuth)
+}
+
+// handleAuth 处理 "AUTH <mechanism> [initial-response]"，返回 false 时关闭连接
+func (s *session) handleAuth(arg string) bool {
+	switch {
+	case s.srv.Auth == nil:
+		s.reply(502, "5.5.1 AUTH not available")
+		return true
+	case !s.authAvailable():
+		s.reply(538, "5.7.11 Encryption required for requested authentication mechanism")
+		return true
+	case s.helo == "":
+		s.reply(503, "5.5.1 Send HELO/EHLO first")
+		return true
+	case s.user != "":
+		s.reply(503, "5.5.1 Already authenticated")
+		return true
+	case s.inMail:
+		s.reply(503, "5.5.1 AUTH not permitted during a mail transaction")
+		return true
+	}
+
+	mech, initial, hasInitial := strings.Cut(arg, " ")
+	mech = strings.ToUpper(mech)
+	supported := false
+	for _, m := range s.srv.Auth.Mechanisms() {
+		if m == mech {
+			supported = true
+		}
+	}
+	if !supported {
+		s.reply(504, "5.5.4 Unrecognized authentication type")
+		return true
+	}
+
+	// LOGIN 先后询问用户名和密码 (初始响应为用户名)，合并为 "user\x00password" 交给 Authenticator
+	var prompt string
+	if mech == "LOGIN" {
+		prompt = "VXNlcm5hbWU6" // "Username:"
+	}
+	resp, ok, closed := s.authResponse(initial, hasInitial, prompt)
+	if !ok {
+		return !closed
+	}
+	if mech == "LOGIN" {
+		password, ok, closed := s.authResponse("", false, "UGFzc3dvcmQ6") // "Password:"
+		if !ok {
+			return !closed
+		}
+		resp = append(append(resp, 0), password...)
+	}
+
+	user, challenge, err := s.srv.Auth.Authenticate(context.Background(), mech, resp)
+	if err != nil {
+		s.srv.logf("INFO: SMTP AUTH %s from %s failed - %v", mech, s.conn.RemoteAddr(), err)
+		if challenge != nil {
+			s.text.PrintfLine("334 %s", base64.StdEncoding.EncodeToString(challenge))
+			if _, err := s.text.ReadLine(); err != nil {
+				return false
+			}
+		}
+		s.reply(535, "5.7.8 Authentication credentials invalid")
+		return true
+	}
+	s.user = user
+	s.srv.logf("INFO: SMTP AUTH %s from %s succeeded for %s", mech, s.conn.RemoteAddr(), user)
+	s.reply(235, "2.7.0 Authentication successful")
+	return true
+}
+
+// authResponse 读取一次 SASL 响应，initial 为 AUTH 命令中的初始响应；
+// ok 为 false 时已回复错误，closed 表示连接已断开
+func (s *session) authResponse(initial string, hasInitial bool, prompt string) (resp []byte, ok, closed bool) {
+	if !hasInitial {
+		s.text.PrintfLine("334 %s", prompt)
+		line, err := s.text.ReadLine()
+		if err != nil {
+			return nil, false, true
+		}
+		initial = line
+	}
+	initial = strings.TrimSpace(initial)
+	if initial == "*" {
+		s.reply(501, "5.7.0 Authentication cancelled")
+		return nil, false, false
+	}
+	if initial == "=" {
+		return nil, true, false
+	}
+	resp, err := base64.StdEncoding.DecodeString(initial)
+	if err != nil {
+		s.reply(501, "5.5.2 Cannot decode response")
+		return nil, false, false
+	}
+	return resp, true, false
+}
+
+// parsePath 解析 "FROM:<addr> PARAM=VALUE" 形式的参数
+func parsePath(arg, prefix string) (string, map[string]string, bool) {
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return "", nil, false
+	}
+	rest := strings.TrimSpace(arg[len(prefix):])
+	if !strings.HasPrefix(rest, "<") {
+		return "", nil, false
+	}
+	end := strings.IndexByte(rest, '>')
+	if end < 0 {
+		return "", nil, false
+	}
+
+	params := make(map[string]string)
+	for _, p := range strings.Fields(rest[end+1:]) {
+		k, v, _ := strings.Cut(p, "=")
+		params[strings.ToUpper(k)] = v
+	}
+	return rest[1:end], params, true
+}
+
+func (s *session) handleMail(arg string) {
+	if s.helo == "" {
+		s.reply(503, "5.5.1 Send HELO/EHLO first")
+		return
+	}
+	if s.inMail {
+		s.reply(503, "5.5.1 Nested MAIL command")
+		return
+	}
+	from, params, ok := parsePath(arg, "FROM:")
+	if !ok {
+		s.reply(501, "5.5.4 Syntax: MAIL FROM:<address>")
+		return
+	}
+
+	var size int64
+	if v, ok := params["SIZE"]; ok {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			s.reply(501, "5.5.4 Invalid SIZE parameter")
+			return
+		}
+		if n > s.srv.maxMessageBytes() {
+			s.reply(552, "5.3.4 Message size exceeds fixed maximum message size")
+			return
+		}
+		size = n
+	}
+
+	s.from, s.size, s.inMail = from, size, true
+	s.reply(250, "2.1.0 Sender OK")
+}
+
+func (s *session) handleRcpt(arg string) {
+	if !s.inMail {
+		s.reply(503, "5.5.1 Need MAIL before RCPT")
+		return
+	}
+	to, _, ok := parsePath(arg, "TO:")
+	if !ok || to == "" {
+		s.reply(501, "5.5.4 Syntax: RCPT TO:<address>")
+		return
+	}
+	if len(s.to) >= s.srv.maxRecipients() {
+		s.reply(452, "4.5.3 Too many recipients")
+		return
+	}
+
+	if err := s.srv.Backend.Rcpt(s.ctx(), s.from, to, s.size); err != nil {
+		if s.policy != nil {
+			if d := s.policy.Rejected(s.ctx(), err); d > 0 {
+				time.Sleep(d)
+			}
+		}
+		s.replyError(err)
+		return
+	}
+	if s.policy != nil {
+		if err := s.policy.Rcpt(s.ctx(), s.helo, s.from, to); err != nil {
+			s.replyError(err)
+			return
+		}
+	}
+	s.to = append(s.to, to)
+	s.reply(250, "2.1.5 Recipient OK")
+}
+
+func (s *session) handleData() {
+	if !s.inMail || len(s.to) == 0 {
+		s.reply(503, "5.5.1 Need RCPT before DATA")
+		return
+	}
+	s.reply(354, "Start mail input; end with <CRLF>.<CRLF>")
+
+	max := s.srv.maxMessageBytes()
+	dr := s.text.DotReader()
+	data, err := io.ReadAll(io.LimitReader(dr, max+1))
+	if err != nil {
+		s.srv.logf("ERROR: Failed to read message data from %s - %v", s.conn.RemoteAddr(), err)
+		s.reset()
+		return
+	}
+	if int64(len(data)) > max {
+		// 丢弃剩余内容直到结束标记
+		io.Copy(io.Discard, dr)
+		s.reset()
+		s.reply(552, "5.3.4 Message size exceeds fixed maximum message size")
+		return
+	}
+
+	// DotReader 会把行尾规范化为 LF，存储前恢复为 CRLF
+	data = bytes.ReplaceAll(data, []byte("\n"), []byte("\r\n"))
+
+	trace := s.received()
+	if s.policy != nil {
+		trace = s.policy.Headers() + trace
+	}
+	env := &Envelope{
+		RemoteAddr: s.conn.RemoteAddr(),
+		Helo:       s.helo,
+		From:       s.from,
+		To:         s.to,
+		Data:       append([]byte(trace), data...),
+		TLS:        s.tls,
+		User:       s.user,
+	}
+	s.reset()
+
+	if err := s.srv.Backend.Deliver(s.ctx(), env); err != nil {
+		s.replyError(err)
+		return
+	}
+	s.srv.logf("INFO: Accepted message from %s for %v (%d bytes)", env.From, env.To, len(env.Data))
+	s.reply(250, "2.0.0 Message accepted")
+}
+
+// received 生成 Received 跟踪头
+func (s *session) received() string {
+	host, _, _ := net.SplitHostPort(s.conn.RemoteAddr().String())
+	// RFC 3848 传输类型
+	proto := "ESMTP"
+	if s.tls {
+		proto = "ESMTPS"
+	}
+	if s.user != "" {
+		proto += "A"
+	}
+	return fmt.Sprintf("Received: from %s ([%s])\r\n\tby %s with %s;\r\n\t%s\r\n",
+		s.helo, host, s.srv.Hostname, proto, time.Now().Format(time.RFC1123Z))
+}
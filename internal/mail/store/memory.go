@@ -0,0 +1,158 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MemoryStore 进程内邮件存储，用于开发环境和嵌入式场景
+type MemoryStore struct {
+	mu     sync.RWMutex
+	nextID int64
+	msgs   map[string]*Message
+	uids   map[string]uint32
+}
+
+// NewMemoryStore 创建内存邮件存储
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		msgs: make(map[string]*Message),
+		uids: make(map[string]uint32),
+	}
+}
+
+func copyMessage(m *Message) *Message {
+	c := *m
+	c.Flags = append([]string(nil), m.Flags...)
+	c.Raw = append([]byte(nil), m.Raw...)
+	if m.Envelope != nil {
+		env := *m.Envelope
+		c.Envelope = &env
+	}
+	return &c
+}
+
+func (s *MemoryStore) Append(ctx context.Context, msg *Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := msg.Owner + "\x00" + msg.Mailbox
+	s.uids[key]++
+	msg.UID = s.uids[key]
+	if msg.ID == "" {
+		s.nextID++
+		msg.ID = strconv.FormatInt(s.nextID, 16)
+	}
+	if msg.Raw != nil {
+		msg.Size = int64(len(msg.Raw))
+	}
+	if msg.InternalDate.IsZero() {
+		msg.InternalDate = time.Now()
+	}
+	s.msgs[msg.ID] = copyMessage(msg)
+	return nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, owner, id string) (*Message, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	m, ok := s.msgs[id]
+	if !ok || m.Owner != owner {
+		return nil, ErrNotFound
+	}
+	return copyMessage(m), nil
+}
+
+func (s *MemoryStore) List(ctx context.Context, owner, mailbox string) ([]*Message, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var msgs []*Message
+	for _, m := range s.msgs {
+		if m.Owner == owner && m.Mailbox == mailbox {
+			msgs = append(msgs, copyMessage(m))
+		}
+	}
+	sort.Slice(msgs, func(i, j int) bool { return msgs[i].UID < msgs[j].UID })
+	return msgs, nil
+}
+
+func (s *MemoryStore) Update(ctx context.Context, msg *Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.msgs[msg.ID]
+	if !ok || m.Owner != msg.Owner {
+		return ErrNotFound
+	}
+	if m.Revision != msg.Revision {
+		return ErrConflict
+	}
+	if msg.Raw == nil && msg.Envelope == nil {
+		return ErrNoContent
+	}
+	if msg.Raw != nil {
+		msg.Size = int64(len(msg.Raw))
+	}
+	msg.Revision++
+	s.msgs[msg.ID] = copyMessage(msg)
+	return nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, owner, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.msgs[id]
+	if !ok || m.Owner != owner {
+		return ErrNotFound
+	}
+	delete(s.msgs, id)
+	return nil
+}
+
+func (s *MemoryStore) Move(ctx context.Context, owner, id, mailbox string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.msgs[id]
+	if !ok || m.Owner != owner {
+		return ErrNotFound
+	}
+	if m.Mailbox == mailbox {
+		return nil
+	}
+	key := owner + "\x00" + mailbox
+	s.uids[key]++
+	m.Mailbox, m.UID = mailbox, s.uids[key]
+	m.Revision++
+	return nil
+}
+
+func (s *MemoryStore) Mailboxes(ctx context.Context, owner string) ([]string, error) {
+	return s.distinct(func(m *Message) (string, bool) { return m.Mailbox, m.Owner == owner }), nil
+}
+
+func (s *MemoryStore) Owners(ctx context.Context) ([]string, error) {
+	return s.distinct(func(m *Message) (string, bool) { return m.Owner, true }), nil
+}
+
+func (s *MemoryStore) distinct(field func(m *Message) (string, bool)) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	var result []string
+	for _, m := range s.msgs {
+		if v, ok := field(m); ok && !seen[v] {
+			seen[v] = true
+			result = append(result, v)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,230 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore 基于 MongoDB emails 集合的邮件存储
+type MongoStore struct {
+	emails   *mongo.Collection
+	counters *mongo.Collection
+}
+
+type mongoMessage struct {
+	ID      primitive.ObjectID `bson:"_id,omitempty"`
+	Message `bson:",inline"`
+}
+
+// NewMongoStore 创建 MongoDB 邮件存储
+func NewMongoStore(db *mongo.Database) *MongoStore {
+	return &MongoStore{
+		emails:   db.Collection("emails"),
+		counters: db.Collection("counters"),
+	}
+}
+
+// EnsureIndexes 创建邮件查询所需的索引
+func (s *MongoStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.emails.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "owner", Value: 1}, {Key: "mailbox", Value: 1}, {Key: "uid", Value: 1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create emails index: %v", err)
+	}
+	return nil
+}
+
+// nextUID 为邮箱分配递增的 UID
+func (s *MongoStore) nextUID(ctx context.Context, owner, mailbox string) (uint32, error) {
+	var counter struct {
+		Seq int64 `bson:"seq"`
+	}
+	err := s.counters.FindOneAndUpdate(ctx,
+		bson.M{"_id": "uid:" + owner + ":" + mailbox},
+		bson.M{"$inc": bson.M{"seq": 1}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&counter)
+	if err != nil {
+		return 0, err
+	}
+	return uint32(counter.Seq), nil
+}
+
+func (s *MongoStore) Append(ctx context.Context, msg *Message) error {
+	uid, err := s.nextUID(ctx, msg.Owner, msg.Mailbox)
+	if err != nil {
+		log.Printf("ERROR: Failed to allocate UID for %s/%s - %v", msg.Owner, msg.Mailbox, err)
+		return err
+	}
+	msg.UID = uid
+	if msg.Raw != nil {
+		msg.Size = int64(len(msg.Raw))
+	}
+	if msg.InternalDate.IsZero() {
+		msg.InternalDate = time.Now()
+	}
+
+	doc := mongoMessage{Message: *msg}
+	if msg.ID != "" {
+		if doc.ID, err = primitive.ObjectIDFromHex(msg.ID); err != nil {
+			return fmt.Errorf("invalid message id %q", msg.ID)
+		}
+	}
+	res, err := s.emails.InsertOne(ctx, doc)
+	if err != nil {
+		log.Printf("ERROR: Failed to store message for %s - %v", msg.Owner, err)
+		return err
+	}
+	msg.ID = res.InsertedID.(primitive.ObjectID).Hex()
+	return nil
+}
+
+func (s *MongoStore) Get(ctx context.Context, owner, id string) (*Message, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	var doc mongoMessage
+	err = s.emails.FindOne(ctx, bson.M{"_id": oid, "owner": owner}).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	doc.Message.ID = doc.ID.Hex()
+	return &doc.Message, nil
+}
+
+func (s *MongoStore) List(ctx context.Context, owner, mailbox string) ([]*Message, error) {
+	cur, err := s.emails.Find(ctx,
+		bson.M{"owner": owner, "mailbox": mailbox},
+		options.Find().SetSort(bson.D{{Key: "uid", Value: 1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var msgs []*Message
+	for cur.Next(ctx) {
+		var doc mongoMessage
+		if err := cur.Decode(&doc); err != nil {
+			return nil, err
+		}
+		doc.Message.ID = doc.ID.Hex()
+		msgs = append(msgs, &doc.Message)
+	}
+	return msgs, cur.Err()
+}
+
+func (s *MongoStore) Update(ctx context.Context, msg *Message) error {
+	oid, err := primitive.ObjectIDFromHex(msg.ID)
+	if err != nil {
+		return ErrNotFound
+	}
+	if msg.Raw == nil && msg.Envelope == nil {
+		// raw 为 omitempty，覆盖保存会删除内容
+		return ErrNoContent
+	}
+	if msg.Raw != nil {
+		msg.Size = int64(len(msg.Raw))
+	}
+
+	// 旧文档没有 revision 字段，视为 0
+	var revision interface{} = msg.Revision
+	if msg.Revision == 0 {
+		revision = bson.M{"$in": bson.A{0, nil}}
+	}
+	doc := mongoMessage{ID: oid, Message: *msg}
+	doc.Revision++
+
+	res, err := s.emails.ReplaceOne(ctx, bson.M{"_id": oid, "owner": msg.Owner, "revision": revision}, doc)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		n, err := s.emails.CountDocuments(ctx, bson.M{"_id": oid, "owner": msg.Owner})
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrNotFound
+		}
+		return ErrConflict
+	}
+	msg.Revision = doc.Revision
+	return nil
+}
+
+func (s *MongoStore) Delete(ctx context.Context, owner, id string) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	res, err := s.emails.DeleteOne(ctx, bson.M{"_id": oid, "owner": owner})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *MongoStore) Move(ctx context.Context, owner, id, mailbox string) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+	uid, err := s.nextUID(ctx, owner, mailbox)
+	if err != nil {
+		log.Printf("ERROR: Failed to allocate UID for %s/%s - %v", owner, mailbox, err)
+		return err
+	}
+
+	res, err := s.emails.UpdateOne(ctx,
+		bson.M{"_id": oid, "owner": owner},
+		bson.M{"$set": bson.M{"mailbox": mailbox, "uid": uid}, "$inc": bson.M{"revision": 1}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *MongoStore) Mailboxes(ctx context.Context, owner string) ([]string, error) {
+	return s.distinct(ctx, "mailbox", bson.M{"owner": owner})
+}
+
+func (s *MongoStore) Owners(ctx context.Context) ([]string, error) {
+	return s.distinct(ctx, "owner", bson.M{})
+}
+
+func (s *MongoStore) distinct(ctx context.Context, field string, filter bson.M) ([]string, error) {
+	values, err := s.emails.Distinct(ctx, field, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		if str, ok := v.(string); ok {
+			result = append(result, str)
+		}
+	}
+	return result, nil
+}
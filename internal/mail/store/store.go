@@ -0,0 +1,105 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrNotFound 邮件不存在
+var ErrNotFound = errors.New("message not found")
+
+// ErrConflict 邮件在读取后已被其他操作修改
+var ErrConflict = errors.New("message was modified concurrently")
+
+// ErrNoContent Update 的邮件没有内容，覆盖保存会删除原有内容
+var ErrNoContent = errors.New("message update without content")
+
+// 特殊用途邮箱 (RFC 6154)
+const (
+	Inbox  = "INBOX"
+	Sent   = "Sent"
+	Drafts = "Drafts"
+	Junk   = "Junk"
+	Trash  = "Trash"
+)
+
+// DefaultMailboxes 即使没有邮件也会列出的邮箱
+var DefaultMailboxes = []string{Inbox, Sent, Drafts, Junk, Trash}
+
+// IMAP 系统标记
+const (
+	FlagSeen     = `\Seen`
+	FlagAnswered = `\Answered`
+	FlagFlagged  = `\Flagged`
+	FlagDeleted  = `\Deleted`
+	FlagDraft    = `\Draft`
+)
+
+// HasFlag 判断邮件是否带有标记，不区分大小写
+func (m *Message) HasFlag(flag string) bool {
+	for _, f := range m.Flags {
+		if strings.EqualFold(f, flag) {
+			return true
+		}
+	}
+	return false
+}
+
+// Message 存储在邮箱中的单封邮件
+type Message struct {
+	ID           string    `bson:"-" json:"id"`
+	Owner        string    `bson:"owner" json:"owner"`
+	Mailbox      string    `bson:"mailbox" json:"mailbox"`
+	UID          uint32    `bson:"uid" json:"uid"`
+	Flags        []string  `bson:"flags" json:"flags"`
+	InternalDate time.Time `bson:"internal_date" json:"internal_date"`
+	Size         int64     `bson:"size" json:"size"`
+	// Revision 每次 Update 或 Move 后加一，用于乐观并发控制
+	Revision int64 `bson:"revision" json:"revision"`
+	// Raw 为完整的 RFC 5322 邮件内容，启用加密时落库前会被清空
+	Raw []byte `bson:"raw,omitempty" json:"-"`
+	// Envelope 启用静态加密时保存密文和包装后的数据密钥
+	Envelope *Envelope `bson:"enc,omitempty" json:"-"`
+}
+
+// Envelope 信封加密后的邮件正文
+type Envelope struct {
+	// Version 附加认证数据的格式，0 为只绑定 owner 的旧格式
+	Version    int    `bson:"v,omitempty"`
+	KeyID      string `bson:"key_id"`
+	WrappedKey []byte `bson:"wrapped_key"`
+	Nonce      []byte `bson:"nonce"`
+	Ciphertext []byte `bson:"ciphertext"`
+}
+
+// NewID 生成邮件 ID，用于需要在 Append 之前知道 ID 的场景 (如加密时绑定邮件 ID)
+func NewID() string {
+	return primitive.NewObjectID().Hex()
+}
+
+// Store 邮件存储接口，IMAP/POP3/API 的读写都通过它完成
+type Store interface {
+	// Append 将邮件追加到 msg.Owner 的 msg.Mailbox 中并分配 UID；msg.ID 为空时分配 ID，
+	// 否则使用调用方以 NewID 预先生成的 ID
+	Append(ctx context.Context, msg *Message) error
+	// Get 读取单封邮件
+	Get(ctx context.Context, owner, id string) (*Message, error)
+	// List 列出邮箱中的全部邮件，按 UID 升序
+	List(ctx context.Context, owner, mailbox string) ([]*Message, error)
+	// Update 覆盖保存邮件的元数据和内容。msg 须带有完整内容 (Raw，或加密后的 Envelope)，
+	// 只修改标记时也应先 Get 再保存，否则返回 ErrNoContent。msg.Revision 须与存储中的值一致，
+	// 否则返回 ErrConflict；成功后 msg.Revision 加一
+	Update(ctx context.Context, msg *Message) error
+	// Delete 删除单封邮件
+	Delete(ctx context.Context, owner, id string) error
+	// Move 将邮件移动到 mailbox，ID 不变，在目标邮箱中分配新的 UID 并将 Revision 加一
+	Move(ctx context.Context, owner, id, mailbox string) error
+	// Mailboxes 列出用户存在邮件的全部邮箱
+	Mailboxes(ctx context.Context, owner string) ([]string, error)
+	// Owners 列出存在邮件的全部用户
+	Owners(ctx context.Context) ([]string, error)
+}
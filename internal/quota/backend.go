@@ -0,0 +1,116 @@
+package quota
+
+import (
+	"context"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Record 单个配额范围的持久化记录
+type Record struct {
+	Usage  `bson:",inline" json:"usage"`
+	Limits `bson:",inline" json:"limits"`
+	// Custom 为 true 时使用 Limits，否则使用默认配额
+	Custom bool `bson:"custom"`
+	// Warned 已告警的最高阈值
+	Warned int `bson:"warned"`
+}
+
+// Backend 配额记录的持久化接口
+type Backend interface {
+	Get(ctx context.Context, key string) (Record, error)
+	Add(ctx context.Context, key string, delta Usage) error
+	SetUsage(ctx context.Context, key string, u Usage) error
+	SetLimits(ctx context.Context, key string, l Limits) error
+	SetWarned(ctx context.Context, key string, threshold int) error
+}
+
+// MongoBackend 使用 MongoDB quotas 集合保存配额记录
+type MongoBackend struct {
+	coll *mongo.Collection
+}
+
+// NewMongoBackend 创建 MongoDB 配额存储
+func NewMongoBackend(db *mongo.Database) *MongoBackend {
+	return &MongoBackend{coll: db.Collection("quotas")}
+}
+
+func (b *MongoBackend) Get(ctx context.Context, key string) (Record, error) {
+	var rec Record
+	err := b.coll.FindOne(ctx, bson.M{"_id": key}).Decode(&rec)
+	if err == mongo.ErrNoDocuments {
+		return Record{}, nil
+	}
+	return rec, err
+}
+
+func (b *MongoBackend) upsert(ctx context.Context, key string, update bson.M) error {
+	_, err := b.coll.UpdateOne(ctx, bson.M{"_id": key}, update, options.Update().SetUpsert(true))
+	return err
+}
+
+func (b *MongoBackend) Add(ctx context.Context, key string, delta Usage) error {
+	return b.upsert(ctx, key, bson.M{"$inc": bson.M{"bytes": delta.Bytes, "messages": delta.Messages}})
+}
+
+func (b *MongoBackend) SetUsage(ctx context.Context, key string, u Usage) error {
+	return b.upsert(ctx, key, bson.M{"$set": bson.M{"bytes": u.Bytes, "messages": u.Messages}})
+}
+
+func (b *MongoBackend) SetLimits(ctx context.Context, key string, l Limits) error {
+	return b.upsert(ctx, key, bson.M{"$set": bson.M{
+		"limit_bytes": l.Bytes, "limit_messages": l.Messages, "custom": true,
+	}})
+}
+
+func (b *MongoBackend) SetWarned(ctx context.Context, key string, threshold int) error {
+	return b.upsert(ctx, key, bson.M{"$set": bson.M{"warned": threshold}})
+}
+
+// MemoryBackend 进程内配额存储
+type MemoryBackend struct {
+	mu      sync.Mutex
+	records map[string]Record
+}
+
+// NewMemoryBackend 创建内存配额存储
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{records: make(map[string]Record)}
+}
+
+func (b *MemoryBackend) update(key string, fn func(r *Record)) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	r := b.records[key]
+	fn(&r)
+	b.records[key] = r
+	return nil
+}
+
+func (b *MemoryBackend) Get(ctx context.Context, key string) (Record, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.records[key], nil
+}
+
+func (b *MemoryBackend) Add(ctx context.Context, key string, delta Usage) error {
+	return b.update(key, func(r *Record) {
+		r.Usage.Bytes += delta.Bytes
+		r.Usage.Messages += delta.Messages
+	})
+}
+
+func (b *MemoryBackend) SetUsage(ctx context.Context, key string, u Usage) error {
+	return b.update(key, func(r *Record) { r.Usage = u })
+}
+
+func (b *MemoryBackend) SetLimits(ctx context.Context, key string, l Limits) error {
+	return b.update(key, func(r *Record) { r.Limits, r.Custom = l, true })
+}
+
+func (b *MemoryBackend) SetWarned(ctx context.Context, key string, threshold int) error {
+	return b.update(key, func(r *Record) { r.Warned = threshold })
+}
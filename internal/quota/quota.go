@@ -0,0 +1,216 @@
+package quota
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"YoPost/internal/config"
+)
+
+// Limits 配额上限，0 表示不限制
+type Limits struct {
+	Bytes    int64 `bson:"limit_bytes" json:"bytes"`
+	Messages int64 `bson:"limit_messages" json:"messages"`
+}
+
+// Usage 已用量
+type Usage struct {
+	Bytes    int64 `bson:"bytes" json:"bytes"`
+	Messages int64 `bson:"messages" json:"messages"`
+}
+
+// Status 某个配额范围的用量与上限
+type Status struct {
+	Scope  string `json:"scope"` // user | domain
+	Name   string `json:"name"`
+	Usage  Usage  `json:"usage"`
+	Limits Limits `json:"limits"`
+}
+
+// Percent 返回字节或邮件数中较高的使用百分比，不限制时返回 0
+func (s Status) Percent() int {
+	p := 0
+	if s.Limits.Bytes > 0 {
+		p = int(s.Usage.Bytes * 100 / s.Limits.Bytes)
+	}
+	if s.Limits.Messages > 0 {
+		if m := int(s.Usage.Messages * 100 / s.Limits.Messages); m > p {
+			p = m
+		}
+	}
+	return p
+}
+
+// ExceededError 投递会超出配额
+type ExceededError struct {
+	Scope string
+	Name  string
+	// Permanent 为 true 表示单封邮件本身就超过上限，重试也无法成功
+	Permanent bool
+}
+
+func (e *ExceededError) Error() string {
+	if e.Permanent {
+		return fmt.Sprintf("message exceeds %s storage allocation for %s", e.Scope, e.Name)
+	}
+	return fmt.Sprintf("%s quota exceeded for %s", e.Scope, e.Name)
+}
+
+// Notifier 用量越过告警阈值时调用
+type Notifier func(ctx context.Context, owner string, status Status, threshold int)
+
+// Manager 按邮箱和域名增量统计用量并执行配额检查
+type Manager struct {
+	backend Backend
+	config  config.QuotaConfig
+	notify  Notifier
+}
+
+// NewManager 创建配额管理器
+func NewManager(backend Backend, cfg config.QuotaConfig) *Manager {
+	thresholds := append([]int(nil), cfg.WarnThresholds...)
+	sort.Ints(thresholds)
+	cfg.WarnThresholds = thresholds
+	return &Manager{backend: backend, config: cfg}
+}
+
+// SetNotifier 设置配额告警回调
+func (m *Manager) SetNotifier(n Notifier) {
+	m.notify = n
+}
+
+func domainOf(owner string) string {
+	if i := strings.LastIndex(owner, "@"); i >= 0 {
+		return strings.ToLower(owner[i+1:])
+	}
+	return ""
+}
+
+func key(scope, name string) string {
+	return scope + ":" + strings.ToLower(name)
+}
+
+func (m *Manager) status(ctx context.Context, scope, name string) (Status, error) {
+	rec, err := m.backend.Get(ctx, key(scope, name))
+	if err != nil {
+		return Status{}, err
+	}
+
+	limits := rec.Limits
+	if !rec.Custom {
+		if scope == "user" {
+			limits = Limits{Bytes: m.config.UserBytes, Messages: m.config.UserMessages}
+		} else {
+			limits = Limits{Bytes: m.config.DomainBytes, Messages: m.config.DomainMessages}
+		}
+	}
+	return Status{Scope: scope, Name: strings.ToLower(name), Usage: rec.Usage, Limits: limits}, nil
+}
+
+// User 返回邮箱用户的配额状态
+func (m *Manager) User(ctx context.Context, owner string) (Status, error) {
+	return m.status(ctx, "user", owner)
+}
+
+// Domain 返回域名的配额状态
+func (m *Manager) Domain(ctx context.Context, domain string) (Status, error) {
+	return m.status(ctx, "domain", domain)
+}
+
+// scopes 返回一次投递涉及的配额范围
+func (m *Manager) scopes(owner string) [][2]string {
+	scopes := [][2]string{{"user", owner}}
+	if d := domainOf(owner); d != "" {
+		scopes = append(scopes, [2]string{"domain", d})
+	}
+	return scopes
+}
+
+// Check 检查向 owner 投递 size 字节的邮件是否会超出用户或域名配额
+func (m *Manager) Check(ctx context.Context, owner string, size int64) error {
+	for _, sc := range m.scopes(owner) {
+		st, err := m.status(ctx, sc[0], sc[1])
+		if err != nil {
+			return err
+		}
+		if st.Limits.Bytes > 0 && size > st.Limits.Bytes {
+			return &ExceededError{Scope: st.Scope, Name: st.Name, Permanent: true}
+		}
+		if (st.Limits.Bytes > 0 && st.Usage.Bytes+size > st.Limits.Bytes) ||
+			(st.Limits.Messages > 0 && st.Usage.Messages+1 > st.Limits.Messages) {
+			return &ExceededError{Scope: st.Scope, Name: st.Name}
+		}
+	}
+	return nil
+}
+
+// Charge 记录一封新存储的邮件，并在越过阈值时发送告警
+func (m *Manager) Charge(ctx context.Context, owner string, size int64) error {
+	for _, sc := range m.scopes(owner) {
+		if err := m.backend.Add(ctx, key(sc[0], sc[1]), Usage{Bytes: size, Messages: 1}); err != nil {
+			log.Printf("ERROR: Failed to update %s quota usage for %s - %v", sc[0], sc[1], err)
+			return err
+		}
+	}
+	m.checkThreshold(ctx, owner)
+	return nil
+}
+
+// Release 记录一封被删除的邮件
+func (m *Manager) Release(ctx context.Context, owner string, size int64) error {
+	for _, sc := range m.scopes(owner) {
+		if err := m.backend.Add(ctx, key(sc[0], sc[1]), Usage{Bytes: -size, Messages: -1}); err != nil {
+			log.Printf("ERROR: Failed to update %s quota usage for %s - %v", sc[0], sc[1], err)
+			return err
+		}
+	}
+	m.checkThreshold(ctx, owner)
+	return nil
+}
+
+// checkThreshold 用量越过更高阈值时告警一次，回落到阈值以下后重新计数
+func (m *Manager) checkThreshold(ctx context.Context, owner string) {
+	if len(m.config.WarnThresholds) == 0 {
+		return
+	}
+	st, err := m.User(ctx, owner)
+	if err != nil {
+		return
+	}
+	rec, err := m.backend.Get(ctx, key("user", owner))
+	if err != nil {
+		return
+	}
+
+	reached := 0
+	percent := st.Percent()
+	for _, t := range m.config.WarnThresholds {
+		if percent >= t {
+			reached = t
+		}
+	}
+	if reached == rec.Warned {
+		return
+	}
+	if err := m.backend.SetWarned(ctx, key("user", owner), reached); err != nil {
+		log.Printf("ERROR: Failed to record quota warning for %s - %v", owner, err)
+		return
+	}
+	if reached > rec.Warned && m.notify != nil {
+		log.Printf("INFO: Mailbox %s reached %d%% of quota", owner, percent)
+		m.notify(ctx, owner, st, reached)
+	}
+}
+
+// SetUserLimits 设置用户的自定义配额
+func (m *Manager) SetUserLimits(ctx context.Context, owner string, l Limits) error {
+	return m.backend.SetLimits(ctx, key("user", owner), l)
+}
+
+// SetDomainLimits 设置域名的自定义配额
+func (m *Manager) SetDomainLimits(ctx context.Context, domain string, l Limits) error {
+	return m.backend.SetLimits(ctx, key("domain", domain), l)
+}
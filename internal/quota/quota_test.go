@@ -0,0 +1,106 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"YoPost/internal/config"
+)
+
+func TestCheck(t *testing.T) {
+	ctx := context.Background()
+	cfg := config.QuotaConfig{UserBytes: 1000, UserMessages: 3, DomainBytes: 1500}
+
+	tests := []struct {
+		name      string
+		custom    func(m *Manager)
+		stored    map[string][]int64
+		owner     string
+		size      int64
+		scope     string
+		permanent bool
+	}{
+		{"empty mailbox", nil, nil, "alice@example.com", 100, "", false},
+		{"user bytes", nil, map[string][]int64{"alice@example.com": {900}}, "alice@example.com", 101, "user", false},
+		{"user bytes exactly full", nil, map[string][]int64{"alice@example.com": {900}}, "alice@example.com", 100, "", false},
+		{"user messages", nil, map[string][]int64{"alice@example.com": {1, 1, 1}}, "alice@example.com", 1, "user", false},
+		{"larger than the user limit", nil, nil, "alice@example.com", 1001, "user", true},
+		{"domain bytes", nil, map[string][]int64{"alice@example.com": {800}, "bob@example.com": {600}}, "carol@example.com", 200, "domain", false},
+		{"other domain", nil, map[string][]int64{"alice@example.com": {800}, "bob@example.com": {600}}, "carol@example.net", 200, "", false},
+		{"domain counts case-insensitively", nil, map[string][]int64{"alice@Example.com": {800}, "bob@example.com": {600}}, "carol@EXAMPLE.com", 200, "domain", false},
+		{"custom user limit", func(m *Manager) {
+			m.SetUserLimits(ctx, "alice@example.com", Limits{Bytes: 5000})
+		}, map[string][]int64{"alice@example.com": {1, 1, 1}}, "alice@example.com", 1600, "domain", true},
+		{"custom unlimited domain", func(m *Manager) {
+			m.SetUserLimits(ctx, "alice@example.com", Limits{})
+			m.SetDomainLimits(ctx, "example.com", Limits{})
+		}, map[string][]int64{"alice@example.com": {1, 1, 1}}, "alice@example.com", 1600, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewManager(NewMemoryBackend(), cfg)
+			if tt.custom != nil {
+				tt.custom(m)
+			}
+			for owner, sizes := range tt.stored {
+				for _, size := range sizes {
+					if err := m.Charge(ctx, owner, size); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			err := m.Check(ctx, tt.owner, tt.size)
+			if tt.scope == "" {
+				if err != nil {
+					t.Fatalf("Check() error = %v", err)
+				}
+				return
+			}
+			var ee *ExceededError
+			if !errors.As(err, &ee) {
+				t.Fatalf("Check() error = %v, want *ExceededError", err)
+			}
+			if ee.Scope != tt.scope || ee.Permanent != tt.permanent {
+				t.Errorf("Check() error = %+v, want scope %s permanent %v", ee, tt.scope, tt.permanent)
+			}
+		})
+	}
+}
+
+func TestWarnThresholds(t *testing.T) {
+	ctx := context.Background()
+	const owner = "alice@example.com"
+	m := NewManager(NewMemoryBackend(), config.QuotaConfig{UserBytes: 100, WarnThresholds: []int{95, 80}})
+	var warned []int
+	m.SetNotifier(func(ctx context.Context, owner string, st Status, threshold int) {
+		warned = append(warned, threshold)
+	})
+
+	steps := []struct {
+		name   string
+		delta  int64
+		warned []int
+	}{
+		{"below", 50, nil},
+		{"first threshold", 30, []int{80}},
+		{"same threshold", 5, []int{80}},
+		{"second threshold", 10, []int{80, 95}},
+		{"drop below", -30, []int{80, 95}},
+		{"reach again", 20, []int{80, 95, 80}},
+	}
+	for _, s := range steps {
+		var err error
+		if s.delta > 0 {
+			err = m.Charge(ctx, owner, s.delta)
+		} else {
+			err = m.Release(ctx, owner, -s.delta)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(warned) != len(s.warned) || (len(warned) > 0 && warned[len(warned)-1] != s.warned[len(s.warned)-1]) {
+			t.Errorf("%s: warnings = %v, want %v", s.name, warned, s.warned)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package quota
+
+import (
+	"context"
+	"log"
+
+	"YoPost/internal/mail/store"
+)
+
+// Store 在写入和删除邮件时增量更新配额用量的存储包装
+type Store struct {
+	store.Store
+	manager *Manager
+}
+
+// NewStore 创建带配额统计的存储
+func NewStore(inner store.Store, m *Manager) *Store {
+	return &Store{Store: inner, manager: m}
+}
+
+func (s *Store) Append(ctx context.Context, msg *store.Message) error {
+	size := int64(len(msg.Raw))
+	if err := s.manager.Check(ctx, msg.Owner, size); err != nil {
+		return err
+	}
+	if err := s.Store.Append(ctx, msg); err != nil {
+		return err
+	}
+	return s.manager.Charge(ctx, msg.Owner, size)
+}
+
+// Update 按新旧内容的大小差调整用量，msg.Raw 为空时返回 store.ErrNoContent
+func (s *Store) Update(ctx context.Context, msg *store.Message) error {
+	if msg.Raw == nil {
+		return store.ErrNoContent
+	}
+	old, err := s.Store.Get(ctx, msg.Owner, msg.ID)
+	if err != nil {
+		return err
+	}
+	if err := s.Store.Update(ctx, msg); err != nil {
+		return err
+	}
+	if delta := int64(len(msg.Raw)) - old.Size; delta != 0 {
+		for _, sc := range s.manager.scopes(msg.Owner) {
+			if err := s.manager.backend.Add(ctx, key(sc[0], sc[1]), Usage{Bytes: delta}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Store) Delete(ctx context.Context, owner, id string) error {
+	msg, err := s.Store.Get(ctx, owner, id)
+	if err != nil {
+		return err
+	}
+	if err := s.Store.Delete(ctx, owner, id); err != nil {
+		return err
+	}
+	return s.manager.Release(ctx, owner, msg.Size)
+}
+
+// Recalculate 根据存储中的实际邮件重新统计全部用户和域名的用量
+// 用于首次启用配额或修复计数偏差
+func (m *Manager) Recalculate(ctx context.Context, st store.Store) error {
+	owners, err := st.Owners(ctx)
+	if err != nil {
+		return err
+	}
+
+	domains := make(map[string]Usage)
+	for _, owner := range owners {
+		mailboxes, err := st.Mailboxes(ctx, owner)
+		if err != nil {
+			return err
+		}
+		var u Usage
+		for _, mailbox := range mailboxes {
+			msgs, err := st.List(ctx, owner, mailbox)
+			if err != nil {
+				return err
+			}
+			for _, msg := range msgs {
+				u.Bytes += msg.Size
+				u.Messages++
+			}
+		}
+		if err := m.backend.SetUsage(ctx, key("user", owner), u); err != nil {
+			return err
+		}
+		if d := domainOf(owner); d != "" {
+			du := domains[d]
+			du.Bytes += u.Bytes
+			du.Messages += u.Messages
+			domains[d] = du
+		}
+	}
+	for d, u := range domains {
+		if err := m.backend.SetUsage(ctx, key("domain", d), u); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("INFO: Recalculated quota usage for %d users and %d domains", len(owners), len(domains))
+	return nil
+}
@@ -0,0 +1,83 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"YoPost/internal/config"
+	"YoPost/internal/mail/store"
+)
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	const owner = "alice@example.com"
+	m := NewManager(NewMemoryBackend(), config.QuotaConfig{UserBytes: 100})
+	s := NewStore(store.NewMemoryStore(), m)
+	usage := func() (Usage, Usage) {
+		t.Helper()
+		u, err := m.User(ctx, owner)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, err := m.Domain(ctx, "example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return u.Usage, d.Usage
+	}
+
+	first := &store.Message{Owner: owner, Mailbox: store.Inbox, Raw: make([]byte, 40)}
+	second := &store.Message{Owner: owner, Mailbox: store.Inbox, Raw: make([]byte, 30)}
+	steps := []struct {
+		name string
+		do   func() error
+		err  error
+		want Usage
+	}{
+		{"append", func() error { return s.Append(ctx, first) }, nil, Usage{Bytes: 40, Messages: 1}},
+		{"append second", func() error { return s.Append(ctx, second) }, nil, Usage{Bytes: 70, Messages: 2}},
+		{"over quota", func() error {
+			return s.Append(ctx, &store.Message{Owner: owner, Mailbox: store.Inbox, Raw: make([]byte, 31)})
+		}, &ExceededError{}, Usage{Bytes: 70, Messages: 2}},
+		{"update content", func() error {
+			msg, err := s.Get(ctx, owner, first.ID)
+			if err != nil {
+				return err
+			}
+			msg.Raw = make([]byte, 50)
+			return s.Update(ctx, msg)
+		}, nil, Usage{Bytes: 80, Messages: 2}},
+		{"update without content", func() error {
+			msg, err := s.Get(ctx, owner, first.ID)
+			if err != nil {
+				return err
+			}
+			msg.Raw = nil
+			return s.Update(ctx, msg)
+		}, store.ErrNoContent, Usage{Bytes: 80, Messages: 2}},
+		{"move", func() error { return s.Move(ctx, owner, second.ID, store.Trash) }, nil, Usage{Bytes: 80, Messages: 2}},
+		{"delete releases", func() error { return s.Delete(ctx, owner, second.ID) }, nil, Usage{Bytes: 50, Messages: 1}},
+		{"delete missing", func() error { return s.Delete(ctx, owner, second.ID) }, store.ErrNotFound, Usage{Bytes: 50, Messages: 1}},
+	}
+	for _, st := range steps {
+		err := st.do()
+		switch want := st.err.(type) {
+		case nil:
+			if err != nil {
+				t.Fatalf("%s: error = %v", st.name, err)
+			}
+		case *ExceededError:
+			if !errors.As(err, &want) {
+				t.Fatalf("%s: error = %v, want *ExceededError", st.name, err)
+			}
+		default:
+			if !errors.Is(err, want) {
+				t.Fatalf("%s: error = %v, want %v", st.name, err, want)
+			}
+		}
+		if u, d := usage(); u != st.want || d != st.want {
+			t.Errorf("%s: user usage %+v domain usage %+v, want %+v", st.name, u, d, st.want)
+		}
+	}
+}
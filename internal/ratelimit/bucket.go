@@ -0,0 +1,42 @@
+package ratelimit
+
+import (
+	"math"
+	"time"
+)
+
+// Bucket 令牌桶，容量为每个周期的数量，在一个周期内匀速补满；零值在第一次使用时是满的。
+// Bucket 不加锁，由调用方同步
+type Bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Take 按当前容量补充令牌后取出 n 个，不足时不取并返回还需等待的时间；
+// commit 为 false 时只检查。n 大于 capacity 时永远无法满足，调用方应先行判断
+func (b *Bucket) Take(n float64, capacity int, period time.Duration, now time.Time, commit bool) time.Duration {
+	c := float64(capacity)
+	if b.last.IsZero() {
+		b.tokens = c
+	} else {
+		b.tokens += float64(now.Sub(b.last)) / float64(period) * c
+	}
+	if b.tokens > c {
+		b.tokens = c
+	}
+	b.last = now
+	if b.tokens < n {
+		return time.Duration((n - b.tokens) / c * float64(period))
+	}
+	if commit {
+		b.tokens -= n
+	}
+	return 0
+}
+
+// Remaining 返回 now 时可用的令牌数，不修改令牌桶
+func (b *Bucket) Remaining(capacity int, period time.Duration, now time.Time) int {
+	c := *b
+	c.Take(0, capacity, period, now, false)
+	return int(math.Floor(c.tokens))
+}
@@ -0,0 +1,54 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucketTake(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	type take struct {
+		after  time.Duration
+		n      float64
+		commit bool
+		wait   time.Duration
+	}
+	tests := []struct {
+		name  string
+		takes []take
+	}{
+		{"full when new", []take{{0, 60, true, 0}}},
+		{"empty bucket waits", []take{{0, 60, true, 0}, {0, 1, true, time.Second}}},
+		{"refills over the period", []take{{0, 60, true, 0}, {30 * time.Second, 30, true, 0}, {0, 1, true, time.Second}}},
+		{"never above capacity", []take{{0, 1, true, 0}, {time.Hour, 60, true, 0}, {0, 1, true, time.Second}}},
+		{"check does not take", []take{{0, 60, false, 0}, {0, 60, true, 0}}},
+		{"refused take does not take", []take{{0, 50, true, 0}, {0, 20, true, 10 * time.Second}, {0, 10, true, 0}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b Bucket
+			now := start
+			for i, tk := range tt.takes {
+				now = now.Add(tk.after)
+				if got := b.Take(tk.n, 60, time.Minute, now, tk.commit); got != tk.wait {
+					t.Fatalf("take %d: Take(%v) = %s, want %s", i, tk.n, got, tk.wait)
+				}
+			}
+		})
+	}
+}
+
+func TestBucketRemaining(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	var b Bucket
+	if got := b.Remaining(10, time.Hour, now); got != 10 {
+		t.Errorf("Remaining() of new bucket = %d, want 10", got)
+	}
+	b.Take(4, 10, time.Hour, now, true)
+	if got := b.Remaining(10, time.Hour, now.Add(6*time.Minute)); got != 7 {
+		t.Errorf("Remaining() = %d, want 7", got)
+	}
+	if got := b.Remaining(10, time.Hour, now); got != 6 {
+		t.Errorf("Remaining() changed the bucket: %d, want 6", got)
+	}
+}
@@ -0,0 +1,336 @@
+// Package ratelimit 出站限速：按已认证用户和 API 密钥限制每小时提交的邮件数和收件人数 (含批量发送)，
+// 按收件人域名限制出站队列的投递并发和速率。全部计数保存在进程内
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"YoPost/internal/auth"
+	"YoPost/internal/config"
+	"YoPost/internal/mail/queue"
+)
+
+// LimitError 超出提交限制
+type LimitError struct {
+	// Scope 为 "user" 或 "api_key"，Name 为用户地址或密钥 ID
+	Scope string
+	Name  string
+	// Limit 为 "messages" 或 "recipients"，Requested 为本次提交的数量
+	Limit     string
+	PerHour   int
+	Requested int
+	// RetryAfter 为 0 时 Requested 超过每小时上限本身，等待也无法提交，见 Permanent
+	RetryAfter time.Duration
+}
+
+func (e *LimitError) Error() string {
+	if e.Permanent() {
+		return fmt.Sprintf("rate limit exceeded: %s %s may submit at most %d %s per hour, %d requested",
+			e.Scope, e.Name, e.PerHour, e.Limit, e.Requested)
+	}
+	return fmt.Sprintf("rate limit exceeded: %s %s may submit %d %s per hour, retry in %s",
+		e.Scope, e.Name, e.PerHour, e.Limit, e.RetryAfter.Round(time.Second))
+}
+
+// Permanent 报告提交的数量是否超过每小时上限，这样的提交重试也不会成功
+func (e *LimitError) Permanent() bool {
+	return e.RetryAfter == 0
+}
+
+// sender 一个用户或 API 密钥的提交令牌桶和计数
+type sender struct {
+	messages   Bucket
+	recipients Bucket
+	submitted  int64
+	rejected   int64
+}
+
+// domain 一个收件人域名的投递状态
+type domain struct {
+	rate      Bucket
+	inFlight  int
+	delivered int64
+	throttled int64
+	last      time.Time
+}
+
+// Limiter 提交限速和出站投递限速，注册到 config.Holder 后支持热加载
+type Limiter struct {
+	config atomic.Pointer[config.LimitsConfig]
+
+	mu      sync.Mutex
+	users   map[string]*sender
+	keys    map[string]*sender
+	domains map[string]*domain
+	pruned  time.Time
+}
+
+// NewLimiter 创建 Limiter
+func NewLimiter(cfg config.LimitsConfig) *Limiter {
+	l := &Limiter{users: make(map[string]*sender), keys: make(map[string]*sender), domains: make(map[string]*domain)}
+	l.config.Store(&cfg)
+	return l
+}
+
+// PrepareReload 新的限制对之后的提交和投递生效，已有的计数保留
+func (l *Limiter) PrepareReload(cfg *config.Config) (func(), error) {
+	c := cfg.Limits
+	return func() { l.config.Store(&c) }, nil
+}
+
+// check 检查一个发送方的两个令牌桶，commit 为 true 时取出令牌；返回的错误没有 Scope 和 Name
+func check(s *sender, limits config.SubmitLimits, messages, recipients int, now time.Time, commit bool) *LimitError {
+	for _, c := range []struct {
+		bucket  *Bucket
+		limit   string
+		perHour int
+		n       int
+	}{
+		{&s.messages, "messages", limits.MessagesPerHour, messages},
+		{&s.recipients, "recipients", limits.RecipientsPerHour, recipients},
+	} {
+		if c.perHour <= 0 {
+			continue
+		}
+		if c.n > c.perHour {
+			return &LimitError{Limit: c.limit, PerHour: c.perHour, Requested: c.n}
+		}
+		if wait := c.bucket.Take(float64(c.n), c.perHour, time.Hour, now, commit); wait > 0 {
+			return &LimitError{Limit: c.limit, PerHour: c.perHour, Requested: c.n, RetryAfter: wait}
+		}
+	}
+	return nil
+}
+
+// Submit 记录 user 提交一封有 recipients 个收件人的邮件；通过 API 密钥认证时同时计入密钥的限制。
+// 任一限制不足时不计入任何令牌桶并返回 *LimitError
+func (l *Limiter) Submit(ctx context.Context, user string, recipients int) error {
+	return l.submit(ctx, user, 1, recipients)
+}
+
+// SubmitBatch 记录 user 创建一个有 recipients 个收件人的批次，每个收件人计为一封邮件，规则同 Submit
+func (l *Limiter) SubmitBatch(ctx context.Context, user string, recipients int) error {
+	return l.submit(ctx, user, recipients, recipients)
+}
+
+func (l *Limiter) submit(ctx context.Context, user string, messages, recipients int) error {
+	cfg := l.config.Load()
+	var key string
+	if p := auth.FromContext(ctx); p != nil {
+		key = p.KeyID
+	}
+	user = strings.ToLower(user)
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	type target struct {
+		scope, name string
+		s           *sender
+		limits      config.SubmitLimits
+	}
+	targets := []target{{"user", user, l.sender(l.users, user), cfg.User}}
+	if key != "" {
+		targets = append(targets, target{"api_key", key, l.sender(l.keys, key), cfg.APIKey})
+	}
+	for _, t := range targets {
+		if err := check(t.s, t.limits, messages, recipients, now, false); err != nil {
+			t.s.rejected++
+			err.Scope, err.Name = t.scope, t.name
+			return err
+		}
+	}
+	for _, t := range targets {
+		check(t.s, t.limits, messages, recipients, now, true)
+		t.s.submitted += int64(messages)
+	}
+	return nil
+}
+
+// sender 返回 m 中的发送方，不存在时创建；调用方需持有锁
+func (l *Limiter) sender(m map[string]*sender, name string) *sender {
+	s, ok := m[name]
+	if !ok {
+		s = &sender{}
+		m[name] = s
+	}
+	return s
+}
+
+// domainLimits 返回域名的并发和每分钟速率限制
+func domainLimits(cfg *config.LimitsConfig, name string) (concurrency, rate int) {
+	d := cfg.Delivery
+	concurrency, rate = d.DomainConcurrency, d.DomainRate
+	for k, v := range d.DomainConcurrencies {
+		if strings.EqualFold(k, name) {
+			concurrency = v
+		}
+	}
+	for k, v := range d.DomainRates {
+		if strings.EqualFold(k, name) {
+			rate = v
+		}
+	}
+	return concurrency, rate
+}
+
+// Domains 返回收件人的域名 (小写，去重)
+func Domains(to []string) []string {
+	seen := make(map[string]bool, len(to))
+	var out []string
+	for _, rcpt := range to {
+		d := strings.ToLower(rcpt[strings.LastIndexByte(rcpt, '@')+1:])
+		if !seen[d] {
+			seen[d] = true
+			out = append(out, d)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// concurrencyRetry 域名并发已满时建议的重试间隔
+const concurrencyRetry = 5 * time.Second
+
+// Acquire 实现 queue.Throttle：item 的每个收件人域名都有空闲并发和速率令牌时占用它们，
+// 否则不占用任何名额并返回可以重试的时间。投递成功时 release 才计入各域名的 Delivered
+func (l *Limiter) Acquire(item *queue.Item, now time.Time) (func(bool), time.Time) {
+	cfg := l.config.Load()
+	names := Domains(item.To)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.prune(now)
+
+	ds := make([]*domain, len(names))
+	var wait time.Duration
+	for i, name := range names {
+		d, ok := l.domains[name]
+		if !ok {
+			d = &domain{}
+			l.domains[name] = d
+		}
+		ds[i] = d
+		d.last = now
+		concurrency, rate := domainLimits(cfg, name)
+		w := time.Duration(0)
+		if concurrency > 0 && d.inFlight >= concurrency {
+			w = concurrencyRetry
+		} else if rate > 0 {
+			w = d.rate.Take(1, rate, time.Minute, now, false)
+		}
+		if w > 0 {
+			d.throttled++
+			if w > wait {
+				wait = w
+			}
+		}
+	}
+	if wait > 0 {
+		return nil, now.Add(wait)
+	}
+
+	for i, d := range ds {
+		if _, rate := domainLimits(cfg, names[i]); rate > 0 {
+			d.rate.Take(1, rate, time.Minute, now, true)
+		}
+		d.inFlight++
+	}
+	var once sync.Once
+	return func(delivered bool) {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			for _, d := range ds {
+				d.inFlight--
+				if delivered {
+					d.delivered++
+				}
+			}
+		})
+	}, time.Time{}
+}
+
+// prune 每 10 分钟清理一次一小时内没有投递的域名；调用方需持有锁
+func (l *Limiter) prune(now time.Time) {
+	if now.Sub(l.pruned) < 10*time.Minute {
+		return
+	}
+	l.pruned = now
+	for name, d := range l.domains {
+		if d.inFlight == 0 && now.Sub(d.last) > time.Hour {
+			delete(l.domains, name)
+		}
+	}
+}
+
+// SenderStats 一个用户或 API 密钥的提交状态
+type SenderStats struct {
+	Name              string `json:"name"`
+	MessagesPerHour   int    `json:"messages_per_hour"`
+	RecipientsPerHour int    `json:"recipients_per_hour"`
+	// MessagesRemaining 和 RecipientsRemaining 为当前可提交的数量，对应限制为 0 (不限) 时为 -1
+	MessagesRemaining   int   `json:"messages_remaining"`
+	RecipientsRemaining int   `json:"recipients_remaining"`
+	Submitted           int64 `json:"submitted"`
+	Rejected            int64 `json:"rejected"`
+}
+
+// DomainStats 一个收件人域名的投递状态
+type DomainStats struct {
+	Domain      string `json:"domain"`
+	Concurrency int    `json:"concurrency"`
+	RatePerMin  int    `json:"rate_per_minute"`
+	InFlight    int    `json:"in_flight"`
+	// Delivered 投递成功的邮件数，不含失败和推迟的尝试
+	Delivered int64 `json:"delivered"`
+	// Throttled 因并发或速率限制而推迟的次数
+	Throttled int64 `json:"throttled"`
+}
+
+// Stats 限速状态，计数从进程启动开始
+type Stats struct {
+	Users   []SenderStats `json:"users"`
+	APIKeys []SenderStats `json:"api_keys"`
+	Domains []DomainStats `json:"domains"`
+}
+
+// Stats 返回当前的限速状态，按名称排序
+func (l *Limiter) Stats() *Stats {
+	cfg := l.config.Load()
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	st := &Stats{Users: senderStats(l.users, cfg.User, now), APIKeys: senderStats(l.keys, cfg.APIKey, now), Domains: []DomainStats{}}
+	for name, d := range l.domains {
+		concurrency, rate := domainLimits(cfg, name)
+		st.Domains = append(st.Domains, DomainStats{Domain: name, Concurrency: concurrency, RatePerMin: rate,
+			InFlight: d.inFlight, Delivered: d.delivered, Throttled: d.throttled})
+	}
+	sort.Slice(st.Domains, func(i, j int) bool { return st.Domains[i].Domain < st.Domains[j].Domain })
+	return st
+}
+
+func senderStats(m map[string]*sender, limits config.SubmitLimits, now time.Time) []SenderStats {
+	out := []SenderStats{}
+	for name, s := range m {
+		ss := SenderStats{Name: name, MessagesPerHour: limits.MessagesPerHour, RecipientsPerHour: limits.RecipientsPerHour, MessagesRemaining: -1, RecipientsRemaining: -1, Submitted: s.submitted, Rejected: s.rejected}
+		if limits.MessagesPerHour > 0 {
+			ss.MessagesRemaining = s.messages.Remaining(limits.MessagesPerHour, time.Hour, now)
+		}
+		if limits.RecipientsPerHour > 0 {
+			ss.RecipientsRemaining = s.recipients.Remaining(limits.RecipientsPerHour, time.Hour, now)
+		}
+		out = append(out, ss)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
@@ -0,0 +1,154 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"YoPost/internal/auth"
+	"YoPost/internal/config"
+	"YoPost/internal/mail/queue"
+)
+
+func TestSubmit(t *testing.T) {
+	user := context.Background()
+	key := auth.NewContext(user, &auth.Principal{Subject: "alice@example.com", KeyID: "k1"})
+	type submit struct {
+		ctx        context.Context
+		batch      bool
+		recipients int
+		scope      string
+		limit      string
+		permanent  bool
+	}
+	tests := []struct {
+		name    string
+		limits  config.LimitsConfig
+		submits []submit
+	}{
+		{"unlimited", config.LimitsConfig{}, []submit{
+			{user, false, 1000, "", "", false},
+			{user, true, 1000, "", "", false},
+		}},
+		{"messages per hour", config.LimitsConfig{User: config.SubmitLimits{MessagesPerHour: 2}}, []submit{
+			{user, false, 5, "", "", false},
+			{user, false, 5, "", "", false},
+			{user, false, 1, "user", "messages", false},
+		}},
+		{"recipients per hour", config.LimitsConfig{User: config.SubmitLimits{RecipientsPerHour: 5}}, []submit{
+			{user, false, 3, "", "", false},
+			{user, false, 3, "user", "recipients", false},
+			{user, false, 2, "", "", false},
+		}},
+		{"more recipients than the hourly limit", config.LimitsConfig{User: config.SubmitLimits{RecipientsPerHour: 5}}, []submit{
+			{user, false, 6, "user", "recipients", true},
+			{user, false, 5, "", "", false},
+		}},
+		{"batch counts every recipient as a message", config.LimitsConfig{User: config.SubmitLimits{MessagesPerHour: 5}}, []submit{
+			{user, true, 3, "", "", false},
+			{user, true, 3, "user", "messages", false},
+			{user, true, 2, "", "", false},
+		}},
+		{"batch larger than the hourly limit", config.LimitsConfig{User: config.SubmitLimits{MessagesPerHour: 5}}, []submit{
+			{user, true, 6, "user", "messages", true},
+		}},
+		{"api key limit", config.LimitsConfig{User: config.SubmitLimits{MessagesPerHour: 10}, APIKey: config.SubmitLimits{MessagesPerHour: 1}}, []submit{
+			{key, false, 1, "", "", false},
+			{key, false, 1, "api_key", "messages", false},
+			{user, false, 1, "", "", false},
+		}},
+		{"key submissions count against the user", config.LimitsConfig{User: config.SubmitLimits{MessagesPerHour: 2}, APIKey: config.SubmitLimits{MessagesPerHour: 10}}, []submit{
+			{key, false, 1, "", "", false},
+			{key, false, 1, "", "", false},
+			{user, false, 1, "user", "messages", false},
+		}},
+		{"rejected submission is not counted", config.LimitsConfig{User: config.SubmitLimits{MessagesPerHour: 2}, APIKey: config.SubmitLimits{MessagesPerHour: 1}}, []submit{
+			{key, false, 1, "", "", false},
+			{key, false, 1, "api_key", "messages", false},
+			{user, false, 1, "", "", false},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLimiter(tt.limits)
+			for i, s := range tt.submits {
+				var err error
+				if s.batch {
+					err = l.SubmitBatch(s.ctx, "Alice@example.com", s.recipients)
+				} else {
+					err = l.Submit(s.ctx, "Alice@example.com", s.recipients)
+				}
+				if s.scope == "" {
+					if err != nil {
+						t.Fatalf("submit %d: error = %v", i, err)
+					}
+					continue
+				}
+				var le *LimitError
+				if !errors.As(err, &le) {
+					t.Fatalf("submit %d: error = %v, want *LimitError", i, err)
+				}
+				requested := s.recipients
+				if s.limit == "messages" && !s.batch {
+					requested = 1
+				}
+				if le.Scope != s.scope || le.Limit != s.limit || le.Requested != requested || le.Permanent() != s.permanent {
+					t.Errorf("submit %d: error = %+v, want scope %s limit %s requested %d permanent %v", i, le, s.scope, s.limit, requested, s.permanent)
+				}
+			}
+		})
+	}
+}
+
+func TestAcquire(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	item := func(to ...string) *queue.Item { return &queue.Item{To: to} }
+	l := NewLimiter(config.LimitsConfig{Delivery: config.DeliveryLimits{
+		DomainConcurrency: 1,
+		DomainRate:        2,
+		DomainRates:       map[string]int{"Fast.example": 100},
+	}})
+
+	release, _ := l.Acquire(item("a@slow.example"), now)
+	if release == nil {
+		t.Fatal("first Acquire() throttled")
+	}
+	if r, retry := l.Acquire(item("b@slow.example", "c@fast.example"), now); r != nil || !retry.Equal(now.Add(concurrencyRetry)) {
+		t.Fatalf("Acquire() at domain concurrency = %v, %s, want throttled until %s", r != nil, retry, now.Add(concurrencyRetry))
+	}
+	release(false)
+	release(true)
+
+	second, _ := l.Acquire(item("b@slow.example"), now)
+	if second == nil {
+		t.Fatal("Acquire() after release throttled")
+	}
+	second(true)
+	if r, retry := l.Acquire(item("c@slow.example"), now); r != nil || !retry.Equal(now.Add(30*time.Second)) {
+		t.Fatalf("Acquire() over domain rate = %v, %s, want throttled until %s", r != nil, retry, now.Add(30*time.Second))
+	}
+	for i := 0; i < 3; i++ {
+		r, _ := l.Acquire(item("x@fast.example"), now)
+		if r == nil {
+			t.Fatalf("Acquire() %d on fast.example throttled", i)
+		}
+		r(i != 1)
+	}
+
+	want := map[string]DomainStats{
+		"slow.example": {Concurrency: 1, RatePerMin: 2, Delivered: 1, Throttled: 2},
+		"fast.example": {Concurrency: 1, RatePerMin: 100, Delivered: 2, Throttled: 0},
+	}
+	stats := l.Stats().Domains
+	if len(stats) != len(want) {
+		t.Fatalf("Stats().Domains = %+v, want %d domains", stats, len(want))
+	}
+	for _, d := range stats {
+		w := want[d.Domain]
+		w.Domain = d.Domain
+		if d != w {
+			t.Errorf("Stats() domain = %+v, want %+v", d, w)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package search
+
+import (
+	"context"
+	"net/mail"
+	"strings"
+	"time"
+
+	"YoPost/internal/mail/message"
+	"YoPost/internal/mail/store"
+)
+
+// 可检索的字段，FieldAll 为全部字段的并集，对应 IMAP SEARCH TEXT
+const (
+	FieldSubject    = "subject"
+	FieldFrom       = "from"
+	FieldTo         = "to"
+	FieldBody       = "body"
+	FieldAttachment = "attachment"
+	FieldAll        = "all"
+)
+
+// Document 一封邮件的索引文档
+type Document struct {
+	ID      string
+	Owner   string
+	Mailbox string
+	UID     uint32
+	Date    time.Time
+	Fields  map[string][]string
+}
+
+// Query 检索条件，多个字段之间为 AND 关系
+type Query struct {
+	Mailbox string
+	// Terms 字段到检索词的映射，同一字段的全部词都必须匹配
+	Terms map[string]string
+	Limit int
+}
+
+// Hit 检索结果
+type Hit struct {
+	ID      string    `json:"id"`
+	Mailbox string    `json:"mailbox"`
+	UID     uint32    `json:"uid"`
+	Date    time.Time `json:"date"`
+}
+
+// Index 全文索引接口
+type Index interface {
+	Put(ctx context.Context, doc *Document) error
+	Remove(ctx context.Context, owner, id string) error
+	Search(ctx context.Context, owner string, q Query) ([]Hit, error)
+}
+
+// addressText 将地址列表展开为可分词的文本
+func addressText(list []*mail.Address) string {
+	var b strings.Builder
+	for _, a := range list {
+		b.WriteString(a.Name)
+		b.WriteByte(' ')
+		b.WriteString(a.Address)
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
+
+// NewDocument 解析邮件并生成索引文档
+func NewDocument(msg *store.Message) (*Document, error) {
+	p, err := message.Parse(msg.Raw)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := map[string][]string{
+		FieldSubject: Unique(Tokenize(p.Subject)),
+		FieldFrom:    Unique(Tokenize(addressText(p.From))),
+		FieldTo:      Unique(Tokenize(addressText(p.To) + " " + addressText(p.Cc))),
+		FieldBody:    Unique(Tokenize(p.Text + " " + message.HTMLToText(p.HTML))),
+	}
+	var names []string
+	for _, a := range p.Attachments {
+		names = append(names, a.Filename)
+	}
+	fields[FieldAttachment] = Unique(Tokenize(strings.Join(names, " ")))
+
+	var all []string
+	for _, f := range fields {
+		all = append(all, f...)
+	}
+	fields[FieldAll] = Unique(all)
+
+	date := p.Date
+	if date.IsZero() {
+		date = msg.InternalDate
+	}
+	return &Document{
+		ID:      msg.ID,
+		Owner:   msg.Owner,
+		Mailbox: msg.Mailbox,
+		UID:     msg.UID,
+		Date:    date,
+		Fields:  fields,
+	}, nil
+}
@@ -0,0 +1,79 @@
+package search
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// MemoryIndex 进程内倒排索引
+type MemoryIndex struct {
+	mu   sync.RWMutex
+	docs map[string]*memoryDoc
+}
+
+type memoryDoc struct {
+	doc    *Document
+	fields map[string]map[string]bool
+}
+
+// NewMemoryIndex 创建内存索引
+func NewMemoryIndex() *MemoryIndex {
+	return &MemoryIndex{docs: make(map[string]*memoryDoc)}
+}
+
+func (idx *MemoryIndex) Put(ctx context.Context, doc *Document) error {
+	md := &memoryDoc{doc: doc, fields: make(map[string]map[string]bool)}
+	for f, tokens := range doc.Fields {
+		set := make(map[string]bool, len(tokens))
+		for _, t := range tokens {
+			set[t] = true
+		}
+		md.fields[f] = set
+	}
+
+	idx.mu.Lock()
+	idx.docs[doc.Owner+"\x00"+doc.ID] = md
+	idx.mu.Unlock()
+	return nil
+}
+
+func (idx *MemoryIndex) Remove(ctx context.Context, owner, id string) error {
+	idx.mu.Lock()
+	delete(idx.docs, owner+"\x00"+id)
+	idx.mu.Unlock()
+	return nil
+}
+
+func (idx *MemoryIndex) Search(ctx context.Context, owner string, q Query) ([]Hit, error) {
+	terms := q.tokens()
+
+	idx.mu.RLock()
+	var hits []Hit
+	for _, md := range idx.docs {
+		if md.doc.Owner != owner || (q.Mailbox != "" && md.doc.Mailbox != q.Mailbox) {
+			continue
+		}
+		if md.matches(terms) {
+			hits = append(hits, Hit{ID: md.doc.ID, Mailbox: md.doc.Mailbox, UID: md.doc.UID, Date: md.doc.Date})
+		}
+	}
+	idx.mu.RUnlock()
+
+	sort.Slice(hits, func(i, j int) bool { return hits[i].Date.After(hits[j].Date) })
+	if q.Limit > 0 && len(hits) > q.Limit {
+		hits = hits[:q.Limit]
+	}
+	return hits, nil
+}
+
+func (md *memoryDoc) matches(terms map[string][]string) bool {
+	for f, tokens := range terms {
+		for _, t := range tokens {
+			if !md.fields[f][t] {
+				return false
+			}
+		}
+	}
+	return true
+}
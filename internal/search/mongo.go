@@ -0,0 +1,94 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoIndex 使用 MongoDB 多键索引保存检索词
+// 每个字段的检索词保存为数组，查询时用 $all 匹配
+type MongoIndex struct {
+	coll *mongo.Collection
+}
+
+// NewMongoIndex 创建 MongoDB 索引
+func NewMongoIndex(db *mongo.Database) *MongoIndex {
+	return &MongoIndex{coll: db.Collection("search_index")}
+}
+
+// EnsureIndexes 为 owner 与各字段创建多键索引
+func (idx *MongoIndex) EnsureIndexes(ctx context.Context) error {
+	models := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "owner", Value: 1}, {Key: "mailbox", Value: 1}, {Key: "date", Value: -1}}},
+	}
+	for _, f := range []string{FieldAll, FieldSubject, FieldFrom, FieldTo, FieldBody, FieldAttachment} {
+		models = append(models, mongo.IndexModel{Keys: bson.D{{Key: "owner", Value: 1}, {Key: "terms." + f, Value: 1}}})
+	}
+	if _, err := idx.coll.Indexes().CreateMany(ctx, models); err != nil {
+		return fmt.Errorf("failed to create search indexes: %v", err)
+	}
+	return nil
+}
+
+func (idx *MongoIndex) Put(ctx context.Context, doc *Document) error {
+	_, err := idx.coll.ReplaceOne(ctx,
+		bson.M{"_id": doc.Owner + ":" + doc.ID},
+		bson.M{
+			"owner":   doc.Owner,
+			"msg_id":  doc.ID,
+			"mailbox": doc.Mailbox,
+			"uid":     doc.UID,
+			"date":    doc.Date,
+			"terms":   doc.Fields,
+		},
+		options.Replace().SetUpsert(true),
+	)
+	return err
+}
+
+func (idx *MongoIndex) Remove(ctx context.Context, owner, id string) error {
+	_, err := idx.coll.DeleteOne(ctx, bson.M{"_id": owner + ":" + id})
+	return err
+}
+
+func (idx *MongoIndex) Search(ctx context.Context, owner string, q Query) ([]Hit, error) {
+	filter := bson.M{"owner": owner}
+	if q.Mailbox != "" {
+		filter["mailbox"] = q.Mailbox
+	}
+	for f, tokens := range q.tokens() {
+		if len(tokens) > 0 {
+			filter["terms."+f] = bson.M{"$all": tokens}
+		}
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "date", Value: -1}})
+	if q.Limit > 0 {
+		opts.SetLimit(int64(q.Limit))
+	}
+	cur, err := idx.coll.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var hits []Hit
+	for cur.Next(ctx) {
+		var doc struct {
+			MsgID   string    `bson:"msg_id"`
+			Mailbox string    `bson:"mailbox"`
+			UID     uint32    `bson:"uid"`
+			Date    time.Time `bson:"date"`
+		}
+		if err := cur.Decode(&doc); err != nil {
+			return nil, err
+		}
+		hits = append(hits, Hit{ID: doc.MsgID, Mailbox: doc.Mailbox, UID: doc.UID, Date: doc.Date})
+	}
+	return hits, cur.Err()
+}
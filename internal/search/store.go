@@ -0,0 +1,162 @@
+package search
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"strings"
+
+	"YoPost/internal/mail/store"
+)
+
+// tokens 将检索词按与索引相同的方式分词
+func (q Query) tokens() map[string][]string {
+	out := make(map[string][]string, len(q.Terms))
+	for f, term := range q.Terms {
+		if tokens := Unique(Tokenize(term)); len(tokens) > 0 {
+			out[f] = tokens
+		}
+	}
+	return out
+}
+
+// blindIndex 用 HMAC 替换检索词的索引包装
+// 启用静态加密时使用，避免索引中保存可读的正文词汇
+type blindIndex struct {
+	Index
+	key []byte
+}
+
+// Blind 返回对检索词做 HMAC-SHA256 处理的索引
+func Blind(idx Index, key []byte) Index {
+	return &blindIndex{Index: idx, key: key}
+}
+
+func (b *blindIndex) blind(owner string, tokens []string) []string {
+	out := make([]string, len(tokens))
+	for i, t := range tokens {
+		mac := hmac.New(sha256.New, b.key)
+		mac.Write([]byte(owner + "\x00" + t))
+		out[i] = hex.EncodeToString(mac.Sum(nil)[:12])
+	}
+	return out
+}
+
+func (b *blindIndex) Put(ctx context.Context, doc *Document) error {
+	blinded := *doc
+	blinded.Fields = make(map[string][]string, len(doc.Fields))
+	for f, tokens := range doc.Fields {
+		blinded.Fields[f] = b.blind(doc.Owner, tokens)
+	}
+	return b.Index.Put(ctx, &blinded)
+}
+
+func (b *blindIndex) Search(ctx context.Context, owner string, q Query) ([]Hit, error) {
+	// 检索词分词后再 blind，Terms 中以空格拼接，重新分词不会改变十六进制值
+	blinded := Query{Mailbox: q.Mailbox, Limit: q.Limit, Terms: make(map[string]string)}
+	for f, tokens := range q.tokens() {
+		blinded.Terms[f] = strings.Join(b.blind(owner, tokens), " ")
+	}
+	return b.Index.Search(ctx, owner, blinded)
+}
+
+// Store 在邮件写入、更新和删除时增量维护索引的存储包装
+// 应包装在加密存储之外，以便索引明文内容
+type Store struct {
+	store.Store
+	index Index
+}
+
+// NewStore 创建带增量索引的存储
+func NewStore(inner store.Store, idx Index) *Store {
+	return &Store{Store: inner, index: idx}
+}
+
+func (s *Store) put(ctx context.Context, msg *store.Message) {
+	doc, err := NewDocument(msg)
+	if err != nil {
+		log.Printf("ERROR: Failed to parse message %s for indexing - %v", msg.ID, err)
+		return
+	}
+	if err := s.index.Put(ctx, doc); err != nil {
+		log.Printf("ERROR: Failed to index message %s - %v", msg.ID, err)
+	}
+}
+
+func (s *Store) Append(ctx context.Context, msg *store.Message) error {
+	if err := s.Store.Append(ctx, msg); err != nil {
+		return err
+	}
+	s.put(ctx, msg)
+	return nil
+}
+
+func (s *Store) Update(ctx context.Context, msg *store.Message) error {
+	if err := s.Store.Update(ctx, msg); err != nil {
+		return err
+	}
+	s.put(ctx, msg)
+	return nil
+}
+
+func (s *Store) Delete(ctx context.Context, owner, id string) error {
+	if err := s.Store.Delete(ctx, owner, id); err != nil {
+		return err
+	}
+	if err := s.index.Remove(ctx, owner, id); err != nil {
+		log.Printf("ERROR: Failed to remove message %s from index - %v", id, err)
+	}
+	return nil
+}
+
+func (s *Store) Move(ctx context.Context, owner, id, mailbox string) error {
+	if err := s.Store.Move(ctx, owner, id, mailbox); err != nil {
+		return err
+	}
+	// 索引文档记录了邮箱和 UID，移动后重新写入
+	msg, err := s.Store.Get(ctx, owner, id)
+	if err != nil {
+		log.Printf("ERROR: Failed to reindex moved message %s - %v", id, err)
+		return nil
+	}
+	s.put(ctx, msg)
+	return nil
+}
+
+// Rebuild 为存储中的全部邮件重建索引
+func Rebuild(ctx context.Context, st store.Store, idx Index) (int, error) {
+	owners, err := st.Owners(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, owner := range owners {
+		mailboxes, err := st.Mailboxes(ctx, owner)
+		if err != nil {
+			return n, err
+		}
+		for _, mailbox := range mailboxes {
+			msgs, err := st.List(ctx, owner, mailbox)
+			if err != nil {
+				return n, err
+			}
+			for _, msg := range msgs {
+				doc, err := NewDocument(msg)
+				if err != nil {
+					log.Printf("ERROR: Failed to parse message %s for indexing - %v", msg.ID, err)
+					continue
+				}
+				if err := idx.Put(ctx, doc); err != nil {
+					return n, err
+				}
+				n++
+			}
+		}
+	}
+
+	log.Printf("INFO: Rebuilt search index for %d messages", n)
+	return n, nil
+}
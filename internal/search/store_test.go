@@ -0,0 +1,105 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+
+	"YoPost/internal/mail/store"
+)
+
+func testMessage(subject, body string) []byte {
+	return []byte(fmt.Sprintf("From: Bob <bob@example.com>\r\nTo: Alice <alice@example.com>\r\nCc: Carol <carol@example.com>\r\n"+
+		"Subject: %s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s\r\n", subject, body))
+}
+
+func TestStore(t *testing.T) {
+	indexes := []struct {
+		name  string
+		index func() (Index, *MemoryIndex)
+	}{
+		{"plain", func() (Index, *MemoryIndex) { idx := NewMemoryIndex(); return idx, idx }},
+		{"blind", func() (Index, *MemoryIndex) {
+			idx := NewMemoryIndex()
+			return Blind(idx, []byte("0123456789abcdef0123456789abcdef")), idx
+		}},
+	}
+	for _, ix := range indexes {
+		t.Run(ix.name, func(t *testing.T) {
+			ctx := context.Background()
+			const owner = "alice@example.com"
+			idx, inner := ix.index()
+			s := NewStore(store.NewMemoryStore(), idx)
+			meeting := &store.Message{Owner: owner, Mailbox: store.Inbox, Raw: testMessage("项目会议纪要", "明天下午三点开会")}
+			invoice := &store.Message{Owner: owner, Mailbox: store.Inbox, Raw: testMessage("Invoice 42", "Payment due next week")}
+			for _, msg := range []*store.Message{meeting, invoice} {
+				if err := s.Append(ctx, msg); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := s.Append(ctx, &store.Message{Owner: "bob@example.com", Mailbox: store.Inbox, Raw: testMessage("项目会议", "")}); err != nil {
+				t.Fatal(err)
+			}
+
+			search := func(q Query) []string {
+				t.Helper()
+				hits, err := idx.Search(ctx, owner, q)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var ids []string
+				for _, h := range hits {
+					ids = append(ids, h.ID)
+				}
+				slices.Sort(ids)
+				return ids
+			}
+			both := []string{meeting.ID, invoice.ID}
+			slices.Sort(both)
+			tests := []struct {
+				name  string
+				terms map[string]string
+				want  []string
+			}{
+				{"chinese subject", map[string]string{FieldSubject: "会议"}, []string{meeting.ID}},
+				{"chinese body", map[string]string{FieldBody: "下午三点"}, []string{meeting.ID}},
+				{"latin case-insensitive", map[string]string{FieldSubject: "INVOICE"}, []string{invoice.ID}},
+				{"cc in to field", map[string]string{FieldTo: "carol"}, both},
+				{"all fields", map[string]string{FieldAll: "payment bob"}, []string{invoice.ID}},
+				{"every term must match", map[string]string{FieldBody: "payment 会议"}, nil},
+				{"wrong field", map[string]string{FieldFrom: "invoice"}, nil},
+			}
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					if got := search(Query{Terms: tt.terms}); !slices.Equal(got, tt.want) {
+						t.Errorf("Search(%v) = %v, want %v", tt.terms, got, tt.want)
+					}
+				})
+			}
+
+			if err := s.Move(ctx, owner, invoice.ID, store.Trash); err != nil {
+				t.Fatal(err)
+			}
+			if got := search(Query{Mailbox: store.Trash, Terms: map[string]string{FieldAll: "invoice"}}); !slices.Equal(got, []string{invoice.ID}) {
+				t.Errorf("Search() in Trash after Move = %v, want %v", got, []string{invoice.ID})
+			}
+			if err := s.Delete(ctx, owner, meeting.ID); err != nil {
+				t.Fatal(err)
+			}
+			if got := search(Query{Terms: map[string]string{FieldSubject: "会议"}}); got != nil {
+				t.Errorf("Search() after Delete = %v, want none", got)
+			}
+
+			// 启用 Blind 时底层索引不应保存可读的检索词
+			for _, md := range inner.docs {
+				if md.doc.ID != invoice.ID {
+					continue
+				}
+				if readable := md.fields[FieldSubject]["invoice"]; readable == (ix.name == "blind") {
+					t.Errorf("inner index has readable term = %v for %s index", readable, ix.name)
+				}
+			}
+		})
+	}
+}
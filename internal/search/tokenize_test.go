@@ -0,0 +1,38 @@
+package search
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"latin words", "Hello, World! 2024", []string{"hello", "world", "2024"}},
+		{"chinese bigrams", "全文检索", []string{"全文", "文检", "检索"}},
+		{"single han", "信", []string{"信"}},
+		{"japanese kana and kanji", "メール検索", []string{"メー", "ール", "ル検", "検索"}},
+		{"hiragana", "こんにちは", []string{"こん", "んに", "にち", "ちは"}},
+		{"korean", "메일", []string{"메일"}},
+		{"mixed scripts", "YoPost邮件服务器v2", []string{"yopost", "邮件", "件服", "服务", "务器", "v2"}},
+		{"punctuation splits cjk", "邮件，检索", []string{"邮件", "检索"}},
+		{"empty", " \t", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Tokenize(tt.text); !slices.Equal(got, tt.want) {
+				t.Errorf("Tokenize(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnique(t *testing.T) {
+	got := Unique([]string{"a", "b", "a", "c", "b"})
+	if want := []string{"a", "b", "c"}; !slices.Equal(got, want) {
+		t.Errorf("Unique() = %q, want %q", got, want)
+	}
+}
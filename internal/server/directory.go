@@ -0,0 +1,97 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"YoPost/internal/db/mysql"
+)
+
+// Directory 本地用户、域名和别名目录
+type Directory interface {
+	// UserExists 判断地址是否为本地邮箱
+	UserExists(ctx context.Context, address string) (bool, error)
+	// Routing 返回目录中的本地域名和别名，与配置文件中的合并使用
+	Routing(ctx context.Context) (domains []string, aliases map[string]string, err error)
+}
+
+// mysqlDirectory 基于 MySQL users/domains/aliases 表的目录
+type mysqlDirectory struct {
+	*mysql.MySQLClient
+}
+
+// NewMySQLDirectory 创建基于 MySQL 的目录
+func NewMySQLDirectory(c *mysql.MySQLClient) Directory {
+	return mysqlDirectory{c}
+}
+
+func (d mysqlDirectory) Routing(ctx context.Context) ([]string, map[string]string, error) {
+	domains, err := d.ListDomains(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	list, err := d.ListAliases(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	aliases := make(map[string]string, len(list))
+	for _, a := range list {
+		aliases[a.Address] = a.Target
+	}
+	return domains, aliases, nil
+}
+
+// MemoryDirectory 进程内目录，用于测试和嵌入式场景
+type MemoryDirectory struct {
+	mu      sync.RWMutex
+	users   map[string]bool
+	domains []string
+	aliases map[string]string
+}
+
+// NewMemoryDirectory 创建包含给定用户的内存目录
+func NewMemoryDirectory(users ...string) *MemoryDirectory {
+	d := &MemoryDirectory{users: make(map[string]bool), aliases: make(map[string]string)}
+	for _, u := range users {
+		d.AddUser(u)
+	}
+	return d
+}
+
+// AddUser 添加本地用户
+func (d *MemoryDirectory) AddUser(address string) {
+	d.mu.Lock()
+	d.users[strings.ToLower(address)] = true
+	d.mu.Unlock()
+}
+
+// AddDomain 添加本地域名
+func (d *MemoryDirectory) AddDomain(domain string) {
+	d.mu.Lock()
+	d.domains = append(d.domains, strings.ToLower(domain))
+	d.mu.Unlock()
+}
+
+// SetAlias 添加或修改别名
+func (d *MemoryDirectory) SetAlias(address, target string) {
+	d.mu.Lock()
+	d.aliases[strings.ToLower(address)] = strings.ToLower(target)
+	d.mu.Unlock()
+}
+
+func (d *MemoryDirectory) UserExists(ctx context.Context, address string) (bool, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.users[strings.ToLower(address)], nil
+}
+
+func (d *MemoryDirectory) Routing(ctx context.Context) ([]string, map[string]string, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	aliases := make(map[string]string, len(d.aliases))
+	for k, v := range d.aliases {
+		aliases[k] = v
+	}
+	return append([]string(nil), d.domains...), aliases, nil
+}
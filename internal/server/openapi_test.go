@@ -0,0 +1,29 @@
+package server
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"YoPost/internal/api/docs"
+)
+
+// TestOpenAPIDocument 提交的 OpenAPI 文档须与注册的路由一致，不一致时运行 yopost openapi -o docs/api/openapi.json
+func TestOpenAPIDocument(t *testing.T) {
+	r := APIRouter()
+	if problems := r.CheckDocs(); len(problems) > 0 {
+		t.Errorf("undocumented routes:\n  %s", strings.Join(problems, "\n  "))
+	}
+	spec, err := docs.Spec(r).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := os.ReadFile("../../docs/api/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(current, spec) {
+		t.Error("docs/api/openapi.json is out of date, run: yopost openapi -o docs/api/openapi.json")
+	}
+}
@@ -0,0 +1,441 @@
+// Package server 将配置、存储、目录和传输组装为一个可嵌入的 YoPost 实例
+//
+// 同一进程内可以创建多个互不影响的 Server，各自持有自己的配置、存储和监听器
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+
+	"YoPost/internal/api/admin"
+	authapi "YoPost/internal/api/auth"
+	bulkapi "YoPost/internal/api/bulk"
+	"YoPost/internal/api/docs"
+	mailboxapi "YoPost/internal/api/mailbox"
+	queueapi "YoPost/internal/api/queue"
+	quotaapi "YoPost/internal/api/quota"
+	"YoPost/internal/api/rest"
+	searchapi "YoPost/internal/api/search"
+	"YoPost/internal/api/smtp"
+	spamapi "YoPost/internal/api/spam"
+	suppressionapi "YoPost/internal/api/suppression"
+	templatesapi "YoPost/internal/api/templates"
+	webhookapi "YoPost/internal/api/webhook"
+	"YoPost/internal/auth"
+	"YoPost/internal/auth/oidc"
+	"YoPost/internal/bulk"
+	"YoPost/internal/certs"
+	"YoPost/internal/config"
+	"YoPost/internal/mail/core"
+	"YoPost/internal/mail/delivery"
+	"YoPost/internal/mail/dnsbl"
+	"YoPost/internal/mail/inbound"
+	"YoPost/internal/mail/policy"
+	"YoPost/internal/mail/queue"
+	"YoPost/internal/mail/sasl"
+	"YoPost/internal/mail/smtpd"
+	"YoPost/internal/mail/store"
+	"YoPost/internal/ratelimit"
+	"YoPost/internal/spam"
+	"YoPost/internal/suppression"
+	"YoPost/internal/webhook"
+)
+
+// Options 构造 Server 所需的依赖，除 Config 和 Storage 外均可为空
+type Options struct {
+	Config *config.Config
+	// ConfigPath 热加载时重新读取的配置文件，为空时按 config.ResolvePath 查找
+	ConfigPath string
+	Storage    *Storage
+	// Directory 本地用户目录，为空时使用空的 MemoryDirectory
+	Directory Directory
+	// Relay 出站中继，为空时按 Config.Relay 创建
+	Relay *core.Relay
+	// Sender 出站队列的投递方式，为空时通过 Relay 投递
+	Sender queue.Sender
+	// Certs 服务端证书，为空时按 Config.TLS 加载
+	Certs *certs.Store
+	// Auth API 用户与密钥存储，为空时使用空的 auth.MemoryStore
+	Auth auth.Store
+	// Logger 为空时使用 log 包的默认 Logger
+	Logger *log.Logger
+}
+
+// Server 一个完整的 YoPost 实例
+type Server struct {
+	config    *config.Holder
+	storage   *Storage
+	store     store.Store // storage.Store 外加垃圾邮件训练，供 REST 接口使用，不修改调用方的 Storage
+	directory Directory
+	relay     *core.Relay
+	certs     *certs.Store
+	auth      *auth.Service
+	logger    *log.Logger
+
+	local    *delivery.Local
+	smtp     *smtpd.Server
+	policy   *policy.Policy
+	dnsbl    *dnsbl.Checker
+	spam     *spam.Filter
+	worker   *queue.Worker
+	webhooks *webhook.Dispatcher
+	bulk     *bulk.Runner
+	suppress *suppression.Manager
+	limiter  *ratelimit.Limiter
+	v1       *rest.Router
+	handler  http.Handler
+	api      *http.Server
+}
+
+// New 根据 opts 创建 Server，不启动任何监听器
+func New(opts Options) (*Server, error) {
+	if opts.Config == nil || opts.Storage == nil {
+		return nil, errors.New("server: Config and Storage are required")
+	}
+	cfg := opts.Config
+
+	s := &Server{
+		config:    config.NewHolder(opts.ConfigPath, cfg),
+		storage:   opts.Storage,
+		directory: opts.Directory,
+		relay:     opts.Relay,
+		certs:     opts.Certs,
+		logger:    opts.Logger,
+	}
+	if s.logger == nil {
+		s.logger = log.Default()
+	}
+	if s.directory == nil {
+		s.directory = NewMemoryDirectory()
+	}
+	if s.relay == nil {
+		s.relay = core.NewRelay(cfg.Relay)
+	}
+	if s.certs == nil {
+		var err error
+		if s.certs, err = certs.NewStore(cfg.TLS); err != nil {
+			return nil, err
+		}
+	}
+	sender := opts.Sender
+	if sender == nil {
+		sender = queue.RelaySender(s.relay)
+	}
+
+	// 投递、退信、入站和配额告警事件推送到 Webhook 端点
+	s.webhooks = webhook.NewDispatcher(s.storage.Webhooks, cfg.Webhooks)
+	s.webhooks.Logger = s.logger
+	s.storage.Quota.SetNotifier(quotaNotifier(s.webhooks, delivery.QuotaWarning(s.storage.Unmetered())))
+
+	// 垃圾邮件评分，用户将邮件移入或移出 Junk 时训练贝叶斯分类器
+	var err error
+	if s.spam, err = spam.NewFilter(cfg.Spam, s.storage.Spam); err != nil {
+		return nil, err
+	}
+	s.spam.Logger = s.logger
+	s.store = spam.NewTrainingStore(s.storage.Store, s.spam)
+
+	// 入站投递；已认证用户提交的邮件检查抑制列表
+	s.local, err = NewLocal(context.Background(), cfg, s.storage, s.directory, s.webhooks)
+	if err != nil {
+		return nil, err
+	}
+	if s.suppress, err = suppression.NewManager(s.storage.Suppressions, cfg); err != nil {
+		return nil, err
+	}
+	s.local.SetSuppression(s.suppress)
+
+	// 已认证用户和 API 密钥的提交限速，出站队列按收件人域名限制并发和速率
+	s.limiter = ratelimit.NewLimiter(cfg.Limits)
+	s.local.SetLimiter(s.limiter)
+
+	s.smtp = &smtpd.Server{
+		Addr:            cfg.Listeners.SMTP.Listen,
+		Hostname:        cfg.Server.Hostname,
+		Backend:         s.local,
+		MaxMessageBytes: cfg.Listeners.SMTP.MaxMessageBytes,
+		MaxRecipients:   cfg.Listeners.SMTP.MaxRecipients,
+		Logger:          s.logger,
+	}
+	s.policy = policy.New(cfg.Listeners.SMTP.Policy, s.storage.Greylist)
+	s.policy.Logger = s.logger
+	s.dnsbl = dnsbl.New(cfg.Listeners.SMTP.DNSBL)
+	s.dnsbl.Logger = s.logger
+	s.policy.SetDNSBL(s.dnsbl)
+	s.spam.SetDNSBL(s.dnsbl)
+	s.local.SetSpamFilter(s.spam)
+	s.smtp.Policy = s.policy
+	if cfg.Listeners.SMTP.StartTLS {
+		s.smtp.TLSConfig = s.certs.TLSConfig()
+	}
+
+	// 定时邮件中的本地收件人由 Local 投递，其余交给 sender
+	s.worker = &queue.Worker{
+		Queue:  s.storage.Queue,
+		Sender: s.local.QueueSender(sender),
+		Logger: s.logger,
+		Notify: QueueNotifier(s.webhooks, s.storage),
+
+		Concurrency: cfg.Limits.Delivery.Concurrency,
+		Throttle:    s.limiter,
+	}
+
+	// 批量发送的邮件经 Local 放入出站队列
+	s.bulk = bulk.NewRunner(s.storage.Batches, s.local, cfg.API.Bulk)
+	s.bulk.Logger = s.logger
+	s.bulk.Unsubscribe = s.suppress.Headers
+
+	// HTTP API：全部接口都需要认证，旧的未版本化路径保留兼容，仅限超级管理员
+	authStore := opts.Auth
+	if authStore == nil {
+		authStore = auth.NewMemoryStore()
+	}
+	if s.auth, err = auth.NewService(authStore, cfg.Auth); err != nil {
+		return nil, err
+	}
+	// SMTP 提交的认证方式：用户密码 (PLAIN/LOGIN) 和 IdP 令牌 (XOAUTH2/OAUTHBEARER)
+	var mechs sasl.Multi
+	if cfg.Listeners.SMTP.PasswordAuth {
+		mechs = append(mechs, &sasl.Password{Verify: s.verifyPassword(authStore)})
+	}
+	if cfg.Auth.OIDC.Enabled {
+		client := oidc.NewClient(cfg.Auth.OIDC)
+		s.auth.EnableOIDC(client)
+		if cfg.Auth.OIDC.SASL {
+			mechs = append(mechs, &sasl.OAuth{Verify: s.verifyOAuth(client)})
+		}
+	}
+	if len(mechs) > 0 {
+		s.smtp.Auth = mechs
+		s.smtp.AllowInsecureAuth = cfg.Listeners.SMTP.AllowInsecureAuth
+	}
+	legacy := http.NewServeMux()
+	(&smtp.API{Relay: s.relay, Limiter: s.limiter}).Register(legacy)
+	(&admin.API{Config: s.config, Limiter: s.limiter}).Register(legacy)
+	(&quotaapi.API{Manager: s.storage.Quota}).Register(legacy)
+	mux := http.NewServeMux()
+	mux.Handle("/api/", s.auth.Protect(auth.RoleSuperAdmin, legacy))
+
+	s.v1 = rest.NewRouter("/api/v1", cfg.API.MaxBodyBytes)
+	s.v1.Use(s.auth.Middleware())
+	s.routes(s.v1)
+	mux.Handle(s.v1.Prefix()+"/", s.v1)
+	s.handler = mux
+	s.api = &http.Server{Addr: cfg.API.Listen, Handler: s.handler, ErrorLog: s.logger}
+
+	// 热加载
+	s.config.Subscribe(s.certs)
+	s.config.Subscribe(s.relay)
+	s.config.Subscribe(s.auth)
+	s.config.Subscribe(s.webhooks)
+	s.config.Subscribe(s.bulk)
+	s.config.Subscribe(s.suppress)
+	s.config.Subscribe(s.limiter)
+	s.config.Subscribe(s.policy)
+	s.config.Subscribe(s.dnsbl)
+	s.config.Subscribe(s.spam)
+	s.config.Subscribe(s.local.Router())
+	s.config.Subscribe(config.ReloadFunc(func(c *config.Config) (func(), error) {
+		domains, aliases, err := routing(context.Background(), s.directory, c)
+		return func() { s.local.SetRouting(domains, aliases) }, err
+	}))
+	s.config.Subscribe(config.ReloadFunc(func(c *config.Config) (func(), error) {
+		return func() { s.smtp.SetLimits(c.Listeners.SMTP.MaxMessageBytes, c.Listeners.SMTP.MaxRecipients) }, nil
+	}))
+	return s, nil
+}
+
+// routes 注册 /api/v1 的全部路由，文档路由最后注册以包含其他全部路由
+func (s *Server) routes(r *rest.Router) {
+	(&authapi.API{Service: s.auth}).Routes(r)
+	(&smtp.API{Relay: s.relay, Limiter: s.limiter}).Routes(r)
+	(&admin.API{Config: s.config, Limiter: s.limiter, DNSBL: s.dnsbl}).Routes(r)
+	(&quotaapi.API{Manager: s.storage.Quota}).Routes(r)
+	(&searchapi.API{Store: s.store, Index: s.storage.Index}).Routes(r)
+	(&mailboxapi.API{Store: s.store, Delivery: s.local, Config: s.config, Queue: s.storage.Queue,
+		Templates: s.storage.Templates}).Routes(r)
+	(&templatesapi.API{Store: s.storage.Templates}).Routes(r)
+	(&bulkapi.API{Runner: s.bulk, Templates: s.storage.Templates, Delivery: s.local, Config: s.config, Limiter: s.limiter}).Routes(r)
+	(&suppressionapi.API{Manager: s.suppress}).Routes(r)
+	(&spamapi.API{Filter: s.spam}).Routes(r)
+	(&queueapi.API{Queue: s.storage.Queue}).Routes(r)
+	(&webhookapi.API{Dispatcher: s.webhooks}).Routes(r)
+	(&docs.API{Router: r}).Routes(r)
+}
+
+// APIRouter 返回注册了全部 /api/v1 路由的 Router，用于生成和检查 OpenAPI 文档；
+// 处理函数的依赖均为空，不能用于处理请求
+func APIRouter() *rest.Router {
+	cfg := config.Default()
+	s := &Server{config: config.NewHolder("", cfg), storage: &Storage{}}
+	r := rest.NewRouter("/api/v1", cfg.API.MaxBodyBytes)
+	s.routes(r)
+	return r
+}
+
+// verifyPassword 返回 SMTP PLAIN/LOGIN 认证使用的密码校验，用户还须存在于用户目录
+func (s *Server) verifyPassword(st auth.Store) func(ctx context.Context, user, password string) (string, error) {
+	return func(ctx context.Context, user, password string) (string, error) {
+		username := delivery.Normalize(user)
+		ok, err := st.CheckPassword(ctx, username, password)
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			return "", fmt.Errorf("invalid password for %s", username)
+		}
+		if ok, err = s.directory.UserExists(ctx, username); err != nil {
+			return "", err
+		}
+		if !ok {
+			return "", fmt.Errorf("user %s does not exist", username)
+		}
+		return username, nil
+	}
+}
+
+// verifyOAuth 校验 SMTP AUTH 使用的 IdP 访问令牌，令牌对应的用户必须是本地用户
+func (s *Server) verifyOAuth(client *oidc.Client) func(ctx context.Context, token string) (string, error) {
+	return func(ctx context.Context, token string) (string, error) {
+		claims, err := client.VerifyAccessToken(ctx, token)
+		if err != nil {
+			return "", err
+		}
+		username, err := client.Username(claims)
+		if err != nil {
+			return "", err
+		}
+		ok, err := s.directory.UserExists(ctx, username)
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			return "", fmt.Errorf("user %s does not exist", username)
+		}
+		return username, nil
+	}
+}
+
+// NewLocal 创建本地投递后端，设置本地域名、别名、入站路由和出站队列；hooks 不为空时
+// 发布 message.received 和 message.route_failed 事件
+func NewLocal(ctx context.Context, cfg *config.Config, storage *Storage, dir Directory, hooks *webhook.Dispatcher) (*delivery.Local, error) {
+	local := delivery.NewLocal(storage.Store, storage.Quota, dir)
+	domains, aliases, err := routing(ctx, dir, cfg)
+	if err != nil {
+		return nil, err
+	}
+	local.SetRouting(domains, aliases)
+	local.SetOutbound(storage.Queue)
+	local.SetRouter(inbound.NewRouter(cfg.Server.Routes))
+	if hooks != nil {
+		local.OnReceived(receivedHook(hooks))
+		local.OnRouteFailed(routeFailedHook(hooks))
+	}
+	return local, nil
+}
+
+// routing 合并配置文件和目录中的本地域名与别名，配置文件中的别名优先
+func routing(ctx context.Context, dir Directory, cfg *config.Config) ([]string, map[string]string, error) {
+	domains, aliases, err := dir.Routing(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	domains = append(append([]string(nil), cfg.Server.Domains...), domains...)
+	if aliases == nil {
+		aliases = make(map[string]string)
+	}
+	for address, target := range cfg.Server.Aliases {
+		aliases[address] = target
+	}
+	return domains, aliases, nil
+}
+
+// Config 返回配置持有者，可用于热加载和订阅配置变更
+func (s *Server) Config() *config.Holder {
+	return s.config
+}
+
+// Storage 返回存储栈
+func (s *Server) Storage() *Storage {
+	return s.storage
+}
+
+// Relay 返回出站中继
+func (s *Server) Relay() *core.Relay {
+	return s.relay
+}
+
+// Router 返回 /api/v1 路由器，可在 ServeAPI 之前注册额外的路由或中间件
+func (s *Server) Router() *rest.Router {
+	return s.v1
+}
+
+// Auth 返回 API 认证服务
+func (s *Server) Auth() *auth.Service {
+	return s.auth
+}
+
+// Handler 返回 HTTP API 的 http.Handler，可挂载到调用方自己的 HTTP 服务
+func (s *Server) Handler() http.Handler {
+	return s.handler
+}
+
+// ServeSMTP 在 l 上处理入站 SMTP 连接，直到 ShutdownSMTP 被调用
+func (s *Server) ServeSMTP(l net.Listener) error {
+	err := s.smtp.Serve(l)
+	if err == smtpd.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// ServeAPI 在 l 上提供 HTTP API，直到 ShutdownAPI 被调用
+func (s *Server) ServeAPI(l net.Listener) error {
+	s.logger.Printf("INFO: API server listening on %s", l.Addr())
+	err := s.api.Serve(l)
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// RunQueue 处理出站队列、批量发送和 Webhook 推送直到 ctx 取消，返回前完成当前投递并释放未投递的邮件
+func (s *Server) RunQueue(ctx context.Context) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		s.webhooks.Run(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		s.bulk.Run(ctx)
+	}()
+	s.worker.Run(ctx)
+	wg.Wait()
+}
+
+// Webhooks 返回 Webhook 分发器，可用于发布自定义事件
+func (s *Server) Webhooks() *webhook.Dispatcher {
+	return s.webhooks
+}
+
+// ShutdownAPI 停止 HTTP API 并等待进行中的请求完成
+func (s *Server) ShutdownAPI(ctx context.Context) error {
+	return s.api.Shutdown(ctx)
+}
+
+// ShutdownSMTP 停止入站 SMTP 并等待进行中的事务完成
+func (s *Server) ShutdownSMTP(ctx context.Context) error {
+	return s.smtp.Shutdown(ctx)
+}
+
+// Shutdown 依次停止 HTTP API 和入站 SMTP；出站队列通过取消 RunQueue 的 ctx 停止
+func (s *Server) Shutdown(ctx context.Context) error {
+	return errors.Join(s.ShutdownAPI(ctx), s.ShutdownSMTP(ctx))
+}
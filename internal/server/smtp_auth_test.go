@@ -0,0 +1,92 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+
+	"YoPost/internal/auth/oidc/oidctest"
+	"YoPost/internal/config"
+)
+
+// xoauth2 以 XOAUTH2 发送令牌，收到错误信息后按 RFC 要求回应空响应
+type xoauth2 struct {
+	user, token string
+}
+
+func (a xoauth2) Start(*smtp.ServerInfo) (string, []byte, error) {
+	return "XOAUTH2", []byte("user=" + a.user + "\x01auth=Bearer " + a.token + "\x01\x01"), nil
+}
+
+func (a xoauth2) Next(fromServer []byte, more bool) ([]byte, error) {
+	if more {
+		return []byte{}, nil
+	}
+	return nil, nil
+}
+
+func TestSMTPAuthXOAUTH2(t *testing.T) {
+	idp := oidctest.NewServer("yopost")
+	defer idp.Close()
+
+	cfg := config.Default()
+	cfg.Server.Domains = []string{"example.com"}
+	cfg.Listeners.SMTP.StartTLS = false
+	cfg.Listeners.SMTP.AllowInsecureAuth = true
+	cfg.Auth.JWTSecret = "0123456789abcdef0123456789abcdef"
+	cfg.Auth.OIDC = config.OIDCConfig{Enabled: true, SASL: true, Issuer: idp.URL, ClientID: "yopost",
+		RedirectURL: "http://localhost/api/v1/auth/oidc/callback", UsernameClaim: "email", Audiences: []string{"smtp"}}
+	storage, err := NewMemoryStorage(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := New(Options{Config: cfg, Storage: storage, Directory: NewMemoryDirectory("alice@example.com")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.ServeSMTP(l)
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		s.ShutdownSMTP(ctx)
+	}()
+
+	tests := []struct {
+		name   string
+		user   string
+		claims map[string]interface{}
+		ok     bool
+	}{
+		{"valid", "alice@example.com", map[string]interface{}{"aud": "smtp", "email": "alice@example.com"}, true},
+		{"expired", "alice@example.com", map[string]interface{}{"aud": "smtp", "email": "alice@example.com", "exp": time.Now().Add(-time.Hour).Unix()}, false},
+		{"wrong audience", "alice@example.com", map[string]interface{}{"aud": "yopost-web", "email": "alice@example.com"}, false},
+		{"token of another user", "alice@example.com", map[string]interface{}{"aud": "smtp", "email": "bob@example.com"}, false},
+		{"not a local user", "carol@example.com", map[string]interface{}{"aud": "smtp", "email": "carol@example.com"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := smtp.Dial(l.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+			if err := c.Hello("client.example.com"); err != nil {
+				t.Fatal(err)
+			}
+			err = c.Auth(xoauth2{user: tt.user, token: idp.Token(tt.claims)})
+			if tt.ok && err != nil {
+				t.Errorf("AUTH XOAUTH2 error = %v", err)
+			}
+			if !tt.ok && (err == nil || !strings.HasPrefix(err.Error(), "535")) {
+				t.Errorf("AUTH XOAUTH2 error = %v, want 535", err)
+			}
+		})
+	}
+}
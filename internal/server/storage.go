@@ -0,0 +1,153 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"YoPost/internal/bulk"
+	"YoPost/internal/config"
+	"YoPost/internal/mail/encrypt"
+	"YoPost/internal/mail/policy"
+	"YoPost/internal/mail/queue"
+	"YoPost/internal/mail/store"
+	"YoPost/internal/quota"
+	"YoPost/internal/search"
+	"YoPost/internal/spam"
+	"YoPost/internal/suppression"
+	"YoPost/internal/templates"
+	"YoPost/internal/webhook"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Storage 邮件存储各层
+type Storage struct {
+	// Base 未经过任何包装的存储，写入时不加密，只用于迁移等需要读写原始数据的场景
+	Base store.Store
+	// Store 完整的存储栈: 配额 -> 检索索引 -> 加密 -> Base；Server 的 REST 接口另在外层加上垃圾邮件训练
+	Store store.Store
+	// Encryption 静态加密层，未启用加密时为 nil
+	Encryption *encrypt.Store
+	Index      search.Index
+	Quota      *quota.Manager
+	Queue      queue.Queue
+	// Webhooks Webhook 端点与投递记录，NewStorage 默认使用内存存储
+	Webhooks webhook.Store
+	// Templates 事务邮件模板，NewStorage 默认使用内存存储
+	Templates templates.Store
+	// Batches 批量发送的批次与收件人，NewStorage 默认使用内存存储
+	Batches bulk.Store
+	// Suppressions 抑制列表，NewStorage 默认使用内存存储
+	Suppressions suppression.Store
+	// Greylist 入站 SMTP 灰名单，NewStorage 默认使用内存存储
+	Greylist policy.Store
+	// Spam 每个用户的贝叶斯训练数据，NewStorage 默认使用内存存储
+	Spam spam.Store
+
+	ensureIndexes func(ctx context.Context) error
+}
+
+// EnsureIndexes 创建存储所需的数据库索引
+func (s *Storage) EnsureIndexes(ctx context.Context) error {
+	if s.ensureIndexes == nil {
+		return nil
+	}
+	return s.ensureIndexes(ctx)
+}
+
+// Unmetered 返回不计入配额的存储，用于配额告警等系统邮件；启用加密时仍经过加密层
+func (s *Storage) Unmetered() store.Store {
+	if s.Encryption != nil {
+		return s.Encryption
+	}
+	return s.Base
+}
+
+// NewStorage 在 base 上按配置组装存储栈，index 为未经 Blind 处理的检索索引
+func NewStorage(cfg *config.Config, base store.Store, index search.Index, qb quota.Backend, q queue.Queue) (*Storage, error) {
+	s := &Storage{
+		Base:         base,
+		Quota:        quota.NewManager(qb, cfg.Quota),
+		Queue:        q,
+		Webhooks:     webhook.NewMemoryStore(),
+		Templates:    templates.NewMemoryStore(),
+		Batches:      bulk.NewMemoryStore(),
+		Suppressions: suppression.NewMemoryStore(),
+		Greylist:     policy.NewMemoryStore(),
+		Spam:         spam.NewMemoryStore(),
+	}
+
+	var inner store.Store = base
+	if cfg.Storage.Encryption.Enabled {
+		keyring, err := encrypt.NewKeyringFromConfig(cfg.Storage.Encryption)
+		if err != nil {
+			return nil, fmt.Errorf("storage.encryption: %v", err)
+		}
+		s.Encryption = encrypt.NewStore(inner, keyring)
+		inner = s.Encryption
+		if master, ok := keyring.(*encrypt.MasterKeyring); ok {
+			// 检索词用主密钥派生的密钥做 HMAC，修改 active_key 后需执行 yopost migrate --rotate-keys --reindex
+			_, key, err := master.CurrentKey("\x00search")
+			if err != nil {
+				return nil, err
+			}
+			index = search.Blind(index, key)
+		}
+	}
+
+	s.Index = index
+	s.Store = quota.NewStore(search.NewStore(inner, index), s.Quota)
+	return s, nil
+}
+
+// OpenStorage 在 MongoDB 上组装存储栈
+func OpenStorage(cfg *config.Config, db *mongo.Database) (*Storage, error) {
+	base := store.NewMongoStore(db)
+	index := search.NewMongoIndex(db)
+	q := queue.NewMongoQueue(db)
+	s, err := NewStorage(cfg, base, index, quota.NewMongoBackend(db), q)
+	if err != nil {
+		return nil, err
+	}
+	hooks := webhook.NewMongoStore(db)
+	s.Webhooks = hooks
+	s.Templates = templates.NewMongoStore(db)
+	batches := bulk.NewMongoStore(db)
+	s.Batches = batches
+	suppressions := suppression.NewMongoStore(db)
+	s.Suppressions = suppressions
+	greylist := policy.NewMongoStore(db)
+	s.Greylist = greylist
+	bayes := spam.NewMongoStore(db)
+	s.Spam = bayes
+	s.ensureIndexes = func(ctx context.Context) error {
+		if err := base.EnsureIndexes(ctx); err != nil {
+			return err
+		}
+		if err := index.EnsureIndexes(ctx); err != nil {
+			return err
+		}
+		if err := q.EnsureIndexes(ctx); err != nil {
+			return err
+		}
+		if err := hooks.EnsureIndexes(ctx); err != nil {
+			return err
+		}
+		if err := batches.EnsureIndexes(ctx); err != nil {
+			return err
+		}
+		if err := suppressions.EnsureIndexes(ctx); err != nil {
+			return err
+		}
+		if err := greylist.EnsureIndexes(ctx); err != nil {
+			return err
+		}
+		return bayes.EnsureIndexes(ctx)
+	}
+	return s, nil
+}
+
+// NewMemoryStorage 创建进程内存储，用于测试和嵌入式场景
+func NewMemoryStorage(cfg *config.Config) (*Storage, error) {
+	return NewStorage(cfg, store.NewMemoryStore(), search.NewMemoryIndex(), quota.NewMemoryBackend(), queue.NewMemoryQueue())
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"YoPost/internal/config"
+	"YoPost/internal/mail/delivery"
+	"YoPost/internal/mail/store"
+	"YoPost/internal/quota"
+)
+
+// TestQuotaWarningEncrypted 启用静态加密时配额告警邮件也须加密落库
+func TestQuotaWarningEncrypted(t *testing.T) {
+	ctx := context.Background()
+	keys := filepath.Join(t.TempDir(), "keys.yml")
+	if err := os.WriteFile(keys, []byte("keys:\n  k1: MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.Default()
+	cfg.Storage.Encryption = config.EncryptionConfig{Enabled: true, Mode: "master", MasterKeysFile: keys, ActiveKey: "k1"}
+	storage, err := NewMemoryStorage(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const owner = "alice@example.com"
+	delivery.QuotaWarning(storage.Unmetered())(ctx, owner, quota.Status{}, 80)
+	msgs, err := storage.Base.List(ctx, owner, store.Inbox)
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("Base.List() = %d messages, %v, want 1", len(msgs), err)
+	}
+	if msgs[0].Raw != nil || msgs[0].Envelope == nil {
+		t.Errorf("stored warning raw %q envelope %v, want only the envelope", msgs[0].Raw, msgs[0].Envelope)
+	}
+	got, err := storage.Store.Get(ctx, owner, msgs[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(got.Raw, []byte("Subject: Mailbox quota warning: 80% used")) {
+		t.Errorf("Get() = %q, want the decrypted warning", got.Raw)
+	}
+}
+
+// TestNewKeepsStorage server.New 不应替换调用方 Storage 中的存储栈
+func TestNewKeepsStorage(t *testing.T) {
+	storage, err := NewMemoryStorage(config.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := storage.Store
+	if _, err := New(Options{Config: config.Default(), Storage: storage}); err != nil {
+		t.Fatal(err)
+	}
+	if storage.Store != st {
+		t.Errorf("New() replaced Storage.Store with %T", storage.Store)
+	}
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"YoPost/internal/bulk"
+	"YoPost/internal/mail/delivery"
+	"YoPost/internal/mail/inbound"
+	"YoPost/internal/mail/message"
+	"YoPost/internal/mail/queue"
+	"YoPost/internal/mail/store"
+	"YoPost/internal/quota"
+	"YoPost/internal/suppression"
+	"YoPost/internal/webhook"
+)
+
+// receivedHook 本地投递成功后发布 message.received 事件
+func receivedHook(d *webhook.Dispatcher) delivery.ReceivedFunc {
+	return func(ctx context.Context, msg *store.Message, from string) {
+		data := webhook.MessageData{
+			ID:       msg.ID,
+			Owner:    msg.Owner,
+			Mailbox:  msg.Mailbox,
+			From:     from,
+			Size:     msg.Size,
+			Received: msg.InternalDate,
+		}
+		if p, err := message.ParseHeader(msg.Raw); err == nil {
+			data.Subject, data.MessageID = p.Subject, p.MessageID
+			if len(p.From) > 0 {
+				data.HeaderFrom = p.From[0].Address
+			}
+		}
+		d.Publish(ctx, webhook.EventMessageReceived, data)
+	}
+}
+
+// routeFailedHook 入站路由转存后发布 message.route_failed 事件
+func routeFailedHook(d *webhook.Dispatcher) delivery.RouteFailedFunc {
+	return func(ctx context.Context, route *inbound.Route, from, rcpt string, stored *store.Message, cause error) {
+		d.Publish(ctx, webhook.EventRouteFailed, webhook.RouteFailedData{
+			Route:    route.Match,
+			URL:      route.URL,
+			From:     from,
+			To:       rcpt,
+			Error:    cause.Error(),
+			StoredID: stored.ID,
+			StoredIn: stored.Owner,
+		})
+	}
+}
+
+// QueueNotifier 返回出站队列投递结果对应的 Webhook 事件发布函数，
+// 批量邮件的结果同时写回 st.Batches，硬退信的地址加入 st.Suppressions
+func QueueNotifier(d *webhook.Dispatcher, st *Storage) queue.Notifier {
+	recordBatch := bulk.Notifier(st.Batches)
+	suppress := suppression.Notifier(st.Suppressions)
+	return func(ctx context.Context, item *queue.Item, result queue.Result, err error) {
+		recordBatch(ctx, item, result, err)
+		suppress(ctx, item, result, err)
+		data := webhook.DeliveryData{
+			QueueID:  item.ID,
+			Owner:    item.Owner,
+			From:     item.From,
+			To:       item.To,
+			BatchID:  item.Batch,
+			Attempts: item.Attempts,
+		}
+		if err != nil {
+			data.Error = err.Error()
+		}
+		if p, err := message.ParseHeader(item.Raw); err == nil {
+			data.Subject, data.MessageID = p.Subject, p.MessageID
+		}
+		event := webhook.EventMessageDelivered
+		switch result {
+		case queue.Deferred:
+			event = webhook.EventMessageDeferred
+			next := item.NextAttempt.UTC().Truncate(time.Second)
+			data.NextAttempt = &next
+		case queue.Bounced:
+			event = webhook.EventMessageBounced
+		}
+		d.Publish(ctx, event, data)
+	}
+}
+
+// quotaNotifier 在 next 之外发布 mailbox.quota_warning 事件
+func quotaNotifier(d *webhook.Dispatcher, next quota.Notifier) quota.Notifier {
+	return func(ctx context.Context, owner string, status quota.Status, threshold int) {
+		next(ctx, owner, status, threshold)
+		d.Publish(ctx, webhook.EventQuotaWarning, webhook.QuotaData{
+			Owner:         owner,
+			Threshold:     threshold,
+			Percent:       status.Percent(),
+			UsedBytes:     status.Usage.Bytes,
+			LimitBytes:    status.Limits.Bytes,
+			UsedMessages:  status.Usage.Messages,
+			LimitMessages: status.Limits.Messages,
+		})
+	}
+}
@@ -19,10 +19,12 @@ func SendTestEmail(to string, subject string, body string) error {
 	}
 
 	// 初始化邮件服务器配置
-	if err := core.InitMailServer(); err != nil {
+	cfg, err := config.Load("")
+	if err != nil {
 		log.Printf("ERROR: Failed to init mail server - %v", err)
 		return err
 	}
+	relay := core.NewRelay(cfg.Relay)
 
 	// 获取第一个测试用户
 	user := testCfg.Userinfo[0]
@@ -34,7 +36,7 @@ func SendTestEmail(to string, subject string, body string) error {
 		body + "\r\n")
 
 	// 调用核心邮件发送功能
-	err = core.TLSstatus(user.Email, []string{to}, msg, user.Username, user.Password)
+	err = relay.Send(user.Email, []string{to}, msg, user.Username, user.Password)
 	if err != nil {
 		log.Printf("ERROR: Failed to send test email - %v", err)
 		return err
@@ -0,0 +1,133 @@
+package spam
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"YoPost/internal/mail/message"
+	"YoPost/internal/search"
+)
+
+// ErrNotFound 邮件未被学习过
+var ErrNotFound = errors.New("spam: message not trained")
+
+// Counts 词或邮件在学习过的垃圾邮件和正常邮件中出现的次数
+type Counts struct {
+	Spam int `bson:"spam" json:"spam"`
+	Ham  int `bson:"ham" json:"ham"`
+}
+
+// Store 每个用户的贝叶斯训练数据
+type Store interface {
+	// Counts 返回 owner 的词频，未出现过的词不返回；空字符串的计数为学习过的邮件数
+	Counts(ctx context.Context, owner string, tokens []string) (map[string]Counts, error)
+	// Add 将每个词的计数加上 delta，计数不小于 0
+	Add(ctx context.Context, owner string, tokens []string, delta Counts) error
+	// Trained 返回邮件学习时的分类，未学习过时返回 ErrNotFound
+	Trained(ctx context.Context, owner, id string) (spam bool, err error)
+	// SetTrained 记录邮件学习时的分类
+	SetTrained(ctx context.Context, owner, id string, spam bool) error
+	// Reset 删除 owner 的全部词频和学习记录
+	Reset(ctx context.Context, owner string) error
+}
+
+const (
+	// maxTokens 每封邮件最多使用的不同词数
+	maxTokens = 3000
+	// maxInteresting 分类时使用的概率离 0.5 最远的词数
+	maxInteresting = 150
+)
+
+// tokenize 返回邮件用于分类的词：主题、发件人域名、链接主机名和附件类型带前缀，正文词不带前缀。
+// 正文按检索索引的方式分词 (中日韩文字按二元组)，过短、过长和纯数字的词不使用
+func tokenize(p *message.Parsed) []string {
+	var out []string
+	for _, t := range search.Tokenize(p.Subject) {
+		out = append(out, "subject:"+t)
+	}
+	for _, a := range p.From {
+		out = append(out, "from:"+domain(a.Address))
+	}
+	for _, m := range urlRe.FindAllStringSubmatch(p.Text+"\n"+p.HTML, -1) {
+		out = append(out, "url:"+strings.ToLower(m[1]))
+	}
+	for _, a := range p.Attachments {
+		out = append(out, "attachment:"+strings.ToLower(a.ContentType))
+	}
+	for _, t := range search.Tokenize(p.PlainText()) {
+		if n := utf8.RuneCountInString(t); n < 2 || n > 30 || (n < 3 && t[0] < utf8.RuneSelf) || strings.Trim(t, "0123456789") == "" {
+			continue
+		}
+		out = append(out, t)
+	}
+	out = search.Unique(out)
+	if len(out) > maxTokens {
+		out = out[:maxTokens]
+	}
+	return out
+}
+
+// classify 返回 owner 的分类器给出的垃圾邮件概率 (Robinson-Fisher 卡方合并)，
+// 垃圾邮件或正常邮件学习得不足 min_messages 封时返回 -1
+func (f *Filter) classify(ctx context.Context, s *settings, owner string, tokens []string) (float64, error) {
+	counts, err := f.store.Counts(ctx, owner, append(append([]string(nil), tokens...), ""))
+	if err != nil {
+		return 0, err
+	}
+	total := counts[""]
+	if total.Spam < s.Bayes.MinMessages || total.Ham < s.Bayes.MinMessages {
+		return -1, nil
+	}
+
+	var probs []float64
+	for _, t := range tokens {
+		c, ok := counts[t]
+		if !ok {
+			continue
+		}
+		spam := math.Min(1, float64(c.Spam)/float64(total.Spam))
+		ham := math.Min(1, float64(c.Ham)/float64(total.Ham))
+		if spam+ham == 0 {
+			continue
+		}
+		// 出现次数少的词向 0.5 收缩 (强度 1，先验 0.5)
+		n := float64(c.Spam + c.Ham)
+		p := (0.5 + n*spam/(spam+ham)) / (1 + n)
+		if math.Abs(p-0.5) < 0.1 {
+			continue
+		}
+		probs = append(probs, math.Max(0.01, math.Min(0.99, p)))
+	}
+	if len(probs) == 0 {
+		return 0.5, nil
+	}
+	sort.Slice(probs, func(i, j int) bool { return math.Abs(probs[i]-0.5) > math.Abs(probs[j]-0.5) })
+	if len(probs) > maxInteresting {
+		probs = probs[:maxInteresting]
+	}
+
+	var lnSpam, lnHam float64
+	for _, p := range probs {
+		lnSpam += math.Log(p)
+		lnHam += math.Log(1 - p)
+	}
+	spamminess := chi2Q(-2*lnSpam, 2*len(probs))
+	hamminess := chi2Q(-2*lnHam, 2*len(probs))
+	return (1 + spamminess - hamminess) / 2, nil
+}
+
+// chi2Q 自由度为偶数 v 的卡方分布上尾概率
+func chi2Q(x2 float64, v int) float64 {
+	m := x2 / 2
+	term := math.Exp(-m)
+	sum := term
+	for i := 1; i < v/2; i++ {
+		term *= m / float64(i)
+		sum += term
+	}
+	return math.Min(sum, 1)
+}
@@ -0,0 +1,136 @@
+package spam
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+
+	"YoPost/internal/config"
+	"YoPost/internal/mail/message"
+)
+
+func raw(from, subject, body string) []byte {
+	return []byte(fmt.Sprintf("From: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s\r\n", from, subject, body))
+}
+
+func TestTokenize(t *testing.T) {
+	p, err := message.Parse(raw("Shop <deals@Promo.Example.com>", "Cheap Watches", "Buy cheap watches at https://Win.Example.net/x 12345 ab 特价商品"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens := tokenize(p)
+	tests := []struct {
+		token string
+		want  bool
+	}{
+		{"subject:cheap", true},
+		{"subject:watches", true},
+		{"from:promo.example.com", true},
+		{"url:win.example.net", true},
+		{"cheap", true},
+		{"特价", true},
+		{"价商", true},
+		{"at", false},
+		{"ab", false},
+		{"12345", false},
+	}
+	for _, tt := range tests {
+		if got := slices.Contains(tokens, tt.token); got != tt.want {
+			t.Errorf("tokenize() contains %q = %v, want %v (tokens %v)", tt.token, got, tt.want, tokens)
+		}
+	}
+}
+
+func newBayesFilter(t *testing.T) *Filter {
+	t.Helper()
+	f, err := NewFilter(config.SpamConfig{Enabled: true, Bayes: config.SpamBayesConfig{Enabled: true, MinMessages: 3, Weight: 5}}, NewMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestClassify(t *testing.T) {
+	ctx := context.Background()
+	const owner = "alice@example.com"
+	f := newBayesFilter(t)
+	probability := func(msg []byte) float64 {
+		t.Helper()
+		p, err := message.Parse(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, err := f.classify(ctx, f.settings.Load(), owner, tokenize(p))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	spammy := raw("Winner <prize@lottery.example>", "Claim your prize", "Congratulations winner, claim your lottery prize now")
+	hammy := raw("Bob <bob@example.com>", "Meeting notes", "Attached are the notes from the project meeting")
+
+	if got := probability(spammy); got != -1 {
+		t.Errorf("classify() before training = %v, want -1", got)
+	}
+	for i := 0; i < 3; i++ {
+		id := fmt.Sprint(i)
+		if err := f.Learn(ctx, owner, "spam"+id, raw("Winner <prize@lottery.example>", "Claim your prize "+id, "Congratulations winner, claim your lottery prize"), true); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Learn(ctx, owner, "ham"+id, raw("Bob <bob@example.com>", "Project meeting "+id, "Notes from the project meeting are attached"), false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		msg      []byte
+		min, max float64
+	}{
+		{"spam", spammy, 0.9, 1},
+		{"ham", hammy, 0, 0.1},
+		{"unknown words", raw("Carol <carol@other.example>", "Holiday", "Photographs beach sunshine"), 0.5, 0.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := probability(tt.msg); got < tt.min || got > tt.max {
+				t.Errorf("classify() = %v, want between %v and %v", got, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestLearn(t *testing.T) {
+	ctx := context.Background()
+	const owner = "alice@example.com"
+	msg := raw("Bob <bob@example.com>", "Hello", "Lunch tomorrow")
+
+	tests := []struct {
+		name  string
+		learn []bool
+		want  Counts
+	}{
+		{"spam", []bool{true}, Counts{Spam: 1}},
+		{"same class twice", []bool{false, false}, Counts{Ham: 1}},
+		{"reclassified", []bool{true, false}, Counts{Ham: 1}},
+		{"reclassified back", []bool{true, false, true}, Counts{Spam: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newBayesFilter(t)
+			for _, spam := range tt.learn {
+				if err := f.Learn(ctx, owner, "1", msg, spam); err != nil {
+					t.Fatal(err)
+				}
+			}
+			tr, err := f.Training(ctx, owner)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tr.Counts != tt.want {
+				t.Errorf("Training() = %+v, want %+v", tr.Counts, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package spam
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryStore 进程内训练数据存储
+type MemoryStore struct {
+	mu      sync.Mutex
+	tokens  map[string]map[string]Counts
+	trained map[string]map[string]bool
+}
+
+// NewMemoryStore 创建内存存储
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{tokens: make(map[string]map[string]Counts), trained: make(map[string]map[string]bool)}
+}
+
+func (s *MemoryStore) Counts(ctx context.Context, owner string, tokens []string) (map[string]Counts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string]Counts)
+	for _, t := range tokens {
+		if c, ok := s.tokens[owner][t]; ok {
+			out[t] = c
+		}
+	}
+	return out, nil
+}
+
+func (s *MemoryStore) Add(ctx context.Context, owner string, tokens []string, delta Counts) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := s.tokens[owner]
+	if m == nil {
+		m = make(map[string]Counts)
+		s.tokens[owner] = m
+	}
+	for _, t := range tokens {
+		c := m[t]
+		c.Spam = max(0, c.Spam+delta.Spam)
+		c.Ham = max(0, c.Ham+delta.Ham)
+		if c == (Counts{}) {
+			delete(m, t)
+			continue
+		}
+		m[t] = c
+	}
+	return nil
+}
+
+func (s *MemoryStore) Trained(ctx context.Context, owner, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	spam, ok := s.trained[owner][id]
+	if !ok {
+		return false, ErrNotFound
+	}
+	return spam, nil
+}
+
+func (s *MemoryStore) SetTrained(ctx context.Context, owner, id string, spam bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.trained[owner] == nil {
+		s.trained[owner] = make(map[string]bool)
+	}
+	s.trained[owner][id] = spam
+	return nil
+}
+
+func (s *MemoryStore) Reset(ctx context.Context, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tokens, owner)
+	delete(s.trained, owner)
+	return nil
+}
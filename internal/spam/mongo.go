@@ -0,0 +1,123 @@
+package spam
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore 基于 MongoDB 的训练数据存储：spam_tokens 集合保存每个用户的词频，
+// spam_trained 集合记录学习过的邮件
+type MongoStore struct {
+	tokens  *mongo.Collection
+	trained *mongo.Collection
+}
+
+type mongoToken struct {
+	Key    string `bson:"_id"`
+	Owner  string `bson:"owner"`
+	Token  string `bson:"token"`
+	Counts `bson:",inline"`
+}
+
+type mongoTrained struct {
+	Key       string    `bson:"_id"`
+	Owner     string    `bson:"owner"`
+	Spam      bool      `bson:"spam"`
+	TrainedAt time.Time `bson:"trained_at"`
+}
+
+// NewMongoStore 创建 MongoDB 存储
+func NewMongoStore(db *mongo.Database) *MongoStore {
+	return &MongoStore{tokens: db.Collection("spam_tokens"), trained: db.Collection("spam_trained")}
+}
+
+// EnsureIndexes 创建按用户删除训练数据使用的索引
+func (s *MongoStore) EnsureIndexes(ctx context.Context) error {
+	for _, c := range []*mongo.Collection{s.tokens, s.trained} {
+		if _, err := c.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "owner", Value: 1}}}); err != nil {
+			return fmt.Errorf("failed to create %s indexes: %v", c.Name(), err)
+		}
+	}
+	return nil
+}
+
+func key(owner, s string) string {
+	return owner + "\x00" + s
+}
+
+func (s *MongoStore) Counts(ctx context.Context, owner string, tokens []string) (map[string]Counts, error) {
+	keys := make([]string, len(tokens))
+	for i, t := range tokens {
+		keys[i] = key(owner, t)
+	}
+	cur, err := s.tokens.Find(ctx, bson.M{"_id": bson.M{"$in": keys}})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	out := make(map[string]Counts)
+	for cur.Next(ctx) {
+		var doc mongoToken
+		if err := cur.Decode(&doc); err != nil {
+			return nil, err
+		}
+		out[doc.Token] = doc.Counts
+	}
+	return out, cur.Err()
+}
+
+// Add 以更新管道累加计数，计数不小于 0
+func (s *MongoStore) Add(ctx context.Context, owner string, tokens []string, delta Counts) error {
+	if len(tokens) == 0 {
+		return nil
+	}
+	inc := func(field string, n int) bson.M {
+		return bson.M{"$max": bson.A{0, bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$" + field, 0}}, n}}}}
+	}
+	models := make([]mongo.WriteModel, len(tokens))
+	for i, t := range tokens {
+		models[i] = mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": key(owner, t)}).
+			SetUpdate(mongo.Pipeline{{{Key: "$set", Value: bson.D{
+				{Key: "owner", Value: owner},
+				{Key: "token", Value: t},
+				{Key: "spam", Value: inc("spam", delta.Spam)},
+				{Key: "ham", Value: inc("ham", delta.Ham)},
+			}}}}).
+			SetUpsert(true)
+	}
+	_, err := s.tokens.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+func (s *MongoStore) Trained(ctx context.Context, owner, id string) (bool, error) {
+	var doc mongoTrained
+	err := s.trained.FindOne(ctx, bson.M{"_id": key(owner, id)}).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return false, ErrNotFound
+	}
+	if err != nil {
+		return false, err
+	}
+	return doc.Spam, nil
+}
+
+func (s *MongoStore) SetTrained(ctx context.Context, owner, id string, spam bool) error {
+	doc := mongoTrained{Key: key(owner, id), Owner: owner, Spam: spam, TrainedAt: time.Now()}
+	_, err := s.trained.ReplaceOne(ctx, bson.M{"_id": doc.Key}, doc, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (s *MongoStore) Reset(ctx context.Context, owner string) error {
+	if _, err := s.tokens.DeleteMany(ctx, bson.M{"owner": owner}); err != nil {
+		return err
+	}
+	_, err := s.trained.DeleteMany(ctx, bson.M{"owner": owner})
+	return err
+}
@@ -0,0 +1,200 @@
+package spam
+
+import (
+	"fmt"
+	"net/mail"
+	"net/textproto"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"YoPost/internal/config"
+	"YoPost/internal/mail/message"
+)
+
+// rule 一项头部或正文检查
+type rule struct {
+	name  string
+	score float64
+	match func(p *message.Parsed) bool
+}
+
+var (
+	// urlRe 匹配正文中的 http(s) 链接，子匹配为主机名
+	urlRe = regexp.MustCompile(`(?i)https?://([a-z0-9.\-\[\]:]+)`)
+	// numericHostRe 以 IP 地址为主机名的链接
+	numericHostRe = regexp.MustCompile(`^\[?[0-9.:a-f]*[0-9]\]?(:[0-9]+)?$`)
+	// executables 常被用于投放恶意软件的附件扩展名
+	executables = map[string]bool{".exe": true, ".scr": true, ".pif": true, ".com": true, ".bat": true, ".cmd": true,
+		".js": true, ".vbs": true, ".jar": true, ".msi": true, ".hta": true, ".lnk": true}
+)
+
+// builtin 内置检查，得分可以被同名的无 pattern 自定义规则覆盖
+var builtin = []rule{
+	{"MISSING_FROM", 2, func(p *message.Parsed) bool { return len(p.From) == 0 }},
+	{"MISSING_DATE", 1, func(p *message.Parsed) bool { return p.Header.Get("Date") == "" }},
+	{"MISSING_MESSAGE_ID", 1, func(p *message.Parsed) bool { return p.MessageID == "" }},
+	{"MISSING_SUBJECT", 0.5, func(p *message.Parsed) bool { return strings.TrimSpace(p.Subject) == "" }},
+	{"DATE_IN_FUTURE", 1.5, func(p *message.Parsed) bool { return p.Date.After(time.Now().Add(24 * time.Hour)) }},
+	{"SUBJECT_ALL_CAPS", 1, func(p *message.Parsed) bool { return allCaps(p.Subject) }},
+	{"FROM_NAME_SPOOF", 2.5, fromNameSpoof},
+	{"REPLY_TO_OTHER_DOMAIN", 0.5, replyToOtherDomain},
+	{"HTML_ONLY", 0.5, func(p *message.Parsed) bool { return p.Text == "" && p.HTML != "" }},
+	{"URL_NUMERIC_IP", 1.5, numericURL},
+	{"EXECUTABLE_ATTACHMENT", 3, func(p *message.Parsed) bool {
+		for _, a := range p.Attachments {
+			if executables[strings.ToLower(path.Ext(a.Filename))] {
+				return true
+			}
+		}
+		return false
+	}},
+}
+
+// authScores 受信任的 Authentication-Results 中各方法结果的默认得分
+var authScores = map[string]float64{
+	"SPF_FAIL":     1.5,
+	"SPF_SOFTFAIL": 0.7,
+	"DKIM_FAIL":    1,
+	"DKIM_PASS":    -0.2,
+	"DMARC_FAIL":   2.5,
+	"DMARC_PASS":   -0.5,
+}
+
+// known 判断 name 是否为内置检查
+func known(name string) bool {
+	if _, ok := authScores[name]; ok || name == "MALFORMED_MESSAGE" {
+		return true
+	}
+	for _, r := range builtin {
+		if r.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// customRule 编译配置中的规则，header 为空时匹配正文的纯文本
+func customRule(r config.SpamRule) (rule, error) {
+	re, err := regexp.Compile(r.Pattern)
+	if err != nil {
+		return rule{}, fmt.Errorf("spam rule %s: %v", r.Name, err)
+	}
+	header := textproto.CanonicalMIMEHeaderKey(r.Header)
+	return rule{name: r.Name, score: r.Score, match: func(p *message.Parsed) bool {
+		if header == "" {
+			return re.MatchString(p.PlainText())
+		}
+		for _, v := range p.Header[header] {
+			if re.MatchString(message.DecodeHeader(v)) {
+				return true
+			}
+		}
+		return false
+	}}, nil
+}
+
+// allCaps 至少包含 10 个字母且全部为大写
+func allCaps(s string) bool {
+	letters := 0
+	for _, r := range s {
+		if unicode.IsLower(r) {
+			return false
+		}
+		if unicode.IsUpper(r) {
+			letters++
+		}
+	}
+	return letters >= 10
+}
+
+func domain(address string) string {
+	return strings.ToLower(address[strings.LastIndexByte(address, '@')+1:])
+}
+
+// fromNameSpoof From 的显示名称中包含另一个域名的地址，如 "service@bank.example" <x@other.example>
+func fromNameSpoof(p *message.Parsed) bool {
+	for _, a := range p.From {
+		if i := strings.IndexByte(a.Name, '@'); i > 0 {
+			name := strings.Trim(a.Name[i+1:], " \"'<>()")
+			if name != "" && !strings.EqualFold(name, domain(a.Address)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// replyToOtherDomain Reply-To 指向与 From 不同的域名
+func replyToOtherDomain(p *message.Parsed) bool {
+	if len(p.From) == 0 {
+		return false
+	}
+	from := domain(p.From[0].Address)
+	for _, a := range message.ParseAddressList(p.Header.Get("Reply-To")) {
+		if domain(a.Address) != from {
+			return true
+		}
+	}
+	return false
+}
+
+// numericURL 正文中有以 IP 地址为主机名的链接
+func numericURL(p *message.Parsed) bool {
+	for _, m := range urlRe.FindAllStringSubmatch(p.Text+"\n"+p.HTML, -1) {
+		if numericHostRe.MatchString(strings.ToLower(m[1])) {
+			return true
+		}
+	}
+	return false
+}
+
+// authResults 返回 Authentication-Results 头部 (RFC 8601) 中各方法的结果。只采信最上面一个 authserv-id
+// 受信任的头部，它由最后经过的受信任 MTA 添加；其下带有受信任 ID 的头部来自外部，可能是伪造的 (RFC 8601 第 5 节)。
+// 该头部中同一方法有多个结果时 (如多个 DKIM 签名) 任一 pass 即为 pass
+func authResults(h mail.Header, trusted map[string]bool) map[string]string {
+	results := make(map[string]string)
+	if len(trusted) == 0 {
+		return results
+	}
+	for _, v := range h["Authentication-Results"] {
+		parts := strings.Split(stripComments(v), ";")
+		if id := strings.Fields(parts[0]); len(id) == 0 || !trusted[strings.ToLower(id[0])] {
+			continue
+		}
+		for _, part := range parts[1:] {
+			fields := strings.Fields(part)
+			if len(fields) == 0 {
+				continue
+			}
+			method, result, ok := strings.Cut(strings.ToLower(fields[0]), "=")
+			if !ok {
+				continue
+			}
+			if prev, seen := results[method]; !seen || (prev != "pass" && result == "pass") {
+				results[method] = result
+			}
+		}
+		break
+	}
+	return results
+}
+
+// stripComments 删除头部中的 (注释)
+func stripComments(v string) string {
+	var b strings.Builder
+	depth := 0
+	for _, r := range v {
+		switch {
+		case r == '(':
+			depth++
+		case r == ')' && depth > 0:
+			depth--
+		case depth == 0:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
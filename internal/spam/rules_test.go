@@ -0,0 +1,64 @@
+package spam
+
+import (
+	"maps"
+	"net/mail"
+	"testing"
+)
+
+func TestAuthResults(t *testing.T) {
+	trusted := map[string]bool{"mx.example.com": true}
+	header := func(values ...string) mail.Header {
+		return mail.Header{"Authentication-Results": values}
+	}
+	tests := []struct {
+		name    string
+		header  mail.Header
+		trusted map[string]bool
+		want    map[string]string
+	}{
+		{"trusted", header("mx.example.com; spf=pass smtp.mailfrom=a.example; dkim=pass header.d=a.example; dmarc=pass"), trusted,
+			map[string]string{"spf": "pass", "dkim": "pass", "dmarc": "pass"}},
+		{"forged below trusted", header(
+			"mx.example.com; spf=fail smtp.mailfrom=bank.example; dmarc=fail",
+			"mx.example.com; spf=pass smtp.mailfrom=bank.example; dkim=pass; dmarc=pass"), trusted,
+			map[string]string{"spf": "fail", "dmarc": "fail"}},
+		{"untrusted above trusted", header(
+			"relay.other.example; spf=pass; dmarc=pass",
+			"MX.Example.com (comment); spf=softfail"), trusted,
+			map[string]string{"spf": "softfail"}},
+		{"any dkim signature passes", header("mx.example.com; dkim=fail header.d=a.example; dkim=pass header.d=b.example"), trusted,
+			map[string]string{"dkim": "pass"}},
+		{"untrusted only", header("relay.other.example; spf=pass"), trusted, map[string]string{}},
+		{"nothing trusted", header("mx.example.com; spf=pass"), nil, map[string]string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := authResults(tt.header, tt.trusted); !maps.Equal(got, tt.want) {
+				t.Errorf("authResults() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripHeaders(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"forged score", "X-Spam-Score: -10.0\r\nX-Spam-Status: No, score=-10.0\r\n tests=none\r\nSubject: hi\r\n\r\nX-Spam-Score: body\r\n",
+			"Subject: hi\r\n\r\nX-Spam-Score: body\r\n"},
+		{"case-insensitive", "Subject: hi\r\nx-spam-flag: NO\r\nFrom: a@example.com\r\n\r\nbody\r\n",
+			"Subject: hi\r\nFrom: a@example.com\r\n\r\nbody\r\n"},
+		{"other x headers kept", "X-Spamd-Result: 1\r\nX-Mailer: test\r\n\r\nbody\r\n", "X-Spamd-Result: 1\r\nX-Mailer: test\r\n\r\nbody\r\n"},
+		{"no body", "X-Spam-Score: 1\nSubject: hi\n", "Subject: hi\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(StripHeaders([]byte(tt.data))); got != tt.want {
+				t.Errorf("StripHeaders() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
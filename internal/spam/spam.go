@@ -0,0 +1,369 @@
+// Package spam 入站垃圾邮件评分：头部和正文规则、受信任的 Authentication-Results、DNS 列表命中
+// 和每个用户的贝叶斯分类器的得分相加，写入 X-Spam-Score/X-Spam-Status 头部，达到 tag_score 的邮件存入 Junk。
+// 用户将邮件移入或移出 Junk 时分类器学习该邮件，见 TrainingStore
+package spam
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"YoPost/internal/config"
+	"YoPost/internal/mail/dnsbl"
+	"YoPost/internal/mail/message"
+	"YoPost/internal/mail/smtpd"
+)
+
+// Test 一项计分的检查
+type Test struct {
+	Name  string  `json:"name"`
+	Score float64 `json:"score"`
+}
+
+// Result 一封邮件对一个收件人的评分
+type Result struct {
+	Score float64 `json:"score"`
+	// Required 判定为垃圾邮件的分数 (tag_score)
+	Required float64 `json:"required"`
+	Spam     bool    `json:"spam"`
+	// Junk 邮件应存入 Junk
+	Junk bool `json:"junk"`
+	// Bayes 贝叶斯分类器给出的垃圾邮件概率，未启用或训练不足时为 -1
+	Bayes float64 `json:"bayes"`
+	Tests []Test  `json:"tests"`
+}
+
+// Headers 返回添加到邮件开头的 X-Spam-Score 和 X-Spam-Status 头部
+func (r *Result) Headers() string {
+	status := "No"
+	if r.Spam {
+		status = "Yes"
+	}
+	names := make([]string, len(r.Tests))
+	for i, t := range r.Tests {
+		names[i] = t.Name
+	}
+	tests := strings.Join(names, ",")
+	if tests == "" {
+		tests = "none"
+	}
+	return fmt.Sprintf("X-Spam-Score: %.1f\r\nX-Spam-Status: %s, score=%.1f required=%.1f tests=%s\r\n",
+		r.Score, status, r.Score, r.Required, tests)
+}
+
+// StripHeaders 删除邮件头部中已有的 X-Spam-* 字段 (含折行部分)，在添加 Headers 之前调用，
+// 防止发件方伪造评分结果
+func StripHeaders(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	skip := false
+	for rest := data; len(rest) > 0; {
+		line := rest
+		if i := bytes.IndexByte(rest, '\n'); i >= 0 {
+			line = rest[:i+1]
+		}
+		rest = rest[len(line):]
+		if len(bytes.TrimRight(line, "\r\n")) == 0 {
+			// 空行之后为正文，原样保留
+			return append(append(out, line...), rest...)
+		}
+		if line[0] != ' ' && line[0] != '\t' {
+			skip = len(line) > 7 && strings.EqualFold(string(line[:7]), "X-Spam-")
+		}
+		if !skip {
+			out = append(out, line...)
+		}
+	}
+	return out
+}
+
+// settings 解析后的配置，热加载时整体替换
+type settings struct {
+	config.SpamConfig
+	rules   []rule
+	scores  map[string]float64
+	trusted map[string]bool
+}
+
+func newSettings(cfg config.SpamConfig) (*settings, error) {
+	s := &settings{SpamConfig: cfg, scores: make(map[string]float64), trusted: make(map[string]bool)}
+	for _, id := range cfg.TrustedAuthservIDs {
+		s.trusted[strings.ToLower(id)] = true
+	}
+	for _, r := range cfg.Rules {
+		if r.Pattern == "" {
+			// 没有 pattern 的规则只修改同名内置检查的得分
+			if !known(r.Name) {
+				return nil, fmt.Errorf("spam rule %s: pattern is required unless overriding a built-in test", r.Name)
+			}
+			s.scores[r.Name] = r.Score
+			continue
+		}
+		cr, err := customRule(r)
+		if err != nil {
+			return nil, err
+		}
+		s.rules = append(s.rules, cr)
+	}
+	return s, nil
+}
+
+// score 返回内置检查的得分，可被同名的自定义规则覆盖
+func (s *settings) score(name string, def float64) float64 {
+	if v, ok := s.scores[name]; ok {
+		return v
+	}
+	return def
+}
+
+// Filter 垃圾邮件评分，注册到 config.Holder 后支持热加载
+type Filter struct {
+	store    Store
+	dnsbl    *dnsbl.Checker
+	settings atomic.Pointer[settings]
+	// Logger 为空时使用 log 包的默认 Logger
+	Logger *log.Logger
+}
+
+// NewFilter 创建 Filter，st 保存每个用户的贝叶斯训练数据
+func NewFilter(cfg config.SpamConfig, st Store) (*Filter, error) {
+	s, err := newSettings(cfg)
+	if err != nil {
+		return nil, err
+	}
+	f := &Filter{store: st}
+	f.settings.Store(s)
+	return f, nil
+}
+
+// PrepareReload 新的阈值和规则对之后投递的邮件生效
+func (f *Filter) PrepareReload(cfg *config.Config) (func(), error) {
+	s, err := newSettings(cfg.Spam)
+	if err != nil {
+		return nil, err
+	}
+	return func() { f.settings.Store(s) }, nil
+}
+
+// SetDNSBL 设置 DNS 列表查询，命中列表的权重乘以 dnsbl_weight 计入得分；查询结果与 SMTP 连接策略共用缓存
+func (f *Filter) SetDNSBL(c *dnsbl.Checker) {
+	f.dnsbl = c
+}
+
+func (f *Filter) logf(format string, args ...interface{}) {
+	if f.Logger != nil {
+		f.Logger.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+// Enabled 判断是否启用了评分
+func (f *Filter) Enabled() bool {
+	return f.settings.Load().Enabled
+}
+
+// Analysis 一封邮件中与收件人无关的检查结果
+type Analysis struct {
+	filter   *Filter
+	settings *settings
+	env      *smtpd.Envelope
+	tests    []Test
+	score    float64
+	// tokens 贝叶斯分类使用的词，未启用分类器时为空
+	tokens []string
+}
+
+func (a *Analysis) add(name string, score float64) {
+	if score == 0 {
+		return
+	}
+	a.tests = append(a.tests, Test{Name: name, Score: score})
+	a.score += score
+}
+
+// Analyze 执行规则、认证结果和 DNS 列表检查，返回的 Analysis 再按收件人加上贝叶斯得分
+func (f *Filter) Analyze(ctx context.Context, env *smtpd.Envelope) *Analysis {
+	s := f.settings.Load()
+	a := &Analysis{filter: f, settings: s, env: env}
+
+	p, err := message.Parse(env.Data)
+	if err != nil {
+		a.add("MALFORMED_MESSAGE", s.score("MALFORMED_MESSAGE", 2))
+	} else {
+		for _, r := range builtin {
+			if r.match(p) {
+				a.add(r.name, s.score(r.name, r.score))
+			}
+		}
+		for _, r := range s.rules {
+			if r.match(p) {
+				a.add(r.name, r.score)
+			}
+		}
+		for method, result := range authResults(p.Header, s.trusted) {
+			name := strings.ToUpper(method + "_" + result)
+			if def, ok := authScores[name]; ok {
+				a.add(name, s.score(name, def))
+			}
+		}
+		if s.Bayes.Enabled {
+			a.tokens = tokenize(p)
+		}
+	}
+
+	if f.dnsbl != nil && f.dnsbl.Enabled() && s.DNSBLWeight > 0 {
+		r := &dnsbl.Result{}
+		if tcp, ok := env.RemoteAddr.(*net.TCPAddr); ok {
+			r.Merge(f.dnsbl.CheckIP(ctx, tcp.IP))
+		}
+		r.Merge(f.dnsbl.CheckDomains(ctx, env.Helo, env.From[strings.LastIndexByte(env.From, '@')+1:]))
+		for _, h := range r.Hits {
+			prefix := "DNSBL_"
+			if h.Weight < 0 {
+				prefix = "DNSWL_"
+			}
+			a.add(prefix+strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(h.Zone)), h.Weight*s.DNSBLWeight)
+		}
+	}
+	return a
+}
+
+// Reject 不含贝叶斯的得分达到 reject_score 时返回 550 5.7.1，整封邮件在投递前被拒绝
+func (a *Analysis) Reject() error {
+	s := a.settings
+	if s.RejectScore <= 0 || a.score < s.RejectScore {
+		return nil
+	}
+	a.filter.logf("INFO: Rejecting message from <%s> as spam - score %.1f (%s)", a.env.From, a.score, testNames(a.tests))
+	return &smtpd.Error{Code: 550, Enhanced: "5.7.1", Message: "Message rejected as spam"}
+}
+
+// Check 加上 owner 的贝叶斯得分，返回对该收件人的评分；分类器出错时忽略贝叶斯得分
+func (a *Analysis) Check(ctx context.Context, owner string) *Result {
+	s := a.settings
+	r := &Result{Score: a.score, Required: s.TagScore, Bayes: -1, Tests: append([]Test(nil), a.tests...)}
+	if len(a.tokens) > 0 {
+		p, err := a.filter.classify(ctx, s, owner, a.tokens)
+		if err != nil {
+			a.filter.logf("ERROR: Failed to classify message for %s - %v", owner, err)
+		} else if p >= 0 {
+			r.Bayes = p
+			if score := math.Round((p-0.5)*2*s.Bayes.Weight*100) / 100; score != 0 {
+				r.Tests = append(r.Tests, Test{Name: fmt.Sprintf("BAYES_%02d", min(int(p*100), 99)), Score: score})
+				r.Score += score
+			}
+		}
+	}
+	sort.Slice(r.Tests, func(i, j int) bool { return r.Tests[i].Name < r.Tests[j].Name })
+	r.Spam = r.Score >= s.TagScore
+	r.Junk = r.Spam && s.MoveToJunk
+	if r.Spam {
+		a.filter.logf("INFO: Message from <%s> to %s is spam - score %.1f (%s)", a.env.From, owner, r.Score, testNames(r.Tests))
+	}
+	return r
+}
+
+func testNames(tests []Test) string {
+	parts := make([]string, len(tests))
+	for i, t := range tests {
+		parts[i] = fmt.Sprintf("%s=%.1f", t.Name, t.Score)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Learn 将 owner 的邮件作为垃圾邮件 (spam 为 true) 或正常邮件学习；已按相同分类学习过的邮件不重复计数，
+// 按相反分类学习过的邮件先撤销原来的计数。未启用分类器时不学习
+func (f *Filter) Learn(ctx context.Context, owner, id string, raw []byte, spam bool) error {
+	if !f.settings.Load().Bayes.Enabled {
+		return nil
+	}
+	p, err := message.Parse(raw)
+	if err != nil {
+		return err
+	}
+	return f.train(ctx, owner, id, tokenize(p), spam)
+}
+
+// AutoLearn 按 bayes.auto_learn 的阈值学习存入 owner 邮箱的邮件 id，阈值只与不含贝叶斯的得分比较；
+// r 为该收件人的评分，分类器的结论与阈值相反时不学习，避免强化错误的分类
+func (a *Analysis) AutoLearn(ctx context.Context, owner, id string, r *Result) {
+	b := a.settings.Bayes
+	if !b.AutoLearn || len(a.tokens) == 0 || (a.score > b.AutoLearnHam && a.score < b.AutoLearnSpam) {
+		return
+	}
+	spam := a.score >= b.AutoLearnSpam
+	if r.Bayes >= 0 && (r.Bayes > 0.5) != spam && r.Bayes != 0.5 {
+		return
+	}
+	if err := a.filter.train(ctx, owner, id, a.tokens, spam); err != nil {
+		a.filter.logf("ERROR: Failed to learn message %s of %s - %v", id, owner, err)
+	}
+}
+
+// train 记录 tokens 的计数和邮件的分类
+func (f *Filter) train(ctx context.Context, owner, id string, tokens []string, spam bool) error {
+	prev, err := f.store.Trained(ctx, owner, id)
+	switch {
+	case err == nil && prev == spam:
+		return nil
+	case err != nil && !errors.Is(err, ErrNotFound):
+		return err
+	}
+	delta := Counts{Ham: 1}
+	if spam {
+		delta = Counts{Spam: 1}
+	}
+	if err == nil {
+		delta = Counts{Spam: delta.Spam - delta.Ham, Ham: delta.Ham - delta.Spam}
+	}
+	// 空字符串的计数为学习过的邮件数
+	if err := f.store.Add(ctx, owner, append(append([]string(nil), tokens...), ""), delta); err != nil {
+		return err
+	}
+	if err := f.store.SetTrained(ctx, owner, id, spam); err != nil {
+		return err
+	}
+	class := "ham"
+	if spam {
+		class = "spam"
+	}
+	f.logf("INFO: Learned message %s of %s as %s", id, owner, class)
+	return nil
+}
+
+// Training 用户的训练状态
+type Training struct {
+	Owner string `json:"owner"`
+	Counts
+	// MinMessages 垃圾邮件和正常邮件各需学习的数量，都达到后 Active 为 true
+	MinMessages int  `json:"min_messages"`
+	Active      bool `json:"active"`
+}
+
+// Training 返回 owner 学习过的邮件数
+func (f *Filter) Training(ctx context.Context, owner string) (*Training, error) {
+	s := f.settings.Load()
+	counts, err := f.store.Counts(ctx, owner, []string{""})
+	if err != nil {
+		return nil, err
+	}
+	t := &Training{Owner: owner, Counts: counts[""], MinMessages: s.Bayes.MinMessages}
+	t.Active = s.Bayes.Enabled && t.Spam >= s.Bayes.MinMessages && t.Ham >= s.Bayes.MinMessages
+	return t, nil
+}
+
+// Reset 删除 owner 的全部训练数据
+func (f *Filter) Reset(ctx context.Context, owner string) error {
+	if err := f.store.Reset(ctx, owner); err != nil {
+		return err
+	}
+	f.logf("INFO: Reset Bayesian classifier of %s", owner)
+	return nil
+}
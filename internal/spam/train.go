@@ -0,0 +1,47 @@
+package spam
+
+import (
+	"context"
+
+	"YoPost/internal/mail/store"
+)
+
+// TrainingStore 在用户将邮件移入或移出 Junk 时训练贝叶斯分类器的存储包装，
+// 目前只有 REST API 的移动邮件经过 Store.Move。应包装在加密存储之外，以便读取明文内容
+type TrainingStore struct {
+	store.Store
+	filter *Filter
+}
+
+// NewTrainingStore 创建训练存储
+func NewTrainingStore(inner store.Store, f *Filter) *TrainingStore {
+	return &TrainingStore{Store: inner, filter: f}
+}
+
+// Move 移入 Junk 的邮件作为垃圾邮件学习，从 Junk 移到 Trash 以外邮箱的邮件作为正常邮件学习；
+// 读取邮件或学习失败都不影响移动
+func (s *TrainingStore) Move(ctx context.Context, owner, id, mailbox string) error {
+	// 移动前读取原邮箱和内容，移动不改变内容
+	msg, gerr := s.Store.Get(ctx, owner, id)
+	if err := s.Store.Move(ctx, owner, id, mailbox); err != nil {
+		return err
+	}
+	if gerr != nil {
+		s.filter.logf("WARNING: Skipped learning moved message %s of %s - %v", id, owner, gerr)
+		return nil
+	}
+
+	var spam bool
+	switch {
+	case mailbox == store.Junk && msg.Mailbox != store.Junk:
+		spam = true
+	case msg.Mailbox == store.Junk && mailbox != store.Junk && mailbox != store.Trash:
+		spam = false
+	default:
+		return nil
+	}
+	if err := s.filter.Learn(ctx, owner, id, msg.Raw, spam); err != nil {
+		s.filter.logf("ERROR: Failed to learn message %s of %s - %v", id, owner, err)
+	}
+	return nil
+}
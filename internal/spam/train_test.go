@@ -0,0 +1,67 @@
+package spam
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"YoPost/internal/mail/store"
+)
+
+// failingGet 读取邮件总是失败的存储
+type failingGet struct {
+	store.Store
+}
+
+func (failingGet) Get(ctx context.Context, owner, id string) (*store.Message, error) {
+	return nil, errors.New("read failed")
+}
+
+func TestTrainingStoreMove(t *testing.T) {
+	ctx := context.Background()
+	const owner = "alice@example.com"
+
+	tests := []struct {
+		name     string
+		from, to string
+		failGet  bool
+		want     Counts
+	}{
+		{"into junk", store.Inbox, store.Junk, false, Counts{Spam: 1}},
+		{"out of junk", store.Junk, store.Inbox, false, Counts{Ham: 1}},
+		{"junk to trash", store.Junk, store.Trash, false, Counts{}},
+		{"between folders", store.Inbox, store.Sent, false, Counts{}},
+		{"read error does not block move", store.Inbox, store.Junk, true, Counts{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := store.NewMemoryStore()
+			msg := &store.Message{Owner: owner, Mailbox: tt.from, Raw: raw("Bob <bob@example.com>", "Hello", "Lunch tomorrow")}
+			if err := mem.Append(ctx, msg); err != nil {
+				t.Fatal(err)
+			}
+			var inner store.Store = mem
+			if tt.failGet {
+				inner = failingGet{mem}
+			}
+			f := newBayesFilter(t)
+			if err := NewTrainingStore(inner, f).Move(ctx, owner, msg.ID, tt.to); err != nil {
+				t.Fatalf("Move() error = %v", err)
+			}
+			moved, err := mem.Get(ctx, owner, msg.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if moved.Mailbox != tt.to {
+				t.Errorf("message in %s after Move(), want %s", moved.Mailbox, tt.to)
+			}
+			tr, err := f.Training(ctx, owner)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tr.Counts != tt.want {
+				t.Errorf("Training() = %+v, want %+v", tr.Counts, tt.want)
+			}
+		})
+	}
+}
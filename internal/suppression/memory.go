@@ -0,0 +1,117 @@
+package suppression
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MemoryStore 进程内存储，用于开发环境和嵌入式场景
+type MemoryStore struct {
+	mu      sync.Mutex
+	nextID  int64
+	entries map[string]*Entry
+}
+
+// NewMemoryStore 创建内存存储
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]*Entry)}
+}
+
+func copyEntry(e *Entry) *Entry {
+	c := *e
+	return &c
+}
+
+func (s *MemoryStore) Add(ctx context.Context, e *Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, old := range s.entries {
+		if old.Owner == e.Owner && old.Address == e.Address {
+			return ErrExists
+		}
+	}
+	s.nextID++
+	e.ID = strconv.FormatInt(s.nextID, 16)
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+	s.entries[e.ID] = copyEntry(e)
+	return nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id string) (*Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return copyEntry(e), nil
+}
+
+func (s *MemoryStore) Find(ctx context.Context, sender, address string) (*Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var global *Entry
+	for _, e := range s.entries {
+		if e.Address != address {
+			continue
+		}
+		if e.Owner == sender {
+			return copyEntry(e), nil
+		}
+		if e.Owner == "" {
+			global = e
+		}
+	}
+	if global == nil {
+		return nil, ErrNotFound
+	}
+	return copyEntry(global), nil
+}
+
+func (s *MemoryStore) List(ctx context.Context, owners ...string) ([]*Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var out []*Entry
+	for _, e := range s.entries {
+		if len(owners) > 0 && !contains(owners, e.Owner) {
+			continue
+		}
+		out = append(out, copyEntry(e))
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Address != out[j].Address {
+			return out[i].Address < out[j].Address
+		}
+		return out[i].Owner < out[j].Owner
+	})
+	return out, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.entries[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.entries, id)
+	return nil
+}
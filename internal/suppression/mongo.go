@@ -0,0 +1,124 @@
+package suppression
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore 基于 MongoDB suppressions 集合的存储
+type MongoStore struct {
+	entries *mongo.Collection
+}
+
+type mongoEntry struct {
+	ID    primitive.ObjectID `bson:"_id,omitempty"`
+	Entry `bson:",inline"`
+}
+
+func (d *mongoEntry) entry() *Entry {
+	d.Entry.ID = d.ID.Hex()
+	return &d.Entry
+}
+
+// NewMongoStore 创建 MongoDB 存储
+func NewMongoStore(db *mongo.Database) *MongoStore {
+	return &MongoStore{entries: db.Collection("suppressions")}
+}
+
+// EnsureIndexes 创建地址与所属用户的唯一索引
+func (s *MongoStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.entries.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "address", Value: 1}, {Key: "owner", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create suppression indexes: %v", err)
+	}
+	return nil
+}
+
+func (s *MongoStore) Add(ctx context.Context, e *Entry) error {
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+	oid := primitive.NewObjectID()
+	_, err := s.entries.InsertOne(ctx, mongoEntry{ID: oid, Entry: *e})
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrExists
+	}
+	if err != nil {
+		return err
+	}
+	e.ID = oid.Hex()
+	return nil
+}
+
+// findOne 返回第一个匹配的条目
+func (s *MongoStore) findOne(ctx context.Context, filter bson.M, opts ...*options.FindOneOptions) (*Entry, error) {
+	var doc mongoEntry
+	err := s.entries.FindOne(ctx, filter, opts...).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return doc.entry(), nil
+}
+
+func (s *MongoStore) Get(ctx context.Context, id string) (*Entry, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	return s.findOne(ctx, bson.M{"_id": oid})
+}
+
+func (s *MongoStore) Find(ctx context.Context, sender, address string) (*Entry, error) {
+	// 全局条目的 owner 为空字符串，按 owner 降序时发件人本人的条目在前
+	return s.findOne(ctx, bson.M{"address": address, "owner": bson.M{"$in": []string{sender, ""}}},
+		options.FindOne().SetSort(bson.D{{Key: "owner", Value: -1}}))
+}
+
+func (s *MongoStore) List(ctx context.Context, owners ...string) ([]*Entry, error) {
+	filter := bson.M{}
+	if len(owners) > 0 {
+		filter["owner"] = bson.M{"$in": owners}
+	}
+	cur, err := s.entries.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "address", Value: 1}, {Key: "owner", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var out []*Entry
+	for cur.Next(ctx) {
+		var doc mongoEntry
+		if err := cur.Decode(&doc); err != nil {
+			return nil, err
+		}
+		out = append(out, doc.entry())
+	}
+	return out, cur.Err()
+}
+
+func (s *MongoStore) Delete(ctx context.Context, id string) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+	res, err := s.entries.DeleteOne(ctx, bson.M{"_id": oid})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+// Package suppression 抑制列表：硬退信、退订或投诉的地址不再接收已认证用户发出的邮件。
+// 发往列表中地址的收件人在提交时被拒绝，批量邮件带有 RFC 8058 一键退订链接
+package suppression
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/textproto"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"YoPost/internal/config"
+	"YoPost/internal/mail/queue"
+)
+
+var (
+	ErrNotFound = errors.New("suppression: entry not found")
+	ErrExists   = errors.New("suppression: address already suppressed")
+	// ErrInvalidToken 退订令牌格式错误或签名不匹配
+	ErrInvalidToken = errors.New("suppression: invalid unsubscribe token")
+)
+
+// Reason 地址被加入抑制列表的原因
+type Reason string
+
+const (
+	// ReasonBounce 投递返回 5xx 永久失败 (5.7.x 策略拒绝除外)
+	ReasonBounce Reason = "bounce"
+	// ReasonUnsubscribe 收件人通过退订链接退订
+	ReasonUnsubscribe Reason = "unsubscribe"
+	// ReasonComplaint 收件人投诉为垃圾邮件
+	ReasonComplaint Reason = "complaint"
+	// ReasonManual 通过 API 手动添加
+	ReasonManual Reason = "manual"
+)
+
+// Reasons 全部原因
+var Reasons = []Reason{ReasonBounce, ReasonUnsubscribe, ReasonComplaint, ReasonManual}
+
+// Entry 抑制列表中的一个地址
+type Entry struct {
+	ID string `bson:"-" json:"id"`
+	// Owner 条目只对该用户发出的邮件生效，为空时对全部发件人生效
+	Owner   string `bson:"owner" json:"owner,omitempty"`
+	Address string `bson:"address" json:"address"`
+	Reason  Reason `bson:"reason" json:"reason"`
+	// Detail 退信内容或备注
+	Detail string `bson:"detail,omitempty" json:"detail,omitempty"`
+	// Source 产生条目的出站队列 ID 或批次 ID
+	Source    string    `bson:"source,omitempty" json:"source,omitempty"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+}
+
+// Store 抑制列表存储，地址均为小写
+type Store interface {
+	// Add 保存条目并设置 ID 和 CreatedAt，同一 Owner 下地址已存在时返回 ErrExists
+	Add(ctx context.Context, e *Entry) error
+	Get(ctx context.Context, id string) (*Entry, error)
+	// Find 返回对 sender 发出的邮件生效的条目，sender 本人的条目优先于全局条目；都没有时返回 ErrNotFound
+	Find(ctx context.Context, sender, address string) (*Entry, error)
+	// List 按地址列出 Owner 属于 owners 的条目，owners 为空时列出全部
+	List(ctx context.Context, owners ...string) ([]*Entry, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// Normalize 返回用于比较的地址形式
+func Normalize(address string) string {
+	return strings.ToLower(strings.TrimSpace(address))
+}
+
+// hardBounce 判断投递错误是否说明地址本身不可用：5xx 永久失败，但 5.7.x (策略、内容拒绝) 除外
+func hardBounce(err error) bool {
+	var te *textproto.Error
+	return errors.As(err, &te) && te.Code >= 500 && !strings.HasPrefix(te.Msg, "5.7.")
+}
+
+// Notifier 返回将硬退信地址加入全局抑制列表的 queue.Notifier。
+// 只有一个收件人的邮件才能确定退信的地址，多收件人邮件的退信不会加入列表
+func Notifier(st Store) queue.Notifier {
+	return func(ctx context.Context, item *queue.Item, res queue.Result, err error) {
+		if st == nil || res != queue.Bounced || len(item.To) != 1 || !hardBounce(err) {
+			return
+		}
+		e := &Entry{Address: Normalize(item.To[0]), Reason: ReasonBounce, Detail: err.Error(), Source: item.ID}
+		if aerr := st.Add(ctx, e); aerr != nil {
+			if !errors.Is(aerr, ErrExists) {
+				log.Printf("ERROR: Failed to suppress bounced address %s - %v", e.Address, aerr)
+			}
+			return
+		}
+		log.Printf("INFO: Suppressed %s after bounce of queued message %s", e.Address, item.ID)
+	}
+}
+
+// unsubscribe 退订链接的前缀和令牌签名密钥
+type unsubscribe struct {
+	url string
+	key []byte
+}
+
+// Manager 检查收件人是否被抑制，生成和处理退订链接
+type Manager struct {
+	store  Store
+	config atomic.Pointer[unsubscribe]
+	// random 未配置 suppression.secret 时使用，热加载时保持不变
+	random []byte
+}
+
+// NewManager 创建 Manager，注册到 config.Holder 后支持热加载；未配置签名密钥时随机生成
+func NewManager(st Store, cfg *config.Config) (*Manager, error) {
+	m := &Manager{store: st}
+	if cfg.Suppression.Secret == "" {
+		log.Printf("WARNING: suppression.secret is not set, using a random key; unsubscribe links will not survive a restart")
+		m.random = make([]byte, 32)
+		if _, err := rand.Read(m.random); err != nil {
+			return nil, err
+		}
+	}
+	m.setConfig(cfg)
+	return m, nil
+}
+
+func (m *Manager) setConfig(cfg *config.Config) {
+	u := &unsubscribe{url: cfg.Suppression.UnsubscribeURL, key: []byte(cfg.Suppression.Secret)}
+	if u.url == "" {
+		u.url = "https://" + cfg.Server.Hostname + "/api/v1/unsubscribe"
+	}
+	u.url = strings.TrimRight(u.url, "/")
+	if len(u.key) == 0 {
+		u.key = m.random
+	}
+	m.config.Store(u)
+}
+
+func (m *Manager) PrepareReload(cfg *config.Config) (func(), error) {
+	if cfg.Suppression.Secret == "" && m.random == nil {
+		return nil, errors.New("suppression.secret cannot be removed without a restart")
+	}
+	return func() { m.setConfig(cfg) }, nil
+}
+
+// Store 返回抑制列表存储
+func (m *Manager) Store() Store {
+	return m.store
+}
+
+// Suppressed 返回对 sender 发往 address 的邮件生效的条目，未被抑制时返回 nil
+func (m *Manager) Suppressed(ctx context.Context, sender, address string) (*Entry, error) {
+	e, err := m.store.Find(ctx, Normalize(sender), Normalize(address))
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	return e, err
+}
+
+// sign 返回 payload 的签名
+func (m *Manager) sign(key []byte, payload string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// Token 返回 address 退订 sender 邮件的令牌，batch 记录为条目的来源
+func (m *Manager) Token(sender, address, batch string) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(Normalize(sender) + "\x00" + Normalize(address) + "\x00" + batch))
+	return payload + "." + m.sign(m.config.Load().key, payload)
+}
+
+// Subscription 退订令牌的内容
+type Subscription struct {
+	Sender  string
+	Address string
+	Batch   string
+}
+
+// Parse 校验令牌并返回其内容
+func (m *Manager) Parse(token string) (*Subscription, error) {
+	payload, sig, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(m.sign(m.config.Load().key, payload))) {
+		return nil, ErrInvalidToken
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	parts := strings.Split(string(raw), "\x00")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" {
+		return nil, ErrInvalidToken
+	}
+	return &Subscription{Sender: parts[0], Address: parts[1], Batch: parts[2]}, nil
+}
+
+// Headers 返回批量邮件的 List-Unsubscribe 和 List-Unsubscribe-Post (RFC 8058) 头部
+func (m *Manager) Headers(sender, address, batch string) map[string]string {
+	return map[string]string{
+		"List-Unsubscribe":      "<" + m.config.Load().url + "/" + m.Token(sender, address, batch) + ">",
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+	}
+}
+
+// Unsubscribe 按令牌将地址加入发件人的抑制列表，重复退订返回已有条目
+func (m *Manager) Unsubscribe(ctx context.Context, token string) (*Entry, error) {
+	sub, err := m.Parse(token)
+	if err != nil {
+		return nil, err
+	}
+	e := &Entry{Owner: sub.Sender, Address: sub.Address, Reason: ReasonUnsubscribe, Source: sub.Batch}
+	err = m.store.Add(ctx, e)
+	if errors.Is(err, ErrExists) {
+		return m.store.Find(ctx, sub.Sender, sub.Address)
+	}
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("INFO: %s unsubscribed from mail of %s", e.Address, e.Owner)
+	return e, nil
+}
@@ -0,0 +1,198 @@
+package suppression
+
+import (
+	"context"
+	"errors"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"YoPost/internal/config"
+	"YoPost/internal/mail/queue"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func newManager(t *testing.T, secret string) *Manager {
+	t.Helper()
+	cfg := config.Default()
+	cfg.Server.Hostname = "mail.example.com"
+	cfg.Suppression.Secret = secret
+	m, err := NewManager(NewMemoryStore(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestToken(t *testing.T) {
+	m := newManager(t, testSecret)
+	token := m.Token("Alice@Example.com", " Bob@Remote.example ", "batch1")
+	payload, sig, _ := strings.Cut(token, ".")
+	forged := m.Token("alice@example.com", "carol@remote.example", "batch1")
+	forgedPayload, _, _ := strings.Cut(forged, ".")
+
+	tests := []struct {
+		name  string
+		m     *Manager
+		token string
+		ok    bool
+	}{
+		{"valid", m, token, true},
+		{"other payload", m, forgedPayload + "." + sig, false},
+		{"tampered signature", m, payload + "." + strings.Repeat("A", len(sig)), false},
+		{"other secret", newManager(t, "another secret of thirty-two bytes"), token, false},
+		{"random secret", newManager(t, ""), token, false},
+		{"no signature", m, payload, false},
+		{"malformed payload", m, "!!." + sig, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub, err := tt.m.Parse(tt.token)
+			if !tt.ok {
+				if !errors.Is(err, ErrInvalidToken) {
+					t.Fatalf("Parse() error = %v, want ErrInvalidToken", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if *sub != (Subscription{Sender: "alice@example.com", Address: "bob@remote.example", Batch: "batch1"}) {
+				t.Errorf("Parse() = %+v", sub)
+			}
+		})
+	}
+}
+
+func TestHeaders(t *testing.T) {
+	m := newManager(t, testSecret)
+	token := m.Token("alice@example.com", "bob@remote.example", "")
+	h := m.Headers("alice@example.com", "bob@remote.example", "")
+	want := "<https://mail.example.com/api/v1/unsubscribe/" + token + ">"
+	if h["List-Unsubscribe"] != want || h["List-Unsubscribe-Post"] != "List-Unsubscribe=One-Click" {
+		t.Errorf("Headers() = %v, want List-Unsubscribe %s", h, want)
+	}
+
+	// a reloaded secret invalidates links signed with the old one
+	cfg := config.Default()
+	cfg.Suppression.UnsubscribeURL = "https://example.com/u/"
+	cfg.Suppression.Secret = "another secret of thirty-two bytes"
+	apply, err := m.PrepareReload(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	apply()
+	if _, err := m.Parse(token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Parse() of a link signed before reload error = %v, want ErrInvalidToken", err)
+	}
+	if got := m.Headers("alice@example.com", "bob@remote.example", "")["List-Unsubscribe"]; !strings.HasPrefix(got, "<https://example.com/u/") {
+		t.Errorf("List-Unsubscribe after reload = %s, want the configured url", got)
+	}
+
+	cfg.Suppression.Secret = ""
+	if _, err := m.PrepareReload(cfg); err == nil {
+		t.Error("PrepareReload() removing the secret succeeded")
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	ctx := context.Background()
+	m := newManager(t, testSecret)
+	token := m.Token("alice@example.com", "bob@remote.example", "batch1")
+
+	e, err := m.Unsubscribe(ctx, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Owner != "alice@example.com" || e.Address != "bob@remote.example" || e.Reason != ReasonUnsubscribe || e.Source != "batch1" {
+		t.Errorf("Unsubscribe() = %+v", e)
+	}
+	again, err := m.Unsubscribe(ctx, token)
+	if err != nil || again.ID != e.ID {
+		t.Errorf("second Unsubscribe() = %+v, %v, want the existing entry %s", again, err, e.ID)
+	}
+	if _, err := m.Unsubscribe(ctx, token+"x"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Unsubscribe() with a tampered token error = %v, want ErrInvalidToken", err)
+	}
+
+	tests := []struct {
+		sender, address string
+		want            bool
+	}{
+		{"alice@example.com", "bob@remote.example", true},
+		{"ALICE@example.com", "Bob@Remote.Example", true},
+		{"carol@example.com", "bob@remote.example", false},
+		{"alice@example.com", "dave@remote.example", false},
+	}
+	for _, tt := range tests {
+		got, err := m.Suppressed(ctx, tt.sender, tt.address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (got != nil) != tt.want {
+			t.Errorf("Suppressed(%s, %s) = %+v, want suppressed %v", tt.sender, tt.address, got, tt.want)
+		}
+	}
+}
+
+func TestFind(t *testing.T) {
+	ctx := context.Background()
+	st := NewMemoryStore()
+	global := &Entry{Address: "bob@remote.example", Reason: ReasonBounce}
+	own := &Entry{Owner: "alice@example.com", Address: "bob@remote.example", Reason: ReasonUnsubscribe}
+	for _, e := range []*Entry{global, own} {
+		if err := st.Add(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := st.Add(ctx, &Entry{Address: "bob@remote.example", Reason: ReasonManual}); !errors.Is(err, ErrExists) {
+		t.Errorf("Add() of a duplicate error = %v, want ErrExists", err)
+	}
+
+	tests := []struct {
+		sender string
+		want   *Entry
+	}{
+		{"alice@example.com", own},
+		{"carol@example.com", global},
+	}
+	for _, tt := range tests {
+		got, err := st.Find(ctx, tt.sender, "bob@remote.example")
+		if err != nil || got.ID != tt.want.ID {
+			t.Errorf("Find(%s) = %+v, %v, want %+v", tt.sender, got, err, tt.want)
+		}
+	}
+}
+
+func TestNotifier(t *testing.T) {
+	hard := &textproto.Error{Code: 550, Msg: "5.1.1 no such user"}
+	tests := []struct {
+		name   string
+		to     []string
+		result queue.Result
+		err    error
+		want   bool
+	}{
+		{"hard bounce", []string{"Bob@Remote.example"}, queue.Bounced, hard, true},
+		{"policy rejection", []string{"bob@remote.example"}, queue.Bounced, &textproto.Error{Code: 550, Msg: "5.7.1 rejected as spam"}, false},
+		{"gave up after retries", []string{"bob@remote.example"}, queue.Bounced, &textproto.Error{Code: 451, Msg: "4.3.0 try later"}, false},
+		{"deferred", []string{"bob@remote.example"}, queue.Deferred, hard, false},
+		{"several recipients", []string{"bob@remote.example", "carol@remote.example"}, queue.Bounced, hard, false},
+		{"connection error", []string{"bob@remote.example"}, queue.Bounced, errors.New("connection refused"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			st := NewMemoryStore()
+			Notifier(st)(ctx, &queue.Item{ID: "q1", To: tt.to}, tt.result, tt.err)
+			e, err := st.Find(ctx, "alice@example.com", "bob@remote.example")
+			if got := err == nil; got != tt.want {
+				t.Fatalf("suppressed = %v (%v), want %v", got, err, tt.want)
+			}
+			if tt.want && (e.Owner != "" || e.Reason != ReasonBounce || e.Source != "q1") {
+				t.Errorf("entry = %+v, want a global bounce from q1", e)
+			}
+		})
+	}
+}
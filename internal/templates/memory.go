@@ -0,0 +1,85 @@
+package templates
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore 进程内存储，用于开发环境和嵌入式场景
+type MemoryStore struct {
+	mu        sync.Mutex
+	templates map[string]*Template
+}
+
+// NewMemoryStore 创建内存存储
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{templates: make(map[string]*Template)}
+}
+
+func copyTemplate(t *Template) *Template {
+	c := *t
+	c.Variants = append([]Variant(nil), t.Variants...)
+	return &c
+}
+
+func (s *MemoryStore) Create(ctx context.Context, t *Template) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.templates[t.ID]; ok {
+		return ErrExists
+	}
+	now := time.Now()
+	t.Revision, t.CreatedAt, t.UpdatedAt = 1, now, now
+	s.templates[t.ID] = copyTemplate(t)
+	return nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id string) (*Template, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.templates[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return copyTemplate(t), nil
+}
+
+func (s *MemoryStore) List(ctx context.Context) ([]*Template, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]*Template, 0, len(s.templates))
+	for _, t := range s.templates {
+		out = append(out, copyTemplate(t))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
+
+func (s *MemoryStore) Update(ctx context.Context, t *Template) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, ok := s.templates[t.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	t.Revision, t.CreatedAt, t.UpdatedAt = old.Revision+1, old.CreatedAt, time.Now()
+	s.templates[t.ID] = copyTemplate(t)
+	return nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.templates[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.templates, id)
+	return nil
+}
@@ -0,0 +1,104 @@
+package templates
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore 基于 MongoDB templates 集合的存储，模板 ID 即文档 _id
+type MongoStore struct {
+	templates *mongo.Collection
+}
+
+type mongoTemplate struct {
+	ID       string `bson:"_id"`
+	Template `bson:",inline"`
+}
+
+func (d *mongoTemplate) template() *Template {
+	d.Template.ID = d.ID
+	return &d.Template
+}
+
+// NewMongoStore 创建 MongoDB 存储
+func NewMongoStore(db *mongo.Database) *MongoStore {
+	return &MongoStore{templates: db.Collection("templates")}
+}
+
+func (s *MongoStore) Create(ctx context.Context, t *Template) error {
+	now := time.Now()
+	t.Revision, t.CreatedAt, t.UpdatedAt = 1, now, now
+	_, err := s.templates.InsertOne(ctx, mongoTemplate{ID: t.ID, Template: *t})
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrExists
+	}
+	return err
+}
+
+func (s *MongoStore) Get(ctx context.Context, id string) (*Template, error) {
+	var doc mongoTemplate
+	err := s.templates.FindOne(ctx, bson.M{"_id": id}).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return doc.template(), nil
+}
+
+func (s *MongoStore) List(ctx context.Context) ([]*Template, error) {
+	cur, err := s.templates.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var out []*Template
+	for cur.Next(ctx) {
+		var doc mongoTemplate
+		if err := cur.Decode(&doc); err != nil {
+			return nil, err
+		}
+		out = append(out, doc.template())
+	}
+	return out, cur.Err()
+}
+
+func (s *MongoStore) Update(ctx context.Context, t *Template) error {
+	update := bson.M{
+		"$set": bson.M{
+			"description":    t.Description,
+			"default_locale": t.DefaultLocale,
+			"variants":       t.Variants,
+			"updated_at":     time.Now(),
+		},
+		"$inc": bson.M{"revision": 1},
+	}
+	var doc mongoTemplate
+	err := s.templates.FindOneAndUpdate(ctx, bson.M{"_id": t.ID}, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	*t = *doc.template()
+	return nil
+}
+
+func (s *MongoStore) Delete(ctx context.Context, id string) error {
+	res, err := s.templates.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+// Package templates 保存事务邮件模板 (主题、纯文本和 HTML 正文)，每个模板可以有多种语言的变体；
+// 主题和纯文本用 text/template 渲染，HTML 用 html/template 渲染，变量中的 HTML 会被转义
+package templates
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"regexp"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"golang.org/x/text/language"
+)
+
+var (
+	ErrNotFound = errors.New("template not found")
+	ErrExists   = errors.New("template already exists")
+)
+
+// idPattern 模板 ID 由调用方指定，如 "welcome"、"password-reset"
+var idPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,63}$`)
+
+// ValidID 判断模板 ID 是否合法
+func ValidID(id string) bool {
+	return idPattern.MatchString(id)
+}
+
+// Variant 一种语言的模板内容，Text 和 HTML 至少有一个
+type Variant struct {
+	// Locale BCP 47 语言标签，如 zh-CN、en
+	Locale  string `bson:"locale" json:"locale"`
+	Subject string `bson:"subject" json:"subject"`
+	Text    string `bson:"text,omitempty" json:"text,omitempty"`
+	HTML    string `bson:"html,omitempty" json:"html,omitempty"`
+}
+
+// Template 事务邮件模板
+type Template struct {
+	ID          string `bson:"-" json:"id"`
+	Description string `bson:"description,omitempty" json:"description,omitempty"`
+	// DefaultLocale 请求的语言没有匹配的变体时使用，为空时为第一个变体
+	DefaultLocale string    `bson:"default_locale" json:"default_locale"`
+	Variants      []Variant `bson:"variants" json:"variants"`
+	// Revision 每次修改加一
+	Revision  int64     `bson:"revision" json:"revision"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// Store 模板存储
+type Store interface {
+	// Create 保存新模板，ID 已存在时返回 ErrExists
+	Create(ctx context.Context, t *Template) error
+	Get(ctx context.Context, id string) (*Template, error)
+	// List 按 ID 列出全部模板
+	List(ctx context.Context) ([]*Template, error)
+	// Update 替换模板内容并增加 Revision
+	Update(ctx context.Context, t *Template) error
+	Delete(ctx context.Context, id string) error
+}
+
+// Normalize 规范化语言标签并设置默认语言，然后编译全部变体，返回第一个问题
+func (t *Template) Normalize() error {
+	if len(t.Variants) == 0 {
+		return errors.New("at least one variant is required")
+	}
+	seen := make(map[string]bool)
+	for i := range t.Variants {
+		v := &t.Variants[i]
+		tag, err := language.Parse(v.Locale)
+		if err != nil {
+			return fmt.Errorf("invalid locale %q", v.Locale)
+		}
+		v.Locale = tag.String()
+		if seen[v.Locale] {
+			return fmt.Errorf("duplicate locale %s", v.Locale)
+		}
+		seen[v.Locale] = true
+		if strings.TrimSpace(v.Subject) == "" {
+			return fmt.Errorf("variant %s: subject is required", v.Locale)
+		}
+		if v.Text == "" && v.HTML == "" {
+			return fmt.Errorf("variant %s: text or html is required", v.Locale)
+		}
+		if _, err := compile(v); err != nil {
+			return fmt.Errorf("variant %s: %v", v.Locale, err)
+		}
+	}
+
+	if t.DefaultLocale == "" {
+		t.DefaultLocale = t.Variants[0].Locale
+	}
+	tag, err := language.Parse(t.DefaultLocale)
+	if err != nil || !seen[tag.String()] {
+		return fmt.Errorf("default_locale %q has no variant", t.DefaultLocale)
+	}
+	t.DefaultLocale = tag.String()
+	return nil
+}
+
+// Variant 返回与 locale 最接近的变体，locale 可以是单个语言标签或 Accept-Language 格式的列表；
+// 没有可理解的变体时返回默认语言的变体
+func (t *Template) Variant(locale string) *Variant {
+	def := 0
+	for i, v := range t.Variants {
+		if v.Locale == t.DefaultLocale {
+			def = i
+		}
+	}
+	if locale == "" {
+		return &t.Variants[def]
+	}
+	// 默认语言放在首位，Matcher 没有匹配时返回第一个
+	order := []int{def}
+	tags := []language.Tag{language.Make(t.Variants[def].Locale)}
+	for i, v := range t.Variants {
+		if i != def {
+			order = append(order, i)
+			tags = append(tags, language.Make(v.Locale))
+		}
+	}
+	_, index, conf := language.NewMatcher(tags).Match(parseLocales(locale)...)
+	if conf == language.No {
+		index = 0
+	}
+	return &t.Variants[order[index]]
+}
+
+func parseLocales(locale string) []language.Tag {
+	tags, _, err := language.ParseAcceptLanguage(locale)
+	if err != nil || len(tags) == 0 {
+		return []language.Tag{language.Make(locale)}
+	}
+	return tags
+}
+
+// Compiled 编译后的变体，可以用不同变量多次渲染
+type Compiled struct {
+	Locale  string
+	subject *texttemplate.Template
+	text    *texttemplate.Template
+	html    *htmltemplate.Template
+}
+
+// Rendered 渲染结果
+type Rendered struct {
+	Locale  string `json:"locale"`
+	Subject string `json:"subject"`
+	Text    string `json:"text,omitempty"`
+	HTML    string `json:"html,omitempty"`
+}
+
+// compile 编译变体，引用缺失的变量在渲染时报错
+func compile(v *Variant) (*Compiled, error) {
+	c := &Compiled{Locale: v.Locale}
+	var err error
+	if c.subject, err = texttemplate.New("subject").Option("missingkey=error").Parse(v.Subject); err != nil {
+		return nil, err
+	}
+	if v.Text != "" {
+		if c.text, err = texttemplate.New("text").Option("missingkey=error").Parse(v.Text); err != nil {
+			return nil, err
+		}
+	}
+	if v.HTML != "" {
+		if c.html, err = htmltemplate.New("html").Option("missingkey=error").Parse(v.HTML); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Compile 编译与 locale 最接近的变体
+func (t *Template) Compile(locale string) (*Compiled, error) {
+	return compile(t.Variant(locale))
+}
+
+// Render 用 vars 渲染，主题不能包含换行
+func (c *Compiled) Render(vars map[string]interface{}) (*Rendered, error) {
+	if vars == nil {
+		vars = map[string]interface{}{}
+	}
+	out := &Rendered{Locale: c.Locale}
+	var buf bytes.Buffer
+	if err := c.subject.Execute(&buf, vars); err != nil {
+		return nil, err
+	}
+	out.Subject = strings.TrimSpace(buf.String())
+	if strings.ContainsAny(out.Subject, "\r\n") {
+		return nil, errors.New("rendered subject contains a line break")
+	}
+	if c.text != nil {
+		buf.Reset()
+		if err := c.text.Execute(&buf, vars); err != nil {
+			return nil, err
+		}
+		out.Text = buf.String()
+	}
+	if c.html != nil {
+		buf.Reset()
+		if err := c.html.Execute(&buf, vars); err != nil {
+			return nil, err
+		}
+		out.HTML = buf.String()
+	}
+	return out, nil
+}
+
+// Render 用 vars 渲染与 locale 最接近的变体
+func (t *Template) Render(locale string, vars map[string]interface{}) (*Rendered, error) {
+	c, err := t.Compile(locale)
+	if err != nil {
+		return nil, err
+	}
+	return c.Render(vars)
+}
@@ -0,0 +1,100 @@
+package templates
+
+import (
+	"strings"
+	"testing"
+)
+
+func testTemplate(t *testing.T, defaultLocale string) *Template {
+	t.Helper()
+	tpl := &Template{
+		ID:            "welcome",
+		DefaultLocale: defaultLocale,
+		Variants: []Variant{
+			{Locale: "en", Subject: "Welcome {{.name}}", Text: "Hello {{.name}}"},
+			{Locale: "zh-cn", Subject: "欢迎 {{.name}}", Text: "你好 {{.name}}"},
+			{Locale: "pt-BR", Subject: "Bem-vindo {{.name}}", HTML: "<p>Olá {{.name}}</p>"},
+		},
+	}
+	if err := tpl.Normalize(); err != nil {
+		t.Fatal(err)
+	}
+	return tpl
+}
+
+func TestVariant(t *testing.T) {
+	tests := []struct {
+		name          string
+		defaultLocale string
+		locale        string
+		want          string
+	}{
+		{"empty", "", "", "en"},
+		{"empty with default", "zh-CN", "", "zh-CN"},
+		{"exact", "", "pt-BR", "pt-BR"},
+		{"case insensitive", "", "ZH-cn", "zh-CN"},
+		{"language only", "", "zh", "zh-CN"},
+		{"region fallback", "", "en-GB", "en"},
+		{"other region", "", "pt-PT", "pt-BR"},
+		{"unknown language", "zh-CN", "fr", "zh-CN"},
+		{"malformed", "zh-CN", "not a locale!", "zh-CN"},
+		{"accept-language order", "", "fr-FR, pt;q=0.9, en;q=0.8", "pt-BR"},
+		{"accept-language fallback", "zh-CN", "fr-FR, de;q=0.9", "zh-CN"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := testTemplate(t, tt.defaultLocale).Variant(tt.locale).Locale; got != tt.want {
+				t.Errorf("Variant(%q) = %s, want %s", tt.locale, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name     string
+		template Template
+		err      string
+	}{
+		{"no variants", Template{}, "at least one variant"},
+		{"invalid locale", Template{Variants: []Variant{{Locale: "x", Subject: "s", Text: "t"}}}, "invalid locale"},
+		{"duplicate locale", Template{Variants: []Variant{{Locale: "en", Subject: "s", Text: "t"}, {Locale: "EN", Subject: "s", Text: "t"}}}, "duplicate locale en"},
+		{"default without variant", Template{DefaultLocale: "de", Variants: []Variant{{Locale: "en", Subject: "s", Text: "t"}}}, "default_locale"},
+		{"no body", Template{Variants: []Variant{{Locale: "en", Subject: "s"}}}, "text or html"},
+		{"syntax error", Template{Variants: []Variant{{Locale: "en", Subject: "s", Text: "{{.name"}}}, "variant en"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.template.Normalize(); err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Normalize() error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+	tpl := testTemplate(t, "")
+	tests := []struct {
+		name   string
+		locale string
+		vars   map[string]interface{}
+		want   Rendered
+		err    bool
+	}{
+		{"text", "zh", map[string]interface{}{"name": "<b>Alice</b>"}, Rendered{Locale: "zh-CN", Subject: "欢迎 <b>Alice</b>", Text: "你好 <b>Alice</b>"}, false},
+		{"html escaped", "pt-BR", map[string]interface{}{"name": "<b>Alice</b>"}, Rendered{Locale: "pt-BR", Subject: "Bem-vindo <b>Alice</b>", HTML: "<p>Olá &lt;b&gt;Alice&lt;/b&gt;</p>"}, false},
+		{"missing variable", "en", nil, Rendered{}, true},
+		{"line break in subject", "en", map[string]interface{}{"name": "Alice\r\nBcc: eve@example.com"}, Rendered{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tpl.Render(tt.locale, tt.vars)
+			if (err != nil) != tt.err {
+				t.Fatalf("Render() error = %v, want error %v", err, tt.err)
+			}
+			if err == nil && *got != tt.want {
+				t.Errorf("Render() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,301 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"YoPost/internal/config"
+)
+
+// responseLimit 投递记录中保存的响应体长度
+const responseLimit = 1024
+
+// Dispatcher 为事件创建投递记录，并在后台将到期的记录推送到端点
+type Dispatcher struct {
+	store  Store
+	client *http.Client
+	config atomic.Pointer[config.WebhooksConfig]
+	wake   chan struct{}
+
+	// Interval 轮询间隔，默认 5 秒；Publish 会立即唤醒后台循环
+	Interval time.Duration
+	// Batch 每次取出的投递记录数量，默认 50
+	Batch int
+	// Logger 为空时使用 log 包的默认 Logger
+	Logger *log.Logger
+}
+
+// NewDispatcher 创建 Dispatcher，注册到 config.Holder 后支持热加载
+func NewDispatcher(st Store, cfg config.WebhooksConfig) *Dispatcher {
+	d := &Dispatcher{
+		store: st,
+		// 端点返回的重定向视为失败，避免签名请求被转发到其他地址
+		client: &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}},
+		wake: make(chan struct{}, 1),
+	}
+	d.config.Store(&cfg)
+	return d
+}
+
+// Store 返回端点与投递记录存储
+func (d *Dispatcher) Store() Store {
+	return d.store
+}
+
+func (d *Dispatcher) PrepareReload(cfg *config.Config) (func(), error) {
+	c := cfg.Webhooks
+	return func() { d.config.Store(&c) }, nil
+}
+
+func (d *Dispatcher) logf(format string, args ...interface{}) {
+	if d.Logger != nil {
+		d.Logger.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+func (d *Dispatcher) interval() time.Duration {
+	if d.Interval > 0 {
+		return d.Interval
+	}
+	return 5 * time.Second
+}
+
+func (d *Dispatcher) batch() int {
+	if d.Batch > 0 {
+		return d.Batch
+	}
+	return 50
+}
+
+// backoff 第 n 次失败后的重试间隔: 30s, 1m, 2m ... 最长 1h
+func backoff(attempts int) time.Duration {
+	b := 30 * time.Second
+	for i := 1; i < attempts && b < time.Hour; i++ {
+		b *= 2
+	}
+	if b > time.Hour {
+		b = time.Hour
+	}
+	return b
+}
+
+func newEvent(event string, data interface{}) ([]byte, string, error) {
+	ev := Event{ID: "evt_" + randomHex(12), Type: event, CreatedAt: time.Now().UTC(), Data: data}
+	payload, err := json.Marshal(ev)
+	return payload, ev.ID, err
+}
+
+// Publish 为订阅了 event 的每个启用端点创建一条投递记录，由后台循环推送
+func (d *Dispatcher) Publish(ctx context.Context, event string, data interface{}) error {
+	endpoints, err := d.store.ListEndpoints(ctx)
+	if err != nil {
+		d.logf("ERROR: Failed to publish webhook event %s - %v", event, err)
+		return err
+	}
+	var targets []*Endpoint
+	for _, e := range endpoints {
+		if e.Enabled && e.Accepts(event) {
+			targets = append(targets, e)
+		}
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+
+	payload, id, err := newEvent(event, data)
+	if err != nil {
+		return err
+	}
+	for _, e := range targets {
+		del := &Delivery{EndpointID: e.ID, EventID: id, Event: event, Payload: payload, Status: StatusPending}
+		if err := d.store.AddDelivery(ctx, del); err != nil {
+			d.logf("ERROR: Failed to queue webhook event %s for endpoint %s - %v", event, e.ID, err)
+			return err
+		}
+	}
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Ping 立即向端点发送一个 ping 事件并返回投递记录，失败的记录和其他事件一样重试
+func (d *Dispatcher) Ping(ctx context.Context, e *Endpoint) (*Delivery, error) {
+	payload, id, err := newEvent(EventPing, map[string]string{"endpoint_id": e.ID})
+	if err != nil {
+		return nil, err
+	}
+	// 预先推迟 NextAttempt，后台循环不会同时推送这条记录
+	del := &Delivery{EndpointID: e.ID, EventID: id, Event: EventPing, Payload: payload, Status: StatusPending,
+		NextAttempt: time.Now().Add(time.Minute)}
+	if err := d.store.AddDelivery(ctx, del); err != nil {
+		return nil, err
+	}
+	d.attempt(ctx, e, del)
+	return del, nil
+}
+
+// Retry 将投递记录重新放入重试队列，尝试次数从零开始计算
+func (d *Dispatcher) Retry(ctx context.Context, del *Delivery) error {
+	del.Status = StatusPending
+	del.Attempts = 0
+	del.NextAttempt = time.Now()
+	if err := d.store.UpdateDelivery(ctx, del); err != nil {
+		return err
+	}
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Run 推送到期的投递记录直到 ctx 取消，并定期清理过期记录
+func (d *Dispatcher) Run(ctx context.Context) {
+	d.logf("INFO: Webhook dispatcher started (interval %s)", d.interval())
+	ticker := time.NewTicker(d.interval())
+	defer ticker.Stop()
+	var pruned time.Time
+	for {
+		if _, err := d.ProcessDue(ctx); err != nil && ctx.Err() == nil {
+			d.logf("ERROR: Webhook processing failed - %v", err)
+		}
+		if time.Since(pruned) > time.Hour {
+			d.prune(ctx)
+			pruned = time.Now()
+		}
+		select {
+		case <-ctx.Done():
+			d.logf("INFO: Webhook dispatcher stopped")
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+func (d *Dispatcher) prune(ctx context.Context) {
+	days := d.config.Load().RetentionDays
+	n, err := d.store.Prune(ctx, time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		if ctx.Err() == nil {
+			d.logf("ERROR: Failed to prune webhook deliveries - %v", err)
+		}
+		return
+	}
+	if n > 0 {
+		d.logf("INFO: Pruned %d webhook deliveries older than %d days", n, days)
+	}
+}
+
+// ProcessDue 推送全部到期的投递记录，返回处理的数量
+func (d *Dispatcher) ProcessDue(ctx context.Context) (int, error) {
+	total := 0
+	for ctx.Err() == nil {
+		now := time.Now()
+		// 租约期间进程退出时记录会在租约到期后重新推送
+		timeout := time.Duration(d.config.Load().Timeout) * time.Second
+		deliveries, err := d.store.Lease(ctx, now, now.Add(2*timeout+time.Minute), d.batch())
+		if err != nil {
+			return total, err
+		}
+		for _, del := range deliveries {
+			if ctx.Err() != nil {
+				// 未推送的记录在租约到期后重新推送
+				return total, nil
+			}
+			e, err := d.store.GetEndpoint(ctx, del.EndpointID)
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return total, err
+			}
+			if !e.Enabled {
+				del.Status, del.LastError = StatusFailed, "endpoint disabled"
+				if err := d.store.UpdateDelivery(context.WithoutCancel(ctx), del); err != nil {
+					d.logf("ERROR: Failed to update webhook delivery %s - %v", del.ID, err)
+				}
+				continue
+			}
+			d.attempt(ctx, e, del)
+		}
+		total += len(deliveries)
+		if len(deliveries) < d.batch() {
+			break
+		}
+	}
+	return total, nil
+}
+
+// attempt 推送一次并将结果写回投递记录：2xx 为成功，其余按退避时间重试，
+// 达到 max_attempts 后标记为 failed
+func (d *Dispatcher) attempt(ctx context.Context, e *Endpoint, del *Delivery) {
+	cfg := d.config.Load()
+	code, body, err := d.post(ctx, e, del, time.Duration(cfg.Timeout)*time.Second)
+	if err != nil && ctx.Err() != nil {
+		// 关闭时中断的请求不计入尝试次数，租约到期后重新推送
+		return
+	}
+
+	del.Attempts++
+	del.ResponseCode, del.Response, del.LastError = code, body, ""
+	switch {
+	case err == nil && code >= 200 && code < 300:
+		del.Status = StatusSucceeded
+	default:
+		if err == nil {
+			err = fmt.Errorf("endpoint returned HTTP %d", code)
+		}
+		del.LastError = err.Error()
+		if del.Attempts >= cfg.MaxAttempts {
+			del.Status = StatusFailed
+			d.logf("ERROR: Giving up on webhook delivery %s (%s) to %s after %d attempts - %v", del.ID, del.Event, e.URL, del.Attempts, err)
+		} else {
+			del.NextAttempt = time.Now().Add(backoff(del.Attempts))
+			d.logf("WARNING: Webhook delivery %s (%s) to %s deferred until %s - %v",
+				del.ID, del.Event, e.URL, del.NextAttempt.Format(time.RFC3339), err)
+		}
+	}
+	// 结果必须写回，即使 ctx 已因关闭而取消
+	if err := d.store.UpdateDelivery(context.WithoutCancel(ctx), del); err != nil {
+		d.logf("ERROR: Failed to update webhook delivery %s - %v", del.ID, err)
+	}
+}
+
+func (d *Dispatcher) post(ctx context.Context, e *Endpoint, del *Delivery, timeout time.Duration) (int, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.URL, bytes.NewReader(del.Payload))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "YoPost-Webhook/1.0")
+	req.Header.Set(HeaderEvent, del.Event)
+	req.Header.Set(HeaderDelivery, del.ID)
+	req.Header.Set(HeaderSignature, Sign(e.Secret, time.Now(), del.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, responseLimit))
+	return resp.StatusCode, strings.ToValidUTF8(string(b), ""), nil
+}
@@ -0,0 +1,59 @@
+package webhook
+
+import "time"
+
+// MessageData message.received 事件的数据
+type MessageData struct {
+	// ID 邮件在收件人邮箱中的 ID，可用于 /api/v1/messages/{id}
+	ID      string `json:"id"`
+	Owner   string `json:"owner"`
+	Mailbox string `json:"mailbox"`
+	// From 信封发件人
+	From       string    `json:"from"`
+	HeaderFrom string    `json:"header_from,omitempty"`
+	Subject    string    `json:"subject,omitempty"`
+	MessageID  string    `json:"message_id,omitempty"`
+	Size       int64     `json:"size"`
+	Received   time.Time `json:"received_at"`
+}
+
+// DeliveryData message.delivered、message.deferred 和 message.bounced 事件的数据
+type DeliveryData struct {
+	QueueID string `json:"queue_id"`
+	// Owner 提交邮件的用户
+	Owner     string   `json:"owner,omitempty"`
+	From      string   `json:"from"`
+	To        []string `json:"to"`
+	Subject   string   `json:"subject,omitempty"`
+	MessageID string   `json:"message_id,omitempty"`
+	// BatchID 批量发送的邮件所属的批次
+	BatchID  string `json:"batch_id,omitempty"`
+	Attempts int    `json:"attempts"`
+	Error    string `json:"error,omitempty"`
+	// NextAttempt 仅 message.deferred 事件有值
+	NextAttempt *time.Time `json:"next_attempt,omitempty"`
+}
+
+// QuotaData mailbox.quota_warning 事件的数据
+type QuotaData struct {
+	Owner         string `json:"owner"`
+	Threshold     int    `json:"threshold"`
+	Percent       int    `json:"percent"`
+	UsedBytes     int64  `json:"used_bytes"`
+	LimitBytes    int64  `json:"limit_bytes"`
+	UsedMessages  int64  `json:"used_messages"`
+	LimitMessages int64  `json:"limit_messages"`
+}
+
+// RouteFailedData message.route_failed 事件的数据
+type RouteFailedData struct {
+	// Route 路由的 match
+	Route string `json:"route"`
+	URL   string `json:"url"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Error string `json:"error"`
+	// StoredID 和 StoredIn 为转存后的邮件 ID 和所在邮箱
+	StoredID string `json:"stored_id"`
+	StoredIn string `json:"stored_in"`
+}
@@ -0,0 +1,194 @@
+package webhook
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MemoryStore 进程内存储，用于开发环境和嵌入式场景
+type MemoryStore struct {
+	mu         sync.Mutex
+	nextID     int64
+	endpoints  map[string]*Endpoint
+	deliveries map[string]*Delivery
+}
+
+// NewMemoryStore 创建内存存储
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{endpoints: make(map[string]*Endpoint), deliveries: make(map[string]*Delivery)}
+}
+
+func copyEndpoint(e *Endpoint) *Endpoint {
+	c := *e
+	c.Events = append([]string{}, e.Events...)
+	return &c
+}
+
+func copyDelivery(d *Delivery) *Delivery {
+	c := *d
+	c.Payload = append([]byte(nil), d.Payload...)
+	return &c
+}
+
+func (s *MemoryStore) id() string {
+	s.nextID++
+	return strconv.FormatInt(s.nextID, 16)
+}
+
+func (s *MemoryStore) CreateEndpoint(ctx context.Context, e *Endpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e.ID = s.id()
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+	s.endpoints[e.ID] = copyEndpoint(e)
+	return nil
+}
+
+func (s *MemoryStore) GetEndpoint(ctx context.Context, id string) (*Endpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.endpoints[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return copyEndpoint(e), nil
+}
+
+func (s *MemoryStore) ListEndpoints(ctx context.Context) ([]*Endpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var out []*Endpoint
+	for _, e := range s.endpoints {
+		out = append(out, copyEndpoint(e))
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.Before(out[j].CreatedAt)
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out, nil
+}
+
+func (s *MemoryStore) UpdateEndpoint(ctx context.Context, e *Endpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.endpoints[e.ID]; !ok {
+		return ErrNotFound
+	}
+	s.endpoints[e.ID] = copyEndpoint(e)
+	return nil
+}
+
+func (s *MemoryStore) DeleteEndpoint(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.endpoints[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.endpoints, id)
+	for did, d := range s.deliveries {
+		if d.EndpointID == id {
+			delete(s.deliveries, did)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) AddDelivery(ctx context.Context, d *Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d.ID = s.id()
+	prepare(d)
+	s.deliveries[d.ID] = copyDelivery(d)
+	return nil
+}
+
+func (s *MemoryStore) GetDelivery(ctx context.Context, id string) (*Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d, ok := s.deliveries[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return copyDelivery(d), nil
+}
+
+func (s *MemoryStore) ListDeliveries(ctx context.Context, endpointID string) ([]*Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var out []*Delivery
+	for _, d := range s.deliveries {
+		if d.EndpointID == endpointID {
+			out = append(out, copyDelivery(d))
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.After(out[j].CreatedAt)
+		}
+		return out[i].ID > out[j].ID
+	})
+	return out, nil
+}
+
+func (s *MemoryStore) UpdateDelivery(ctx context.Context, d *Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.deliveries[d.ID]; !ok {
+		return ErrNotFound
+	}
+	d.UpdatedAt = time.Now()
+	s.deliveries[d.ID] = copyDelivery(d)
+	return nil
+}
+
+func (s *MemoryStore) Lease(ctx context.Context, now, until time.Time, limit int) ([]*Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var due []*Delivery
+	for _, d := range s.deliveries {
+		if d.Status == StatusPending && !d.NextAttempt.After(now) {
+			due = append(due, d)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].NextAttempt.Before(due[j].NextAttempt) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	out := make([]*Delivery, len(due))
+	for i, d := range due {
+		d.NextAttempt = until
+		out[i] = copyDelivery(d)
+	}
+	return out, nil
+}
+
+func (s *MemoryStore) Prune(ctx context.Context, before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for id, d := range s.deliveries {
+		if d.Status != StatusPending && d.UpdatedAt.Before(before) {
+			delete(s.deliveries, id)
+			n++
+		}
+	}
+	return n, nil
+}
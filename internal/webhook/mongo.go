@@ -0,0 +1,236 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore 基于 MongoDB webhook_endpoints 和 webhook_deliveries 集合的存储
+type MongoStore struct {
+	endpoints  *mongo.Collection
+	deliveries *mongo.Collection
+}
+
+type mongoEndpoint struct {
+	ID       primitive.ObjectID `bson:"_id,omitempty"`
+	Endpoint `bson:",inline"`
+}
+
+func (d *mongoEndpoint) endpoint() *Endpoint {
+	d.Endpoint.ID = d.ID.Hex()
+	return &d.Endpoint
+}
+
+type mongoDelivery struct {
+	ID       primitive.ObjectID `bson:"_id,omitempty"`
+	Delivery `bson:",inline"`
+}
+
+func (d *mongoDelivery) delivery() *Delivery {
+	d.Delivery.ID = d.ID.Hex()
+	return &d.Delivery
+}
+
+// NewMongoStore 创建 MongoDB 存储
+func NewMongoStore(db *mongo.Database) *MongoStore {
+	return &MongoStore{
+		endpoints:  db.Collection("webhook_endpoints"),
+		deliveries: db.Collection("webhook_deliveries"),
+	}
+}
+
+// EnsureIndexes 创建取到期投递和查询投递日志所需的索引
+func (s *MongoStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.deliveries.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt", Value: 1}}},
+		{Keys: bson.D{{Key: "endpoint_id", Value: 1}, {Key: "created_at", Value: -1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create webhook delivery indexes: %v", err)
+	}
+	return nil
+}
+
+func (s *MongoStore) CreateEndpoint(ctx context.Context, e *Endpoint) error {
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+	res, err := s.endpoints.InsertOne(ctx, mongoEndpoint{Endpoint: *e})
+	if err != nil {
+		return err
+	}
+	e.ID = res.InsertedID.(primitive.ObjectID).Hex()
+	return nil
+}
+
+func (s *MongoStore) GetEndpoint(ctx context.Context, id string) (*Endpoint, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	var doc mongoEndpoint
+	err = s.endpoints.FindOne(ctx, bson.M{"_id": oid}).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return doc.endpoint(), nil
+}
+
+func (s *MongoStore) ListEndpoints(ctx context.Context) ([]*Endpoint, error) {
+	cur, err := s.endpoints.Find(ctx, bson.M{},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var out []*Endpoint
+	for cur.Next(ctx) {
+		var doc mongoEndpoint
+		if err := cur.Decode(&doc); err != nil {
+			return nil, err
+		}
+		out = append(out, doc.endpoint())
+	}
+	return out, cur.Err()
+}
+
+func (s *MongoStore) UpdateEndpoint(ctx context.Context, e *Endpoint) error {
+	oid, err := primitive.ObjectIDFromHex(e.ID)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	res, err := s.endpoints.ReplaceOne(ctx, bson.M{"_id": oid}, mongoEndpoint{ID: oid, Endpoint: *e})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *MongoStore) DeleteEndpoint(ctx context.Context, id string) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	res, err := s.endpoints.DeleteOne(ctx, bson.M{"_id": oid})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	_, err = s.deliveries.DeleteMany(ctx, bson.M{"endpoint_id": id})
+	return err
+}
+
+func (s *MongoStore) AddDelivery(ctx context.Context, d *Delivery) error {
+	prepare(d)
+	res, err := s.deliveries.InsertOne(ctx, mongoDelivery{Delivery: *d})
+	if err != nil {
+		return err
+	}
+	d.ID = res.InsertedID.(primitive.ObjectID).Hex()
+	return nil
+}
+
+func (s *MongoStore) GetDelivery(ctx context.Context, id string) (*Delivery, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	var doc mongoDelivery
+	err = s.deliveries.FindOne(ctx, bson.M{"_id": oid}).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return doc.delivery(), nil
+}
+
+func (s *MongoStore) ListDeliveries(ctx context.Context, endpointID string) ([]*Delivery, error) {
+	cur, err := s.deliveries.Find(ctx, bson.M{"endpoint_id": endpointID},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var out []*Delivery
+	for cur.Next(ctx) {
+		var doc mongoDelivery
+		if err := cur.Decode(&doc); err != nil {
+			return nil, err
+		}
+		out = append(out, doc.delivery())
+	}
+	return out, cur.Err()
+}
+
+func (s *MongoStore) UpdateDelivery(ctx context.Context, d *Delivery) error {
+	oid, err := primitive.ObjectIDFromHex(d.ID)
+	if err != nil {
+		return ErrNotFound
+	}
+	d.UpdatedAt = time.Now()
+
+	res, err := s.deliveries.ReplaceOne(ctx, bson.M{"_id": oid}, mongoDelivery{ID: oid, Delivery: *d})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *MongoStore) Lease(ctx context.Context, now, until time.Time, limit int) ([]*Delivery, error) {
+	var out []*Delivery
+	for len(out) < limit {
+		// 逐条原子地推迟 next_attempt，其他进程不会取到同一条记录
+		var doc mongoDelivery
+		err := s.deliveries.FindOneAndUpdate(ctx,
+			bson.M{"status": StatusPending, "next_attempt": bson.M{"$lte": now}},
+			bson.M{"$set": bson.M{"next_attempt": until}},
+			options.FindOneAndUpdate().
+				SetSort(bson.D{{Key: "next_attempt", Value: 1}}).
+				SetReturnDocument(options.After),
+		).Decode(&doc)
+		if err == mongo.ErrNoDocuments {
+			break
+		}
+		if err != nil {
+			return out, err
+		}
+		out = append(out, doc.delivery())
+	}
+	return out, nil
+}
+
+func (s *MongoStore) Prune(ctx context.Context, before time.Time) (int, error) {
+	res, err := s.deliveries.DeleteMany(ctx, bson.M{
+		"status":     bson.M{"$ne": StatusPending},
+		"updated_at": bson.M{"$lt": before},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int(res.DeletedCount), nil
+}
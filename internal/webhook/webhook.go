@@ -0,0 +1,188 @@
+// Package webhook 将邮件事件以 HMAC-SHA256 签名的 JSON 推送到外部 HTTP 端点，
+// 投递记录持久化保存，失败时按退避时间重试
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 事件类型
+const (
+	EventMessageReceived  = "message.received"
+	EventMessageDelivered = "message.delivered"
+	EventMessageDeferred  = "message.deferred"
+	EventMessageBounced   = "message.bounced"
+	EventQuotaWarning     = "mailbox.quota_warning"
+	// EventRouteFailed 入站路由推送失败，邮件已转存到邮箱
+	EventRouteFailed = "message.route_failed"
+	// EventPing 测试端点时发送，不受事件过滤影响
+	EventPing = "ping"
+)
+
+// Events 端点可以订阅的全部事件类型
+var Events = []string{EventMessageReceived, EventMessageDelivered, EventMessageDeferred, EventMessageBounced, EventQuotaWarning, EventRouteFailed}
+
+// ErrNotFound 端点或投递记录不存在
+var ErrNotFound = errors.New("webhook: not found")
+
+// 签名相关的请求头
+const (
+	HeaderSignature = "X-YoPost-Signature"
+	HeaderEvent     = "X-YoPost-Event"
+	HeaderDelivery  = "X-YoPost-Delivery"
+)
+
+// Endpoint 接收事件的 HTTP 端点
+type Endpoint struct {
+	ID          string `bson:"-" json:"id"`
+	URL         string `bson:"url" json:"url"`
+	Description string `bson:"description,omitempty" json:"description,omitempty"`
+	// Secret 签名密钥，只在创建时返回给调用方
+	Secret string `bson:"secret" json:"-"`
+	// Events 订阅的事件类型，为空表示全部
+	Events    []string  `bson:"events" json:"events"`
+	Enabled   bool      `bson:"enabled" json:"enabled"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+}
+
+// Accepts 判断端点是否订阅了事件
+func (e *Endpoint) Accepts(event string) bool {
+	if event == EventPing || len(e.Events) == 0 {
+		return true
+	}
+	for _, ev := range e.Events {
+		if ev == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Status 投递状态
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+)
+
+// Delivery 一个事件到一个端点的投递记录，pending 状态的记录即重试队列
+type Delivery struct {
+	ID          string    `bson:"-" json:"id"`
+	EndpointID  string    `bson:"endpoint_id" json:"endpoint_id"`
+	EventID     string    `bson:"event_id" json:"event_id"`
+	Event       string    `bson:"event" json:"event"`
+	Payload     []byte    `bson:"payload" json:"-"`
+	Status      Status    `bson:"status" json:"status"`
+	Attempts    int       `bson:"attempts" json:"attempts"`
+	NextAttempt time.Time `bson:"next_attempt" json:"next_attempt"`
+	// ResponseCode 和 Response 为最后一次尝试的 HTTP 状态码和响应体开头部分
+	ResponseCode int       `bson:"response_code,omitempty" json:"response_code,omitempty"`
+	Response     string    `bson:"response,omitempty" json:"response,omitempty"`
+	LastError    string    `bson:"last_error,omitempty" json:"last_error,omitempty"`
+	CreatedAt    time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt    time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// Event 推送给端点的 JSON 请求体
+type Event struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// Store 端点与投递记录存储
+type Store interface {
+	CreateEndpoint(ctx context.Context, e *Endpoint) error
+	GetEndpoint(ctx context.Context, id string) (*Endpoint, error)
+	// ListEndpoints 按创建时间列出全部端点
+	ListEndpoints(ctx context.Context) ([]*Endpoint, error)
+	UpdateEndpoint(ctx context.Context, e *Endpoint) error
+	// DeleteEndpoint 删除端点及其投递记录
+	DeleteEndpoint(ctx context.Context, id string) error
+
+	// AddDelivery 保存新的投递记录并设置 ID、CreatedAt、UpdatedAt
+	AddDelivery(ctx context.Context, d *Delivery) error
+	GetDelivery(ctx context.Context, id string) (*Delivery, error)
+	// ListDeliveries 按创建时间从新到旧列出端点的投递记录
+	ListDeliveries(ctx context.Context, endpointID string) ([]*Delivery, error)
+	UpdateDelivery(ctx context.Context, d *Delivery) error
+	// Lease 取出最多 limit 条到期的 pending 记录，并将其 NextAttempt 推迟到 until
+	Lease(ctx context.Context, now, until time.Time, limit int) ([]*Delivery, error)
+	// Prune 删除 before 之前结束的投递记录，返回删除数量
+	Prune(ctx context.Context, before time.Time) (int, error)
+}
+
+// NewSecret 生成随机签名密钥
+func NewSecret() string {
+	return "whsec_" + randomHex(24)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func mac(secret string, timestamp int64, body []byte) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(h, "%d.", timestamp)
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Sign 生成 X-YoPost-Signature 头："t=<unix 时间>,v1=<hex(HMAC-SHA256(secret, "<t>.<body>"))>"
+func Sign(secret string, t time.Time, body []byte) string {
+	return fmt.Sprintf("t=%d,v1=%s", t.Unix(), mac(secret, t.Unix(), body))
+}
+
+// Verify 校验签名头，时间戳与 now 相差超过 tolerance 时视为重放
+func Verify(secret, header string, body []byte, now time.Time, tolerance time.Duration) error {
+	var timestamp int64
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch k {
+		case "t":
+			timestamp, _ = strconv.ParseInt(v, 10, 64)
+		case "v1":
+			signatures = append(signatures, v)
+		}
+	}
+	if timestamp == 0 || len(signatures) == 0 {
+		return errors.New("webhook: malformed signature header")
+	}
+	if d := now.Sub(time.Unix(timestamp, 0)); d > tolerance || d < -tolerance {
+		return errors.New("webhook: signature timestamp outside tolerance")
+	}
+	expected := mac(secret, timestamp, body)
+	for _, sig := range signatures {
+		if hmac.Equal([]byte(sig), []byte(expected)) {
+			return nil
+		}
+	}
+	return errors.New("webhook: signature mismatch")
+}
+
+// prepare 设置新投递记录的时间字段
+func prepare(d *Delivery) {
+	now := time.Now()
+	if d.CreatedAt.IsZero() {
+		d.CreatedAt = now
+	}
+	d.UpdatedAt = now
+	if d.NextAttempt.IsZero() {
+		d.NextAttempt = d.CreatedAt
+	}
+}
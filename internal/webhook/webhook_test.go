@@ -0,0 +1,41 @@
+package webhook
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	const secret = "whsec_test"
+	body := []byte(`{"event":"ping"}`)
+	now := time.Unix(1700000000, 0)
+	valid := Sign(secret, now, body)
+
+	tests := []struct {
+		name   string
+		secret string
+		header string
+		body   []byte
+		now    time.Time
+		ok     bool
+	}{
+		{"valid", secret, valid, body, now, true},
+		{"within tolerance", secret, valid, body, now.Add(4 * time.Minute), true},
+		{"one of several signatures", secret, "t=1700000000,v1=deadbeef," + valid[len("t=1700000000,"):], body, now, true},
+		{"wrong secret", "other", valid, body, now, false},
+		{"modified body", secret, valid, []byte(`{"event":"pong"}`), now, false},
+		{"replayed", secret, valid, body, now.Add(6 * time.Minute), false},
+		{"from the future", secret, valid, body, now.Add(-6 * time.Minute), false},
+		{"timestamp changed", secret, "t=1700000001," + valid[len("t=1700000000,"):], body, now, false},
+		{"missing signature", secret, "t=1700000000", body, now, false},
+		{"empty header", secret, "", body, now, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.secret, tt.header, tt.body, tt.now, 5*time.Minute)
+			if (err == nil) != tt.ok {
+				t.Errorf("Verify() error = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
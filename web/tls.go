@@ -60,10 +60,7 @@ func whichTLS(conn net.Conn) bool {
 
 	// 尝试CRL检查
 	log.Printf("DEBUG: Attempting CRL check for certificate")
-	crlList, err := certs[0].CRLDistributionPoints()
-	if err != nil {
-		log.Printf("ERROR: Failed to get CRL distribution points - %v", err)
-	}
+	crlList := certs[0].CRLDistributionPoints
 	if len(crlList) > 0 {
 		log.Printf("DEBUG: Found %d CRL distribution points", len(crlList))
 		// 在实际应用中这里应该实现CRL下载和验证逻辑